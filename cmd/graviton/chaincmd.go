@@ -69,6 +69,8 @@ It expects the genesis file as argument.`,
 			utils.GCModeFlag,
 			utils.CacheDatabaseFlag,
 			utils.CacheGCFlag,
+			utils.CacheRefcountFlag,
+			utils.CacheRetentionFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
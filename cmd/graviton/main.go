@@ -82,6 +82,13 @@ var (
 		utils.TxPoolAccountQueueFlag,
 		utils.TxPoolGlobalQueueFlag,
 		utils.TxPoolLifetimeFlag,
+		utils.TxPoolSnapshotFlag,
+		utils.TxPoolResnapshotFlag,
+		utils.TxPoolPrivateLifetimeFlag,
+		utils.TxPoolAdmissionFlag,
+		utils.TxPoolOrderingFlag,
+		utils.TxPoolAllowedFlag,
+		utils.TxPoolPrivilegedFlag,
 		utils.SyncModeFlag,
 		utils.GCModeFlag,
 		utils.LightServFlag,
@@ -92,6 +99,8 @@ var (
 		utils.CacheDatabaseFlag,
 		utils.CacheTrieFlag,
 		utils.CacheGCFlag,
+		utils.CacheRefcountFlag,
+		utils.CacheRetentionFlag,
 		utils.TrieCacheGenFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
@@ -148,9 +157,20 @@ var (
 		utils.WSPortFlag,
 		utils.WSApiFlag,
 		utils.WSAllowedOriginsFlag,
+		utils.WSPathPrefixFlag,
 		utils.IPCDisabledFlag,
 		utils.IPCPathFlag,
 		utils.RPCGlobalGasCap,
+		utils.RPCBatchLimitFlag,
+		utils.RPCResponseLimitFlag,
+		utils.RPCConcurrencyLimitFlag,
+		utils.RPCClientRateLimitFlag,
+		utils.RPCMethodRateLimitsFlag,
+		utils.RPCJWTSecretFlag,
+		utils.RPCJWTFreshnessFlag,
+		utils.RPCPathPrefixFlag,
+		utils.RPCMetricsPathFlag,
+		utils.RPCHealthPathFlag,
 	}
 
 	whisperFlags = []cli.Flag{
@@ -185,6 +205,8 @@ func init() {
 		copydbCommand,
 		removedbCommand,
 		dumpCommand,
+		// See snapshot.go:
+		snapshotCommand,
 		// See monitorcmd.go:
 		monitorCommand,
 		// See accountcmd.go:
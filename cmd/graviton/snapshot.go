@@ -0,0 +1,142 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of susy-graviton.
+//
+// susy-graviton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// susy-graviton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with susy-graviton. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"time"
+
+	"github.com/susy-go/susy-graviton/cmd/utils"
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/core/state/pruner"
+	"github.com/susy-go/susy-graviton/log"
+	"github.com/susy-go/susy-graviton/sofdb"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	bloomFilterSizeFlag = cli.Uint64Flag{
+		Name:  "bloomfilter.size",
+		Usage: "Megabytes of memory allocated to the bloom filter tracking the retained state",
+		Value: pruner.DefaultBloomSize / 1024 / 1024,
+	}
+	snapshotCommand = cli.Command{
+		Name:     "snapshot",
+		Usage:    "Maintain the state data of a stopped node",
+		Category: "BLOCKCHAIN COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:      "prune-state",
+				Usage:     "Delete the stale state data of a stopped node",
+				ArgsUsage: "[<root>...]",
+				Action:    utils.MigrateFlags(pruneState),
+				Category:  "BLOCKCHAIN COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+					utils.SyncModeFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					bloomFilterSizeFlag,
+				},
+				Description: `
+    graviton snapshot prune-state [<root>...]
+
+deletes all trie nodes and contract codes which are not reachable from the
+given state roots. Without arguments, the states of the recent blocks written
+to disk on shutdown are retained, the genesis state is always retained.
+
+The node must be stopped. Pruning first marks the retained state in a bloom
+filter, which is persisted once complete, and then deletes everything else.
+If the process is interrupted after marking, running the command again or
+starting the node finishes the pruning before the database is used.`,
+			},
+			{
+				Name:     "migrate-refcount",
+				Usage:    "Enable trie reference counting for the database of a stopped node",
+				Action:   utils.MigrateFlags(migrateRefcount),
+				Category: "BLOCKCHAIN COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+					utils.SyncModeFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+    graviton snapshot migrate-refcount
+
+counts the references to the trie nodes and contract codes of the states of
+the recent blocks and the genesis, and enables reference counting for the
+database. Afterwards, state data no retained state references any more is
+deleted while the node runs (see --cache.refcount and --cache.retention).
+
+Enabling --cache.refcount without migrating keeps all the state data written
+before forever. Data not reachable from the counted states is never deleted,
+but older states become incomplete once the counted ones are released, so the
+database should be pruned with 'graviton snapshot prune-state' first.
+If the migration is interrupted, it must be run again before the node starts.`,
+			},
+		},
+	}
+)
+
+// pruneState deletes the state data not reachable from the retained roots.
+func pruneState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	db, ok := chaindb.(*sofdb.LDBDatabase)
+	if !ok {
+		utils.Fatalf("State pruning requires a persistent database")
+	}
+	var roots []common.Hash
+	for _, arg := range ctx.Args() {
+		if !hashish(arg) || len(common.FromHex(arg)) != common.HashLength {
+			utils.Fatalf("Invalid state root: %s", arg)
+		}
+		roots = append(roots, common.HexToHash(arg))
+	}
+	start := time.Now()
+	p := pruner.NewPruner(db, stack.ResolvePath(pruner.BloomFileName), ctx.GlobalUint64(bloomFilterSizeFlag.Name)*1024*1024)
+	if err := p.Prune(roots); err != nil {
+		utils.Fatalf("State pruning failed: %v", err)
+	}
+	log.Info("State pruning completed", "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// migrateRefcount counts the references to the retained state data, enabling
+// trie reference counting for the database.
+func migrateRefcount(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	db, ok := chaindb.(*sofdb.LDBDatabase)
+	if !ok {
+		utils.Fatalf("Trie refcount migration requires a persistent database")
+	}
+	if err := pruner.MigrateRefcount(db); err != nil {
+		utils.Fatalf("Trie refcount migration failed: %v", err)
+	}
+	return nil
+}
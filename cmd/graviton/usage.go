@@ -127,6 +127,13 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.TxPoolAccountQueueFlag,
 			utils.TxPoolGlobalQueueFlag,
 			utils.TxPoolLifetimeFlag,
+			utils.TxPoolSnapshotFlag,
+			utils.TxPoolResnapshotFlag,
+			utils.TxPoolPrivateLifetimeFlag,
+			utils.TxPoolAdmissionFlag,
+			utils.TxPoolOrderingFlag,
+			utils.TxPoolAllowedFlag,
+			utils.TxPoolPrivilegedFlag,
 		},
 	},
 	{
@@ -136,6 +143,8 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.CacheDatabaseFlag,
 			utils.CacheTrieFlag,
 			utils.CacheGCFlag,
+			utils.CacheRefcountFlag,
+			utils.CacheRetentionFlag,
 			utils.TrieCacheGenFlag,
 		},
 	},
@@ -154,11 +163,22 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.RPCPortFlag,
 			utils.RPCApiFlag,
 			utils.RPCGlobalGasCap,
+			utils.RPCBatchLimitFlag,
+			utils.RPCResponseLimitFlag,
+			utils.RPCConcurrencyLimitFlag,
+			utils.RPCClientRateLimitFlag,
+			utils.RPCMethodRateLimitsFlag,
+			utils.RPCJWTSecretFlag,
+			utils.RPCJWTFreshnessFlag,
+			utils.RPCPathPrefixFlag,
+			utils.RPCMetricsPathFlag,
+			utils.RPCHealthPathFlag,
 			utils.WSEnabledFlag,
 			utils.WSListenAddrFlag,
 			utils.WSPortFlag,
 			utils.WSApiFlag,
 			utils.WSAllowedOriginsFlag,
+			utils.WSPathPrefixFlag,
 			utils.IPCDisabledFlag,
 			utils.IPCPathFlag,
 			utils.RPCCORSDomainFlag,
@@ -30,6 +30,7 @@ import (
 	"time"
 
 	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/consensus/clique"
 	"github.com/susy-go/susy-graviton/core"
 	"github.com/susy-go/susy-graviton/log"
 	"github.com/susy-go/susy-graviton/params"
@@ -103,6 +104,34 @@ func (w *wizard) makeGenesis() {
 			copy(genesis.ExtraData[32+i*common.AddressLength:], signer[:])
 		}
 
+		// Optionally govern the signers by an on-chain contract instead of header votes
+		fmt.Println()
+		fmt.Println("Should the signers be governed by an on-chain contract? (default = no)")
+		if w.readDefaultYesNo(false) {
+			fmt.Println()
+			fmt.Println("Which address should the governance contract live at? (default = 0x0000000000000000000000000000000000001000)")
+			contract := w.readDefaultAddress(common.HexToAddress("0x0000000000000000000000000000000000001000"))
+
+			weights := make([]uint64, len(signers))
+			for i, signer := range signers {
+				fmt.Println()
+				fmt.Printf("What is the voting weight of %s? (default = 1)\n", signer.Hex())
+				for {
+					if weight := w.readDefaultInt(1); weight > 0 {
+						weights[i] = uint64(weight)
+						break
+					}
+					log.Error("Voting weight must be positive")
+				}
+			}
+			genesis.Config.Clique.Governance = &contract
+			genesis.Alloc[contract] = core.GenesisAccount{
+				Balance: big.NewInt(1),
+				Code:    clique.GovernanceCode(),
+				Storage: clique.GovernanceStorage(signers, weights),
+			}
+		}
+
 	default:
 		log.Crit("Invalid consensus engine choice", "choice", choice)
 	}
@@ -17,6 +17,7 @@ package main
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -85,6 +86,34 @@ var (
 					},
 				},
 			},
+			{
+				Action:             accessGrant,
+				CustomHelpTemplate: helpTemplate,
+				Flags: []cli.Flag{
+					SwarmAccessGrantKeysFlag,
+					SwarmUploadFeedFlag,
+					SwarmDryRunFlag,
+					utils.PasswordFileFlag,
+				},
+				Name:        "grant",
+				Usage:       "grants a given list of public keys and passwords access to the content of an ACT protected root manifest",
+				ArgsUsage:   "<root-manifest>",
+				Description: "adds grantees to the ACT of a root access manifest created with 'swarm access new act' and prints the resulting root access manifest",
+			},
+			{
+				Action:             accessRevoke,
+				CustomHelpTemplate: helpTemplate,
+				Flags: []cli.Flag{
+					SwarmAccessRevokeKeysFlag,
+					SwarmUploadFeedFlag,
+					SwarmDryRunFlag,
+					utils.PasswordFileFlag,
+				},
+				Name:        "revoke",
+				Usage:       "revokes the access of a given list of public keys and passwords to the content of an ACT protected root manifest",
+				ArgsUsage:   "<root-manifest>",
+				Description: "removes grantees from the ACT of a root access manifest created with 'swarm access new act', re-encrypts the content with a new access key and prints the resulting root access manifest. The content is re-encrypted by the node at --bzzapi, which receives its decrypted reference and has to be a local node",
+			},
 		},
 	}
 )
@@ -123,7 +152,7 @@ func accessNewPass(ctx *cli.Context) {
 			utils.Fatalf("had an error printing the manifests: %v", err)
 		}
 	} else {
-		err = uploadManifests(ctx, m, nil)
+		_, err = uploadManifests(ctx, m, nil)
 		if err != nil {
 			utils.Fatalf("had an error uploading the manifests: %v", err)
 		}
@@ -159,7 +188,7 @@ func accessNewPK(ctx *cli.Context) {
 			utils.Fatalf("had an error printing the manifests: %v", err)
 		}
 	} else {
-		err = uploadManifests(ctx, m, nil)
+		_, err = uploadManifests(ctx, m, nil)
 		if err != nil {
 			utils.Fatalf("had an error uploading the manifests: %v", err)
 		}
@@ -223,13 +252,117 @@ func accessNewACT(ctx *cli.Context) {
 			utils.Fatalf("had an error printing the manifests: %v", err)
 		}
 	} else {
-		err = uploadManifests(ctx, m, actManifest)
+		_, err = uploadManifests(ctx, m, actManifest)
 		if err != nil {
 			utils.Fatalf("had an error uploading the manifests: %v", err)
 		}
 	}
 }
 
+func accessGrant(ctx *cli.Context) {
+	var (
+		pkGranteesFilename   = ctx.String(SwarmAccessGrantKeysFlag.Name)
+		passGranteesFilename = ctx.String(utils.PasswordFileFlag.Name)
+	)
+	if pkGranteesFilename == "" && passGranteesFilename == "" {
+		utils.Fatalf("you have to provide either a grantee public-keys file or an encryption passwords file (or both)")
+	}
+	accessUpdate(ctx, &api.ACTUpdate{
+		Grant:          readGrantees(pkGranteesFilename),
+		GrantPasswords: readGrantees(passGranteesFilename),
+	})
+}
+
+func accessRevoke(ctx *cli.Context) {
+	var (
+		pkGranteesFilename   = ctx.String(SwarmAccessRevokeKeysFlag.Name)
+		passGranteesFilename = ctx.String(utils.PasswordFileFlag.Name)
+	)
+	if pkGranteesFilename == "" && passGranteesFilename == "" {
+		utils.Fatalf("you have to provide either a grantee public-keys file or an encryption passwords file (or both)")
+	}
+	accessUpdate(ctx, &api.ACTUpdate{
+		Revoke:          readGrantees(pkGranteesFilename),
+		RevokePasswords: readGrantees(passGranteesFilename),
+	})
+}
+
+// accessUpdate applies the update to the ACT of the root access manifest
+// given as the argument with the account's private key as the publisher's
+// key, and uploads or prints the resulting manifests. Revoked grantees lose
+// access to the content, as it is re-encrypted by the node. The decrypted
+// reference of the content is sent to the node at --bzzapi for that, which
+// only re-encrypts on localhost, so the node has to be a local, trusted one.
+func accessUpdate(ctx *cli.Context, update *api.ACTUpdate) {
+	args := ctx.Args()
+	if len(args) != 1 {
+		utils.Fatalf("Expected 1 argument - the root access manifest")
+	}
+
+	var (
+		ref        = args[0]
+		privateKey = getPrivKey(ctx)
+		dryRun     = ctx.Bool(SwarmDryRunFlag.Name)
+		feedName   = ctx.String(SwarmUploadFeedFlag.Name)
+		bzzapi     = strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
+		client     = client.NewClient(bzzapi)
+	)
+	m, _, err := client.DownloadManifest(ref)
+	if err != nil {
+		utils.Fatalf("error downloading the root access manifest: %v", err)
+	}
+	if len(m.Entries) != 1 || m.Entries[0].Access == nil || m.Entries[0].Access.Type != api.AccessTypeACT {
+		utils.Fatalf("%s is not an ACT protected root access manifest", ref)
+	}
+	list, err := client.List(m.Entries[0].Access.Act, "", "")
+	if err != nil {
+		utils.Fatalf("error listing the ACT manifest: %v", err)
+	}
+	actManifest := &api.Manifest{}
+	for _, e := range list.Entries {
+		actManifest.Entries = append(actManifest.Entries, *e)
+	}
+
+	m, actManifest, err = api.DoACTUpdate(privateKey, m, actManifest, update, func(ref []byte) ([]byte, error) {
+		hash, err := client.Reencrypt(hex.EncodeToString(ref))
+		if err != nil {
+			return nil, err
+		}
+		return hex.DecodeString(hash)
+	})
+	if err != nil {
+		utils.Fatalf("error updating the ACT manifest: %v", err)
+	}
+
+	if dryRun {
+		err = printManifests(m, actManifest)
+		if err != nil {
+			utils.Fatalf("had an error printing the manifests: %v", err)
+		}
+		return
+	}
+	hash, err := uploadManifests(ctx, m, actManifest)
+	if err != nil {
+		utils.Fatalf("had an error uploading the manifests: %v", err)
+	}
+	if feedName != "" {
+		fmt.Println(publishToFeed(ctx, client, feedName, hash))
+	}
+}
+
+// readGrantees reads the grantees from the file with the given name, one
+// per line
+func readGrantees(filename string) []string {
+	if filename == "" {
+		return nil
+	}
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		utils.Fatalf("had an error reading the grantees file: %v", err)
+	}
+	return strings.Split(strings.Trim(string(bytes), "\n"), "\n")
+}
+
 func printManifests(rootAccessManifest, actManifest *api.Manifest) error {
 	js, err := json.Marshal(rootAccessManifest)
 	if err != nil {
@@ -247,7 +380,7 @@ func printManifests(rootAccessManifest, actManifest *api.Manifest) error {
 	return nil
 }
 
-func uploadManifests(ctx *cli.Context, rootAccessManifest, actManifest *api.Manifest) error {
+func uploadManifests(ctx *cli.Context, rootAccessManifest, actManifest *api.Manifest) (string, error) {
 	bzzapi := strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
 	client := client.NewClient(bzzapi)
 
@@ -258,17 +391,17 @@ func uploadManifests(ctx *cli.Context, rootAccessManifest, actManifest *api.Mani
 	if actManifest != nil {
 		key, err = client.UploadManifest(actManifest, false)
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		rootAccessManifest.Entries[0].Access.Act = key
 	}
 	key, err = client.UploadManifest(rootAccessManifest, false)
 	if err != nil {
-		return err
+		return "", err
 	}
 	fmt.Println(key)
-	return nil
+	return key, nil
 }
 
 // makePasswordList reads password lines from the file specified by the global --password flag
@@ -83,6 +83,10 @@ const (
 	SWARM_ACCESS_PASSWORD             = "SWARM_ACCESS_PASSWORD"
 	SWARM_AUTO_DEFAULTPATH            = "SWARM_AUTO_DEFAULTPATH"
 	SWARM_GLOBALSTORE_API             = "SWARM_GLOBALSTORE_API"
+	SWARM_ENV_GATEWAY_MODE            = "SWARM_GATEWAY_MODE"
+	SWARM_ENV_GATEWAY_AUTH_TOKENS     = "SWARM_GATEWAY_AUTH_TOKENS"
+	SWARM_ENV_GATEWAY_QUOTA           = "SWARM_GATEWAY_QUOTA"
+	SWARM_ENV_GATEWAY_QUOTA_PERIOD    = "SWARM_GATEWAY_QUOTA_PERIOD"
 	GRAVITON_ENV_DATADIR                  = "GRAVITON_DATADIR"
 )
 
@@ -267,6 +271,22 @@ func cmdLineOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Con
 		currentConfig.GlobalStoreAPI = ctx.GlobalString(SwarmGlobalStoreAPIFlag.Name)
 	}
 
+	if ctx.GlobalIsSet(SwarmGatewayModeFlag.Name) {
+		currentConfig.GatewayMode = ctx.GlobalBool(SwarmGatewayModeFlag.Name)
+	}
+
+	if tokens := ctx.GlobalString(SwarmGatewayAuthTokensFlag.Name); tokens != "" {
+		currentConfig.GatewayAuthTokens = strings.Split(tokens, ",")
+	}
+
+	if ctx.GlobalIsSet(SwarmGatewayQuotaFlag.Name) {
+		currentConfig.GatewayQuota = ctx.GlobalUint64(SwarmGatewayQuotaFlag.Name)
+	}
+
+	if ctx.GlobalIsSet(SwarmGatewayQuotaPeriodFlag.Name) {
+		currentConfig.GatewayQuotaPeriod = ctx.GlobalDuration(SwarmGatewayQuotaPeriodFlag.Name)
+	}
+
 	return currentConfig
 
 }
@@ -384,6 +404,34 @@ func envVarsOverride(currentConfig *bzzapi.Config) (config *bzzapi.Config) {
 		currentConfig.GlobalStoreAPI = api
 	}
 
+	if gm := os.Getenv(SWARM_ENV_GATEWAY_MODE); gm != "" {
+		gatewayMode, err := strconv.ParseBool(gm)
+		if err != nil {
+			utils.Fatalf("invalid environment variable %s: %v", SWARM_ENV_GATEWAY_MODE, err)
+		}
+		currentConfig.GatewayMode = gatewayMode
+	}
+
+	if tokens := os.Getenv(SWARM_ENV_GATEWAY_AUTH_TOKENS); tokens != "" {
+		currentConfig.GatewayAuthTokens = strings.Split(tokens, ",")
+	}
+
+	if q := os.Getenv(SWARM_ENV_GATEWAY_QUOTA); q != "" {
+		quota, err := strconv.ParseUint(q, 10, 64)
+		if err != nil {
+			utils.Fatalf("invalid environment variable %s: %v", SWARM_ENV_GATEWAY_QUOTA, err)
+		}
+		currentConfig.GatewayQuota = quota
+	}
+
+	if qp := os.Getenv(SWARM_ENV_GATEWAY_QUOTA_PERIOD); qp != "" {
+		period, err := time.ParseDuration(qp)
+		if err != nil {
+			utils.Fatalf("invalid environment variable %s: %v", SWARM_ENV_GATEWAY_QUOTA_PERIOD, err)
+		}
+		currentConfig.GatewayQuotaPeriod = period
+	}
+
 	return currentConfig
 }
 
@@ -111,6 +111,10 @@ var (
 		Name:  "grant-keys",
 		Usage: "grants a given list of public keys in the following file (separated by line breaks) access to an ACT",
 	}
+	SwarmAccessRevokeKeysFlag = cli.StringFlag{
+		Name:  "revoke-keys",
+		Usage: "revokes the access of a given list of public keys in the following file (separated by line breaks) to an ACT",
+	}
 	SwarmUpFromStdinFlag = cli.BoolFlag{
 		Name:  "stdin",
 		Usage: "reads data to be uploaded from stdin",
@@ -123,6 +127,30 @@ var (
 		Name:  "encrypt",
 		Usage: "use encrypted upload",
 	}
+	SwarmProgressFlag = cli.BoolFlag{
+		Name:  "progress",
+		Usage: "show the progress of the upload until its chunks are synced",
+	}
+	SwarmRedundancyFlag = cli.UintFlag{
+		Name:  "redundancy",
+		Usage: "level of erasure coding of the upload from 0 (none) to 4 (paranoid), adding parity chunks to recover lost chunks",
+	}
+	SwarmUploadFeedFlag = cli.StringFlag{
+		Name:  "feed",
+		Usage: "publish the hash of the uploaded manifest as an update of the feed with this name, or hex encoded topic if prefixed with 0x",
+	}
+	SwarmListTimeFlag = cli.Uint64Flag{
+		Name:  "time",
+		Usage: "list the version of a feed manifest's content at this unix time",
+	}
+	SwarmListDiffFlag = cli.StringFlag{
+		Name:  "diff",
+		Usage: "list the differences to this manifest, or to another version of the same feed manifest if empty and --diff-time is given",
+	}
+	SwarmListDiffTimeFlag = cli.Uint64Flag{
+		Name:  "diff-time",
+		Usage: "unix time of the version of the feed manifest to list the differences to",
+	}
 	SwarmAccessPasswordFlag = cli.StringFlag{
 		Name:   "password",
 		Usage:  "Password",
@@ -181,4 +209,20 @@ var (
 		Usage:  "URL of the Global Store API provider (only for testing)",
 		EnvVar: SWARM_GLOBALSTORE_API,
 	}
+	SwarmGatewayModeFlag = cli.BoolFlag{
+		Name:  "gateway",
+		Usage: "Run the HTTP server as a public gateway, which is read-only for clients without an auth token",
+	}
+	SwarmGatewayAuthTokensFlag = cli.StringFlag{
+		Name:  "gateway.auth-tokens",
+		Usage: "Bearer tokens of the clients allowed to write to the gateway (multiple tokens can be supplied separated by a ',')",
+	}
+	SwarmGatewayQuotaFlag = cli.Uint64Flag{
+		Name:  "gateway.quota",
+		Usage: "Number of bytes the gateway serves to an IP address in a quota period, 0 is unlimited",
+	}
+	SwarmGatewayQuotaPeriodFlag = cli.DurationFlag{
+		Name:  "gateway.quota-period",
+		Usage: "Period of the gateway bandwidth quota (default 1h)",
+	}
 )
@@ -23,6 +23,7 @@ import (
 	"text/tabwriter"
 
 	"github.com/susy-go/susy-graviton/cmd/utils"
+	"github.com/susy-go/susy-graviton/swarm/api"
 	swarm "github.com/susy-go/susy-graviton/swarm/api/client"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -33,7 +34,8 @@ var listCommand = cli.Command{
 	Name:               "ls",
 	Usage:              "list files and directories contained in a manifest",
 	ArgsUsage:          "<manifest> [<prefix>]",
-	Description:        "Lists files and directories contained in a manifest",
+	Flags:              []cli.Flag{SwarmListTimeFlag, SwarmListDiffFlag, SwarmListDiffTimeFlag},
+	Description:        "Lists files and directories contained in a manifest. Feed manifests are listed at the version given by --time. With --diff or --diff-time the files added, removed and modified since the given manifest or version are listed instead",
 }
 
 func list(ctx *cli.Context) {
@@ -53,7 +55,13 @@ func list(ctx *cli.Context) {
 
 	bzzapi := strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
 	client := swarm.NewClient(bzzapi)
-	list, err := client.List(manifest, prefix, "")
+
+	if ctx.IsSet(SwarmListDiffFlag.Name) || ctx.IsSet(SwarmListDiffTimeFlag.Name) {
+		listDiff(ctx, client, manifest, prefix)
+		return
+	}
+
+	list, err := client.ListVersion(manifest, prefix, "", ctx.Uint64(SwarmListTimeFlag.Name))
 	if err != nil {
 		utils.Fatalf("Failed to generate file and directory list: %s", err)
 	}
@@ -68,3 +76,32 @@ func list(ctx *cli.Context) {
 		fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Hash, entry.ContentType, entry.Path)
 	}
 }
+
+// listDiff lists the entries which differ between the manifest given by the
+// diff flags and the manifest
+func listDiff(ctx *cli.Context, client *swarm.Client, manifest, prefix string) {
+	from := ctx.String(SwarmListDiffFlag.Name)
+	if from == "" {
+		from = manifest
+	}
+	diff, err := client.Diff(from, manifest, prefix, ctx.Uint64(SwarmListDiffTimeFlag.Name), ctx.Uint64(SwarmListTimeFlag.Name))
+	if err != nil {
+		utils.Fatalf("Failed to generate manifest diff: %s", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "CHANGE\tHASH\tCONTENT TYPE\tPATH")
+	for _, c := range []struct {
+		change  string
+		entries []api.ManifestEntry
+	}{
+		{"A", diff.Added},
+		{"D", diff.Removed},
+		{"M", diff.Modified},
+	} {
+		for _, entry := range c.entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.change, entry.Hash, entry.ContentType, entry.Path)
+		}
+	}
+}
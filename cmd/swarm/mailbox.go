@@ -0,0 +1,161 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of susy-graviton.
+//
+// susy-graviton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// susy-graviton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with susy-graviton. If not, see <http://www.gnu.org/licenses/>.
+
+// Command mailbox sends and fetches the pss messages stored in swarm for
+// offline recipients
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/susy-go/susy-graviton/cmd/utils"
+	"github.com/susy-go/susy-graviton/common/hexutil"
+	"github.com/susy-go/susy-graviton/swarm/pss/mailbox"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var mailboxCommand = cli.Command{
+	Name:               "mailbox",
+	CustomHelpTemplate: helpTemplate,
+	Usage:              "send and fetch messages for offline pss recipients",
+	ArgsUsage:          "COMMAND",
+	Description:        "Sends messages to the mailboxes of pss recipients stored in swarm, and fetches and acknowledges the messages of senders once the node is online. Peers are identified by their pss public keys. This assumes you already have a Swarm node running locally. You must reference the correct path to your bzzd.ipc file",
+	Subcommands: []cli.Command{
+		{
+			Action:             mailboxKey,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "key",
+			Usage:              "print the public key of the node",
+			Description:        "Prints the pss public key of the node, which senders need to send messages to its mailbox",
+		},
+		{
+			Action:             mailboxSend,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "send",
+			Usage:              "send a message to the mailbox of a recipient",
+			ArgsUsage:          "<public key> <message>",
+			Description:        "Stores the message in the mailbox of the recipient with the public key and prints its sequence number",
+		},
+		{
+			Action:             mailboxFetch,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "fetch",
+			Usage:              "fetch the messages of a sender",
+			ArgsUsage:          "<public key>",
+			Description:        "Fetches the messages in the mailbox of the sender with the public key which were not acknowledged yet, at most the latest 256",
+		},
+		{
+			Action:             mailboxAck,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "ack",
+			Usage:              "acknowledge the messages of a sender",
+			ArgsUsage:          "<public key> <seq>",
+			Description:        "Acknowledges the messages in the mailbox of the sender with the public key up to the sequence number, so that they are not fetched again",
+		},
+	},
+}
+
+func mailboxKey(ctx *cli.Context) {
+	client, err := dialRPC(ctx)
+	if err != nil {
+		utils.Fatalf("had an error dailing to RPC endpoint: %v", err)
+	}
+	defer client.Close()
+
+	rctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var pubkey hexutil.Bytes
+	if err := client.CallContext(rctx, &pubkey, "pss_getPublicKey"); err != nil {
+		utils.Fatalf("Failed to get public key: %v", err)
+	}
+	fmt.Println(pubkey)
+}
+
+func mailboxSend(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 2 {
+		utils.Fatalf("Need exactly two arguments <public key> <message>")
+	}
+	client, err := dialRPC(ctx)
+	if err != nil {
+		utils.Fatalf("had an error dailing to RPC endpoint: %v", err)
+	}
+	defer client.Close()
+
+	rctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var seq uint64
+	if err := client.CallContext(rctx, &seq, "pss_mailboxSend", args[0], hexutil.Bytes(args[1])); err != nil {
+		utils.Fatalf("Failed to send message: %v", err)
+	}
+	fmt.Println(seq)
+}
+
+func mailboxFetch(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 1 {
+		utils.Fatalf("Need exactly one argument <public key>")
+	}
+	client, err := dialRPC(ctx)
+	if err != nil {
+		utils.Fatalf("had an error dailing to RPC endpoint: %v", err)
+	}
+	defer client.Close()
+
+	rctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var msgs []*mailbox.Message
+	if err := client.CallContext(rctx, &msgs, "pss_mailboxFetch", args[0]); err != nil {
+		utils.Fatalf("Failed to fetch messages: %v", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "SEQ\tTIME\tMESSAGE")
+	for _, msg := range msgs {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", msg.Seq, time.Unix(int64(msg.Time), 0).Format(time.RFC3339), string(msg.Payload))
+	}
+}
+
+func mailboxAck(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 2 {
+		utils.Fatalf("Need exactly two arguments <public key> <seq>")
+	}
+	seq, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		utils.Fatalf("Invalid sequence number %q: %v", args[1], err)
+	}
+	client, err := dialRPC(ctx)
+	if err != nil {
+		utils.Fatalf("had an error dailing to RPC endpoint: %v", err)
+	}
+	defer client.Close()
+
+	rctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := client.CallContext(rctx, nil, "pss_mailboxAck", args[0], seq); err != nil {
+		utils.Fatalf("Failed to acknowledge messages: %v", err)
+	}
+}
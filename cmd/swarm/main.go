@@ -139,8 +139,14 @@ func init() {
 		downloadCommand,
 		// See manifest.go
 		manifestCommand,
+		// See pin.go
+		pinCommand,
 		// See fs.go
 		fsCommand,
+		// See swap.go
+		swapCommand,
+		// See mailbox.go
+		mailboxCommand,
 		// See db.go
 		dbCommand,
 		// See config.go
@@ -195,6 +201,11 @@ func init() {
 		SwarmUploadMimeType,
 		// bootnode mode
 		SwarmBootnodeModeFlag,
+		// gateway mode
+		SwarmGatewayModeFlag,
+		SwarmGatewayAuthTokensFlag,
+		SwarmGatewayQuotaFlag,
+		SwarmGatewayQuotaPeriodFlag,
 		// storage flags
 		SwarmStorePath,
 		SwarmStoreCapacity,
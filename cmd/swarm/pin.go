@@ -0,0 +1,102 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of susy-graviton.
+//
+// susy-graviton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// susy-graviton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with susy-graviton. If not, see <http://www.gnu.org/licenses/>.
+
+// Command pin protects content from garbage collection
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/susy-go/susy-graviton/cmd/utils"
+	swarm "github.com/susy-go/susy-graviton/swarm/api/client"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var pinCommand = cli.Command{
+	Name:               "pin",
+	CustomHelpTemplate: helpTemplate,
+	Usage:              "pin content in the local store",
+	ArgsUsage:          "COMMAND",
+	Description:        "Protects content and everything it references from garbage collection in the local store.\nCOMMAND could be: add, rm, ls",
+	Subcommands: []cli.Command{
+		{
+			Action:             pinAdd,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "add",
+			Usage:              "pin a file, manifest or feed manifest",
+			ArgsUsage:          "<hash>",
+			Description:        "Pins the content under the hash, recursively following manifests and feeds",
+		},
+		{
+			Action:             pinRemove,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "rm",
+			Usage:              "release a pin",
+			ArgsUsage:          "<hash>",
+			Description:        "Releases a pin of the content under the hash, content pinned several times has to be released as many times",
+		},
+		{
+			Action:             pinList,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "ls",
+			Usage:              "list the pinned content",
+			Description:        "Lists the pinned hashes with the number of pins and chunks",
+		},
+	},
+}
+
+func pinAdd(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 1 {
+		utils.Fatalf("Need exactly one argument <hash>")
+	}
+	bzzapi := strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
+	client := swarm.NewClient(bzzapi)
+	if err := client.Pin(args[0]); err != nil {
+		utils.Fatalf("Failed to pin %s: %v", args[0], err)
+	}
+}
+
+func pinRemove(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 1 {
+		utils.Fatalf("Need exactly one argument <hash>")
+	}
+	bzzapi := strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
+	client := swarm.NewClient(bzzapi)
+	if err := client.Unpin(args[0]); err != nil {
+		utils.Fatalf("Failed to unpin %s: %v", args[0], err)
+	}
+}
+
+func pinList(ctx *cli.Context) {
+	bzzapi := strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
+	client := swarm.NewClient(bzzapi)
+	pins, err := client.Pins()
+	if err != nil {
+		utils.Fatalf("Failed to list pins: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "HASH\tPINS\tCHUNKS")
+	for _, pin := range pins {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", pin.Address, pin.Counter, pin.Chunks)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of susy-graviton.
+//
+// susy-graviton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// susy-graviton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with susy-graviton. If not, see <http://www.gnu.org/licenses/>.
+
+// Command swap inspects the SWAP balances and cheques of a running node
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/susy-go/susy-graviton/cmd/utils"
+	"github.com/susy-go/susy-graviton/contracts/chequebook"
+	"github.com/susy-go/susy-graviton/p2p/enode"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var swapCommand = cli.Command{
+	Name:               "swap",
+	CustomHelpTemplate: helpTemplate,
+	Usage:              "inspect SWAP balances and cheques",
+	ArgsUsage:          "COMMAND",
+	Description:        "Inspects the SWAP balances with peers and the cheques settling them, and cashes received cheques. This assumes you already have a Swarm node running locally with SWAP enabled. You must reference the correct path to your bzzd.ipc file",
+	Subcommands: []cli.Command{
+		{
+			Action:             swapBalances,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "balances",
+			Usage:              "list the balances with peers",
+			Description:        "Lists the balances with the peers accounted for since the node started, positive balances are owed by the peer",
+		},
+		{
+			Action:             swapCheques,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "cheques",
+			Usage:              "show the last cheques exchanged with a peer",
+			ArgsUsage:          "<peer id>",
+			Description:        "Shows the last cheque sent to and the last cheque received from the peer",
+		},
+		{
+			Action:             swapCash,
+			CustomHelpTemplate: helpTemplate,
+			Name:               "cash",
+			Usage:              "cash the last cheque received from a peer",
+			ArgsUsage:          "<peer id>",
+			Description:        "Cashes the last cheque received from a connected peer and prints the transaction hash",
+		},
+	},
+}
+
+func swapBalances(ctx *cli.Context) {
+	client, err := dialRPC(ctx)
+	if err != nil {
+		utils.Fatalf("had an error dailing to RPC endpoint: %v", err)
+	}
+	defer client.Close()
+
+	rctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var balances map[enode.ID]int64
+	if err := client.CallContext(rctx, &balances, "swap_balances"); err != nil {
+		utils.Fatalf("Failed to get balances: %v", err)
+	}
+	ids := make([]enode.ID, 0, len(balances))
+	for id := range balances {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+	w := tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "PEER\tBALANCE")
+	for _, id := range ids {
+		fmt.Fprintf(w, "%s\t%d\n", id, balances[id])
+	}
+}
+
+func swapCheques(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 1 {
+		utils.Fatalf("Need exactly one argument <peer id>")
+	}
+	client, err := dialRPC(ctx)
+	if err != nil {
+		utils.Fatalf("had an error dailing to RPC endpoint: %v", err)
+	}
+	defer client.Close()
+
+	rctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, c := range []struct{ label, method string }{
+		{"sent", "swap_sentCheque"},
+		{"received", "swap_receivedCheque"},
+	} {
+		var cheque *chequebook.Cheque
+		if err := client.CallContext(rctx, &cheque, c.method, args[0]); err != nil {
+			fmt.Printf("%s: none (%v)\n", c.label, err)
+			continue
+		}
+		fmt.Printf("%s: %v\n", c.label, cheque)
+	}
+}
+
+func swapCash(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 1 {
+		utils.Fatalf("Need exactly one argument <peer id>")
+	}
+	client, err := dialRPC(ctx)
+	if err != nil {
+		utils.Fatalf("had an error dailing to RPC endpoint: %v", err)
+	}
+	defer client.Close()
+
+	rctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var txhash string
+	if err := client.CallContext(rctx, &txhash, "swap_cash", args[0]); err != nil {
+		utils.Fatalf("Failed to cash cheque: %v", err)
+	}
+	fmt.Println(txhash)
+}
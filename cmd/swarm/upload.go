@@ -28,9 +28,13 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/susy-go/susy-graviton/common/hexutil"
 	"github.com/susy-go/susy-graviton/log"
 	swarm "github.com/susy-go/susy-graviton/swarm/api/client"
+	"github.com/susy-go/susy-graviton/swarm/chunk"
+	"github.com/susy-go/susy-graviton/swarm/storage/feed"
 
 	"github.com/susy-go/susy-graviton/cmd/utils"
 	"gopkg.in/urfave/cli.v1"
@@ -42,10 +46,14 @@ var upCommand = cli.Command{
 	Name:               "up",
 	Usage:              "uploads a file or directory to swarm using the HTTP API",
 	ArgsUsage:          "<file>",
-	Flags:              []cli.Flag{SwarmEncryptedFlag},
-	Description:        "uploads a file or directory to swarm using the HTTP API and prints the root hash",
+	Flags:              []cli.Flag{SwarmEncryptedFlag, SwarmProgressFlag, SwarmRedundancyFlag, SwarmUploadFeedFlag},
+	Description:        "uploads a file or directory to swarm using the HTTP API and prints the root hash. With --feed the hash of the manifest is published as an update of the feed and the address of the feed manifest is printed on a second line",
 }
 
+// progressStallTimeout is the time the progress of an upload is shown
+// without any of its chunks getting synced before giving up on waiting
+const progressStallTimeout = 30 * time.Second
+
 func upload(ctx *cli.Context) {
 	args := ctx.Args()
 	var (
@@ -57,6 +65,8 @@ func upload(ctx *cli.Context) {
 		mimeType        = ctx.GlobalString(SwarmUploadMimeType.Name)
 		client          = swarm.NewClient(bzzapi)
 		toEncrypt       = ctx.Bool(SwarmEncryptedFlag.Name)
+		showProgress    = ctx.Bool(SwarmProgressFlag.Name)
+		feedName        = ctx.String(SwarmUploadFeedFlag.Name)
 		autoDefaultPath = false
 		file            string
 	)
@@ -88,18 +98,13 @@ func upload(ctx *cli.Context) {
 		file = expandPath(args[0])
 	}
 
-	if !wantManifest {
-		f, err := swarm.Open(file)
-		if err != nil {
-			utils.Fatalf("Error opening file: %s", err)
-		}
-		defer f.Close()
-		hash, err := client.UploadRaw(f, f.Size, toEncrypt)
-		if err != nil {
-			utils.Fatalf("Upload failed: %s", err)
-		}
-		fmt.Println(hash)
-		return
+	redundancy := ctx.Uint(SwarmRedundancyFlag.Name)
+	if redundancy > 4 {
+		utils.Fatalf("Invalid redundancy level %d, the maximum is 4", redundancy)
+	}
+	client.Redundancy = uint8(redundancy)
+	if feedName != "" && (!wantManifest || toEncrypt) {
+		utils.Fatalf("Only unencrypted manifests can be published to a feed")
 	}
 
 	stat, err := os.Stat(file)
@@ -107,10 +112,19 @@ func upload(ctx *cli.Context) {
 		utils.Fatalf("Error opening file: %s", err)
 	}
 
-	// define a function which either uploads a directory or single file
-	// based on the type of the file being uploaded
+	// define a function which either uploads raw data, a directory or single
+	// file based on the type of the file being uploaded
 	var doUpload func() (hash string, err error)
-	if stat.IsDir() {
+	if !wantManifest {
+		doUpload = func() (string, error) {
+			f, err := swarm.Open(file)
+			if err != nil {
+				return "", fmt.Errorf("error opening file: %s", err)
+			}
+			defer f.Close()
+			return client.UploadRaw(f, f.Size, toEncrypt)
+		}
+	} else if stat.IsDir() {
 		doUpload = func() (string, error) {
 			if !recursive {
 				return "", errors.New("Argument is a directory and recursive upload is disabled")
@@ -150,11 +164,124 @@ func upload(ctx *cli.Context) {
 			return client.Upload(f, "", toEncrypt)
 		}
 	}
-	hash, err := doUpload()
-	if err != nil {
-		utils.Fatalf("Upload failed: %s", err)
+	var hash string
+	if !showProgress {
+		hash, err = doUpload()
+		if err != nil {
+			utils.Fatalf("Upload failed: %s", err)
+		}
+	} else {
+		tag, err := client.CreateTag(filepath.Base(file))
+		if err != nil {
+			utils.Fatalf("Error creating upload tag: %s", err)
+		}
+		client.UploadTag = tag.Uid
+
+		uploaded := make(chan struct{})
+		progressErr := make(chan error, 1)
+		go func() {
+			progressErr <- printProgress(client, tag.Uid, uploaded)
+		}()
+		hash, err = doUpload()
+		if err != nil {
+			utils.Fatalf("Upload failed: %s", err)
+		}
+		close(uploaded)
+		if err := <-progressErr; err != nil {
+			log.Warn("Upload not synced", "tag", tag.Uid, "err", err)
+		}
 	}
 	fmt.Println(hash)
+
+	if feedName != "" {
+		fmt.Println(publishToFeed(ctx, client, feedName, hash))
+	}
+}
+
+// publishToFeed publishes the manifest hash as an update of the feed of the
+// account with the topic given by name, creating the feed if needed, and
+// returns the address of the feed manifest
+func publishToFeed(ctx *cli.Context, client *swarm.Client, name, hash string) string {
+	var (
+		topic feed.Topic
+		err   error
+	)
+	if strings.HasPrefix(name, "0x") {
+		var topicBytes []byte
+		if topicBytes, err = hexutil.Decode(name); err == nil {
+			topic, err = feed.NewTopic("", topicBytes)
+		}
+	} else {
+		topic, err = feed.NewTopic(name, nil)
+	}
+	if err != nil {
+		utils.Fatalf("Error parsing feed topic: %s", err)
+	}
+	data, err := hexutil.Decode("0x" + hash)
+	if err != nil {
+		utils.Fatalf("Error parsing manifest hash: %s", err)
+	}
+
+	signer := NewGenericSigner(ctx)
+	query := new(feed.Query)
+	query.User = signer.Address()
+	query.Topic = topic
+	request, err := client.GetFeedRequest(query, "")
+	if err != nil {
+		utils.Fatalf("Error retrieving feed status: %s", err)
+	}
+	request.SetData(data)
+	if err := request.Sign(signer); err != nil {
+		utils.Fatalf("Error signing feed update: %s", err)
+	}
+	// the feed manifest only depends on the feed, so it is the same for
+	// every update
+	manifestAddress, err := client.CreateFeedWithManifest(request)
+	if err != nil {
+		utils.Fatalf("Error updating feed: %s", err)
+	}
+	return manifestAddress
+}
+
+// printProgress prints the chunk counts of the upload tag with the uid to
+// stderr every second. Once the uploaded channel is closed it returns when
+// all chunks of the upload are synced, or with an error if none of them gets
+// synced for progressStallTimeout.
+func printProgress(client *swarm.Client, uid uint32, uploaded chan struct{}) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	defer fmt.Fprintln(os.Stderr)
+
+	var (
+		done       bool
+		lastSynced int64
+		lastChange time.Time
+	)
+	for {
+		select {
+		case <-uploaded:
+			done, uploaded = true, nil
+			lastChange = time.Now()
+		case <-ticker.C:
+		}
+		tag, err := client.GetTag(uid)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "\rsplit: %d stored: %d sent: %d synced: %d total: %d",
+			tag.Get(chunk.StateSplit), tag.Get(chunk.StateStored), tag.Get(chunk.StateSent), tag.Get(chunk.StateSynced), tag.Total())
+		if !done {
+			continue
+		}
+		if tag.Done(chunk.StateSynced) {
+			return nil
+		}
+		if synced := tag.Get(chunk.StateSynced); synced != lastSynced {
+			lastSynced, lastChange = synced, time.Now()
+		} else if time.Since(lastChange) > progressStallTimeout {
+			return errors.New("syncing stalled")
+		}
+	}
 }
 
 // Expands a file path
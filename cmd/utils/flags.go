@@ -33,6 +33,7 @@ import (
 	"github.com/susy-go/susy-graviton/common"
 	"github.com/susy-go/susy-graviton/common/fdlimit"
 	"github.com/susy-go/susy-graviton/consensus"
+	"github.com/susy-go/susy-graviton/consensus/bft"
 	"github.com/susy-go/susy-graviton/consensus/clique"
 	"github.com/susy-go/susy-graviton/consensus/sofash"
 	"github.com/susy-go/susy-graviton/core"
@@ -56,6 +57,7 @@ import (
 	"github.com/susy-go/susy-graviton/p2p/nat"
 	"github.com/susy-go/susy-graviton/p2p/netutil"
 	"github.com/susy-go/susy-graviton/params"
+	"github.com/susy-go/susy-graviton/rpc"
 	whisper "github.com/susy-go/susy-graviton/whisper/whisperv6"
 	cli "gopkg.in/urfave/cli.v1"
 )
@@ -298,6 +300,38 @@ var (
 		Usage: "Maximum amount of time non-executable transaction are queued",
 		Value: sof.DefaultConfig.TxPool.Lifetime,
 	}
+	TxPoolSnapshotFlag = cli.StringFlag{
+		Name:  "txpool.snapshot",
+		Usage: "Disk snapshot of all pooled transactions to survive node restarts (empty = disabled)",
+	}
+	TxPoolResnapshotFlag = cli.DurationFlag{
+		Name:  "txpool.resnapshot",
+		Usage: "Time interval to regenerate the transaction pool snapshot",
+		Value: core.DefaultTxPoolConfig.Resnapshot,
+	}
+	TxPoolPrivateLifetimeFlag = cli.Uint64Flag{
+		Name:  "txpool.privatelifetime",
+		Usage: "Number of blocks private transactions are kept for inclusion",
+		Value: sof.DefaultConfig.TxPool.PrivateLifetime,
+	}
+	TxPoolAdmissionFlag = cli.StringFlag{
+		Name:  "txpool.admission",
+		Usage: "Policy deciding which transactions are accepted (" + strings.Join(core.TxAdmissions(), ", ") + ")",
+		Value: sof.DefaultConfig.TxPool.Admission,
+	}
+	TxPoolOrderingFlag = cli.StringFlag{
+		Name:  "txpool.ordering",
+		Usage: "Ordering deciding which transactions are preferred (" + strings.Join(core.TxOrderings(), ", ") + ")",
+		Value: sof.DefaultConfig.TxPool.Ordering,
+	}
+	TxPoolAllowedFlag = cli.StringFlag{
+		Name:  "txpool.allowed",
+		Usage: "Comma separated accounts allowed to transact by the permissioned policy",
+	}
+	TxPoolPrivilegedFlag = cli.StringFlag{
+		Name:  "txpool.privileged",
+		Usage: "Comma separated accounts transacting for free by the permissioned policy",
+	}
 	// Performance tuning settings
 	CacheFlag = cli.IntFlag{
 		Name:  "cache",
@@ -319,6 +353,14 @@ var (
 		Usage: "Percentage of cache memory allowance to use for trie pruning",
 		Value: 25,
 	}
+	CacheRefcountFlag = cli.BoolFlag{
+		Name:  "cache.refcount",
+		Usage: "Reference count trie nodes on disk, deleting the ones no retained state references (can't be disabled later)",
+	}
+	CacheRetentionFlag = cli.Uint64Flag{
+		Name:  "cache.retention",
+		Usage: "Number of blocks to retain the states committed to disk for with reference counting (0 = all)",
+	}
 	TrieCacheGenFlag = cli.IntFlag{
 		Name:  "trie-cache-gens",
 		Usage: "Number of trie node generations to keep in memory",
@@ -458,6 +500,47 @@ var (
 		Usage: "API's offered over the HTTP-RPC interface",
 		Value: "",
 	}
+	RPCBatchLimitFlag = cli.IntFlag{
+		Name:  "rpc.batchlimit",
+		Usage: "Maximum number of requests in a HTTP/WS-RPC batch (0 = unlimited)",
+	}
+	RPCResponseLimitFlag = cli.IntFlag{
+		Name:  "rpc.responselimit",
+		Usage: "Maximum size in bytes of a HTTP/WS-RPC response (0 = unlimited)",
+	}
+	RPCConcurrencyLimitFlag = cli.IntFlag{
+		Name:  "rpc.concurrencylimit",
+		Usage: "Maximum number of concurrent requests per WS-RPC connection (0 = unlimited)",
+	}
+	RPCClientRateLimitFlag = cli.StringFlag{
+		Name:  "rpc.ratelimit",
+		Usage: "Request rate allowed per remote IP on the HTTP/WS-RPC interfaces (limit[:burst] requests/second)",
+	}
+	RPCMethodRateLimitsFlag = cli.StringFlag{
+		Name:  "rpc.methodratelimits",
+		Usage: "Comma separated list of per method or namespace request rates (e.g. sof_getLogs=5:10,debug=1)",
+	}
+	RPCJWTSecretFlag = cli.StringFlag{
+		Name:  "rpc.jwtsecret",
+		Usage: "Path to a hex encoded secret for HS256 JWT authentication of HTTP/WS-RPC clients (generated if missing)",
+	}
+	RPCJWTFreshnessFlag = cli.DurationFlag{
+		Name:  "rpc.jwtfreshness",
+		Usage: "Maximum distance between the issued-at claim of a JWT token and the local time",
+		Value: rpc.DefaultJWTFreshness,
+	}
+	RPCPathPrefixFlag = cli.StringFlag{
+		Name:  "rpc.prefix",
+		Usage: "Path prefix on which the HTTP-RPC server is served (default: all paths)",
+	}
+	RPCMetricsPathFlag = cli.StringFlag{
+		Name:  "rpc.metricspath",
+		Usage: "Path on the HTTP-RPC server on which the node metrics are served",
+	}
+	RPCHealthPathFlag = cli.StringFlag{
+		Name:  "rpc.healthpath",
+		Usage: "Path on the HTTP-RPC server on which the node health is reported",
+	}
 	IPCDisabledFlag = cli.BoolFlag{
 		Name:  "ipcdisable",
 		Usage: "Disable the IPC-RPC server",
@@ -477,9 +560,13 @@ var (
 	}
 	WSPortFlag = cli.IntFlag{
 		Name:  "wsport",
-		Usage: "WS-RPC server listening port",
+		Usage: "WS-RPC server listening port (shares the HTTP-RPC listener if equal)",
 		Value: node.DefaultWSPort,
 	}
+	WSPathPrefixFlag = cli.StringFlag{
+		Name:  "ws.prefix",
+		Usage: "Path prefix on which the WS-RPC server accepts connections (default: all paths)",
+	}
 	WSApiFlag = cli.StringFlag{
 		Name:  "wsapi",
 		Usage: "API's offered over the WS-RPC interface",
@@ -809,6 +896,54 @@ func setHTTP(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(RPCVirtualHostsFlag.Name) {
 		cfg.HTTPVirtualHosts = splitAndTrim(ctx.GlobalString(RPCVirtualHostsFlag.Name))
 	}
+	if ctx.GlobalIsSet(RPCPathPrefixFlag.Name) {
+		cfg.HTTPPathPrefix = ctx.GlobalString(RPCPathPrefixFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCMetricsPathFlag.Name) {
+		cfg.HTTPMetricsPath = ctx.GlobalString(RPCMetricsPathFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCHealthPathFlag.Name) {
+		cfg.HTTPHealthPath = ctx.GlobalString(RPCHealthPathFlag.Name)
+	}
+}
+
+// setRPCLimits applies the HTTP and WebSocket RPC request limits from the
+// command line flags to the node configuration.
+func setRPCLimits(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCBatchLimitFlag.Name) {
+		cfg.RPCLimits.BatchItems = ctx.GlobalInt(RPCBatchLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCResponseLimitFlag.Name) {
+		cfg.RPCLimits.ResponseSize = ctx.GlobalInt(RPCResponseLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCConcurrencyLimitFlag.Name) {
+		cfg.RPCLimits.ConcurrentRequests = ctx.GlobalInt(RPCConcurrencyLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCClientRateLimitFlag.Name) {
+		rate, err := rpc.ParseRate(ctx.GlobalString(RPCClientRateLimitFlag.Name))
+		if err != nil {
+			Fatalf("Option %q: %v", RPCClientRateLimitFlag.Name, err)
+		}
+		cfg.RPCLimits.ClientRate = rate
+	}
+	if ctx.GlobalIsSet(RPCMethodRateLimitsFlag.Name) {
+		rates, err := rpc.ParseRates(ctx.GlobalString(RPCMethodRateLimitsFlag.Name))
+		if err != nil {
+			Fatalf("Option %q: %v", RPCMethodRateLimitsFlag.Name, err)
+		}
+		cfg.RPCLimits.MethodRates = rates
+	}
+}
+
+// setJWT configures the JWT authentication of the HTTP and WebSocket RPC clients
+// from the set command line flags.
+func setJWT(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCJWTSecretFlag.Name) {
+		cfg.JWTSecret = ctx.GlobalString(RPCJWTSecretFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCJWTFreshnessFlag.Name) {
+		cfg.JWTFreshness = ctx.GlobalDuration(RPCJWTFreshnessFlag.Name)
+	}
 }
 
 // setWS creates the WebSocket RPC listener interface string from the set
@@ -830,6 +965,9 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(WSApiFlag.Name) {
 		cfg.WSModules = splitAndTrim(ctx.GlobalString(WSApiFlag.Name))
 	}
+	if ctx.GlobalIsSet(WSPathPrefixFlag.Name) {
+		cfg.WSPathPrefix = ctx.GlobalString(WSPathPrefixFlag.Name)
+	}
 }
 
 // setIPC creates an IPC path configuration from the set command line flags,
@@ -995,6 +1133,8 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setIPC(ctx, cfg)
 	setHTTP(ctx, cfg)
 	setWS(ctx, cfg)
+	setRPCLimits(ctx, cfg)
+	setJWT(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 	setDataDir(ctx, cfg)
 
@@ -1074,6 +1214,40 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolSnapshotFlag.Name) {
+		cfg.Snapshot = ctx.GlobalString(TxPoolSnapshotFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolResnapshotFlag.Name) {
+		cfg.Resnapshot = ctx.GlobalDuration(TxPoolResnapshotFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolPrivateLifetimeFlag.Name) {
+		cfg.PrivateLifetime = ctx.GlobalUint64(TxPoolPrivateLifetimeFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolAdmissionFlag.Name) {
+		cfg.Admission = ctx.GlobalString(TxPoolAdmissionFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolOrderingFlag.Name) {
+		cfg.Ordering = ctx.GlobalString(TxPoolOrderingFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolAllowedFlag.Name) {
+		cfg.AllowedSenders = splitAccounts(ctx.GlobalString(TxPoolAllowedFlag.Name), TxPoolAllowedFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolPrivilegedFlag.Name) {
+		cfg.PrivilegedSenders = splitAccounts(ctx.GlobalString(TxPoolPrivilegedFlag.Name), TxPoolPrivilegedFlag.Name)
+	}
+}
+
+// splitAccounts parses a comma separated list of accounts given in a flag.
+func splitAccounts(list string, flag string) []common.Address {
+	var accounts []common.Address
+	for _, account := range strings.Split(list, ",") {
+		trimmed := strings.TrimSpace(account)
+		if !common.IsHexAddress(trimmed) {
+			Fatalf("Invalid account in --%s: %s", flag, trimmed)
+		}
+		accounts = append(accounts, common.HexToAddress(trimmed))
+	}
+	return accounts
 }
 
 func setSofash(ctx *cli.Context, cfg *sof.Config) {
@@ -1215,6 +1389,12 @@ func SetSofConfig(ctx *cli.Context, stack *node.Node, cfg *sof.Config) {
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cfg.TrieDirtyCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
 	}
+	if ctx.GlobalIsSet(CacheRefcountFlag.Name) {
+		cfg.TrieRefcount = ctx.GlobalBool(CacheRefcountFlag.Name)
+	}
+	if ctx.GlobalIsSet(CacheRetentionFlag.Name) {
+		cfg.TrieRetention = ctx.GlobalUint64(CacheRetentionFlag.Name)
+	}
 	if ctx.GlobalIsSet(MinerNotifyFlag.Name) {
 		cfg.MinerNotify = strings.Split(ctx.GlobalString(MinerNotifyFlag.Name), ",")
 	}
@@ -1457,6 +1637,8 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	var engine consensus.Engine
 	if config.Clique != nil {
 		engine = clique.New(config.Clique, chainDb)
+	} else if config.BFT != nil {
+		engine = bft.New(config.BFT, chainDb)
 	} else {
 		engine = sofash.NewFaker()
 		if !ctx.GlobalBool(FakePoWFlag.Name) {
@@ -1478,6 +1660,8 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 		TrieCleanLimit: sof.DefaultConfig.TrieCleanCache,
 		TrieDirtyLimit: sof.DefaultConfig.TrieDirtyCache,
 		TrieTimeLimit:  sof.DefaultConfig.TrieTimeout,
+		TrieRefcount:   ctx.GlobalBool(CacheRefcountFlag.Name),
+		TrieRetention:  ctx.GlobalUint64(CacheRetentionFlag.Name),
 	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cache.TrieCleanLimit = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
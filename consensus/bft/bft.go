@@ -0,0 +1,887 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package bft implements a byzantine fault tolerant proof-of-authority consensus
+// engine with instant finality, modelled after PBFT.
+//
+// For every block the validators run one or more rounds of three phases: the
+// proposer of the round broadcasts its block, every validator accepting it
+// broadcasts a prepare, and every validator seeing a quorum of prepares locks on
+// the block and broadcasts a commit carrying its committed seal. A quorum of
+// committed seals, stored in the header's extra-data, finalises the block. If a
+// round doesn't commit in time, the validators change to the next round with a
+// different proposer.
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/susy-go/susy-graviton/accounts"
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/common/hexutil"
+	"github.com/susy-go/susy-graviton/consensus"
+	"github.com/susy-go/susy-graviton/consensus/misc"
+	"github.com/susy-go/susy-graviton/core/state"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/log"
+	"github.com/susy-go/susy-graviton/params"
+	"github.com/susy-go/susy-graviton/rpc"
+	"github.com/susy-go/susy-graviton/sofdb"
+	"github.com/susy-go/susy-graviton/srlp"
+)
+
+const (
+	checkpointInterval = 1024 // Number of blocks after which to save the vote snapshot to the database
+	inmemorySnapshots  = 128  // Number of recent vote snapshots to keep in memory
+	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
+	inmemoryMessages   = 4096 // Number of recent consensus message hashes to keep for deduplication
+	maxHeightLead      = 16   // Maximum number of blocks a relayed message may be ahead of the local head
+)
+
+// BFT protocol constants.
+var (
+	epochLength    = uint64(30000) // Default number of blocks after which to checkpoint and reset the pending votes
+	requestTimeout = uint64(10000) // Default number of milliseconds to wait for a round to commit
+
+	extraVanity = 32 // Fixed number of extra-data prefix bytes reserved for validator vanity
+	sealLength  = 65 // Fixed number of bytes of a secp256k1 seal
+
+	nonceAuthVote = hexutil.MustDecode("0xffffffffffffffff") // Magic nonce number to vote on adding a new validator
+	nonceDropVote = hexutil.MustDecode("0x0000000000000000") // Magic nonce number to vote on removing a validator.
+
+	uncleHash = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
+
+	// bftDigest is the mix digest identifying blocks sealed by the BFT engine,
+	// reading "practical byzantine fault tolerance".
+	bftDigest = common.HexToHash("0x63746963616c2062797a616e74696e65206661756c7420746f6c6572616e6365")
+
+	defaultDifficulty = big.NewInt(1) // Block difficulty, meaningless as blocks are final
+)
+
+// Various error messages to mark blocks invalid. These should be private to
+// prevent engine specific errors from being referenced in the remainder of the
+// codebase, inherently breaking if the engine is swapped out. Please put common
+// error types into the consensus package.
+var (
+	// errUnknownBlock is returned when the list of validators is requested for a
+	// block that is not part of the local blockchain.
+	errUnknownBlock = errors.New("unknown block")
+
+	// errUnauthorized is returned if the local node is asked to seal without
+	// having been authorized with a validator key.
+	errUnauthorized = errors.New("not authorized to seal")
+
+	// errInvalidCheckpointBeneficiary is returned if a checkpoint/epoch transition
+	// block has a beneficiary set to non-zeroes.
+	errInvalidCheckpointBeneficiary = errors.New("beneficiary in checkpoint block non-zero")
+
+	// errInvalidVote is returned if a nonce value is something else that the two
+	// allowed constants of 0x00..0 or 0xff..f.
+	errInvalidVote = errors.New("vote nonce not 0x00..0 or 0xff..f")
+
+	// errInvalidCheckpointVote is returned if a checkpoint/epoch transition block
+	// has a vote nonce set to non-zeroes.
+	errInvalidCheckpointVote = errors.New("vote nonce in checkpoint block non-zero")
+
+	// errMissingVanity is returned if a block's extra-data section is shorter than
+	// 32 bytes, which is required to store the validator vanity.
+	errMissingVanity = errors.New("extra-data 32 byte vanity prefix missing")
+
+	// errInvalidExtraData is returned if the consensus fields following the vanity
+	// in a block's extra-data cannot be decoded.
+	errInvalidExtraData = errors.New("invalid consensus extra-data")
+
+	// errInvalidSignature is returned if a seal or a message signature is not a
+	// 65 byte secp256k1 signature.
+	errInvalidSignature = errors.New("invalid signature")
+
+	// errExtraValidators is returned if non-checkpoint block contain validator
+	// data in their extra-data fields.
+	errExtraValidators = errors.New("non-checkpoint block contains extra validator list")
+
+	// errMismatchingCheckpointValidators is returned if a checkpoint block contains
+	// a list of validators different than the one the local node calculated.
+	errMismatchingCheckpointValidators = errors.New("mismatching validator list on checkpoint block")
+
+	// errInvalidMixDigest is returned if a block's mix digest is not the BFT one.
+	errInvalidMixDigest = errors.New("invalid mix digest")
+
+	// errInvalidUncleHash is returned if a block contains an non-empty uncle list.
+	errInvalidUncleHash = errors.New("non empty uncle hash")
+
+	// errInvalidDifficulty is returned if the difficulty of a block is not 1.
+	errInvalidDifficulty = errors.New("invalid difficulty")
+
+	// ErrInvalidTimestamp is returned if the timestamp of a block is lower than
+	// the previous block's timestamp + the minimum block period.
+	ErrInvalidTimestamp = errors.New("invalid timestamp")
+
+	// errInvalidVotingChain is returned if an authorization list is attempted to
+	// be modified via out-of-range or non-contiguous headers.
+	errInvalidVotingChain = errors.New("invalid voting chain")
+
+	// errUnauthorizedProposer is returned if a header is proposed by a non-validator.
+	errUnauthorizedProposer = errors.New("unauthorized proposer")
+
+	// errInvalidCommittedSeals is returned if a committed seal of a header is not
+	// signed by a validator, or more than once by the same one.
+	errInvalidCommittedSeals = errors.New("invalid committed seals")
+
+	// errInsufficientCommittedSeals is returned if a header is not committed to by
+	// a quorum of validators.
+	errInsufficientCommittedSeals = errors.New("insufficient committed seals")
+
+	// errInvalidMessageHeight is returned if a consensus message is for a height
+	// already agreed on locally, or too far ahead of the local head.
+	errInvalidMessageHeight = errors.New("consensus message of invalid height")
+
+	// errUnauthorizedValidator is returned if a consensus message is sent by a
+	// non-validator.
+	errUnauthorizedValidator = errors.New("unauthorized validator")
+)
+
+// SignerFn is a signer callback function to request a hash to be signed by a
+// backing account.
+type SignerFn func(accounts.Account, []byte) ([]byte, error)
+
+// bftExtra is the consensus data stored in the extra-data of the headers, after
+// the vanity prefix.
+type bftExtra struct {
+	Validators     []common.Address // Validators in ascending order at checkpoints, empty otherwise
+	Seal           []byte           // Signature of the proposer over the sigHash
+	CommittedSeals [][]byte         // Signatures of the validators over the commitHash
+}
+
+// decodeExtra extracts the consensus data from the extra-data of a header.
+func decodeExtra(header *types.Header) (*bftExtra, error) {
+	if len(header.Extra) < extraVanity {
+		return nil, errMissingVanity
+	}
+	extra := new(bftExtra)
+	if err := srlp.DecodeBytes(header.Extra[extraVanity:], extra); err != nil {
+		return nil, errInvalidExtraData
+	}
+	return extra, nil
+}
+
+// encode assembles the extra-data of a header from the given vanity, truncated
+// or padded to its fixed size, and the consensus data.
+func (extra *bftExtra) encode(vanity []byte) []byte {
+	data := make([]byte, extraVanity)
+	copy(data, vanity)
+
+	blob, err := srlp.EncodeToBytes(extra)
+	if err != nil {
+		panic(err) // Can't fail for valid Go values
+	}
+	return append(data, blob...)
+}
+
+// GenesisExtra assembles the extra-data of a genesis block sealed by the given
+// set of initial validators.
+func GenesisExtra(validators []common.Address) []byte {
+	sorted := make([]common.Address, len(validators))
+	copy(sorted, validators)
+	sortAddresses(sorted)
+
+	return (&bftExtra{Validators: sorted}).encode(nil)
+}
+
+// filteredHeader returns a copy of the header with the committed seals, and
+// optionally the proposer seal, removed from its extra-data.
+func filteredHeader(header *types.Header, keepSeal bool) *types.Header {
+	cpy := types.CopyHeader(header)
+
+	extra, err := decodeExtra(header)
+	if err != nil {
+		return cpy
+	}
+	if !keepSeal {
+		extra.Seal = nil
+	}
+	extra.CommittedSeals = nil
+	cpy.Extra = extra.encode(header.Extra[:extraVanity])
+
+	return cpy
+}
+
+// sigHash returns the hash which is used as input for the proposer seal. It is
+// the hash of the entire header apart from the seals in the extra-data.
+func sigHash(header *types.Header) common.Hash {
+	return filteredHeader(header, false).Hash()
+}
+
+// proposalHash returns the hash identifying a proposed block during the rounds,
+// which is the hash of the entire header apart from the committed seals.
+func proposalHash(header *types.Header) common.Hash {
+	return filteredHeader(header, true).Hash()
+}
+
+// commitHash returns the hash the validators sign as committed seals to finalise
+// the proposal with the given hash.
+func commitHash(proposal common.Hash) common.Hash {
+	return crypto.Keccak256Hash(proposal[:], []byte{byte(msgCommit)})
+}
+
+// recoverAddress extracts the Sophon account address from a signature.
+func recoverAddress(hash []byte, signature []byte) (common.Address, error) {
+	if len(signature) != sealLength {
+		return common.Address{}, errInvalidSignature
+	}
+	pubkey, err := crypto.Ecrecover(hash, signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+
+	return signer, nil
+}
+
+// ecrecover extracts the Sophon account address of the proposer of a header.
+func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, error) {
+	// If the signature's already cached, return that
+	hash := header.Hash()
+	if address, known := sigcache.Get(hash); known {
+		return address.(common.Address), nil
+	}
+	extra, err := decodeExtra(header)
+	if err != nil {
+		return common.Address{}, err
+	}
+	signer, err := recoverAddress(sigHash(header).Bytes(), extra.Seal)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sigcache.Add(hash, signer)
+	return signer, nil
+}
+
+// BFT is the byzantine fault tolerant proof-of-authority consensus engine,
+// finalising every block as soon as it's mined.
+type BFT struct {
+	config *params.BFTConfig // Consensus engine configuration parameters
+	db     sofdb.Database    // Database to store and retrieve snapshot checkpoints
+
+	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
+	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
+	messages   *lru.ARCCache // Hashes of recent consensus messages to drop duplicates
+
+	proposals map[common.Address]bool // Current list of proposals we are pushing
+
+	signer      common.Address        // Sophon address of the signing key
+	signFn      SignerFn              // Signer function to authorize hashes with
+	chain       consensus.ChainReader // Local chain the consensus messages are checked against
+	broadcaster consensus.Broadcaster // Network layer to reach the other validators
+	lock        sync.RWMutex          // Protects the signer, proposal, chain and broadcaster fields
+
+	rounds *rounds // Round state machine agreeing on the blocks with the other validators
+}
+
+// New creates a BFT consensus engine with the initial validators set to the ones
+// in the genesis block.
+func New(config *params.BFTConfig, db sofdb.Database) *BFT {
+	// Set any missing consensus parameters to their defaults
+	conf := *config
+	if conf.Epoch == 0 {
+		conf.Epoch = epochLength
+	}
+	if conf.RequestTimeout == 0 {
+		conf.RequestTimeout = requestTimeout
+	}
+	// Allocate the snapshot caches and create the engine
+	recents, _ := lru.NewARC(inmemorySnapshots)
+	signatures, _ := lru.NewARC(inmemorySignatures)
+	messages, _ := lru.NewARC(inmemoryMessages)
+
+	bft := &BFT{
+		config:     &conf,
+		db:         db,
+		recents:    recents,
+		signatures: signatures,
+		messages:   messages,
+		proposals:  make(map[common.Address]bool),
+	}
+	bft.rounds = newRounds(bft)
+	go bft.rounds.loop()
+
+	return bft
+}
+
+// Author implements consensus.Engine, returning the Sophon address recovered
+// from the proposer seal in the header's extra-data section.
+func (b *BFT) Author(header *types.Header) (common.Address, error) {
+	return ecrecover(header, b.signatures)
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules.
+func (b *BFT) VerifyHeader(chain consensus.ChainReader, header *types.Header, seal bool) error {
+	return b.verifyHeader(chain, header, nil, true)
+}
+
+// VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
+// method returns a quit channel to abort the operations and a results channel to
+// retrieve the async verifications (the order is that of the input slice).
+func (b *BFT) VerifyHeaders(chain consensus.ChainReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+
+	go func() {
+		for i, header := range headers {
+			err := b.verifyHeader(chain, header, headers[:i], true)
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return abort, results
+}
+
+// verifyHeader checks whether a header conforms to the consensus rules. The
+// caller may optionally pass in a batch of parents (ascending order) to avoid
+// looking those up from the database. The committed seals are only checked if
+// requested, proposals not having any yet.
+func (b *BFT) verifyHeader(chain consensus.ChainReader, header *types.Header, parents []*types.Header, committed bool) error {
+	if header.Number == nil {
+		return errUnknownBlock
+	}
+	number := header.Number.Uint64()
+
+	// Don't waste time checking blocks from the future
+	if header.Time > uint64(time.Now().Unix()) {
+		return consensus.ErrFutureBlock
+	}
+	// Checkpoint blocks need to enforce zero beneficiary
+	checkpoint := (number % b.config.Epoch) == 0
+	if checkpoint && header.Coinbase != (common.Address{}) {
+		return errInvalidCheckpointBeneficiary
+	}
+	// Nonces must be 0x00..0 or 0xff..f, zeroes enforced on checkpoints
+	if !bytes.Equal(header.Nonce[:], nonceAuthVote) && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errInvalidVote
+	}
+	if checkpoint && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errInvalidCheckpointVote
+	}
+	// Ensure that the extra-data contains a validator list on checkpoint, but none otherwise
+	extra, err := decodeExtra(header)
+	if err != nil {
+		return err
+	}
+	if !checkpoint && len(extra.Validators) != 0 {
+		return errExtraValidators
+	}
+	// Ensure that the mix digest is the BFT one to tell the blocks apart
+	if header.MixDigest != bftDigest {
+		return errInvalidMixDigest
+	}
+	// Ensure that the block doesn't contain any uncles which are meaningless in PoA
+	if header.UncleHash != uncleHash {
+		return errInvalidUncleHash
+	}
+	// Ensure that the block's difficulty is the constant one
+	if number > 0 && (header.Difficulty == nil || header.Difficulty.Cmp(defaultDifficulty) != 0) {
+		return errInvalidDifficulty
+	}
+	// If all checks passed, validate any special fields for hard forks
+	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
+		return err
+	}
+	// All basic checks passed, verify cascading fields
+	return b.verifyCascadingFields(chain, header, parents, committed)
+}
+
+// verifyCascadingFields verifies all the header fields that are not standalone,
+// rather depend on a batch of previous headers. The caller may optionally pass
+// in a batch of parents (ascending order) to avoid looking those up from the
+// database. This is useful for concurrently verifying a batch of new headers.
+func (b *BFT) verifyCascadingFields(chain consensus.ChainReader, header *types.Header, parents []*types.Header, committed bool) error {
+	// The genesis block is the always valid dead-end
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+	// Ensure that the block's timestamp isn't too close to it's parent
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+	if parent.Time+b.config.Period > header.Time {
+		return ErrInvalidTimestamp
+	}
+	// Retrieve the snapshot needed to verify this header and cache it
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	// If the block is a checkpoint block, verify the validator list
+	if number%b.config.Epoch == 0 {
+		extra, err := decodeExtra(header)
+		if err != nil {
+			return err
+		}
+		validators := snap.validators()
+		if len(extra.Validators) != len(validators) {
+			return errMismatchingCheckpointValidators
+		}
+		for i, validator := range validators {
+			if extra.Validators[i] != validator {
+				return errMismatchingCheckpointValidators
+			}
+		}
+	}
+	// All basic checks passed, verify the seals and return
+	return b.verifySeal(chain, header, parents, committed)
+}
+
+// snapshot retrieves the authorization snapshot at a given point in time.
+func (b *BFT) snapshot(chain consensus.ChainReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	// Search for a snapshot in memory or on disk for checkpoints
+	var (
+		headers []*types.Header
+		snap    *Snapshot
+	)
+	for snap == nil {
+		// If an in-memory snapshot was found, use that
+		if s, ok := b.recents.Get(hash); ok {
+			snap = s.(*Snapshot)
+			break
+		}
+		// If an on-disk checkpoint snapshot can be found, use that
+		if number%checkpointInterval == 0 {
+			if s, err := loadSnapshot(b.config, b.signatures, b.db, hash); err == nil {
+				log.Trace("Loaded voting snapshot from disk", "number", number, "hash", hash)
+				snap = s
+				break
+			}
+		}
+		// If we're at an checkpoint block, make a snapshot if it's known
+		if number == 0 || (number%b.config.Epoch == 0 && chain.GetHeaderByNumber(number-1) == nil) {
+			checkpoint := chain.GetHeaderByNumber(number)
+			if checkpoint != nil {
+				extra, err := decodeExtra(checkpoint)
+				if err != nil {
+					return nil, err
+				}
+				hash := checkpoint.Hash()
+
+				snap = newSnapshot(b.config, b.signatures, number, hash, extra.Validators)
+				if err := snap.store(b.db); err != nil {
+					return nil, err
+				}
+				log.Info("Stored checkpoint snapshot to disk", "number", number, "hash", hash)
+				break
+			}
+		}
+		// No snapshot for this header, gather the header and move backward
+		var header *types.Header
+		if len(parents) > 0 {
+			// If we have explicit parents, pick from there (enforced)
+			header = parents[len(parents)-1]
+			if header.Hash() != hash || header.Number.Uint64() != number {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			parents = parents[:len(parents)-1]
+		} else {
+			// No explicit parents (or no more left), reach out to the database
+			header = chain.GetHeader(hash, number)
+			if header == nil {
+				return nil, consensus.ErrUnknownAncestor
+			}
+		}
+		headers = append(headers, header)
+		number, hash = number-1, header.ParentHash
+	}
+	// Previous snapshot found, apply any pending headers on top of it
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	snap, err := snap.apply(headers)
+	if err != nil {
+		return nil, err
+	}
+	b.recents.Add(snap.Hash, snap)
+
+	// If we've generated a new checkpoint snapshot, save to disk
+	if snap.Number%checkpointInterval == 0 && len(headers) > 0 {
+		if err = snap.store(b.db); err != nil {
+			return nil, err
+		}
+		log.Trace("Stored voting snapshot to disk", "number", snap.Number, "hash", snap.Hash)
+	}
+	return snap, err
+}
+
+// VerifyUncles implements consensus.Engine, always returning an error for any
+// uncles as this consensus mechanism doesn't permit uncles.
+func (b *BFT) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	if len(block.Uncles()) > 0 {
+		return errors.New("uncles not allowed")
+	}
+	return nil
+}
+
+// VerifySeal implements consensus.Engine, checking whether the proposer seal and
+// the committed seals contained in the header satisfy the consensus protocol
+// requirements.
+func (b *BFT) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
+	return b.verifySeal(chain, header, nil, true)
+}
+
+// verifySeal checks whether the proposer seal, and optionally the committed
+// seals, contained in the header satisfy the consensus protocol requirements.
+// The method accepts an optional list of parent headers that aren't yet part of
+// the local blockchain to generate the snapshots from.
+func (b *BFT) verifySeal(chain consensus.ChainReader, header *types.Header, parents []*types.Header, committed bool) error {
+	// Verifying the genesis block is not supported
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	// Retrieve the snapshot needed to verify this header and cache it
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	// Resolve the authorization key and check against validators
+	proposer, err := ecrecover(header, b.signatures)
+	if err != nil {
+		return err
+	}
+	if _, ok := snap.Validators[proposer]; !ok {
+		return errUnauthorizedProposer
+	}
+	if !committed {
+		return nil
+	}
+	// Ensure a quorum of distinct validators committed to the block
+	extra, err := decodeExtra(header)
+	if err != nil {
+		return err
+	}
+	var (
+		hash    = commitHash(proposalHash(header)).Bytes()
+		commits = make(map[common.Address]struct{})
+	)
+	for _, seal := range extra.CommittedSeals {
+		validator, err := recoverAddress(hash, seal)
+		if err != nil {
+			return errInvalidCommittedSeals
+		}
+		if _, ok := snap.Validators[validator]; !ok {
+			return errInvalidCommittedSeals
+		}
+		if _, ok := commits[validator]; ok {
+			return errInvalidCommittedSeals
+		}
+		commits[validator] = struct{}{}
+	}
+	if len(commits) < snap.quorum() {
+		return errInsufficientCommittedSeals
+	}
+	return nil
+}
+
+// Prepare implements consensus.Engine, preparing all the consensus fields of the
+// header for running the transactions on top.
+func (b *BFT) Prepare(chain consensus.ChainReader, header *types.Header) error {
+	// If the block isn't a checkpoint, cast a random vote (good enough for now)
+	header.Coinbase = common.Address{}
+	header.Nonce = types.BlockNonce{}
+
+	number := header.Number.Uint64()
+	// Assemble the voting snapshot to check which votes make sense
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if number%b.config.Epoch != 0 {
+		b.lock.RLock()
+
+		// Gather all the proposals that make sense voting on
+		addresses := make([]common.Address, 0, len(b.proposals))
+		for address, authorize := range b.proposals {
+			if snap.validVote(address, authorize) {
+				addresses = append(addresses, address)
+			}
+		}
+		// If there's pending proposals, cast a vote on them
+		if len(addresses) > 0 {
+			header.Coinbase = addresses[rand.Intn(len(addresses))]
+			if b.proposals[header.Coinbase] {
+				copy(header.Nonce[:], nonceAuthVote)
+			} else {
+				copy(header.Nonce[:], nonceDropVote)
+			}
+		}
+		b.lock.RUnlock()
+	}
+	// Blocks are final, so there's no fork choice to weigh
+	header.Difficulty = new(big.Int).Set(defaultDifficulty)
+	header.MixDigest = bftDigest
+
+	// Assemble the consensus extra-data, listing the validators on checkpoints
+	extra := new(bftExtra)
+	if number%b.config.Epoch == 0 {
+		extra.Validators = snap.validators()
+	}
+	header.Extra = extra.encode(header.Extra)
+
+	// Ensure the timestamp has the correct delay
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	header.Time = parent.Time + b.config.Period
+	if header.Time < uint64(time.Now().Unix()) {
+		header.Time = uint64(time.Now().Unix())
+	}
+	return nil
+}
+
+// Finalize implements consensus.Engine, ensuring no uncles are set, nor block
+// rewards given, and returns the final block.
+func (b *BFT) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	// No block rewards in PoA, so the state remains as is and uncles are dropped
+	header.Root = state.IntermediateRoot(chain.Config().IsSIP158(header.Number))
+	header.UncleHash = types.CalcUncleHash(nil)
+
+	// Assemble and return the final block for sealing
+	return types.NewBlock(header, txs, nil, receipts), nil
+}
+
+// Authorize injects a private key into the consensus engine to propose and
+// commit new blocks with.
+func (b *BFT) Authorize(signer common.Address, signFn SignerFn) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.signer = signer
+	b.signFn = signFn
+}
+
+// sign signs the given hash with the local validator key.
+func (b *BFT) sign(hash common.Hash) (common.Address, []byte, error) {
+	b.lock.RLock()
+	signer, signFn := b.signer, b.signFn
+	b.lock.RUnlock()
+
+	if signFn == nil {
+		return common.Address{}, nil, errUnauthorized
+	}
+	signature, err := signFn(accounts.Account{Address: signer}, hash.Bytes())
+	return signer, signature, err
+}
+
+// Seal implements consensus.Engine, signing the block as its proposer and
+// handing it over to the rounds agreeing on the next block. The sealed block is
+// returned once a quorum of validators committed to it, if it gets proposed at
+// all.
+func (b *BFT) Seal(chain consensus.ChainReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	header := block.Header()
+
+	// Sealing the genesis block is not supported
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	// Bail out if we're unauthorized to propose a block
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	b.lock.RLock()
+	signer := b.signer
+	b.lock.RUnlock()
+
+	if _, authorized := snap.Validators[signer]; !authorized {
+		return errUnauthorizedProposer
+	}
+	// Sign the proposal and take part in the rounds of its height
+	extra, err := decodeExtra(header)
+	if err != nil {
+		return err
+	}
+	_, seal, err := b.sign(sigHash(header))
+	if err != nil {
+		return err
+	}
+	extra.Seal, extra.CommittedSeals = seal, nil
+	header.Extra = extra.encode(header.Extra)
+
+	b.rounds.request(&request{
+		chain:   chain,
+		block:   block.WithSeal(header),
+		results: results,
+		stop:    stop,
+	})
+	return nil
+}
+
+// SealHash returns the hash of a block prior to it being sealed.
+func (b *BFT) SealHash(header *types.Header) common.Hash {
+	return sigHash(header)
+}
+
+// CalcDifficulty is the difficulty adjustment algorithm. It returns the difficulty
+// that a new block should have, which is constant as blocks are final.
+func (b *BFT) CalcDifficulty(chain consensus.ChainReader, time uint64, parent *types.Header) *big.Int {
+	return new(big.Int).Set(defaultDifficulty)
+}
+
+// FinalizedHeader implements consensus.Finality. Every block is committed by a
+// quorum of the validators before being imported, so the head itself is final.
+func (b *BFT) FinalizedHeader(chain consensus.ChainReader, head *types.Header) *types.Header {
+	return head
+}
+
+// SafeHeader implements consensus.Finality, returning the head as it's final.
+func (b *BFT) SafeHeader(chain consensus.ChainReader, head *types.Header) *types.Header {
+	return head
+}
+
+// SetBroadcaster implements consensus.Handler, injecting the local chain to check
+// the consensus messages against, and the network layer to exchange them with.
+func (b *BFT) SetBroadcaster(chain consensus.ChainReader, broadcaster consensus.Broadcaster) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.chain = chain
+	b.broadcaster = broadcaster
+}
+
+// localChain returns the local chain injected along with the network layer.
+func (b *BFT) localChain() consensus.ChainReader {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.chain
+}
+
+// HandleMsg implements consensus.Handler, feeding a consensus message received
+// from a peer to the rounds, and reporting whether it should be relayed further.
+// Only the messages of validators for the heights following the local head are
+// accepted, the rest are dropped without being relayed.
+func (b *BFT) HandleMsg(payload []byte) (bool, error) {
+	hash := crypto.Keccak256Hash(payload)
+	if b.messages.Contains(hash) {
+		return false, nil
+	}
+	b.messages.Add(hash, struct{}{})
+
+	msg, err := decodeMessage(payload)
+	if err != nil {
+		return false, err
+	}
+	if err := b.checkSender(msg); err != nil {
+		log.Trace("Discarded consensus message", "msg", msg, "err", err)
+		return false, nil
+	}
+	b.rounds.post(msg)
+	return true, nil
+}
+
+// checkSender verifies that a consensus message is for one of the heights
+// following the local head and was sent by one of its validators.
+func (b *BFT) checkSender(msg *message) error {
+	chain := b.localChain()
+	if chain == nil {
+		return errUnknownBlock
+	}
+	head := chain.CurrentHeader()
+	if number := head.Number.Uint64(); msg.Number <= number || msg.Number > number+maxHeightLead {
+		return errInvalidMessageHeight
+	}
+	snap, err := b.snapshot(chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		return err
+	}
+	if _, ok := snap.Validators[msg.sender]; !ok {
+		return errUnauthorizedValidator
+	}
+	return nil
+}
+
+// broadcast signs a consensus message of the local validator and sends it to
+// the peers.
+func (b *BFT) broadcast(msg *message) error {
+	signer, signature, err := b.sign(msg.sigHash())
+	if err != nil {
+		return err
+	}
+	msg.Signature, msg.sender = signature, signer
+
+	payload, err := srlp.EncodeToBytes(msg)
+	if err != nil {
+		return err
+	}
+	b.messages.Add(crypto.Keccak256Hash(payload), struct{}{})
+
+	b.lock.RLock()
+	broadcaster := b.broadcaster
+	b.lock.RUnlock()
+
+	if broadcaster != nil {
+		broadcaster.BroadcastConsensus(payload)
+	}
+	return nil
+}
+
+// enqueue hands a block committed to by the validators but not sealed locally
+// over to the import.
+func (b *BFT) enqueue(block *types.Block) {
+	b.lock.RLock()
+	broadcaster := b.broadcaster
+	b.lock.RUnlock()
+
+	if broadcaster == nil {
+		log.Warn("Committed block dropped without network", "number", block.Number(), "hash", block.Hash())
+		return
+	}
+	broadcaster.EnqueueBlock(block)
+}
+
+// Close implements consensus.Engine, terminating the rounds.
+func (b *BFT) Close() error {
+	b.rounds.close()
+	return nil
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC API to allow
+// controlling the validator voting.
+func (b *BFT) APIs(chain consensus.ChainReader) []rpc.API {
+	return []rpc.API{{
+		Namespace: "bft",
+		Version:   "1.0",
+		Service:   &API{chain: chain, bft: b},
+		Public:    false,
+	}}
+}
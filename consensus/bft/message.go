@@ -0,0 +1,81 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/srlp"
+)
+
+// Codes of the consensus messages exchanged during the rounds.
+const (
+	msgPropose     uint64 = iota // Block proposed by the proposer of the round
+	msgPrepare                   // Acceptance of the proposal of the round
+	msgCommit                    // Commitment to the proposal, carrying the committed seal
+	msgRoundChange               // Request to move to the round, the current one failing
+)
+
+// errInvalidMessage is returned if a consensus message can't be decoded or its
+// signature is invalid.
+var errInvalidMessage = errors.New("invalid consensus message")
+
+// message is a consensus message signed by a validator.
+type message struct {
+	Code      uint64      // Kind of the message
+	Number    uint64      // Number of the block agreed on
+	Round     uint64      // Round of the agreement the message belongs to
+	Digest    common.Hash // Proposal hash prepared or committed to
+	Proposal  []byte      // RLP encoded block proposed
+	Seal      []byte      // Committed seal of the proposal
+	Signature []byte      // Signature of the validator over the fields above
+
+	sender common.Address // Validator recovered from the signature
+}
+
+// sigHash returns the hash of the message signed by its sender.
+func (m *message) sigHash() common.Hash {
+	blob, _ := srlp.EncodeToBytes([]interface{}{m.Code, m.Number, m.Round, m.Digest, m.Proposal, m.Seal})
+	return crypto.Keccak256Hash(blob)
+}
+
+// String implements the stringer interface.
+func (m *message) String() string {
+	names := map[uint64]string{msgPropose: "propose", msgPrepare: "prepare", msgCommit: "commit", msgRoundChange: "round change"}
+	return fmt.Sprintf("%s(number=%d round=%d sender=%x)", names[m.Code], m.Number, m.Round, m.sender)
+}
+
+// decodeMessage decodes a consensus message received from the network and
+// recovers its sender.
+func decodeMessage(payload []byte) (*message, error) {
+	msg := new(message)
+	if err := srlp.DecodeBytes(payload, msg); err != nil {
+		return nil, errInvalidMessage
+	}
+	if msg.Code > msgRoundChange {
+		return nil, errInvalidMessage
+	}
+	sender, err := recoverAddress(msg.sigHash().Bytes(), msg.Signature)
+	if err != nil {
+		return nil, errInvalidMessage
+	}
+	msg.sender = sender
+	return msg, nil
+}
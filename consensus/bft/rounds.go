@@ -0,0 +1,652 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/consensus"
+	"github.com/susy-go/susy-graviton/core"
+	"github.com/susy-go/susy-graviton/core/state"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/core/vm"
+	"github.com/susy-go/susy-graviton/log"
+	"github.com/susy-go/susy-graviton/srlp"
+)
+
+const (
+	messageChanSize = 256  // Number of consensus messages buffered for the rounds
+	maxBacklog      = 1024 // Maximum number of messages of future heights and rounds to keep
+	maxRoundLead    = 64   // Maximum number of rounds a message may be ahead of the current one
+	maxBackoff      = 6    // Maximum number of times the round timeout doubles
+)
+
+var (
+	// errInvalidProposal is returned if a proposed block doesn't extend the local
+	// chain or its body doesn't match its header.
+	errInvalidProposal = errors.New("invalid proposal")
+
+	// errUnverifiableProposal is returned if a proposed block can't be executed as
+	// the local chain doesn't give access to its state.
+	errUnverifiableProposal = errors.New("unverifiable proposal")
+)
+
+// processingChain is a chain able to execute the proposed blocks on top of the
+// state of their parents before they are agreed on.
+type processingChain interface {
+	consensus.ChainReader
+
+	// StateAt returns the state with the given root.
+	StateAt(root common.Hash) (*state.StateDB, error)
+
+	// Processor returns the processor executing the blocks.
+	Processor() core.Processor
+
+	// Validator returns the validator checking the bodies and states of blocks.
+	Validator() core.Validator
+
+	// GetVMConfig returns the configuration of the virtual machine.
+	GetVMConfig() *vm.Config
+}
+
+// roundState is the progress of the agreement on a block within a round.
+type roundState int
+
+const (
+	stateAcceptRequest roundState = iota // Waiting for the proposal of the round
+	statePreprepared                     // Proposal accepted, collecting prepares
+	statePrepared                        // Quorum of prepares seen, collecting commits
+	stateCommitted                       // Quorum of commits seen, waiting for the block
+)
+
+// request is a locally built block handed over for sealing.
+type request struct {
+	chain   consensus.ChainReader
+	block   *types.Block
+	results chan<- *types.Block
+	stop    <-chan struct{}
+}
+
+// tick is a timer event, valid as long as no newer timer was started.
+type tick struct {
+	number uint64
+	round  uint64
+	seq    uint64
+}
+
+// rounds is the state machine running the rounds of agreement on the blocks. All
+// its state is owned by the loop goroutine.
+type rounds struct {
+	engine *BFT
+
+	requestCh chan *request
+	messageCh chan *message
+	timeoutCh chan tick
+	proposeCh chan tick
+	quit      chan struct{}
+	closeOnce sync.Once
+
+	chain   consensus.ChainReader // Chain the blocks are agreed on
+	pending *request              // Local block to propose at the current height
+
+	number     uint64           // Number of the block agreed on
+	parent     common.Hash      // Hash of the parent of the block agreed on
+	validators []common.Address // Validators of the block in ascending order
+	round      uint64           // Current round of the agreement
+	state      roundState       // Progress of the current round
+	proposal   *types.Block     // Block accepted in the current round
+	digest     common.Hash      // Proposal hash of the accepted block
+	locked     *types.Block     // Block prepared in this or an earlier round
+
+	prepares     map[uint64]map[common.Address]common.Hash // Digests prepared by the validators per round
+	commits      map[common.Hash]map[common.Address][]byte // Committed seals of the validators per digest
+	roundChanges map[uint64]map[common.Address]struct{}    // Validators requesting to move to a round
+	changing     uint64                                    // Highest round requested locally
+	backlog      []*message                                // Messages of future heights and rounds
+
+	seq          uint64      // Sequence number of the current timers
+	timer        *time.Timer // Timer changing the round if it doesn't commit
+	proposeTimer *time.Timer // Timer proposing the local block once its time comes
+}
+
+// newRounds creates the round state machine of a BFT engine.
+func newRounds(engine *BFT) *rounds {
+	return &rounds{
+		engine:    engine,
+		requestCh: make(chan *request),
+		messageCh: make(chan *message, messageChanSize),
+		timeoutCh: make(chan tick),
+		proposeCh: make(chan tick),
+		quit:      make(chan struct{}),
+	}
+}
+
+// close terminates the loop of the state machine.
+func (c *rounds) close() {
+	c.closeOnce.Do(func() { close(c.quit) })
+}
+
+// request hands a locally built block over to the rounds of its height.
+func (c *rounds) request(req *request) {
+	select {
+	case c.requestCh <- req:
+	case <-c.quit:
+	}
+}
+
+// post feeds a consensus message to the rounds.
+func (c *rounds) post(msg *message) {
+	select {
+	case c.messageCh <- msg:
+	case <-c.quit:
+	}
+}
+
+// loop is the goroutine running the rounds.
+func (c *rounds) loop() {
+	defer c.stopTimers()
+
+	for {
+		select {
+		case req := <-c.requestCh:
+			c.handleRequest(req)
+
+		case msg := <-c.messageCh:
+			c.handleMessage(msg)
+
+		case t := <-c.proposeCh:
+			if t.seq == c.seq {
+				c.proposeTimer = nil
+				c.propose()
+			}
+
+		case t := <-c.timeoutCh:
+			if t.seq == c.seq {
+				// The round didn't commit in time, request moving to the next one
+				round := c.round + 1
+				if c.changing >= round {
+					round = c.changing + 1
+				}
+				log.Debug("Consensus round timed out", "number", c.number, "round", c.round, "next", round)
+				c.sendRoundChange(round)
+				c.resetTimer(round)
+			}
+
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// local returns the address of the local validator.
+func (c *rounds) local() common.Address {
+	c.engine.lock.RLock()
+	defer c.engine.lock.RUnlock()
+
+	return c.engine.signer
+}
+
+// proposer returns the validator proposing the block in the given round.
+func (c *rounds) proposer(round uint64) common.Address {
+	return c.validators[(c.number+round)%uint64(len(c.validators))]
+}
+
+// isValidator returns whether the address is a validator of the current height.
+func (c *rounds) isValidator(address common.Address) bool {
+	for _, validator := range c.validators {
+		if validator == address {
+			return true
+		}
+	}
+	return false
+}
+
+// handleRequest takes a locally built block to propose, moving to its height if
+// the local chain advanced.
+func (c *rounds) handleRequest(req *request) {
+	number, parent := req.block.NumberU64(), req.block.ParentHash()
+	if number < c.number {
+		return
+	}
+	c.chain = req.chain
+	if number > c.number || parent != c.parent {
+		if err := c.startHeight(number, parent); err != nil {
+			log.Warn("Failed to start consensus height", "number", number, "err", err)
+			return
+		}
+	}
+	c.pending = req
+	if c.state == stateAcceptRequest && c.proposer(c.round) == c.local() {
+		c.propose()
+	}
+}
+
+// startHeight resets the rounds to agree on the block with the given number on
+// top of the given parent.
+func (c *rounds) startHeight(number uint64, parent common.Hash) error {
+	snap, err := c.engine.snapshot(c.chain, number-1, parent, nil)
+	if err != nil {
+		return err
+	}
+	c.number, c.parent = number, parent
+	c.validators = snap.validators()
+	c.pending, c.locked = nil, nil
+
+	c.prepares = make(map[uint64]map[common.Address]common.Hash)
+	c.commits = make(map[common.Hash]map[common.Address][]byte)
+	c.roundChanges = make(map[uint64]map[common.Address]struct{})
+	c.changing = 0
+
+	log.Debug("Starting consensus height", "number", number, "parent", parent, "validators", len(c.validators))
+	c.startRound(0)
+	return nil
+}
+
+// startRound resets the state of the rounds to the given one, proposing the
+// local block if it's the local validator's turn.
+func (c *rounds) startRound(round uint64) {
+	c.round = round
+	c.state = stateAcceptRequest
+	c.proposal, c.digest = nil, common.Hash{}
+	c.resetTimer(round)
+
+	// Replay the messages waiting for the round, and propose if our turn
+	c.processBacklog()
+	if c.state == stateAcceptRequest && c.proposer(round) == c.local() {
+		c.propose()
+	}
+}
+
+// stopTimers stops the round timers of the current round.
+func (c *rounds) stopTimers() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if c.proposeTimer != nil {
+		c.proposeTimer.Stop()
+		c.proposeTimer = nil
+	}
+}
+
+// resetTimer restarts the timer changing the round, doubling its timeout with
+// every round. The first round is also given the time until its block is due.
+func (c *rounds) resetTimer(round uint64) {
+	c.stopTimers()
+	c.seq++
+
+	backoff := round
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	timeout := time.Duration(c.engine.config.RequestTimeout) * time.Millisecond << backoff
+	if round == 0 {
+		if parent := c.chain.GetHeader(c.parent, c.number-1); parent != nil {
+			if delay := time.Until(time.Unix(int64(parent.Time+c.engine.config.Period), 0)); delay > 0 {
+				timeout += delay
+			}
+		}
+	}
+	t := tick{number: c.number, round: c.round, seq: c.seq}
+	c.timer = time.AfterFunc(timeout, func() {
+		select {
+		case c.timeoutCh <- t:
+		case <-c.quit:
+		}
+	})
+}
+
+// propose broadcasts the block of the local validator for the current round,
+// once its time comes. A block locked on in an earlier round takes precedence
+// over the locally built one.
+func (c *rounds) propose() {
+	if c.proposeTimer != nil {
+		return
+	}
+	block := c.locked
+	if block == nil {
+		if c.pending == nil || c.pending.block.NumberU64() != c.number {
+			return
+		}
+		block = c.pending.block
+	}
+	if delay := time.Until(time.Unix(int64(block.Time()), 0)); delay > 0 {
+		t := tick{number: c.number, round: c.round, seq: c.seq}
+		c.proposeTimer = time.AfterFunc(delay, func() {
+			select {
+			case c.proposeCh <- t:
+			case <-c.quit:
+			}
+		})
+		return
+	}
+	proposal, err := srlp.EncodeToBytes(block)
+	if err != nil {
+		log.Error("Failed to encode proposal", "number", c.number, "err", err)
+		return
+	}
+	log.Debug("Proposing block", "number", c.number, "round", c.round, "hash", proposalHash(block.Header()))
+	c.send(&message{Code: msgPropose, Proposal: proposal})
+}
+
+// send broadcasts a consensus message of the local validator for the current
+// height and handles it locally.
+func (c *rounds) send(msg *message) {
+	if !c.isValidator(c.local()) {
+		return
+	}
+	msg.Number = c.number
+	if msg.Code != msgRoundChange {
+		msg.Round = c.round
+	}
+	if err := c.engine.broadcast(msg); err != nil {
+		log.Warn("Failed to broadcast consensus message", "msg", msg, "err", err)
+		return
+	}
+	c.handleMessage(msg)
+}
+
+// handleMessage processes a consensus message, keeping the ones of future heights
+// and rounds for later.
+func (c *rounds) handleMessage(msg *message) {
+	c.syncHead()
+
+	switch {
+	case c.chain == nil || msg.Number < c.number:
+		return
+	case !c.isValidator(msg.sender):
+		log.Trace("Discarded message of non-validator", "msg", msg)
+		return
+	case msg.Number > c.number:
+		c.storeBacklog(msg)
+		return
+	case msg.Round > c.round+maxRoundLead:
+		return
+	}
+	switch msg.Code {
+	case msgPropose:
+		c.handlePropose(msg)
+	case msgPrepare:
+		c.handlePrepare(msg)
+	case msgCommit:
+		c.handleCommit(msg)
+	case msgRoundChange:
+		c.handleRoundChange(msg)
+	}
+}
+
+// syncHead moves the rounds to the height following the head of the local chain
+// if it advanced past the current one, so nodes not proposing any blocks follow
+// the agreement as well.
+func (c *rounds) syncHead() {
+	if c.chain == nil {
+		c.chain = c.engine.localChain()
+		if c.chain == nil {
+			return
+		}
+	}
+	head := c.chain.CurrentHeader()
+	if number := head.Number.Uint64() + 1; number > c.number {
+		if err := c.startHeight(number, head.Hash()); err != nil {
+			log.Warn("Failed to start consensus height", "number", number, "err", err)
+		}
+	}
+}
+
+// storeBacklog keeps a message of a future height or round, dropping the oldest
+// ones if too many are waiting.
+func (c *rounds) storeBacklog(msg *message) {
+	if len(c.backlog) >= maxBacklog {
+		c.backlog = c.backlog[1:]
+	}
+	c.backlog = append(c.backlog, msg)
+}
+
+// processBacklog handles the waiting messages of the current height and round,
+// dropping the ones of past heights.
+func (c *rounds) processBacklog() {
+	var (
+		ready   []*message
+		waiting []*message
+	)
+	for _, msg := range c.backlog {
+		switch {
+		case msg.Number < c.number:
+		case msg.Number > c.number || (msg.Code == msgPropose && msg.Round > c.round):
+			waiting = append(waiting, msg)
+		default:
+			ready = append(ready, msg)
+		}
+	}
+	c.backlog = waiting
+	for _, msg := range ready {
+		c.handleMessage(msg)
+	}
+}
+
+// handlePropose accepts the block proposed for the current round if it's valid
+// and compatible with the locked one, broadcasting a prepare for it.
+func (c *rounds) handlePropose(msg *message) {
+	switch {
+	case msg.Round > c.round:
+		c.storeBacklog(msg)
+		return
+	case msg.Round < c.round || c.state != stateAcceptRequest:
+		return
+	case msg.sender != c.proposer(c.round):
+		log.Debug("Discarded proposal of wrong proposer", "msg", msg)
+		return
+	}
+	block := new(types.Block)
+	if err := srlp.DecodeBytes(msg.Proposal, block); err != nil {
+		log.Debug("Discarded undecodable proposal", "msg", msg, "err", err)
+		return
+	}
+	digest := proposalHash(block.Header())
+	if c.locked != nil && digest != proposalHash(c.locked.Header()) {
+		log.Debug("Discarded proposal conflicting with locked block", "msg", msg, "hash", digest)
+		return
+	}
+	if err := c.verify(block); err != nil {
+		// Retry proposals from a proposer with a clock slightly ahead
+		if err == consensus.ErrFutureBlock {
+			time.AfterFunc(time.Until(time.Unix(int64(block.Time()), 0)), func() { c.post(msg) })
+			return
+		}
+		log.Debug("Discarded invalid proposal", "msg", msg, "err", err)
+		return
+	}
+	c.proposal, c.digest = block, digest
+	c.state = statePreprepared
+
+	c.send(&message{Code: msgPrepare, Digest: digest})
+	c.checkPrepared()
+	c.checkCommitted()
+}
+
+// verify checks that a proposed block extends the local chain and is valid,
+// executing it on top of the state of its parent.
+func (c *rounds) verify(block *types.Block) error {
+	header := block.Header()
+	if block.NumberU64() != c.number || header.ParentHash != c.parent {
+		return errInvalidProposal
+	}
+	if err := c.engine.verifyHeader(c.chain, header, nil, false); err != nil {
+		return err
+	}
+	if len(block.Uncles()) > 0 || types.DeriveSha(block.Transactions()) != header.TxHash {
+		return errInvalidProposal
+	}
+	chain, ok := c.chain.(processingChain)
+	if !ok {
+		return errUnverifiableProposal
+	}
+	if err := chain.Validator().ValidateBody(block); err != nil {
+		return err
+	}
+	parent := chain.GetBlock(header.ParentHash, c.number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	statedb, err := chain.StateAt(parent.Root())
+	if err != nil {
+		return err
+	}
+	receipts, _, usedGas, err := chain.Processor().Process(block, statedb, *chain.GetVMConfig())
+	if err != nil {
+		return err
+	}
+	return chain.Validator().ValidateState(block, parent, statedb, receipts, usedGas)
+}
+
+// handlePrepare records a prepare of a validator.
+func (c *rounds) handlePrepare(msg *message) {
+	if c.prepares[msg.Round] == nil {
+		c.prepares[msg.Round] = make(map[common.Address]common.Hash)
+	}
+	c.prepares[msg.Round][msg.sender] = msg.Digest
+
+	if msg.Round == c.round {
+		c.checkPrepared()
+	}
+}
+
+// checkPrepared locks on the accepted proposal once a quorum of validators
+// prepared it, broadcasting a commit with the local committed seal.
+func (c *rounds) checkPrepared() {
+	if c.state != statePreprepared {
+		return
+	}
+	prepares := 0
+	for _, digest := range c.prepares[c.round] {
+		if digest == c.digest {
+			prepares++
+		}
+	}
+	if prepares < quorum(len(c.validators)) {
+		return
+	}
+	c.state = statePrepared
+	c.locked = c.proposal
+
+	if !c.isValidator(c.local()) {
+		return
+	}
+	_, seal, err := c.engine.sign(commitHash(c.digest))
+	if err != nil {
+		log.Warn("Failed to sign committed seal", "number", c.number, "err", err)
+		return
+	}
+	c.send(&message{Code: msgCommit, Digest: c.digest, Seal: seal})
+}
+
+// handleCommit records the committed seal of a validator. Committed seals don't
+// depend on the round, so commits of earlier rounds count as well.
+func (c *rounds) handleCommit(msg *message) {
+	validator, err := recoverAddress(commitHash(msg.Digest).Bytes(), msg.Seal)
+	if err != nil || validator != msg.sender {
+		log.Debug("Discarded commit with invalid seal", "msg", msg)
+		return
+	}
+	if c.commits[msg.Digest] == nil {
+		c.commits[msg.Digest] = make(map[common.Address][]byte)
+	}
+	c.commits[msg.Digest][msg.sender] = msg.Seal
+
+	c.checkCommitted()
+}
+
+// checkCommitted finalises the accepted proposal once a quorum of validators
+// committed to it. The proposer of the round assembles the block with their
+// committed seals, the other validators wait for it.
+func (c *rounds) checkCommitted() {
+	if c.state != statePreprepared && c.state != statePrepared {
+		return
+	}
+	commits := c.commits[c.digest]
+	if len(commits) < quorum(len(c.validators)) {
+		return
+	}
+	c.state = stateCommitted
+	c.locked = c.proposal
+
+	log.Debug("Committed to block", "number", c.number, "round", c.round, "hash", c.digest)
+	if c.proposer(c.round) != c.local() {
+		return
+	}
+	// Aggregate the committed seals in validator order into the header
+	header := c.proposal.Header()
+	extra, err := decodeExtra(header)
+	if err != nil {
+		log.Error("Failed to decode committed block", "number", c.number, "err", err)
+		return
+	}
+	extra.CommittedSeals = nil
+	for _, validator := range c.validators {
+		if seal, ok := commits[validator]; ok {
+			extra.CommittedSeals = append(extra.CommittedSeals, seal)
+		}
+	}
+	header.Extra = extra.encode(header.Extra)
+	block := c.proposal.WithSeal(header)
+
+	// Return our own block to the miner, or import the one of an earlier round
+	if c.pending != nil && sigHash(c.pending.block.Header()) == sigHash(header) {
+		select {
+		case c.pending.results <- block:
+		default:
+			log.Warn("Sealing result is not read by miner", "sealhash", sigHash(header))
+		}
+		return
+	}
+	c.engine.enqueue(block)
+}
+
+// sendRoundChange broadcasts a request to move to the given round, unless one
+// was already sent for it.
+func (c *rounds) sendRoundChange(round uint64) {
+	if round <= c.changing {
+		return
+	}
+	c.changing = round
+	c.send(&message{Code: msgRoundChange, Round: round})
+}
+
+// handleRoundChange records the request of a validator to move to a round. The
+// local validator joins the request once enough validators made it that at
+// least one is honest, and moves to the round once a quorum made it.
+func (c *rounds) handleRoundChange(msg *message) {
+	if msg.Round <= c.round {
+		return
+	}
+	if c.roundChanges[msg.Round] == nil {
+		c.roundChanges[msg.Round] = make(map[common.Address]struct{})
+	}
+	c.roundChanges[msg.Round][msg.sender] = struct{}{}
+
+	changes := len(c.roundChanges[msg.Round])
+	if changes >= faulty(len(c.validators))+1 && c.changing < msg.Round {
+		c.sendRoundChange(msg.Round)
+	}
+	if changes >= quorum(len(c.validators)) && msg.Round > c.round {
+		log.Debug("Changing consensus round", "number", c.number, "round", msg.Round)
+		c.startRound(msg.Round)
+	}
+}
@@ -0,0 +1,406 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/susy-go/susy-graviton/accounts"
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/core"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/core/vm"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/log"
+	"github.com/susy-go/susy-graviton/node"
+	"github.com/susy-go/susy-graviton/p2p"
+	"github.com/susy-go/susy-graviton/p2p/enode"
+	"github.com/susy-go/susy-graviton/p2p/simulations"
+	"github.com/susy-go/susy-graviton/p2p/simulations/adapters"
+	"github.com/susy-go/susy-graviton/params"
+	"github.com/susy-go/susy-graviton/rpc"
+	"github.com/susy-go/susy-graviton/sofdb"
+	"github.com/susy-go/susy-graviton/srlp"
+)
+
+// Message codes of the test protocol carrying the consensus between the nodes.
+const (
+	testConsensusMsg = 0x00
+	testBlockMsg     = 0x01
+)
+
+// testPacket is a message queued for sending to a peer.
+type testPacket struct {
+	code uint64
+	data interface{}
+}
+
+// testNode is a simulated validator mining on top of its own chain, exchanging
+// the consensus messages and the committed blocks with its peers.
+type testNode struct {
+	engine *BFT
+	chain  *core.BlockChain
+
+	peers map[enode.ID]chan testPacket // Send queues of the connected peers
+	lock  sync.Mutex
+	quit  chan struct{}
+}
+
+func newTestNode(key *ecdsa.PrivateKey, genesis *core.Genesis) (*testNode, error) {
+	db := sofdb.NewMemDatabase()
+	genesis.MustCommit(db)
+
+	engine := New(genesis.Config.BFT, db)
+	engine.Authorize(crypto.PubkeyToAddress(key.PublicKey), func(account accounts.Account, hash []byte) ([]byte, error) {
+		return crypto.Sign(hash, key)
+	})
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	n := &testNode{
+		engine: engine,
+		chain:  chain,
+		peers:  make(map[enode.ID]chan testPacket),
+		quit:   make(chan struct{}),
+	}
+	engine.SetBroadcaster(chain, n)
+	return n, nil
+}
+
+func (n *testNode) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{Name: "bft", Version: 1, Length: 2, Run: n.run}}
+}
+
+func (n *testNode) APIs() []rpc.API { return nil }
+
+func (n *testNode) Start(server *p2p.Server) error {
+	go n.mine()
+	return nil
+}
+
+func (n *testNode) Stop() error {
+	close(n.quit)
+	n.engine.Close()
+	n.chain.Stop()
+	return nil
+}
+
+// run handles the messages of a peer, sending it the queued ones asynchronously.
+func (n *testNode) run(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	queue := make(chan testPacket, 256)
+
+	n.lock.Lock()
+	n.peers[p.ID()] = queue
+	n.lock.Unlock()
+
+	done := make(chan struct{})
+	defer func() {
+		n.lock.Lock()
+		delete(n.peers, p.ID())
+		n.lock.Unlock()
+		close(done)
+	}()
+	go func() {
+		for {
+			select {
+			case packet := <-queue:
+				if err := p2p.Send(rw, packet.code, packet.data); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		switch msg.Code {
+		case testConsensusMsg:
+			var payload []byte
+			if err := msg.Decode(&payload); err != nil {
+				return err
+			}
+			relay, err := n.engine.HandleMsg(payload)
+			if err != nil {
+				return err
+			}
+			if relay {
+				n.BroadcastConsensus(payload)
+			}
+		case testBlockMsg:
+			block := new(types.Block)
+			if err := msg.Decode(block); err != nil {
+				return err
+			}
+			n.insert(block)
+		}
+		msg.Discard()
+	}
+}
+
+// broadcast queues a message to all the peers.
+func (n *testNode) broadcast(code uint64, data interface{}) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, queue := range n.peers {
+		select {
+		case queue <- testPacket{code: code, data: data}:
+		default:
+		}
+	}
+}
+
+// BroadcastConsensus implements consensus.Broadcaster.
+func (n *testNode) BroadcastConsensus(payload []byte) {
+	n.broadcast(testConsensusMsg, payload)
+}
+
+// EnqueueBlock implements consensus.Broadcaster.
+func (n *testNode) EnqueueBlock(block *types.Block) {
+	go n.insert(block)
+}
+
+// insert imports a block into the chain, propagating it if new.
+func (n *testNode) insert(block *types.Block) {
+	if n.chain.HasBlock(block.Hash(), block.NumberU64()) {
+		return
+	}
+	if _, err := n.chain.InsertChain(types.Blocks{block}); err != nil {
+		log.Debug("Failed to import block", "number", block.Number(), "err", err)
+		return
+	}
+	n.broadcast(testBlockMsg, block)
+}
+
+// mine seals an empty block on top of every new head, importing the ones sealed.
+func (n *testNode) mine() {
+	heads := make(chan core.ChainHeadEvent, 16)
+	sub := n.chain.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	results := make(chan *types.Block, 1)
+	n.seal(n.chain.CurrentBlock(), results)
+	for {
+		select {
+		case head := <-heads:
+			n.seal(head.Block, results)
+		case block := <-results:
+			n.insert(block)
+		case <-n.quit:
+			return
+		}
+	}
+}
+
+// seal builds an empty block on top of the parent and hands it to the engine.
+func (n *testNode) seal(parent *types.Block, results chan *types.Block) {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+	}
+	if err := n.engine.Prepare(n.chain, header); err != nil {
+		log.Error("Failed to prepare block", "err", err)
+		return
+	}
+	statedb, err := n.chain.StateAt(parent.Root())
+	if err != nil {
+		log.Error("Failed to retrieve parent state", "err", err)
+		return
+	}
+	block, _ := n.engine.Finalize(n.chain, header, statedb, nil, nil, nil)
+	if err := n.engine.Seal(n.chain, block, results, nil); err != nil {
+		log.Error("Failed to seal block", "err", err)
+	}
+}
+
+// Tests that a network of validators agrees on a common chain of finalised blocks.
+func TestSimulation(t *testing.T) { testSimulation(t, 4, 4) }
+
+// Tests that a network of validators with a faulty one keeps agreeing on blocks,
+// changing the rounds in which the faulty one is the proposer.
+func TestSimulationRoundChange(t *testing.T) { testSimulation(t, 4, 3) }
+
+func testSimulation(t *testing.T, validators int, online int) {
+	// Create the validator keys and a genesis block listing them
+	confs := make([]*adapters.NodeConfig, validators)
+	addresses := make([]common.Address, validators)
+	for i := range confs {
+		confs[i] = adapters.RandomNodeConfig()
+		addresses[i] = crypto.PubkeyToAddress(confs[i].PrivateKey.PublicKey)
+	}
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = nil
+	config.BFT = &params.BFTConfig{Epoch: 30000, RequestTimeout: 500}
+
+	genesis := &core.Genesis{
+		Config:     &config,
+		ExtraData:  GenesisExtra(addresses),
+		GasLimit:   params.GenesisGasLimit,
+		Difficulty: big.NewInt(1),
+		Mixhash:    bftDigest,
+	}
+	// Start the online validators in a simulated network
+	adapter := adapters.NewSimAdapter(adapters.Services{
+		"bft": func(ctx *adapters.ServiceContext) (node.Service, error) {
+			return newTestNode(ctx.Config.PrivateKey, genesis)
+		},
+	})
+	net := simulations.NewNetwork(adapter, &simulations.NetworkConfig{DefaultService: "bft"})
+	defer net.Shutdown()
+
+	for _, conf := range confs {
+		if _, err := net.NewNodeWithConfig(conf); err != nil {
+			t.Fatalf("failed to create node: %v", err)
+		}
+	}
+	ids := make([]enode.ID, online)
+	for i := range ids {
+		ids[i] = confs[i].ID
+		if err := net.Start(ids[i]); err != nil {
+			t.Fatalf("failed to start node: %v", err)
+		}
+	}
+	nodeOf := func(id enode.ID) *testNode {
+		node, _ := adapter.GetNode(id)
+		return node.Service("bft").(*testNode)
+	}
+	// Connect the validators and wait until every one proposed twice
+	target := uint64(2 * validators)
+
+	action := func(ctx context.Context) error {
+		for i, id := range ids {
+			for _, other := range ids[i+1:] {
+				if err := net.Connect(id, other); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	trigger := make(chan enode.ID)
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			for _, id := range ids {
+				select {
+				case trigger <- id:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	check := func(ctx context.Context, id enode.ID) (bool, error) {
+		return nodeOf(id).chain.CurrentBlock().NumberU64() >= target, nil
+	}
+	result := simulations.NewSimulation(net).Run(ctx, &simulations.Step{
+		Action:  action,
+		Trigger: trigger,
+		Expect:  &simulations.Expectation{Nodes: ids, Check: check},
+	})
+	if result.Error != nil {
+		t.Fatalf("simulation failed: %v", result.Error)
+	}
+	// Ensure all validators agreed on the same blocks, each committed by a quorum
+	reference := nodeOf(ids[0]).chain
+	for number := uint64(1); number <= target; number++ {
+		header := reference.GetHeaderByNumber(number)
+
+		extra, err := decodeExtra(header)
+		if err != nil {
+			t.Fatalf("block %d: failed to decode extra-data: %v", number, err)
+		}
+		if have, want := len(extra.CommittedSeals), quorum(validators); have < want {
+			t.Errorf("block %d: committed seals mismatch: have %d, want at least %d", number, have, want)
+		}
+		for _, id := range ids[1:] {
+			if hash := nodeOf(id).chain.GetHeaderByNumber(number).Hash(); hash != header.Hash() {
+				t.Errorf("block %d: hash mismatch: have %x, want %x", number, hash, header.Hash())
+			}
+		}
+	}
+}
+
+// Tests that only the consensus messages of validators for the heights following
+// the local head are accepted and relayed.
+func TestHandleMsgFilter(t *testing.T) {
+	validator, _ := crypto.GenerateKey()
+	outsider, _ := crypto.GenerateKey()
+
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = nil
+	config.BFT = &params.BFTConfig{Epoch: 30000, RequestTimeout: 500}
+
+	genesis := &core.Genesis{
+		Config:     &config,
+		ExtraData:  GenesisExtra([]common.Address{crypto.PubkeyToAddress(validator.PublicKey)}),
+		GasLimit:   params.GenesisGasLimit,
+		Difficulty: big.NewInt(1),
+		Mixhash:    bftDigest,
+	}
+	n, err := newTestNode(validator, genesis)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	defer n.Stop()
+
+	tests := []struct {
+		key    *ecdsa.PrivateKey
+		number uint64
+		relay  bool
+	}{
+		{validator, 1, true},
+		{validator, maxHeightLead, true},
+		{validator, 0, false},
+		{validator, maxHeightLead + 1, false},
+		{outsider, 1, false},
+	}
+	for i, tt := range tests {
+		msg := &message{Code: msgRoundChange, Number: tt.number, Round: 1}
+		msg.Signature, _ = crypto.Sign(msg.sigHash().Bytes(), tt.key)
+
+		payload, _ := srlp.EncodeToBytes(msg)
+		relay, err := n.engine.HandleMsg(payload)
+		if err != nil {
+			t.Fatalf("test %d: failed to handle message: %v", i, err)
+		}
+		if relay != tt.relay {
+			t.Errorf("test %d: relay mismatch: have %v, want %v", i, relay, tt.relay)
+		}
+	}
+}
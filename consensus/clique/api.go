@@ -30,19 +30,32 @@ type API struct {
 	clique *Clique
 }
 
-// GetSnapshot retrieves the state snapshot at a given block.
-func (api *API) GetSnapshot(number *rpc.BlockNumber) (*Snapshot, error) {
-	// Retrieve the requested block number (or current if none requested)
+// header retrieves the requested header, or the current one if none requested.
+func (api *API) header(number *rpc.BlockNumber) (*types.Header, error) {
 	var header *types.Header
-	if number == nil || *number == rpc.LatestBlockNumber {
+	switch {
+	case number == nil || *number == rpc.LatestBlockNumber:
 		header = api.chain.CurrentHeader()
-	} else {
+	case *number == rpc.FinalizedBlockNumber:
+		header = api.clique.FinalizedHeader(api.chain, api.chain.CurrentHeader())
+	case *number == rpc.SafeBlockNumber:
+		header = api.clique.SafeHeader(api.chain, api.chain.CurrentHeader())
+	default:
 		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
 	}
-	// Ensure we have an actually valid block and return its snapshot
 	if header == nil {
 		return nil, errUnknownBlock
 	}
+	return header, nil
+}
+
+// GetSnapshot retrieves the state snapshot at a given block.
+func (api *API) GetSnapshot(number *rpc.BlockNumber) (*Snapshot, error) {
+	// Retrieve the requested block number (or current if none requested)
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
 	return api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
 }
 
@@ -58,15 +71,9 @@ func (api *API) GetSnapshotAtHash(hash common.Hash) (*Snapshot, error) {
 // GetSigners retrieves the list of authorized signers at the specified block.
 func (api *API) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
 	// Retrieve the requested block number (or current if none requested)
-	var header *types.Header
-	if number == nil || *number == rpc.LatestBlockNumber {
-		header = api.chain.CurrentHeader()
-	} else {
-		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
-	}
-	// Ensure we have an actually valid block and return the signers from its snapshot
-	if header == nil {
-		return nil, errUnknownBlock
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
 	}
 	snap, err := api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
 	if err != nil {
@@ -101,7 +108,7 @@ func (api *API) Proposals() map[common.Address]bool {
 }
 
 // Propose injects a new authorization proposal that the signer will attempt to
-// push through.
+// push through. Proposals are ignored if the signers are governed by a contract.
 func (api *API) Propose(address common.Address, auth bool) {
 	api.clique.lock.Lock()
 	defer api.clique.lock.Unlock()
@@ -107,6 +107,10 @@ var (
 	// list of signers different than the one the local node calculated.
 	errMismatchingCheckpointSigners = errors.New("mismatching signer list on checkpoint block")
 
+	// errGovernanceVote is returned if a block casts a header vote while the
+	// signers are governed by a contract.
+	errGovernanceVote = errors.New("header vote with signer governance")
+
 	// errInvalidMixDigest is returned if a block's mix digest is non-zero.
 	errInvalidMixDigest = errors.New("non-zero mix digest")
 
@@ -209,7 +213,9 @@ type Clique struct {
 
 	signer common.Address // Sophon address of the signing key
 	signFn SignerFn       // Signer function to authorize hashes with
-	lock   sync.RWMutex   // Protects the signer fields
+	lock   sync.RWMutex   // Protects the signer and state fields
+
+	stateFn StateFn // State accessor to read the governance contract with
 
 	// The fields below are for testing only
 	fakeDiff bool // Skip difficulty verifications
@@ -294,6 +300,10 @@ func (c *Clique) verifyHeader(chain consensus.ChainReader, header *types.Header,
 	if checkpoint && !bytes.Equal(header.Nonce[:], nonceDropVote) {
 		return errInvalidCheckpointVote
 	}
+	// Header votes are meaningless if the signers are governed by a contract
+	if c.config.Governance != nil && (header.Coinbase != (common.Address{}) || !bytes.Equal(header.Nonce[:], nonceDropVote)) {
+		return errGovernanceVote
+	}
 	// Check that the extra-data contains both the vanity and signature
 	if len(header.Extra) < extraVanity {
 		return errMissingVanity
@@ -360,7 +370,11 @@ func (c *Clique) verifyCascadingFields(chain consensus.ChainReader, header *type
 		return err
 	}
 	// If the block is a checkpoint block, verify the signer list
-	if number%c.config.Epoch == 0 {
+	if number%c.config.Epoch == 0 && c.config.Governance != nil {
+		if err := c.verifyGovernance(chain, header, true); err != nil {
+			return err
+		}
+	} else if number%c.config.Epoch == 0 {
 		signers := make([]byte, len(snap.Signers)*common.AddressLength)
 		for i, signer := range snap.signers() {
 			copy(signers[i*common.AddressLength:], signer[:])
@@ -401,11 +415,7 @@ func (c *Clique) snapshot(chain consensus.ChainReader, number uint64, hash commo
 			if checkpoint != nil {
 				hash := checkpoint.Hash()
 
-				signers := make([]common.Address, (len(checkpoint.Extra)-extraVanity-extraSeal)/common.AddressLength)
-				for i := 0; i < len(signers); i++ {
-					copy(signers[i][:], checkpoint.Extra[extraVanity+i*common.AddressLength:])
-				}
-				snap = newSnapshot(c.config, c.signatures, number, hash, signers)
+				snap = newSnapshot(c.config, c.signatures, number, hash, checkpointSigners(checkpoint))
 				if err := snap.store(c.db); err != nil {
 					return nil, err
 				}
@@ -436,7 +446,13 @@ func (c *Clique) snapshot(chain consensus.ChainReader, number uint64, hash commo
 	for i := 0; i < len(headers)/2; i++ {
 		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
 	}
-	snap, err := snap.apply(headers)
+	var governance governanceFn
+	if c.config.Governance != nil {
+		governance = func(header *types.Header) ([]common.Address, error) {
+			return c.governanceSigners(chain, header)
+		}
+	}
+	snap, err := snap.apply(headers, governance)
 	if err != nil {
 		return nil, err
 	}
@@ -525,7 +541,7 @@ func (c *Clique) Prepare(chain consensus.ChainReader, header *types.Header) erro
 	if err != nil {
 		return err
 	}
-	if number%c.config.Epoch != 0 {
+	if number%c.config.Epoch != 0 && c.config.Governance == nil {
 		c.lock.RLock()
 
 		// Gather all the proposals that make sense voting on
@@ -556,7 +572,13 @@ func (c *Clique) Prepare(chain consensus.ChainReader, header *types.Header) erro
 	header.Extra = header.Extra[:extraVanity]
 
 	if number%c.config.Epoch == 0 {
-		for _, signer := range snap.signers() {
+		signers := snap.signers()
+		if c.config.Governance != nil {
+			if signers, err = c.governanceSigners(chain, header); err != nil {
+				return err
+			}
+		}
+		for _, signer := range signers {
 			header.Extra = append(header.Extra, signer[:]...)
 		}
 	}
@@ -580,6 +602,13 @@ func (c *Clique) Prepare(chain consensus.ChainReader, header *types.Header) erro
 // Finalize implements consensus.Engine, ensuring no uncles are set, nor block
 // rewards given, and returns the final block.
 func (c *Clique) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	// Checkpoint signers must match the governance contract, if any. The state of
+	// the parent is available by now, so the check can't be deferred anymore.
+	if header.Number.Uint64()%c.config.Epoch == 0 && c.config.Governance != nil {
+		if err := c.verifyGovernance(chain, header, false); err != nil {
+			return nil, err
+		}
+	}
 	// No block rewards in PoA, so the state remains as is and uncles are dropped
 	header.Root = state.IntermediateRoot(chain.Config().IsSIP158(header.Number))
 	header.UncleHash = types.CalcUncleHash(nil)
@@ -696,6 +725,33 @@ func (c *Clique) SealHash(header *types.Header) common.Hash {
 	return sigHash(header)
 }
 
+// FinalizedHeader implements consensus.Finality. Clique offers no absolute
+// finality, so a block is deemed final once as many blocks as there are signers
+// have been sealed on top of it.
+func (c *Clique) FinalizedHeader(chain consensus.ChainReader, head *types.Header) *types.Header {
+	return c.confirmedHeader(chain, head, func(signers int) uint64 { return uint64(signers) })
+}
+
+// SafeHeader implements consensus.Finality, returning the most recent block
+// which a majority of the signers has sealed, either itself or a descendant.
+func (c *Clique) SafeHeader(chain consensus.ChainReader, head *types.Header) *types.Header {
+	return c.confirmedHeader(chain, head, func(signers int) uint64 { return uint64(signers / 2) })
+}
+
+// confirmedHeader retrieves the ancestor of the head as many blocks deep as the
+// given function requires for the number of signers authorized at the head.
+func (c *Clique) confirmedHeader(chain consensus.ChainReader, head *types.Header, depth func(signers int) uint64) *types.Header {
+	snap, err := c.snapshot(chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		return nil
+	}
+	confirms := depth(len(snap.Signers))
+	if head.Number.Uint64() < confirms {
+		return nil
+	}
+	return chain.GetHeaderByNumber(head.Number.Uint64() - confirms)
+}
+
 // Close implements consensus.Engine. It's a noop for clique as there are no background threads.
 func (c *Clique) Close() error {
 	return nil
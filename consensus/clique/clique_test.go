@@ -0,0 +1,108 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/core"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/core/vm"
+	"github.com/susy-go/susy-graviton/params"
+	"github.com/susy-go/susy-graviton/sofdb"
+)
+
+// Tests that the finalized and safe blocks trail the head by as many blocks as
+// there are signers and by half of them respectively.
+func TestFinality(t *testing.T) {
+	accounts := newTesterAccountPool()
+	names := []string{"A", "B", "C", "D"}
+
+	signers := make([]common.Address, len(names))
+	for i, name := range names {
+		signers[i] = accounts.address(name)
+	}
+	sort.Sort(signersAscending(signers))
+
+	genesis := &core.Genesis{
+		ExtraData: make([]byte, extraVanity+common.AddressLength*len(signers)+extraSeal),
+	}
+	for i, signer := range signers {
+		copy(genesis.ExtraData[extraVanity+i*common.AddressLength:], signer[:])
+	}
+	db := sofdb.NewMemDatabase()
+	genesis.Commit(db)
+
+	config := *params.TestChainConfig
+	config.Clique = &params.CliqueConfig{Period: 1, Epoch: 30000}
+
+	engine := New(config.Clique, db)
+	engine.fakeDiff = true
+
+	// Seal a chain of blocks by the signers in turn
+	blocks, _ := core.GenerateChain(&config, genesis.ToBlock(db), engine, db, 10, nil)
+	for i, block := range blocks {
+		header := block.Header()
+		if i > 0 {
+			header.ParentHash = blocks[i-1].Hash()
+		}
+		header.Extra = make([]byte, extraVanity+extraSeal)
+		header.Difficulty = diffInTurn
+
+		accounts.sign(header, names[i%len(names)])
+		blocks[i] = block.WithSeal(header)
+	}
+	chain, err := core.NewBlockChain(db, nil, &config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create test chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Nothing is final until enough blocks are sealed on top of the genesis
+	if header := chain.CurrentFinalizedHeader(); header != nil {
+		t.Errorf("finalized header mismatch on genesis: have #%d, want none", header.Number)
+	}
+	finalized := make(chan core.ChainFinalizedEvent, len(blocks))
+	sub := chain.SubscribeChainFinalizedEvent(finalized)
+	defer sub.Unsubscribe()
+
+	for i, block := range blocks {
+		if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+			t.Fatalf("block %d: failed to import: %v", i, err)
+		}
+	}
+	head := blocks[len(blocks)-1].NumberU64()
+	if header := chain.CurrentFinalizedHeader(); header == nil || header.Number.Uint64() != head-uint64(len(signers)) {
+		t.Errorf("finalized header mismatch: have %v, want #%d", header, head-uint64(len(signers)))
+	}
+	if header := chain.CurrentSafeHeader(); header == nil || header.Number.Uint64() != head-uint64(len(signers)/2) {
+		t.Errorf("safe header mismatch: have %v, want #%d", header, head-uint64(len(signers)/2))
+	}
+	// Every block past the depth of the signers should have been announced final once
+	for number := uint64(0); number <= head-uint64(len(signers)); number++ {
+		if ev := <-finalized; ev.Header.Number.Uint64() != number {
+			t.Errorf("finalized event mismatch: have #%d, want #%d", ev.Header.Number.Uint64(), number)
+		}
+	}
+	select {
+	case ev := <-finalized:
+		t.Errorf("unexpected finalized event: #%d", ev.Header.Number.Uint64())
+	default:
+	}
+}
@@ -0,0 +1,76 @@
+pragma solidity ^0.5.0;
+
+/// @title Signer governance for the clique consensus engine
+/// @notice Keeps the signers authorized to seal blocks along with their voting
+/// weights. The consensus engine reads the first four fields directly from the
+/// storage, so their layout must not change. The binding and the runtime code
+/// embedded into the genesis are generated from this source with go generate in
+/// the clique package, see gencode.go. Until then, the runtime code is assembled
+/// by hand in governance.go to behave exactly as this source.
+contract Governance {
+    address[] signers;                  // slot 0
+    mapping(address => uint256) weight; // slot 1
+    uint256 total;                      // slot 2, sum of all the weights
+    uint256 generation;                 // slot 3, bumped on every change
+
+    event Voted(address indexed voter, address indexed signer, uint256 weight);
+    event Changed(address indexed signer, uint256 weight);
+
+    /// @notice Casts the weight of the calling signer for setting the weight of
+    /// an account, zero meaning removal. Once the proposal gathers more than half
+    /// of the total weight, it is applied and all outstanding votes are
+    /// invalidated.
+    function vote(address signer, uint256 newWeight) external {
+        uint256 voterWeight = weight[msg.sender];
+        require(voterWeight != 0);
+
+        // Mark the proposal voted by the signer, rejecting repeated votes
+        bytes32 proposal = keccak256(abi.encode(signer, newWeight, generation));
+        bytes32 voteSlot = keccak256(abi.encode(proposal, msg.sender));
+        bytes32 tallySlot = keccak256(abi.encode(proposal));
+
+        uint256 voted;
+        assembly { voted := sload(voteSlot) }
+        require(voted == 0);
+
+        // Add the weight of the signer to the tally of the proposal
+        uint256 tally;
+        assembly {
+            sstore(voteSlot, 1)
+            tally := add(sload(tallySlot), voterWeight)
+            sstore(tallySlot, tally)
+        }
+        emit Voted(msg.sender, signer, newWeight);
+
+        // Apply the proposal if it gathered the majority of the weights
+        if (tally * 2 <= total) {
+            return;
+        }
+        uint256 old = weight[signer];
+        uint256 newTotal = total - old + newWeight;
+        require(newTotal != 0); // never remove the last signer
+
+        total = newTotal;
+        weight[signer] = newWeight;
+        generation++;
+        emit Changed(signer, newWeight);
+
+        // Update the list of signers if the account joined or left
+        if (old == 0) {
+            if (newWeight != 0) {
+                signers.push(signer);
+            }
+            return;
+        }
+        if (newWeight != 0) {
+            return;
+        }
+        for (uint256 i = 0; i < signers.length; i++) {
+            if (signers[i] == signer) {
+                signers[i] = signers[signers.length - 1];
+                signers.length--;
+                return;
+            }
+        }
+    }
+}
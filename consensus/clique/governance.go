@@ -0,0 +1,508 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+//go:generate abigen --sol contract/governance.sol --pkg contract --out contract/governance.go
+//go:generate go run ./gencode.go
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/consensus"
+	"github.com/susy-go/susy-graviton/core/state"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/core/vm"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/log"
+)
+
+// The governance contract keeps the authorized signers and their voting weights
+// in the following storage layout, mirroring that of the Solidity contract in
+// contract/governance.sol, so the consensus engine can read them without execution:
+//
+//	address[] signers;                  // slot 0
+//	mapping(address => uint256) weight; // slot 1
+//	uint256 total;                      // slot 2, sum of all the weights
+//	uint256 generation;                 // slot 3, bumped on every change
+//
+// Its single method vote(address signer, uint256 weight) casts the weight of
+// the calling signer for setting the weight of the given account, zero meaning
+// removal. Once the proposal gathers more than half of the total weight, it is
+// applied and all outstanding votes are invalidated. Votes are logged with the
+// Voted(address indexed voter, address indexed signer, uint256 weight) event,
+// changes with Changed(address indexed signer, uint256 weight).
+var (
+	governanceSignersSlot    = common.Hash{}
+	governanceWeightsSlot    = common.BigToHash(big.NewInt(1))
+	governanceTotalSlot      = common.BigToHash(big.NewInt(2))
+	governanceGenerationSlot = common.BigToHash(big.NewInt(3))
+
+	// governanceSignersBase is the storage slot of the first signer
+	governanceSignersBase = crypto.Keccak256Hash(governanceSignersSlot[:])
+
+	// GovernanceVoteSelector is the method selector of vote(address,uint256).
+	GovernanceVoteSelector = crypto.Keccak256([]byte("vote(address,uint256)"))[:4]
+
+	// GovernanceVotedTopic is the topic of the event logged for each vote.
+	GovernanceVotedTopic = crypto.Keccak256Hash([]byte("Voted(address,address,uint256)"))
+
+	// GovernanceChangedTopic is the topic of the event logged for each change.
+	GovernanceChangedTopic = crypto.Keccak256Hash([]byte("Changed(address,uint256)"))
+)
+
+// GovernanceABI is the JSON ABI of the signer governance contract.
+const GovernanceABI = `[{"constant":false,"inputs":[{"name":"signer","type":"address"},{"name":"newWeight","type":"uint256"}],"name":"vote","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},{"anonymous":false,"inputs":[{"indexed":true,"name":"voter","type":"address"},{"indexed":true,"name":"signer","type":"address"},{"indexed":false,"name":"weight","type":"uint256"}],"name":"Voted","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"signer","type":"address"},{"indexed":false,"name":"weight","type":"uint256"}],"name":"Changed","type":"event"}]`
+
+// errGovernanceUnavailable is returned if the state needed to read the signers
+// from the governance contract is not available locally.
+var errGovernanceUnavailable = errors.New("governance state unavailable")
+
+// StateFn retrieves the state belonging to a state root.
+type StateFn func(root common.Hash) (*state.StateDB, error)
+
+// governanceFn retrieves the signers registered in the governance contract at
+// the state a header is built on.
+type governanceFn func(header *types.Header) ([]common.Address, error)
+
+// governanceWeightSlot returns the storage slot of the weight of a signer.
+func governanceWeightSlot(signer common.Address) common.Hash {
+	return crypto.Keccak256Hash(common.BytesToHash(signer[:]).Bytes(), governanceWeightsSlot[:])
+}
+
+// governanceSignerSlot returns the storage slot of the signer at an index.
+func governanceSignerSlot(index uint64) common.Hash {
+	slot := new(big.Int).SetBytes(governanceSignersBase[:])
+	return common.BigToHash(slot.Add(slot, new(big.Int).SetUint64(index)))
+}
+
+// GovernanceCode returns the runtime code of the signer governance contract.
+func GovernanceCode() []byte {
+	return common.CopyBytes(governanceCode)
+}
+
+// GovernanceStorage returns the storage of a governance contract authorizing
+// the given signers with the given voting weights, for embedding into genesis.
+func GovernanceStorage(signers []common.Address, weights []uint64) map[common.Hash]common.Hash {
+	storage := make(map[common.Hash]common.Hash)
+
+	total := new(big.Int)
+	for i, signer := range signers {
+		storage[governanceSignerSlot(uint64(i))] = common.BytesToHash(signer[:])
+		storage[governanceWeightSlot(signer)] = common.BigToHash(new(big.Int).SetUint64(weights[i]))
+		total.Add(total, new(big.Int).SetUint64(weights[i]))
+	}
+	storage[governanceSignersSlot] = common.BigToHash(big.NewInt(int64(len(signers))))
+	storage[governanceTotalSlot] = common.BigToHash(total)
+	return storage
+}
+
+// readGovernanceSigners retrieves the signers registered in the governance
+// contract, in ascending order.
+func readGovernanceSigners(statedb *state.StateDB, contract common.Address) []common.Address {
+	count := statedb.GetState(contract, governanceSignersSlot).Big().Uint64()
+
+	signers := make([]common.Address, count)
+	for i := uint64(0); i < count; i++ {
+		signers[i] = common.BytesToAddress(statedb.GetState(contract, governanceSignerSlot(i)).Bytes())
+	}
+	sort.Sort(signersAscending(signers))
+	return signers
+}
+
+// SetStateFn injects the state accessor used to read the signers from the
+// governance contract. Without it, checkpoint signer lists are only checked
+// against the snapshots derived from previous checkpoints.
+func (c *Clique) SetStateFn(stateFn StateFn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.stateFn = stateFn
+}
+
+// governanceSigners retrieves the signers registered in the governance contract
+// at the state the given header is built on.
+func (c *Clique) governanceSigners(chain consensus.ChainReader, header *types.Header) ([]common.Address, error) {
+	c.lock.RLock()
+	stateFn := c.stateFn
+	c.lock.RUnlock()
+
+	if stateFn == nil {
+		return nil, errGovernanceUnavailable
+	}
+	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return nil, errGovernanceUnavailable
+	}
+	statedb, err := stateFn(parent.Root)
+	if err != nil {
+		return nil, errGovernanceUnavailable
+	}
+	return readGovernanceSigners(statedb, *c.config.Governance), nil
+}
+
+// verifyGovernance checks that the signer list of a checkpoint header matches
+// the governance contract.
+//
+// Headers are verified ahead of the processing of their parents, whose state is
+// then not available yet. If deferrable, the check is left to Finalize in that
+// case, which does require the state once the block is processed.
+func (c *Clique) verifyGovernance(chain consensus.ChainReader, header *types.Header, deferrable bool) error {
+	signers, err := c.governanceSigners(chain, header)
+	if err == errGovernanceUnavailable && deferrable {
+		log.Trace("Deferring governance checkpoint verification", "number", header.Number, "hash", header.Hash())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return checkSigners(header, signers)
+}
+
+// checkpointSigners extracts the signer list of a checkpoint header.
+func checkpointSigners(header *types.Header) []common.Address {
+	signers := make([]common.Address, (len(header.Extra)-extraVanity-extraSeal)/common.AddressLength)
+	for i := 0; i < len(signers); i++ {
+		copy(signers[i][:], header.Extra[extraVanity+i*common.AddressLength:])
+	}
+	return signers
+}
+
+// checkSigners verifies the signer list of a checkpoint header.
+func checkSigners(header *types.Header, signers []common.Address) error {
+	have := checkpointSigners(header)
+	if len(have) != len(signers) {
+		return errMismatchingCheckpointSigners
+	}
+	for i := range have {
+		if have[i] != signers[i] {
+			return errMismatchingCheckpointSigners
+		}
+	}
+	return nil
+}
+
+// governanceCode is the runtime code of the signer governance contract, assembled
+// by hand to behave exactly as the Solidity source in contract/governance.sol.
+//
+// TODO: replace it with contract.GovernanceDeployedCode, generated from the source
+// by go generate, which requires solc.
+var governanceCode = assembleGovernance()
+
+// Memory locations of the local variables of the governance contract.
+const (
+	memTarget = 0x80 + iota*0x20
+	memWeight
+	memVoter
+	memGeneration
+	memTally
+	memOld
+	memCount
+)
+
+// assembleGovernance assembles the runtime code of the governance contract.
+func assembleGovernance() []byte {
+	a := newAssembler()
+
+	// Reject anything but value-less vote(address,uint256) calls
+	a.push(0x44)
+	a.op(vm.CALLDATASIZE, vm.LT)
+	a.jumpi("revert")
+	a.op(vm.CALLVALUE)
+	a.jumpi("revert")
+	a.pushBytes(new(big.Int).Lsh(big.NewInt(1), 224).Bytes())
+	a.push(0)
+	a.op(vm.CALLDATALOAD, vm.DIV)
+	a.pushBytes(GovernanceVoteSelector)
+	a.op(vm.EQ, vm.ISZERO)
+	a.jumpi("revert")
+
+	// Load the arguments and the weight of the voter, which must be a signer
+	a.pushBytes(bytes.Repeat([]byte{0xff}, common.AddressLength))
+	a.push(4)
+	a.op(vm.CALLDATALOAD, vm.AND)
+	a.set(memTarget)
+	a.push(0x24)
+	a.op(vm.CALLDATALOAD)
+	a.set(memWeight)
+	a.op(vm.CALLER)
+	a.weightSlot()
+	a.op(vm.SLOAD, vm.DUP1)
+	a.set(memVoter)
+	a.op(vm.ISZERO)
+	a.jumpi("revert")
+	a.pushBytes(governanceGenerationSlot[:])
+	a.op(vm.SLOAD)
+	a.set(memGeneration)
+
+	// Mark the proposal voted by the signer, rejecting repeated votes
+	a.get(memTarget)
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.get(memWeight)
+	a.push(0x20)
+	a.op(vm.MSTORE)
+	a.get(memGeneration)
+	a.push(0x40)
+	a.op(vm.MSTORE)
+	a.push(0x60)
+	a.push(0)
+	a.op(vm.SHA3) // proposal id
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.op(vm.CALLER)
+	a.push(0x20)
+	a.op(vm.MSTORE)
+	a.push(0x40)
+	a.push(0)
+	a.op(vm.SHA3) // vote slot
+	a.op(vm.DUP1, vm.SLOAD)
+	a.jumpi("revert")
+	a.push(1)
+	a.op(vm.SWAP1, vm.SSTORE)
+
+	// Add the weight of the signer to the tally of the proposal
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.SHA3) // tally slot
+	a.op(vm.DUP1, vm.SLOAD)
+	a.get(memVoter)
+	a.op(vm.ADD, vm.DUP1)
+	a.set(memTally)
+	a.op(vm.SWAP1, vm.SSTORE)
+
+	a.get(memWeight)
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.get(memTarget)
+	a.op(vm.CALLER)
+	a.pushBytes(GovernanceVotedTopic[:])
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.LOG3)
+
+	// Apply the proposal if it gathered the majority of the weights
+	a.pushBytes(governanceTotalSlot[:])
+	a.op(vm.SLOAD)
+	a.get(memTally)
+	a.push(2)
+	a.op(vm.MUL, vm.GT)
+	a.jumpi("apply")
+	a.op(vm.STOP)
+
+	a.label("apply")
+	a.get(memTarget)
+	a.weightSlot()
+	a.op(vm.SLOAD)
+	a.set(memOld)
+	a.get(memOld)
+	a.pushBytes(governanceTotalSlot[:])
+	a.op(vm.SLOAD, vm.SUB)
+	a.get(memWeight)
+	a.op(vm.ADD, vm.DUP1, vm.ISZERO)
+	a.jumpi("revert") // never remove the last signer
+	a.pushBytes(governanceTotalSlot[:])
+	a.op(vm.SSTORE)
+	a.get(memWeight)
+	a.get(memTarget)
+	a.weightSlot()
+	a.op(vm.SSTORE)
+	a.get(memGeneration)
+	a.push(1)
+	a.op(vm.ADD)
+	a.pushBytes(governanceGenerationSlot[:])
+	a.op(vm.SSTORE)
+
+	a.get(memWeight)
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.get(memTarget)
+	a.pushBytes(GovernanceChangedTopic[:])
+	a.push(0x20)
+	a.push(0)
+	a.op(vm.LOG2)
+
+	// Update the list of signers if the account joined or left
+	a.get(memOld)
+	a.op(vm.ISZERO)
+	a.jumpi("join")
+	a.get(memWeight)
+	a.jumpi("done")
+
+	// Signer left, move the last one into its place
+	a.pushBytes(governanceSignersSlot[:])
+	a.op(vm.SLOAD)
+	a.set(memCount)
+	a.push(0)
+	a.label("scan")
+	a.get(memCount)
+	a.op(vm.DUP2, vm.LT, vm.ISZERO)
+	a.jumpi("done")
+	a.op(vm.DUP1)
+	a.pushBytes(governanceSignersBase[:])
+	a.op(vm.ADD, vm.SLOAD)
+	a.get(memTarget)
+	a.op(vm.EQ)
+	a.jumpi("found")
+	a.push(1)
+	a.op(vm.ADD)
+	a.jump("scan")
+
+	a.label("found")
+	a.push(1)
+	a.get(memCount)
+	a.op(vm.SUB)
+	a.pushBytes(governanceSignersBase[:])
+	a.op(vm.ADD, vm.DUP1, vm.SLOAD, vm.DUP3)
+	a.pushBytes(governanceSignersBase[:])
+	a.op(vm.ADD, vm.SSTORE)
+	a.push(0)
+	a.op(vm.SWAP1, vm.SSTORE)
+	a.push(1)
+	a.get(memCount)
+	a.op(vm.SUB)
+	a.pushBytes(governanceSignersSlot[:])
+	a.op(vm.SSTORE, vm.STOP)
+
+	// Signer joined, append it to the list
+	a.label("join")
+	a.get(memWeight)
+	a.op(vm.ISZERO)
+	a.jumpi("done")
+	a.pushBytes(governanceSignersSlot[:])
+	a.op(vm.SLOAD, vm.DUP1)
+	a.get(memTarget)
+	a.op(vm.SWAP1)
+	a.pushBytes(governanceSignersBase[:])
+	a.op(vm.ADD, vm.SSTORE)
+	a.push(1)
+	a.op(vm.ADD)
+	a.pushBytes(governanceSignersSlot[:])
+	a.op(vm.SSTORE)
+
+	a.label("done")
+	a.op(vm.STOP)
+
+	a.label("revert")
+	a.push(0)
+	a.op(vm.DUP1, vm.REVERT)
+
+	return a.assemble()
+}
+
+// assembler is a minimal SVM assembler resolving jump labels.
+type assembler struct {
+	code   []byte
+	labels map[string]int
+	jumps  map[int]string // Positions of jump destinations to fill in
+}
+
+func newAssembler() *assembler {
+	return &assembler{
+		labels: make(map[string]int),
+		jumps:  make(map[int]string),
+	}
+}
+
+// op appends plain opcodes.
+func (a *assembler) op(ops ...vm.OpCode) {
+	for _, op := range ops {
+		a.code = append(a.code, byte(op))
+	}
+}
+
+// push appends the shortest push of a small number.
+func (a *assembler) push(n uint64) {
+	a.pushBytes(new(big.Int).SetUint64(n).Bytes())
+}
+
+// pushBytes appends the shortest push of a big endian number.
+func (a *assembler) pushBytes(value []byte) {
+	for len(value) > 1 && value[0] == 0 {
+		value = value[1:]
+	}
+	if len(value) == 0 {
+		value = []byte{0}
+	}
+	a.code = append(a.code, byte(vm.PUSH1)+byte(len(value)-1))
+	a.code = append(a.code, value...)
+}
+
+// set stores the top of the stack into a memory variable.
+func (a *assembler) set(offset uint64) {
+	a.push(offset)
+	a.op(vm.MSTORE)
+}
+
+// get loads a memory variable onto the stack.
+func (a *assembler) get(offset uint64) {
+	a.push(offset)
+	a.op(vm.MLOAD)
+}
+
+// weightSlot replaces the address on the top of the stack with the storage slot
+// of its weight.
+func (a *assembler) weightSlot() {
+	a.push(0)
+	a.op(vm.MSTORE)
+	a.pushBytes(governanceWeightsSlot[:])
+	a.push(0x20)
+	a.op(vm.MSTORE)
+	a.push(0x40)
+	a.push(0)
+	a.op(vm.SHA3)
+}
+
+// label marks a jump destination.
+func (a *assembler) label(name string) {
+	a.labels[name] = len(a.code)
+	a.op(vm.JUMPDEST)
+}
+
+// jump appends an unconditional jump to a label.
+func (a *assembler) jump(name string) {
+	a.jumpTo(name)
+	a.op(vm.JUMP)
+}
+
+// jumpi appends a jump to a label, taken if the top of the stack is non-zero.
+func (a *assembler) jumpi(name string) {
+	a.jumpTo(name)
+	a.op(vm.JUMPI)
+}
+
+// jumpTo pushes the position of a label, to be filled in once known.
+func (a *assembler) jumpTo(name string) {
+	a.code = append(a.code, byte(vm.PUSH2))
+	a.jumps[len(a.code)] = name
+	a.code = append(a.code, 0, 0)
+}
+
+// assemble fills in the jump destinations and returns the code.
+func (a *assembler) assemble() []byte {
+	for pos, name := range a.jumps {
+		dest, ok := a.labels[name]
+		if !ok {
+			panic("unknown label " + name)
+		}
+		a.code[pos], a.code[pos+1] = byte(dest>>8), byte(dest)
+	}
+	return a.code
+}
@@ -0,0 +1,287 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/susy-go/susy-graviton/accounts/abi"
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/consensus"
+	"github.com/susy-go/susy-graviton/core"
+	"github.com/susy-go/susy-graviton/core/state"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/core/vm"
+	"github.com/susy-go/susy-graviton/core/vm/runtime"
+	"github.com/susy-go/susy-graviton/params"
+	"github.com/susy-go/susy-graviton/sofdb"
+)
+
+// generatorEngine is a clique engine usable for chain generation, where the
+// snapshots needed to calculate the difficulty are not available.
+type generatorEngine struct {
+	*Clique
+}
+
+func (e generatorEngine) CalcDifficulty(chain consensus.ChainReader, time uint64, parent *types.Header) *big.Int {
+	return diffInTurn
+}
+
+// Finalize assembles the block without checking the checkpoint signers, which
+// are only filled in after generation.
+func (e generatorEngine) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	header.Root = state.IntermediateRoot(chain.Config().IsSIP158(header.Number))
+	header.UncleHash = types.CalcUncleHash(nil)
+	return types.NewBlock(header, txs, nil, receipts), nil
+}
+
+// Tests that signers governed by a contract are switched at checkpoints to the
+// ones voted in on chain, and that checkpoints deviating from the contract are
+// rejected.
+func TestGovernance(t *testing.T) {
+	tests := []struct {
+		checkpoint []string
+		results    []string
+		failure    error
+	}{
+		{checkpoint: []string{"A", "B", "C"}, results: []string{"A", "B", "C"}},
+		{checkpoint: []string{"A", "B"}, failure: errMismatchingCheckpointSigners},
+	}
+	for i, tt := range tests {
+		accounts := newTesterAccountPool()
+		contract := common.HexToAddress("0x1000")
+
+		// Create the genesis block with the governance contract of two signers
+		signers := []common.Address{accounts.address("A"), accounts.address("B")}
+		sort.Sort(signersAscending(signers))
+
+		genesis := &core.Genesis{
+			ExtraData: make([]byte, extraVanity+common.AddressLength*len(signers)+extraSeal),
+			Alloc: core.GenesisAlloc{
+				contract:              {Balance: big.NewInt(1), Code: GovernanceCode(), Storage: GovernanceStorage(signers, []uint64{1, 1})},
+				accounts.address("A"): {Balance: big.NewInt(1000000000)},
+				accounts.address("B"): {Balance: big.NewInt(1000000000)},
+			},
+		}
+		for j, signer := range signers {
+			copy(genesis.ExtraData[extraVanity+j*common.AddressLength:], signer[:])
+		}
+		db := sofdb.NewMemDatabase()
+		genesis.Commit(db)
+
+		config := *params.TestChainConfig
+		config.Clique = &params.CliqueConfig{
+			Period:     1,
+			Epoch:      3,
+			Governance: &contract,
+		}
+		engine := New(config.Clique, db)
+		engine.fakeDiff = true
+
+		// Vote C in by both signers, then switch to it at the checkpoint
+		vote := append(append(common.CopyBytes(GovernanceVoteSelector), common.BytesToHash(accounts.address("C").Bytes()).Bytes()...), common.BigToHash(big.NewInt(1)).Bytes()...)
+		sealers := []string{"A", "B", "A", "C"}
+
+		blocks, _ := core.GenerateChain(&config, genesis.ToBlock(db), generatorEngine{engine}, db, len(sealers), func(j int, gen *core.BlockGen) {
+			if j < 2 {
+				tx, _ := types.SignTx(types.NewTransaction(0, contract, new(big.Int), 500000, new(big.Int), vote), types.HomesteadSigner{}, accounts.accounts[sealers[j]])
+				gen.AddTx(tx)
+			}
+		})
+		for j, block := range blocks {
+			header := block.Header()
+			if j > 0 {
+				header.ParentHash = blocks[j-1].Hash()
+			}
+			header.Extra = make([]byte, extraVanity+extraSeal)
+			if header.Number.Uint64()%config.Clique.Epoch == 0 {
+				header.Extra = make([]byte, extraVanity+len(tt.checkpoint)*common.AddressLength+extraSeal)
+				accounts.checkpoint(header, tt.checkpoint)
+			}
+			header.Difficulty = diffInTurn
+
+			accounts.sign(header, sealers[j])
+			blocks[j] = block.WithSeal(header)
+		}
+		chain, err := core.NewBlockChain(db, nil, &config, engine, vm.Config{}, nil)
+		if err != nil {
+			t.Fatalf("test %d: failed to create test chain: %v", i, err)
+		}
+		engine.SetStateFn(chain.StateAt)
+
+		if _, err := chain.InsertChain(blocks); err != tt.failure {
+			t.Errorf("test %d: failure mismatch: have %v, want %v", i, err, tt.failure)
+		}
+		if tt.failure != nil {
+			continue
+		}
+		head := blocks[len(blocks)-1]
+		snap, err := engine.snapshot(chain, head.NumberU64(), head.Hash(), nil)
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve snapshot: %v", i, err)
+		}
+		want := make([]common.Address, len(tt.results))
+		for j, signer := range tt.results {
+			want[j] = accounts.address(signer)
+		}
+		sort.Sort(signersAscending(want))
+
+		if have := snap.signers(); len(have) != len(want) {
+			t.Errorf("test %d: signers mismatch: have %x, want %x", i, have, want)
+		} else {
+			for j := range have {
+				if have[j] != want[j] {
+					t.Errorf("test %d, signer %d: signer mismatch: have %x, want %x", i, j, have[j], want[j])
+				}
+			}
+		}
+		statedb, _ := chain.State()
+		if total := statedb.GetState(contract, governanceTotalSlot).Big(); total.Cmp(big.NewInt(3)) != 0 {
+			t.Errorf("test %d: total weight mismatch: have %v, want %v", i, total, 3)
+		}
+	}
+}
+
+// Tests the governance contract through its ABI, ensuring that the assembled
+// code behaves as the Solidity source.
+func TestGovernanceABI(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(GovernanceABI))
+	if err != nil {
+		t.Fatalf("failed to parse ABI: %v", err)
+	}
+	if id := parsed.Methods["vote"].Id(); string(id) != string(GovernanceVoteSelector) {
+		t.Fatalf("vote selector mismatch: have %x, want %x", GovernanceVoteSelector, id)
+	}
+	if id := parsed.Events["Voted"].Id(); id != GovernanceVotedTopic {
+		t.Fatalf("Voted topic mismatch: have %x, want %x", GovernanceVotedTopic, id)
+	}
+	if id := parsed.Events["Changed"].Id(); id != GovernanceChangedTopic {
+		t.Fatalf("Changed topic mismatch: have %x, want %x", GovernanceChangedTopic, id)
+	}
+	var (
+		contract = common.HexToAddress("0x1000")
+		a        = common.HexToAddress("0xa")
+		b        = common.HexToAddress("0xb")
+		c        = common.HexToAddress("0xc")
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(sofdb.NewMemDatabase()))
+	statedb.SetCode(contract, GovernanceCode())
+	for slot, value := range GovernanceStorage([]common.Address{a, b}, []uint64{1, 1}) {
+		statedb.SetState(contract, slot, value)
+	}
+	// vote casts a vote through the ABI and returns the logs it emitted
+	vote := func(voter, signer common.Address, weight int64) ([]*types.Log, error) {
+		input, err := parsed.Pack("vote", signer, big.NewInt(weight))
+		if err != nil {
+			t.Fatalf("failed to pack vote: %v", err)
+		}
+		logs := len(statedb.Logs())
+		if _, _, err := runtime.Call(contract, input, &runtime.Config{State: statedb, Origin: voter}); err != nil {
+			return nil, err
+		}
+		return statedb.Logs()[logs:], nil
+	}
+	// checkLog checks the topics and the weight of a log
+	checkLog := func(log *types.Log, event string, weight int64, topics ...common.Address) {
+		want := []common.Hash{parsed.Events[event].Id()}
+		for _, topic := range topics {
+			want = append(want, common.BytesToHash(topic[:]))
+		}
+		if len(log.Topics) != len(want) {
+			t.Fatalf("%s topic count mismatch: have %d, want %d", event, len(log.Topics), len(want))
+		}
+		for i := range want {
+			if log.Topics[i] != want[i] {
+				t.Errorf("%s topic %d mismatch: have %x, want %x", event, i, log.Topics[i], want[i])
+			}
+		}
+		var data struct{ Weight *big.Int }
+		if err := parsed.Unpack(&data, event, log.Data); err != nil {
+			t.Fatalf("failed to unpack %s: %v", event, err)
+		}
+		if data.Weight.Int64() != weight {
+			t.Errorf("%s weight mismatch: have %v, want %d", event, data.Weight, weight)
+		}
+	}
+	checkSigners := func(want ...common.Address) {
+		sort.Sort(signersAscending(want))
+		have := readGovernanceSigners(statedb, contract)
+		if len(have) != len(want) {
+			t.Fatalf("signers mismatch: have %x, want %x", have, want)
+		}
+		for i := range have {
+			if have[i] != want[i] {
+				t.Fatalf("signers mismatch: have %x, want %x", have, want)
+			}
+		}
+	}
+	// A vote without majority is only logged, and can't be repeated
+	logs, err := vote(a, c, 2)
+	if err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("log count mismatch: have %d, want 1", len(logs))
+	}
+	checkLog(logs[0], "Voted", 2, a, c)
+	checkSigners(a, b)
+
+	if _, err := vote(a, c, 2); err == nil {
+		t.Fatalf("repeated vote succeeded")
+	}
+	if _, err := vote(c, c, 2); err == nil {
+		t.Fatalf("non-signer vote succeeded")
+	}
+	// Reaching the majority applies the proposal
+	if logs, err = vote(b, c, 2); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("log count mismatch: have %d, want 2", len(logs))
+	}
+	checkLog(logs[0], "Voted", 2, b, c)
+	checkLog(logs[1], "Changed", 2, c)
+	checkSigners(a, b, c)
+
+	if total := statedb.GetState(contract, governanceTotalSlot).Big(); total.Int64() != 4 {
+		t.Errorf("total weight mismatch: have %v, want 4", total)
+	}
+	// Removing a signer needs the majority too
+	if _, err := vote(a, b, 0); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	checkSigners(a, b, c)
+	if logs, err = vote(c, b, 0); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	checkLog(logs[1], "Changed", 0, b)
+	checkSigners(a, c)
+
+	// A signer with the majority of the weights decides alone, but the last
+	// signer can't be removed
+	if _, err := vote(c, a, 0); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	checkSigners(c)
+	if _, err := vote(c, c, 0); err == nil {
+		t.Fatalf("last signer removal succeeded")
+	}
+	checkSigners(c)
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/susy-go/susy-graviton/common"
 	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/log"
 	"github.com/susy-go/susy-graviton/sofdb"
 	"github.com/susy-go/susy-graviton/params"
 	lru "github.com/hashicorp/golang-lru"
@@ -180,7 +181,13 @@ func (s *Snapshot) uncast(address common.Address, authorize bool) bool {
 
 // apply creates a new authorization snapshot by applying the given headers to
 // the original one.
-func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
+//
+// If the signers are governed by a contract, header votes are not tallied, but
+// the signer set is replaced at every checkpoint by the list in its extra-data,
+// which is validated against the contract state if governance is able to read
+// it. Otherwise the validation is deferred to the processing of the checkpoint
+// block, which fails if the list doesn't match, see Clique.Finalize.
+func (s *Snapshot) apply(headers []*types.Header, governance governanceFn) (*Snapshot, error) {
 	// Allow passing in no headers for cleaner code
 	if len(headers) == 0 {
 		return s, nil
@@ -223,6 +230,37 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 		}
 		snap.Recents[number] = signer
 
+		// If the signers are governed by a contract, switch them on checkpoints
+		if s.config.Governance != nil {
+			if number%s.config.Epoch != 0 {
+				continue
+			}
+			if governance != nil {
+				signers, err := governance(header)
+				switch {
+				case err == nil:
+					if err := checkSigners(header, signers); err != nil {
+						return nil, err
+					}
+				case err != errGovernanceUnavailable:
+					return nil, err
+				default:
+					log.Trace("Deferring governance checkpoint verification", "number", number, "hash", header.Hash())
+				}
+			}
+			snap.Signers = make(map[common.Address]struct{})
+			for _, signer := range checkpointSigners(header) {
+				snap.Signers[signer] = struct{}{}
+			}
+			// Signer list changed, delete any recents beyond the new limit
+			limit := uint64(len(snap.Signers)/2 + 1)
+			for block := range snap.Recents {
+				if block+limit <= number {
+					delete(snap.Recents, block)
+				}
+			}
+			continue
+		}
 		// Header authorized, discard any previous votes from the signer
 		for i, vote := range snap.Votes {
 			if vote.Signer == signer && vote.Address == header.Coinbase {
@@ -114,3 +114,43 @@ type PoW interface {
 	// Hashrate returns the current mining hashrate of a PoW consensus engine.
 	Hashrate() float64
 }
+
+// Broadcaster is the network layer through which consensus engines exchanging
+// messages of their own reach the other nodes.
+type Broadcaster interface {
+	// BroadcastConsensus sends a consensus message to all the peers not known to
+	// already have it.
+	BroadcastConsensus(payload []byte)
+
+	// EnqueueBlock schedules a block finalised by the consensus for import and
+	// propagation.
+	EnqueueBlock(block *types.Block)
+}
+
+// Handler is a consensus engine which reaches agreement on blocks by exchanging
+// messages of its own between the nodes.
+type Handler interface {
+	Engine
+
+	// SetBroadcaster injects the local chain the messages are validated against,
+	// and the network layer to send messages and blocks with.
+	SetBroadcaster(chain ChainReader, broadcaster Broadcaster)
+
+	// HandleMsg processes a consensus message received from a peer, returning
+	// whether it is new and valid, and should be relayed to the other peers.
+	HandleMsg(payload []byte) (bool, error)
+}
+
+// Finality is a consensus engine able to tell which blocks of a chain can no
+// longer be reverted.
+type Finality interface {
+	Engine
+
+	// FinalizedHeader retrieves the most recent header in the chain ending with
+	// the given head that the engine considers irreversible, or nil if none is.
+	FinalizedHeader(chain ChainReader, head *types.Header) *types.Header
+
+	// SafeHeader retrieves the most recent header in the chain ending with the
+	// given head that is unlikely to be reverted, or nil if none is.
+	SafeHeader(chain ChainReader, head *types.Header) *types.Header
+}
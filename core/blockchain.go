@@ -53,6 +53,10 @@ var (
 	blockWriteTimer      = metrics.NewRegisteredTimer("chain/write", nil)
 
 	ErrNoGenesis = errors.New("Genesis not found in chain")
+
+	// ErrRefcountMigration is returned if the database is opened while its
+	// migration to trie reference counting is unfinished.
+	ErrRefcountMigration = errors.New("unfinished trie refcount migration, rerun it")
 )
 
 const (
@@ -75,6 +79,8 @@ type CacheConfig struct {
 	TrieCleanLimit int           // Memory allowance (MB) to use for caching trie nodes in memory
 	TrieDirtyLimit int           // Memory limit (MB) at which to start flushing dirty trie nodes to disk
 	TrieTimeLimit  time.Duration // Time limit after which to flush the current in-memory trie to disk
+	TrieRefcount   bool          // Whether to reference count trie nodes on disk, deleting unreferenced ones
+	TrieRetention  uint64        // Number of blocks to retain committed states for with refcounting (0 = all)
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -105,6 +111,7 @@ type BlockChain struct {
 	chainSideFeed event.Feed
 	chainHeadFeed event.Feed
 	logsFeed      event.Feed
+	finalizedFeed event.Feed
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
 
@@ -116,6 +123,9 @@ type BlockChain struct {
 	currentBlock     atomic.Value // Current head of the block chain
 	currentFastBlock atomic.Value // Current head of the fast-sync chain (may be above the block chain!)
 
+	finalized     *types.Header // Last finalized header announced to the subscribers
+	finalizedLock sync.Mutex    // Lock protecting the finalized header announcements
+
 	stateCache    state.Database // State database to reuse between imports (contains state cache)
 	bodyCache     *lru.Cache     // Cache for the most recent block bodies
 	bodyRLPCache  *lru.Cache     // Cache for the most recent block bodies in RLP encoded format
@@ -123,6 +133,8 @@ type BlockChain struct {
 	blockCache    *lru.Cache     // Cache for the most recent entire blocks
 	futureBlocks  *lru.Cache     // future blocks are blocks added for later processing
 
+	retained []rawdb.RetainedState // Committed states retained on disk with trie refcounting
+
 	quit    chan struct{} // blockchain quit channel
 	running int32         // running must be called atomically
 	// procInterrupt must be atomically called
@@ -142,6 +154,9 @@ type BlockChain struct {
 // available in the database. It initialises the default Sophon Validator and
 // Processor.
 func NewBlockChain(db sofdb.Database, cacheConfig *CacheConfig, chainConfig *params.ChainConfig, engine consensus.Engine, vmConfig vm.Config, shouldPreserve func(block *types.Block) bool) (*BlockChain, error) {
+	if rawdb.ReadTrieRefcountMigration(db) {
+		return nil, ErrRefcountMigration
+	}
 	if cacheConfig == nil {
 		cacheConfig = &CacheConfig{
 			TrieCleanLimit: 256,
@@ -156,12 +171,23 @@ func NewBlockChain(db sofdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	futureBlocks, _ := lru.New(maxFutureBlocks)
 	badBlocks, _ := lru.New(badBlockLimit)
 
+	// Once trie nodes are reference counted, every node flushed to disk must be
+	// counted, otherwise referenced nodes could be deleted later.
+	stateCache := state.NewDatabaseWithCache(db, cacheConfig.TrieCleanLimit)
+	if !cacheConfig.TrieRefcount && rawdb.ReadTrieRefcount(db) {
+		log.Warn("Trie nodes are reference counted in the database, keeping it enabled")
+	}
+	if cacheConfig.TrieRefcount || rawdb.ReadTrieRefcount(db) {
+		rawdb.WriteTrieRefcount(db)
+		stateCache = state.NewDatabaseWithRefcount(db, cacheConfig.TrieCleanLimit)
+	}
 	bc := &BlockChain{
 		chainConfig:    chainConfig,
 		cacheConfig:    cacheConfig,
 		db:             db,
 		triegc:         prque.New(nil),
-		stateCache:     state.NewDatabaseWithCache(db, cacheConfig.TrieCleanLimit),
+		stateCache:     stateCache,
+		retained:       rawdb.ReadRetainedStates(db),
 		quit:           make(chan struct{}),
 		shouldPreserve: shouldPreserve,
 		bodyCache:      bodyCache,
@@ -365,6 +391,26 @@ func (bc *BlockChain) CurrentFastBlock() *types.Block {
 	return bc.currentFastBlock.Load().(*types.Block)
 }
 
+// CurrentFinalizedHeader retrieves the most recent header of the canonical chain
+// the consensus engine deems irreversible, or nil if there's none or the engine
+// has no notion of finality.
+func (bc *BlockChain) CurrentFinalizedHeader() *types.Header {
+	if finality, ok := bc.engine.(consensus.Finality); ok {
+		return finality.FinalizedHeader(bc, bc.CurrentBlock().Header())
+	}
+	return nil
+}
+
+// CurrentSafeHeader retrieves the most recent header of the canonical chain the
+// consensus engine deems unlikely to be reverted, or nil if there's none or the
+// engine has no notion of finality.
+func (bc *BlockChain) CurrentSafeHeader() *types.Header {
+	if finality, ok := bc.engine.(consensus.Finality); ok {
+		return finality.SafeHeader(bc, bc.CurrentBlock().Header())
+	}
+	return nil
+}
+
 // SetProcessor sets the processor required for making state modifications.
 func (bc *BlockChain) SetProcessor(processor Processor) {
 	bc.procmu.Lock()
@@ -712,7 +758,7 @@ func (bc *BlockChain) Stop() {
 				recent := bc.GetBlockByNumber(number - offset)
 
 				log.Info("Writing cached state to disk", "block", recent.Number(), "hash", recent.Hash(), "root", recent.Root())
-				if err := triedb.Commit(recent.Root(), true); err != nil {
+				if err := bc.commitState(recent.Root(), recent.NumberU64(), true); err != nil {
 					log.Error("Failed to commit recent state trie", "err", err)
 				}
 			}
@@ -744,6 +790,56 @@ func (bc *BlockChain) procFutureBlocks() {
 	}
 }
 
+// commitState flushes a state trie to disk. If trie nodes are reference counted,
+// the state is recorded to be retained until it falls out of the retention window.
+func (bc *BlockChain) commitState(root common.Hash, number uint64, report bool) error {
+	triedb := bc.stateCache.TrieDB()
+	if err := triedb.Commit(root, report); err != nil {
+		return err
+	}
+	if triedb.Refcount() {
+		bc.retained = append(bc.retained, rawdb.RetainedState{Number: number, Root: root})
+		rawdb.WriteRetainedStates(bc.db, bc.retained)
+	}
+	return nil
+}
+
+// releaseStates deletes the committed states older than the retention window
+// of the given head block from disk. The most recent committed state is always
+// retained, as the chain is rewound to it after a crash.
+func (bc *BlockChain) releaseStates(head uint64) {
+	triedb := bc.stateCache.TrieDB()
+	if !triedb.Refcount() || bc.cacheConfig.TrieRetention == 0 || len(bc.retained) < 2 {
+		return
+	}
+	latest := 0
+	for i, state := range bc.retained {
+		if state.Number >= bc.retained[latest].Number {
+			latest = i
+		}
+	}
+	var retained, released []rawdb.RetainedState
+	for i, state := range bc.retained {
+		if i != latest && state.Number+bc.cacheConfig.TrieRetention < head {
+			released = append(released, state)
+		} else {
+			retained = append(retained, state)
+		}
+	}
+	if len(released) == 0 {
+		return
+	}
+	// Drop the states from the list first, a crash may only leak them
+	bc.retained = retained
+	rawdb.WriteRetainedStates(bc.db, bc.retained)
+
+	for _, state := range released {
+		if err := triedb.Release(state.Root); err != nil {
+			log.Error("Failed to release state trie", "number", state.Number, "root", state.Root, "err", err)
+		}
+	}
+}
+
 // WriteStatus status of write
 type WriteStatus byte
 
@@ -954,7 +1050,7 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 
 	// If we're running an archive node, always flush
 	if bc.cacheConfig.Disabled {
-		if err := triedb.Commit(root, false); err != nil {
+		if err := bc.commitState(root, block.NumberU64(), false); err != nil {
 			return NonStatTy, err
 		}
 	} else {
@@ -988,7 +1084,9 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 						log.Info("State in memory for too long, committing", "time", bc.gcproc, "allowance", bc.cacheConfig.TrieTimeLimit, "optimum", float64(chosen-lastWrite)/triesInMemory)
 					}
 					// Flush an entire trie and restart the counters
-					triedb.Commit(header.Root, true)
+					if err := bc.commitState(header.Root, chosen, true); err != nil {
+						log.Error("Failed to commit state trie", "number", chosen, "err", err)
+					}
 					lastWrite = chosen
 					bc.gcproc = 0
 				}
@@ -1004,6 +1102,8 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 			}
 		}
 	}
+	// Delete the committed states which fell out of the retention window
+	bc.releaseStates(block.NumberU64())
 
 	// Write other block data using a batch.
 	batch := bc.db.NewBatch()
@@ -1543,6 +1643,7 @@ func (bc *BlockChain) PostChainEvents(events []interface{}, logs []*types.Log) {
 
 		case ChainHeadEvent:
 			bc.chainHeadFeed.Send(ev)
+			bc.postFinalized()
 
 		case ChainSideEvent:
 			bc.chainSideFeed.Send(ev)
@@ -1550,6 +1651,24 @@ func (bc *BlockChain) PostChainEvents(events []interface{}, logs []*types.Log) {
 	}
 }
 
+// postFinalized announces the finalized header of the canonical chain if it
+// advanced since the last announcement.
+func (bc *BlockChain) postFinalized() {
+	header := bc.CurrentFinalizedHeader()
+	if header == nil {
+		return
+	}
+	bc.finalizedLock.Lock()
+	if bc.finalized != nil && header.Number.Cmp(bc.finalized.Number) <= 0 {
+		bc.finalizedLock.Unlock()
+		return
+	}
+	bc.finalized = header
+	bc.finalizedLock.Unlock()
+
+	bc.finalizedFeed.Send(ChainFinalizedEvent{Header: header})
+}
+
 func (bc *BlockChain) update() {
 	futureTimer := time.NewTicker(5 * time.Second)
 	defer futureTimer.Stop()
@@ -1741,6 +1860,11 @@ func (bc *BlockChain) SubscribeChainSideEvent(ch chan<- ChainSideEvent) event.Su
 	return bc.scope.Track(bc.chainSideFeed.Subscribe(ch))
 }
 
+// SubscribeChainFinalizedEvent registers a subscription of ChainFinalizedEvent.
+func (bc *BlockChain) SubscribeChainFinalizedEvent(ch chan<- ChainFinalizedEvent) event.Subscription {
+	return bc.scope.Track(bc.finalizedFeed.Subscribe(ch))
+}
+
 // SubscribeLogsEvent registers a subscription of []*types.Log.
 func (bc *BlockChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
 	return bc.scope.Track(bc.logsFeed.Subscribe(ch))
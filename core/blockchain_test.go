@@ -1744,3 +1744,53 @@ func TestLowDiffLongChain(t *testing.T) {
 		header = chain.GetHeader(header.ParentHash, number-1)
 	}
 }
+
+// Tests that with trie reference counting, the states committed to disk are
+// deleted once they fall out of the retention window.
+func TestTrieRefcountRetention(t *testing.T) {
+	engine := sofash.NewFaker()
+
+	db := sofdb.NewMemDatabase()
+	genesis := new(Genesis).MustCommit(db)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 32, func(i int, b *BlockGen) { b.SetCoinbase(common.Address{byte(i)}) })
+
+	diskdb := sofdb.NewMemDatabase()
+	new(Genesis).MustCommit(diskdb)
+
+	config := &CacheConfig{Disabled: true, TrieRefcount: true, TrieRetention: 8}
+	chain, err := NewBlockChain(diskdb, config, params.TestChainConfig, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if !rawdb.ReadTrieRefcount(diskdb) {
+		t.Fatalf("trie refcounting not recorded in database")
+	}
+	for i, block := range blocks {
+		_, err := state.New(block.Root(), state.NewDatabase(diskdb))
+		if retained := block.NumberU64()+config.TrieRetention >= uint64(len(blocks)); retained && err != nil {
+			t.Errorf("block %d: retained state missing: %v", i+1, err)
+		} else if !retained && err == nil {
+			t.Errorf("block %d: state outside retention window not deleted", i+1)
+		}
+	}
+	if _, err := state.New(genesis.Root(), state.NewDatabase(diskdb)); err != nil {
+		t.Errorf("genesis state missing: %v", err)
+	}
+	if have, want := len(rawdb.ReadRetainedStates(diskdb)), int(config.TrieRetention)+1; have != want {
+		t.Errorf("retained state count mismatch: have %d, want %d", have, want)
+	}
+	// Reference counting must stay enabled even if not configured any more
+	chain.Stop()
+	chain, err = NewBlockChain(diskdb, &CacheConfig{Disabled: true}, params.TestChainConfig, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if !chain.stateCache.TrieDB().Refcount() {
+		t.Errorf("trie refcounting disabled on reopened chain")
+	}
+}
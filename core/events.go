@@ -46,3 +46,7 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// ChainFinalizedEvent is posted when the consensus engine deems a newer block
+// of the canonical chain irreversible.
+type ChainFinalizedEvent struct{ Header *types.Header }
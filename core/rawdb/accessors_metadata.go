@@ -95,3 +95,73 @@ func WritePreimages(db DatabaseWriter, preimages map[common.Hash][]byte) {
 	preimageCounter.Inc(int64(len(preimages)))
 	preimageHitCounter.Inc(int64(len(preimages)))
 }
+
+// ReadTrieRefcount retrieves whether the trie nodes in the database are
+// reference counted.
+func ReadTrieRefcount(db DatabaseReader) bool {
+	ok, _ := db.Has(trieRefcountKey)
+	return ok
+}
+
+// WriteTrieRefcount flags the trie nodes in the database as reference counted.
+// Once set, the flag must never be cleared.
+func WriteTrieRefcount(db DatabaseWriter) {
+	if err := db.Put(trieRefcountKey, []byte{1}); err != nil {
+		log.Crit("Failed to store trie refcount flag", "err", err)
+	}
+}
+
+// ReadTrieRefcountMigration retrieves whether a migration of the database to
+// trie reference counting was started but not finished.
+func ReadTrieRefcountMigration(db DatabaseReader) bool {
+	ok, _ := db.Has(trieRefcountMigrationKey)
+	return ok
+}
+
+// WriteTrieRefcountMigration flags a migration to trie reference counting as
+// started.
+func WriteTrieRefcountMigration(db DatabaseWriter) {
+	if err := db.Put(trieRefcountMigrationKey, []byte{1}); err != nil {
+		log.Crit("Failed to store trie refcount migration flag", "err", err)
+	}
+}
+
+// DeleteTrieRefcountMigration flags a migration to trie reference counting as
+// finished.
+func DeleteTrieRefcountMigration(db DatabaseDeleter) {
+	if err := db.Delete(trieRefcountMigrationKey); err != nil {
+		log.Crit("Failed to delete trie refcount migration flag", "err", err)
+	}
+}
+
+// RetainedState is a committed state which is retained on disk until released.
+type RetainedState struct {
+	Number uint64
+	Root   common.Hash
+}
+
+// ReadRetainedStates retrieves the committed states retained on disk, in the
+// order they were committed.
+func ReadRetainedStates(db DatabaseReader) []RetainedState {
+	data, _ := db.Get(retainedStatesKey)
+	if len(data) == 0 {
+		return nil
+	}
+	var states []RetainedState
+	if err := srlp.DecodeBytes(data, &states); err != nil {
+		log.Error("Invalid retained state list", "err", err)
+		return nil
+	}
+	return states
+}
+
+// WriteRetainedStates stores the committed states retained on disk.
+func WriteRetainedStates(db DatabaseWriter, states []RetainedState) {
+	data, err := srlp.EncodeToBytes(states)
+	if err != nil {
+		log.Crit("Failed to encode retained state list", "err", err)
+	}
+	if err := db.Put(retainedStatesKey, data); err != nil {
+		log.Crit("Failed to store retained state list", "err", err)
+	}
+}
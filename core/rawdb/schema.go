@@ -41,6 +41,15 @@ var (
 	// fastTrieProgressKey tracks the number of trie entries imported during fast sync.
 	fastTrieProgressKey = []byte("TrieSync")
 
+	// trieRefcountKey flags whether the trie nodes are reference counted on disk.
+	trieRefcountKey = []byte("TrieRefcount")
+
+	// trieRefcountMigrationKey flags an unfinished migration to trie reference counting.
+	trieRefcountMigrationKey = []byte("TrieRefcountMigration")
+
+	// retainedStatesKey tracks the committed states retained on disk.
+	retainedStatesKey = []byte("RetainedStates")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
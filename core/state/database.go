@@ -89,6 +89,17 @@ func NewDatabaseWithCache(db sofdb.Database, cache int) Database {
 	}
 }
 
+// NewDatabaseWithRefcount creates a backing store for state like
+// NewDatabaseWithCache, which also reference counts the trie nodes and contract
+// codes flushed to disk, deleting them once no retained state references them.
+func NewDatabaseWithRefcount(db sofdb.Database, cache int) Database {
+	csc, _ := lru.New(codeSizeCacheSize)
+	return &cachingDB{
+		db:            trie.NewDatabaseWithRefcount(db, cache),
+		codeSizeCache: csc,
+	}
+}
+
 type cachingDB struct {
 	db            *trie.Database
 	mu            sync.Mutex
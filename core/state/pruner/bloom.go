@@ -0,0 +1,175 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/susy-go/susy-graviton/common"
+	"golang.org/x/crypto/sha3"
+)
+
+// bloomHashes is the number of bits set in the filter for every inserted key.
+// Keys are Keccak256 hashes, so the filter positions are taken directly from
+// distinct 8 byte chunks of them.
+const bloomHashes = 4
+
+// bloomBatchSize is the number of bytes of the filter encoded at once while it
+// is persisted or loaded.
+const bloomBatchSize = 64 * 1024
+
+// errBloomCorrupted is returned if a persisted bloom filter fails its checksum.
+var errBloomCorrupted = errors.New("state bloom filter corrupted")
+
+// stateBloom is a bloom filter tracking the hashes of the trie nodes and
+// contract codes reachable from the retained state roots. False positives only
+// cause some stale data to be kept, so they are safe.
+type stateBloom struct {
+	bits []uint64
+}
+
+// newStateBloom creates an empty bloom filter of the given size in bytes.
+func newStateBloom(size uint64) *stateBloom {
+	if size < 8 {
+		size = 8
+	}
+	return &stateBloom{bits: make([]uint64, size/8)}
+}
+
+// positions returns the filter bits corresponding to a key.
+func (b *stateBloom) positions(key []byte) [bloomHashes]uint64 {
+	var (
+		pos  [bloomHashes]uint64
+		bits = uint64(len(b.bits)) * 64
+	)
+	for i := 0; i < bloomHashes; i++ {
+		pos[i] = binary.BigEndian.Uint64(key[i*8:]) % bits
+	}
+	return pos
+}
+
+// add inserts a hash into the filter.
+func (b *stateBloom) add(hash common.Hash) {
+	for _, pos := range b.positions(hash[:]) {
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+// contains reports whether a 32 byte key may have been inserted into the filter.
+func (b *stateBloom) contains(key []byte) bool {
+	for _, pos := range b.positions(key) {
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// commit atomically persists the filter to the given path, followed by the
+// checksum of its content. Once the file exists, the marking is complete and
+// the deletion can be resumed from it after a crash. The filter is streamed to
+// the file in batches, as it may take a good portion of the available memory.
+func (b *stateBloom) commit(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	var (
+		hasher = sha3.NewLegacyKeccak256()
+		out    = io.MultiWriter(f, hasher)
+		batch  = make([]byte, 0, bloomBatchSize)
+	)
+	for _, word := range b.bits {
+		var enc [8]byte
+		binary.BigEndian.PutUint64(enc[:], word)
+		if batch = append(batch, enc[:]...); len(batch) == cap(batch) {
+			if _, err := out.Write(batch); err != nil {
+				f.Close()
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if _, err := out.Write(batch); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(hasher.Sum(nil)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadStateBloom reads a bloom filter persisted by commit.
+func loadStateBloom(path string) (*stateBloom, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size() - common.HashLength
+	if size < 8 || size%8 != 0 {
+		return nil, errBloomCorrupted
+	}
+	var (
+		bloom  = &stateBloom{bits: make([]uint64, size/8)}
+		hasher = sha3.NewLegacyKeccak256()
+		reader = bufio.NewReaderSize(f, bloomBatchSize)
+		in     = io.TeeReader(reader, hasher)
+		batch  = make([]byte, bloomBatchSize)
+	)
+	for i := 0; i < len(bloom.bits); {
+		n := len(bloom.bits) - i
+		if n > bloomBatchSize/8 {
+			n = bloomBatchSize / 8
+		}
+		if _, err := io.ReadFull(in, batch[:n*8]); err != nil {
+			return nil, err
+		}
+		for j := 0; j < n; j++ {
+			bloom.bits[i+j] = binary.BigEndian.Uint64(batch[j*8:])
+		}
+		i += n
+	}
+	sum := make([]byte, common.HashLength)
+	if _, err := io.ReadFull(reader, sum); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hasher.Sum(nil), sum) {
+		return nil, errBloomCorrupted
+	}
+	return bloom, nil
+}
@@ -0,0 +1,274 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pruner implements the offline deletion of stale state data.
+package pruner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/core/rawdb"
+	"github.com/susy-go/susy-graviton/core/state"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/log"
+	"github.com/susy-go/susy-graviton/sofdb"
+	"github.com/susy-go/susy-graviton/trie"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	// BloomFileName is the name of the file the state bloom filter is persisted
+	// to within the node's instance directory.
+	BloomFileName = "statebloom.bf"
+
+	// DefaultBloomSize is the default size of the state bloom filter in bytes.
+	DefaultBloomSize = 2048 * 1024 * 1024
+
+	// recentBlocks is the number of recent blocks whose state the blockchain
+	// may have flushed to disk on shutdown (core.triesInMemory).
+	recentBlocks = 128
+)
+
+// Pruner deletes the trie nodes and contract codes which are not reachable from
+// a set of retained state roots. It operates on the database of a stopped node.
+//
+// Pruning happens in two phases. The marking phase iterates the retained states
+// and records every reachable node in a bloom filter, which is then persisted.
+// The sweeping phase deletes every node missing from the filter. If the process
+// is interrupted during sweeping, the persisted filter allows it to be resumed;
+// the node must not be run on the half-pruned database until then, otherwise
+// freshly written nodes would be deleted by the resumed sweep.
+type Pruner struct {
+	db        *sofdb.LDBDatabase
+	bloomPath string
+	bloomSize uint64
+}
+
+// NewPruner creates a pruner for the given database, persisting its bloom filter
+// of the given size in bytes at bloomPath.
+func NewPruner(db *sofdb.LDBDatabase, bloomPath string, bloomSize uint64) *Pruner {
+	if bloomSize == 0 {
+		bloomSize = DefaultBloomSize
+	}
+	return &Pruner{
+		db:        db,
+		bloomPath: bloomPath,
+		bloomSize: bloomSize,
+	}
+}
+
+// Prune deletes all state data not reachable from the given roots. If no roots
+// are given, the states of the recent blocks persisted by the blockchain on
+// shutdown are retained. The genesis state is always retained. An interrupted
+// pruning is resumed instead of starting a new one.
+func (p *Pruner) Prune(roots []common.Hash) error {
+	if _, err := os.Stat(p.bloomPath); err == nil {
+		log.Warn("Resuming interrupted state pruning", "bloom", p.bloomPath)
+		return RecoverPruning(p.db, p.bloomPath)
+	}
+	if len(roots) == 0 {
+		recent, err := recentStates(p.db)
+		if err != nil {
+			return err
+		}
+		for _, state := range recent {
+			roots = append(roots, state.Root)
+		}
+	}
+	for _, root := range roots {
+		if !hasState(p.db, root) {
+			return fmt.Errorf("state %x not available", root)
+		}
+	}
+	if root, ok := blockRoot(p.db, 0); ok && hasState(p.db, root) {
+		roots = append(roots, root)
+	}
+	// Mark all the nodes reachable from the retained roots
+	bloom := newStateBloom(p.bloomSize)
+	for _, root := range roots {
+		if err := markState(p.db, bloom, root); err != nil {
+			return err
+		}
+	}
+	if err := bloom.commit(p.bloomPath); err != nil {
+		return err
+	}
+	return sweep(p.db, bloom, p.bloomPath)
+}
+
+// RecoverPruning resumes a pruning which was interrupted after its marking phase
+// completed. It is a noop if no persisted bloom filter exists. It must be invoked
+// before the database is modified by anything else.
+func RecoverPruning(db *sofdb.LDBDatabase, bloomPath string) error {
+	bloom, err := loadStateBloom(bloomPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Info("Finishing interrupted state pruning", "bloom", bloomPath)
+	return sweep(db, bloom, bloomPath)
+}
+
+// recentStates returns the states of the recent blocks which are available on
+// disk, preferring the ones the blockchain persists on shutdown.
+func recentStates(db *sofdb.LDBDatabase) ([]rawdb.RetainedState, error) {
+	head := rawdb.ReadHeadBlockHash(db)
+	number := rawdb.ReadHeaderNumber(db, head)
+	if number == nil {
+		return nil, errors.New("head block not found")
+	}
+	var states []rawdb.RetainedState
+	for _, offset := range []uint64{0, 1, recentBlocks - 1} {
+		if *number < offset {
+			continue
+		}
+		if root, ok := blockRoot(db, *number-offset); ok && hasState(db, root) {
+			states = append(states, rawdb.RetainedState{Number: *number - offset, Root: root})
+		}
+	}
+	if len(states) > 0 {
+		return states, nil
+	}
+	// The node was not shut down cleanly, fall back to the most recent state
+	for offset := uint64(0); offset < recentBlocks && offset <= *number; offset++ {
+		if root, ok := blockRoot(db, *number-offset); ok && hasState(db, root) {
+			log.Warn("Head state missing, retaining older state", "number", *number-offset, "root", root)
+			return []rawdb.RetainedState{{Number: *number - offset, Root: root}}, nil
+		}
+	}
+	return nil, errors.New("no recent state available")
+}
+
+// blockRoot returns the state root of the canonical block with the given number.
+func blockRoot(db *sofdb.LDBDatabase, number uint64) (common.Hash, bool) {
+	hash := rawdb.ReadCanonicalHash(db, number)
+	if hash == (common.Hash{}) {
+		return common.Hash{}, false
+	}
+	header := rawdb.ReadHeader(db, hash, number)
+	if header == nil {
+		return common.Hash{}, false
+	}
+	return header.Root, true
+}
+
+// hasState reports whether the root node of a state is present in the database.
+func hasState(db *sofdb.LDBDatabase, root common.Hash) bool {
+	if root == types.EmptyRootHash {
+		return true
+	}
+	ok, _ := db.Has(root[:])
+	return ok
+}
+
+// markState adds all the trie nodes and contract codes of a state to the bloom
+// filter.
+func markState(db *sofdb.LDBDatabase, bloom *stateBloom, root common.Hash) error {
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		return err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		nodes  int
+	)
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+		// Nodes embedded into their parents have no hash and aren't stored
+		if it.Hash == (common.Hash{}) {
+			continue
+		}
+		bloom.add(it.Hash)
+		nodes++
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Marking state data", "root", root, "nodes", nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if it.Error != nil {
+		return it.Error
+	}
+	log.Info("Marked state data", "root", root, "nodes", nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// sweep deletes all trie nodes and contract codes missing from the bloom filter,
+// then removes the persisted filter and compacts the database. Deletions are
+// idempotent, so an interrupted sweep can simply be run again.
+func sweep(db *sofdb.LDBDatabase, bloom *stateBloom, bloomPath string) error {
+	var (
+		start   = time.Now()
+		logged  = time.Now()
+		batch   = db.NewBatch()
+		deleted int
+		kept    int
+	)
+	it := db.NewIterator()
+	for it.Next() {
+		// Trie nodes and contract codes are the only entries keyed by plain hashes
+		key := it.Key()
+		if len(key) != common.HashLength {
+			continue
+		}
+		if bloom.contains(key) {
+			kept++
+			continue
+		}
+		batch.Delete(key)
+		trie.DeleteNodeMetadata(batch, common.BytesToHash(key))
+		deleted++
+
+		if batch.ValueSize() >= sofdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				it.Release()
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data", "deleted", deleted, "kept", kept, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Pruned state data", "deleted", deleted, "kept", kept, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// All stale data deleted, the pruning can't be resumed any more
+	if err := os.Remove(bloomPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	start = time.Now()
+	log.Info("Compacting database")
+	if err := db.LDB().CompactRange(util.Range{}); err != nil {
+		return err
+	}
+	log.Info("Compacted database", "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
@@ -0,0 +1,249 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/core/rawdb"
+	"github.com/susy-go/susy-graviton/core/state"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/sofdb"
+	"github.com/susy-go/susy-graviton/trie"
+)
+
+// newTestDatabase creates a database on disk, returning it along with the path
+// of the bloom filter and a cleanup function.
+func newTestDatabase(t *testing.T) (*sofdb.LDBDatabase, string, func()) {
+	dir, err := ioutil.TempDir("", "pruner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sofdb.NewLDBDatabase(filepath.Join(dir, "chaindata"), 0, 0)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, filepath.Join(dir, BloomFileName), func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// commitState creates a state on top of the given root, modifying n accounts
+// with storage and code, and flushes it to disk.
+func commitState(t *testing.T, db *sofdb.LDBDatabase, parent common.Hash, seed byte, n int) common.Hash {
+	sdb := state.NewDatabase(db)
+	statedb, err := state.New(parent, sdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		addr := common.BytesToAddress([]byte{seed, byte(i)})
+		statedb.AddBalance(addr, big.NewInt(int64(i+1)))
+		statedb.SetState(addr, common.BytesToHash([]byte{byte(i)}), common.BytesToHash([]byte{seed, byte(i)}))
+		statedb.SetCode(addr, []byte{seed, byte(i), 0x60})
+	}
+	root, err := statedb.Commit(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sdb.TrieDB().Commit(root, false); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// checkState iterates over all the nodes of a state, failing if any is missing.
+func checkState(t *testing.T, db *sofdb.LDBDatabase, root common.Hash) {
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("state %x unavailable: %v", root, err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("state %x incomplete: %v", root, it.Error)
+	}
+}
+
+// countStateEntries returns the number of entries keyed by a plain hash.
+func countStateEntries(db *sofdb.LDBDatabase) int {
+	var count int
+	it := db.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		if len(it.Key()) == common.HashLength {
+			count++
+		}
+	}
+	return count
+}
+
+func TestPrune(t *testing.T) {
+	db, bloomPath, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	stale := commitState(t, db, common.Hash{}, 1, 64)
+	retained := commitState(t, db, stale, 2, 64)
+	before := countStateEntries(db)
+
+	if err := NewPruner(db, bloomPath, 1024*1024).Prune([]common.Hash{retained}); err != nil {
+		t.Fatalf("pruning failed: %v", err)
+	}
+	checkState(t, db, retained)
+	if ok, _ := db.Has(stale[:]); ok {
+		t.Errorf("stale state root not pruned")
+	}
+	if after := countStateEntries(db); after >= before {
+		t.Errorf("nothing pruned: %d entries before, %d after", before, after)
+	}
+	if _, err := os.Stat(bloomPath); !os.IsNotExist(err) {
+		t.Errorf("bloom filter not removed: %v", err)
+	}
+	// Pruning without a retained state must fail without deleting anything
+	before = countStateEntries(db)
+	if err := NewPruner(db, bloomPath, 1024*1024).Prune([]common.Hash{stale}); err == nil {
+		t.Fatalf("pruning with missing state succeeded")
+	}
+	if after := countStateEntries(db); after != before {
+		t.Errorf("failed pruning deleted data: %d entries before, %d after", before, after)
+	}
+}
+
+func TestRecoverPruning(t *testing.T) {
+	db, bloomPath, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	stale := commitState(t, db, common.Hash{}, 1, 32)
+	retained := commitState(t, db, common.Hash{}, 2, 32)
+
+	// Nothing to recover without a persisted filter
+	if err := RecoverPruning(db, bloomPath); err != nil {
+		t.Fatalf("recovery without filter failed: %v", err)
+	}
+	checkState(t, db, stale)
+
+	// Simulate a crash right after the marking phase
+	bloom := newStateBloom(1024 * 1024)
+	if err := markState(db, bloom, retained); err != nil {
+		t.Fatalf("marking failed: %v", err)
+	}
+	if err := bloom.commit(bloomPath); err != nil {
+		t.Fatalf("failed to persist filter: %v", err)
+	}
+	if err := RecoverPruning(db, bloomPath); err != nil {
+		t.Fatalf("recovery failed: %v", err)
+	}
+	checkState(t, db, retained)
+	if ok, _ := db.Has(stale[:]); ok {
+		t.Errorf("stale state root not pruned")
+	}
+}
+
+func TestStateBloomPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pruner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, BloomFileName)
+
+	// The filter spans several batches of the encoding
+	bloom := newStateBloom(2*bloomBatchSize + 1024)
+	hash := common.HexToHash("0xdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	bloom.add(hash)
+
+	if err := bloom.commit(path); err != nil {
+		t.Fatalf("failed to persist filter: %v", err)
+	}
+	loaded, err := loadStateBloom(path)
+	if err != nil {
+		t.Fatalf("failed to load filter: %v", err)
+	}
+	if !loaded.contains(hash[:]) {
+		t.Errorf("loaded filter misses inserted hash")
+	}
+	if loaded.contains(common.HexToHash("0x01").Bytes()) {
+		t.Errorf("loaded filter contains unrelated hash")
+	}
+	// Corrupted filters must be rejected
+	blob, _ := ioutil.ReadFile(path)
+	blob[0] ^= 0xff
+	ioutil.WriteFile(path, blob, 0600)
+	if _, err := loadStateBloom(path); err != errBloomCorrupted {
+		t.Errorf("corruption error mismatch: have %v, want %v", err, errBloomCorrupted)
+	}
+}
+
+func TestMigrateRefcount(t *testing.T) {
+	db, _, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	stale := commitState(t, db, common.Hash{}, 1, 32)
+	retained := commitState(t, db, stale, 2, 32)
+
+	if err := MigrateRefcount(db); err == nil {
+		t.Fatalf("migration without head block succeeded")
+	}
+	genesis := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0), Root: types.EmptyRootHash})
+	head := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Root: retained, ParentHash: genesis.Hash()})
+	for _, block := range []*types.Block{genesis, head} {
+		rawdb.WriteHeader(db, block.Header())
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+	}
+	rawdb.WriteHeadBlockHash(db, head.Hash())
+
+	// Simulate an interrupted migration, which must be discarded
+	rawdb.WriteTrieRefcountMigration(db)
+	if err := trie.TrackRefcounts(db, stale, nil); err != nil {
+		t.Fatalf("failed to count stale state: %v", err)
+	}
+	if err := MigrateRefcount(db); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	if !rawdb.ReadTrieRefcount(db) || rawdb.ReadTrieRefcountMigration(db) {
+		t.Fatalf("migration not recorded as finished")
+	}
+	if err := MigrateRefcount(db); err != errRefcountEnabled {
+		t.Fatalf("repeated migration error mismatch: have %v, want %v", err, errRefcountEnabled)
+	}
+	states := rawdb.ReadRetainedStates(db)
+	if len(states) == 0 || states[0].Root != retained {
+		t.Fatalf("retained states mismatch: %v", states)
+	}
+	// Releasing the counted state must delete it, leaving uncounted data alone
+	before := countStateEntries(db)
+	if err := state.NewDatabaseWithRefcount(db, 0).TrieDB().Release(retained); err != nil {
+		t.Fatalf("failed to release state: %v", err)
+	}
+	if ok, _ := db.Has(stale[:]); !ok {
+		t.Errorf("uncounted state root deleted")
+	}
+	if ok, _ := db.Has(retained[:]); ok {
+		t.Errorf("released state root not deleted")
+	}
+	if after := countStateEntries(db); after >= before {
+		t.Errorf("nothing deleted: %d entries before, %d after", before, after)
+	}
+}
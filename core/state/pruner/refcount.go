@@ -0,0 +1,137 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/core/rawdb"
+	"github.com/susy-go/susy-graviton/core/state"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/log"
+	"github.com/susy-go/susy-graviton/sofdb"
+	"github.com/susy-go/susy-graviton/srlp"
+	"github.com/susy-go/susy-graviton/trie"
+)
+
+// errRefcountEnabled is returned if a database already reference counting its
+// trie nodes is migrated.
+var errRefcountEnabled = errors.New("trie nodes already reference counted")
+
+// emptyCode is the known hash of the empty SVM bytecode.
+var emptyCode = crypto.Keccak256(nil)
+
+// MigrateRefcount turns on reference counting of the trie nodes for a database
+// which was used without it. The states of the recent blocks the blockchain
+// persists on shutdown are counted and retained, the genesis state is counted
+// and retained forever. Nodes not reachable from them stay uncounted and are
+// never deleted, but other states lose the nodes they share with the counted
+// ones once those are released, so the database should be pruned first.
+//
+// If the migration is interrupted, the counts written so far are inconsistent.
+// Running it again discards them and starts over, the blockchain refuses to
+// open the database until then.
+func MigrateRefcount(db *sofdb.LDBDatabase) error {
+	if rawdb.ReadTrieRefcount(db) {
+		return errRefcountEnabled
+	}
+	states, err := recentStates(db)
+	if err != nil {
+		return err
+	}
+	if rawdb.ReadTrieRefcountMigration(db) {
+		log.Warn("Restarting interrupted trie refcount migration")
+		if err := deleteRefcounts(db); err != nil {
+			return err
+		}
+	}
+	rawdb.WriteTrieRefcountMigration(db)
+
+	// Count the retained states, along with their storage tries and codes
+	start := time.Now()
+	resolve := func(leaf []byte) ([]common.Hash, []common.Hash) {
+		var (
+			account state.Account
+			tries   []common.Hash
+			blobs   []common.Hash
+		)
+		if err := srlp.DecodeBytes(leaf, &account); err != nil {
+			return nil, nil
+		}
+		if account.Root != types.EmptyRootHash {
+			tries = append(tries, account.Root)
+		}
+		if !bytes.Equal(account.CodeHash, emptyCode) {
+			blobs = append(blobs, common.BytesToHash(account.CodeHash))
+		}
+		return tries, blobs
+	}
+	track := func(root common.Hash) error {
+		if root == types.EmptyRootHash {
+			return nil
+		}
+		if err := trie.TrackRefcounts(db, root, resolve); err != nil {
+			return fmt.Errorf("failed to count state %x: %v", root, err)
+		}
+		log.Info("Counted state references", "root", root, "elapsed", common.PrettyDuration(time.Since(start)))
+		return nil
+	}
+	if root, ok := blockRoot(db, 0); ok && hasState(db, root) {
+		if err := track(root); err != nil {
+			return err
+		}
+	}
+	for _, state := range states {
+		if err := track(state.Root); err != nil {
+			return err
+		}
+	}
+	rawdb.WriteRetainedStates(db, states)
+	rawdb.WriteTrieRefcount(db)
+	rawdb.DeleteTrieRefcountMigration(db)
+
+	log.Info("Migrated to trie reference counting", "states", len(states), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// deleteRefcounts removes all the reference counting metadata of trie nodes.
+func deleteRefcounts(db *sofdb.LDBDatabase) error {
+	batch := db.NewBatch()
+	for _, prefix := range trie.NodeMetadataPrefixes() {
+		it := db.NewIteratorWithPrefix(prefix)
+		for it.Next() {
+			batch.Delete(common.CopyBytes(it.Key()))
+			if batch.ValueSize() >= sofdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					it.Release()
+					return err
+				}
+				batch.Reset()
+			}
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
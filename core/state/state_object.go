@@ -23,6 +23,7 @@ import (
 	"math/big"
 
 	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/core/types"
 	"github.com/susy-go/susy-graviton/crypto"
 	"github.com/susy-go/susy-graviton/srlp"
 )
@@ -214,6 +215,19 @@ func (self *stateObject) setState(key, value common.Hash) {
 	self.dirtyStorage[key] = value
 }
 
+// SetStorage drops the account's storage trie and replaces it with the given
+// slots. The previous contents are not journalled and can't be reverted.
+func (self *stateObject) SetStorage(db Database, storage map[common.Hash]common.Hash) {
+	self.trie, _ = db.OpenStorageTrie(self.addrHash, common.Hash{})
+	self.data.Root = types.EmptyRootHash
+	self.originStorage = make(Storage)
+	self.dirtyStorage = make(Storage)
+
+	for key, value := range storage {
+		self.SetState(db, key, value)
+	}
+}
+
 // updateTrie writes cached storage modifications into the object's storage trie.
 func (self *stateObject) updateTrie(db Database) Trie {
 	tr := self.getTrie(db)
@@ -435,3 +435,31 @@ func TestCopyOfCopy(t *testing.T) {
 		t.Fatalf("2nd copy fail, expected 42, got %v", got)
 	}
 }
+
+// Tests that replacing the storage of an account drops all the slots that were
+// already committed and only leaves the given ones.
+func TestSetStorage(t *testing.T) {
+	sdb, _ := New(common.Hash{}, NewDatabase(sofdb.NewMemDatabase()))
+	addr := common.HexToAddress("aaaa")
+	sdb.SetState(addr, common.Hash{1}, common.Hash{1})
+	sdb.SetState(addr, common.Hash{2}, common.Hash{2})
+
+	root, _ := sdb.Commit(false)
+	sdb, _ = New(root, sdb.Database())
+
+	sdb.SetStorage(addr, map[common.Hash]common.Hash{{2}: {3}, {4}: {4}})
+	for key, want := range map[common.Hash]common.Hash{{1}: {}, {2}: {3}, {4}: {4}} {
+		if got := sdb.GetState(addr, key); got != want {
+			t.Errorf("slot %x mismatch: have %x, want %x", key, got, want)
+		}
+	}
+	// Make sure the replaced storage survives hashing and committing
+	root, _ = sdb.Commit(false)
+	sdb, _ = New(root, sdb.Database())
+	if got := sdb.GetState(addr, common.Hash{1}); got != (common.Hash{}) {
+		t.Errorf("dropped slot resurrected after commit: %x", got)
+	}
+	if got := sdb.GetState(addr, common.Hash{2}); got != (common.Hash{3}) {
+		t.Errorf("replaced slot mismatch after commit: have %x, want %x", got, common.Hash{3})
+	}
+}
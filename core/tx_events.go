@@ -0,0 +1,240 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/event"
+	"github.com/susy-go/susy-graviton/metrics"
+)
+
+// txEventQueueLimit is the maximum number of undelivered transaction events,
+// above which the oldest ones are dropped.
+const txEventQueueLimit = 4096
+
+// eventDropCounter counts the transaction events never delivered to a subscriber.
+var eventDropCounter = metrics.NewRegisteredCounter("txpool/events/dropped", nil)
+
+var (
+	// ErrTxReplaced is the reason reported for a pooled transaction replaced by
+	// another one with the same nonce.
+	ErrTxReplaced = errors.New("replaced by another transaction")
+
+	// ErrNonceGap is the reason reported for pending transactions demoted to the
+	// queue because a transaction preceding them was removed.
+	ErrNonceGap = errors.New("nonce gap")
+
+	// ErrQueueLifetime is the reason reported for queued transactions evicted
+	// after staying in the queue for longer than the configured lifetime.
+	ErrQueueLifetime = errors.New("queue lifetime exceeded")
+
+	// ErrAccountLimit is the reason reported for transactions evicted because
+	// their account exceeded its allowance of slots.
+	ErrAccountLimit = errors.New("account limit exceeded")
+
+	// ErrPoolLimit is the reason reported for transactions evicted because the
+	// pool exceeded its global limits.
+	ErrPoolLimit = errors.New("pool limit exceeded")
+)
+
+// TxEventKind is the kind of a transaction lifecycle change in the pool.
+type TxEventKind uint8
+
+const (
+	TxEventQueued   TxEventKind = iota // Transaction entered the non-executable queue
+	TxEventPending                     // Transaction became executable
+	TxEventReplaced                    // Transaction was replaced by another one
+	TxEventDemoted                     // Transaction was moved back to the queue
+	TxEventDropped                     // Transaction was removed from the pool
+	TxEventRejected                    // Transaction was not accepted into the pool
+	TxEventMined                       // Transaction was included into a block
+)
+
+// String implements fmt.Stringer.
+func (kind TxEventKind) String() string {
+	switch kind {
+	case TxEventQueued:
+		return "queued"
+	case TxEventPending:
+		return "pending"
+	case TxEventReplaced:
+		return "replaced"
+	case TxEventDemoted:
+		return "demoted"
+	case TxEventDropped:
+		return "dropped"
+	case TxEventRejected:
+		return "rejected"
+	case TxEventMined:
+		return "mined"
+	default:
+		return "unknown"
+	}
+}
+
+// TxPoolEvent is posted when a transaction changes its status in the pool,
+// along with the reason of the change if it isn't a regular progression.
+type TxPoolEvent struct {
+	Kind        TxEventKind
+	Tx          *types.Transaction
+	Reason      error       // Reason of rejection, replacement, demotion or removal
+	Replacement common.Hash // Hash of the replacing transaction if replaced by a public one
+}
+
+// txEvents delivers the transaction lifecycle events of the pool to their
+// subscribers in order, without blocking the pool or the other subscribers on
+// slow consumers: events which don't fit into the channel of a subscriber are
+// dropped for it.
+type txEvents struct {
+	subs  map[chan<- TxPoolEvent]struct{} // Channels of the subscribers
+	scope event.SubscriptionScope
+
+	queue []TxPoolEvent   // Events not yet delivered
+	wake  chan struct{}   // Notification channel for new queued events
+	quit  chan struct{}   // Termination channel to stop the delivery
+	lock  sync.Mutex      // Lock protecting the subscribers and the queue
+	wg    *sync.WaitGroup // Wait group of the pool for shutdown sync
+}
+
+// newTxEvents creates a transaction event dispatcher and starts delivering.
+func newTxEvents(wg *sync.WaitGroup) *txEvents {
+	events := &txEvents{
+		subs: make(map[chan<- TxPoolEvent]struct{}),
+		wake: make(chan struct{}, 1),
+		quit: make(chan struct{}),
+		wg:   wg,
+	}
+	wg.Add(1)
+	go events.loop()
+
+	return events
+}
+
+// subscribe registers a subscription to the transaction lifecycle events.
+func (events *txEvents) subscribe(ch chan<- TxPoolEvent) event.Subscription {
+	events.lock.Lock()
+	events.subs[ch] = struct{}{}
+	events.lock.Unlock()
+
+	return events.scope.Track(event.NewSubscription(func(unsub <-chan struct{}) error {
+		<-unsub
+
+		events.lock.Lock()
+		delete(events.subs, ch)
+		events.lock.Unlock()
+		return nil
+	}))
+}
+
+// active reports whether anybody is interested in the events, allowing to skip
+// assembling them otherwise.
+func (events *txEvents) active() bool {
+	return events.scope.Count() > 0
+}
+
+// post queues an event for delivery, dropping the oldest undelivered one if
+// the queue is full.
+func (events *txEvents) post(ev TxPoolEvent) {
+	events.lock.Lock()
+	if len(events.queue) >= txEventQueueLimit {
+		events.queue = events.queue[1:]
+		eventDropCounter.Inc(1)
+	}
+	events.queue = append(events.queue, ev)
+	events.lock.Unlock()
+
+	select {
+	case events.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop delivers the queued events until the dispatcher is closed.
+func (events *txEvents) loop() {
+	defer events.wg.Done()
+
+	for {
+		select {
+		case <-events.wake:
+			events.lock.Lock()
+			queue := events.queue
+			events.queue = nil
+
+			for _, ev := range queue {
+				for ch := range events.subs {
+					select {
+					case ch <- ev:
+					default:
+						eventDropCounter.Inc(1)
+					}
+				}
+			}
+			events.lock.Unlock()
+		case <-events.quit:
+			return
+		}
+	}
+}
+
+// close terminates the delivery and all the subscriptions.
+func (events *txEvents) close() {
+	close(events.quit)
+	events.scope.Close()
+}
+
+// SubscribeTxPoolEvent registers a subscription of TxPoolEvent, reporting every
+// lifecycle change of the non-private transactions in the pool. Events are never
+// waited for: those not fitting into the channel are dropped, so it should be
+// buffered.
+func (pool *TxPool) SubscribeTxPoolEvent(ch chan<- TxPoolEvent) event.Subscription {
+	return pool.events.subscribe(ch)
+}
+
+// notify posts a transaction lifecycle event, unless nobody is listening or the
+// transaction is private.
+func (pool *TxPool) notify(kind TxEventKind, tx *types.Transaction, reason error) {
+	if !pool.events.active() || pool.privates.contains(tx.Hash()) {
+		return
+	}
+	pool.events.post(TxPoolEvent{Kind: kind, Tx: tx, Reason: reason})
+}
+
+// notifyReplaced posts the event of a transaction replaced by another one, the
+// hash of which is only reported if it isn't private.
+func (pool *TxPool) notifyReplaced(old, tx *types.Transaction) {
+	if !pool.events.active() || pool.privates.contains(old.Hash()) {
+		return
+	}
+	ev := TxPoolEvent{Kind: TxEventReplaced, Tx: old, Reason: ErrTxReplaced}
+	if !pool.privates.contains(tx.Hash()) {
+		ev.Replacement = tx.Hash()
+	}
+	pool.events.post(ev)
+}
+
+// unpayable returns the reason why a transaction was filtered out by balance or
+// gas limit.
+func (pool *TxPool) unpayable(tx *types.Transaction) error {
+	if tx.Gas() > pool.currentMaxGas {
+		return ErrGasLimit
+	}
+	return ErrInsufficientFunds
+}
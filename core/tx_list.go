@@ -247,18 +247,13 @@ func (l *txList) Overlaps(tx *types.Transaction) bool {
 // transaction was accepted, and if yes, any previous transaction it replaced.
 //
 // If the new transaction is accepted into the list, the lists' cost and gas
-// thresholds are also potentially updated.
-func (l *txList) Add(tx *types.Transaction, priceBump uint64) (bool, *types.Transaction) {
+// thresholds are also potentially updated. Replacing an existing transaction
+// with the same nonce is subject to the admission policy.
+func (l *txList) Add(tx *types.Transaction, policy TxAdmissionPolicy) (bool, *types.Transaction) {
 	// If there's an older better transaction, abort
 	old := l.txs.Get(tx.Nonce())
-	if old != nil {
-		threshold := new(big.Int).Div(new(big.Int).Mul(old.GasPrice(), big.NewInt(100+int64(priceBump))), big.NewInt(100))
-		// Have to ensure that the new gas price is higher than the old gas
-		// price as well as checking the percentage threshold to ensure that
-		// this is accurate for low (Wei-level) gas price replacements
-		if old.GasPrice().Cmp(tx.GasPrice()) >= 0 || threshold.Cmp(tx.GasPrice()) > 0 {
-			return false, nil
-		}
+	if old != nil && !policy.Replace(old, tx) {
+		return false, nil
 	}
 	// Otherwise overwrite the old transaction with the current one
 	l.txs.Put(tx)
@@ -364,55 +359,70 @@ func (l *txList) Flatten() types.Transactions {
 }
 
 // priceHeap is a heap.Interface implementation over transactions for retrieving
-// price-sorted transactions to discard when the pool fills up.
-type priceHeap []*types.Transaction
+// the worst transactions according to a transaction ordering to discard when
+// the pool fills up.
+type priceHeap struct {
+	ordering TxOrdering
+	items    []*PooledTx
+}
 
-func (h priceHeap) Len() int      { return len(h) }
-func (h priceHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *priceHeap) Len() int      { return len(h.items) }
+func (h *priceHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
 
-func (h priceHeap) Less(i, j int) bool {
-	// Sort primarily by price, returning the cheaper one
-	switch h[i].GasPrice().Cmp(h[j].GasPrice()) {
-	case -1:
+func (h *priceHeap) Less(i, j int) bool {
+	// Sort primarily by the eviction order of the ordering, returning the worse one
+	switch {
+	case evictBefore(h.ordering, h.items[i], h.items[j]):
 		return true
-	case 1:
+	case evictBefore(h.ordering, h.items[j], h.items[i]):
 		return false
 	}
-	// If the prices match, stabilize via nonces (high nonce is worse)
-	return h[i].Nonce() > h[j].Nonce()
+	// If the ordering ties, stabilize via nonces (high nonce is worse)
+	return h.items[i].Tx.Nonce() > h.items[j].Tx.Nonce()
 }
 
 func (h *priceHeap) Push(x interface{}) {
-	*h = append(*h, x.(*types.Transaction))
+	h.items = append(h.items, x.(*PooledTx))
 }
 
 func (h *priceHeap) Pop() interface{} {
-	old := *h
+	old := h.items
 	n := len(old)
 	x := old[n-1]
-	*h = old[0 : n-1]
+	h.items = old[0 : n-1]
 	return x
 }
 
-// txPricedList is a price-sorted heap to allow operating on transactions pool
-// contents in a price-incrementing way.
+// txPricedList is a heap sorted by a transaction ordering to allow operating on
+// transactions pool contents in a worst-first way.
 type txPricedList struct {
-	all    *txLookup  // Pointer to the map of all transactions
-	items  *priceHeap // Heap of prices of all the stored transactions
-	stales int        // Number of stale price points to (re-heap trigger)
+	all    *txLookup    // Pointer to the map of all transactions
+	signer types.Signer // Signer to derive the senders of transactions with
+	items  *priceHeap   // Heap of the ordered stored transactions
+	stales int          // Number of stale price points to (re-heap trigger)
+	sorted bool         // Whether the heap is sorted by price (default ordering)
 }
 
-// newTxPricedList creates a new price-sorted transaction heap.
-func newTxPricedList(all *txLookup) *txPricedList {
+// newTxPricedList creates a new transaction heap sorted by the given ordering.
+func newTxPricedList(all *txLookup, signer types.Signer, ordering TxOrdering) *txPricedList {
+	_, sorted := ordering.(priceOrdering)
 	return &txPricedList{
-		all:   all,
-		items: new(priceHeap),
+		all:    all,
+		signer: signer,
+		items:  &priceHeap{ordering: ordering},
+		sorted: sorted,
 	}
 }
 
+// pooled wraps a transaction with the metadata needed by the ordering.
+func (l *txPricedList) pooled(tx *types.Transaction, seq uint64) *PooledTx {
+	from, _ := types.Sender(l.signer, tx) // already validated
+	return &PooledTx{Tx: tx, From: from, Seq: seq}
+}
+
 // Put inserts a new transaction into the heap.
 func (l *txPricedList) Put(tx *types.Transaction) {
-	heap.Push(l.items, tx)
+	heap.Push(l.items, l.pooled(tx, l.all.Seq(tx.Hash())))
 }
 
 // Removed notifies the prices transaction list that an old transaction dropped
@@ -421,15 +431,15 @@ func (l *txPricedList) Put(tx *types.Transaction) {
 func (l *txPricedList) Removed() {
 	// Bump the stale counter, but exit if still too low (< 25%)
 	l.stales++
-	if l.stales <= len(*l.items)/4 {
+	if l.stales <= l.items.Len()/4 {
 		return
 	}
 	// Seems we've reached a critical number of stale transactions, reheap
-	reheap := make(priceHeap, 0, l.all.Count())
+	reheap := &priceHeap{ordering: l.items.ordering, items: make([]*PooledTx, 0, l.all.Count())}
 
-	l.stales, l.items = 0, &reheap
-	l.all.Range(func(hash common.Hash, tx *types.Transaction) bool {
-		*l.items = append(*l.items, tx)
+	l.stales, l.items = 0, reheap
+	l.all.RangeSeq(func(hash common.Hash, tx *types.Transaction, seq uint64) bool {
+		l.items.items = append(l.items.items, l.pooled(tx, seq))
 		return true
 	})
 	heap.Init(l.items)
@@ -437,46 +447,52 @@ func (l *txPricedList) Removed() {
 
 // Cap finds all the transactions below the given price threshold, drops them
 // from the priced list and returns them for further removal from the entire pool.
-func (l *txPricedList) Cap(threshold *big.Int, local *accountSet) types.Transactions {
+//
+// Unless the heap is sorted by price, all the transactions need to be checked.
+func (l *txPricedList) Cap(threshold *big.Int, exempt func(common.Address) bool) types.Transactions {
 	drop := make(types.Transactions, 0, 128) // Remote underpriced transactions to drop
-	save := make(types.Transactions, 0, 64)  // Local underpriced transactions to keep
+	save := make([]*PooledTx, 0, 64)         // Local underpriced transactions to keep
 
-	for len(*l.items) > 0 {
+	for l.items.Len() > 0 {
 		// Discard stale transactions if found during cleanup
-		tx := heap.Pop(l.items).(*types.Transaction)
-		if l.all.Get(tx.Hash()) == nil {
+		item := heap.Pop(l.items).(*PooledTx)
+		if l.all.Get(item.Tx.Hash()) == nil {
 			l.stales--
 			continue
 		}
 		// Stop the discards if we've reached the threshold
-		if tx.GasPrice().Cmp(threshold) >= 0 {
-			save = append(save, tx)
-			break
+		if item.Tx.GasPrice().Cmp(threshold) >= 0 {
+			save = append(save, item)
+			if l.sorted {
+				break
+			}
+			continue
 		}
-		// Non stale transaction found, discard unless local
-		if local.containsTx(tx) {
-			save = append(save, tx)
+		// Non stale transaction found, discard unless exempt
+		if exempt(item.From) {
+			save = append(save, item)
 		} else {
-			drop = append(drop, tx)
+			drop = append(drop, item.Tx)
 		}
 	}
-	for _, tx := range save {
-		heap.Push(l.items, tx)
+	for _, item := range save {
+		heap.Push(l.items, item)
 	}
 	return drop
 }
 
-// Underpriced checks whether a transaction is cheaper than (or as cheap as) the
-// lowest priced transaction currently being tracked.
-func (l *txPricedList) Underpriced(tx *types.Transaction, local *accountSet) bool {
-	// Local transactions cannot be underpriced
-	if local.containsTx(tx) {
+// Underpriced checks whether a transaction is worse than (or as bad as) the
+// worst transaction currently being tracked.
+func (l *txPricedList) Underpriced(tx *types.Transaction, exempt func(common.Address) bool) bool {
+	// Exempt transactions cannot be underpriced
+	item := l.pooled(tx, l.all.NextSeq())
+	if exempt(item.From) {
 		return false
 	}
 	// Discard stale price points if found at the heap start
-	for len(*l.items) > 0 {
-		head := []*types.Transaction(*l.items)[0]
-		if l.all.Get(head.Hash()) == nil {
+	for l.items.Len() > 0 {
+		head := l.items.items[0]
+		if l.all.Get(head.Tx.Hash()) == nil {
 			l.stales--
 			heap.Pop(l.items)
 			continue
@@ -484,37 +500,36 @@ func (l *txPricedList) Underpriced(tx *types.Transaction, local *accountSet) boo
 		break
 	}
 	// Check if the transaction is underpriced or not
-	if len(*l.items) == 0 {
+	if l.items.Len() == 0 {
 		log.Error("Pricing query for empty pool") // This cannot happen, print to catch programming errors
 		return false
 	}
-	cheapest := []*types.Transaction(*l.items)[0]
-	return cheapest.GasPrice().Cmp(tx.GasPrice()) >= 0
+	return !evictBefore(l.items.ordering, l.items.items[0], item)
 }
 
-// Discard finds a number of most underpriced transactions, removes them from the
-// priced list and returns them for further removal from the entire pool.
-func (l *txPricedList) Discard(count int, local *accountSet) types.Transactions {
+// Discard finds a number of worst transactions, removes them from the priced
+// list and returns them for further removal from the entire pool.
+func (l *txPricedList) Discard(count int, exempt func(common.Address) bool) types.Transactions {
 	drop := make(types.Transactions, 0, count) // Remote underpriced transactions to drop
-	save := make(types.Transactions, 0, 64)    // Local underpriced transactions to keep
+	save := make([]*PooledTx, 0, 64)           // Local underpriced transactions to keep
 
-	for len(*l.items) > 0 && count > 0 {
+	for l.items.Len() > 0 && count > 0 {
 		// Discard stale transactions if found during cleanup
-		tx := heap.Pop(l.items).(*types.Transaction)
-		if l.all.Get(tx.Hash()) == nil {
+		item := heap.Pop(l.items).(*PooledTx)
+		if l.all.Get(item.Tx.Hash()) == nil {
 			l.stales--
 			continue
 		}
-		// Non stale transaction found, discard unless local
-		if local.containsTx(tx) {
-			save = append(save, tx)
+		// Non stale transaction found, discard unless exempt
+		if exempt(item.From) {
+			save = append(save, item)
 		} else {
-			drop = append(drop, tx)
+			drop = append(drop, item.Tx)
 			count--
 		}
 	}
-	for _, tx := range save {
-		heap.Push(l.items, tx)
+	for _, item := range save {
+		heap.Push(l.items, item)
 	}
 	return drop
 }
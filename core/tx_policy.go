@@ -0,0 +1,420 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/core/types"
+)
+
+var (
+	// ErrSenderNotAllowed is returned if a permissioned transaction pool receives
+	// a transaction from an account not allowed to transact.
+	ErrSenderNotAllowed = errors.New("sender not allowed")
+
+	// ErrContractNotAllowed is returned if a permissioned transaction pool receives
+	// a transaction calling a whitelisted contract from an account not on its list.
+	ErrContractNotAllowed = errors.New("sender not whitelisted for contract")
+)
+
+const (
+	// PriceTxAdmission is the name of the default admission policy, accepting any
+	// transaction paying at least the minimum gas price.
+	PriceTxAdmission = "price"
+
+	// PermissionedTxAdmission is the name of the admission policy restricting the
+	// accounts allowed to transact, optionally with free transactions.
+	PermissionedTxAdmission = "permissioned"
+
+	// PriceTxOrdering is the name of the default ordering, preferring transactions
+	// paying higher gas prices.
+	PriceTxOrdering = "price"
+
+	// FIFOTxOrdering is the name of the ordering preferring transactions in the
+	// order they arrived into the pool.
+	FIFOTxOrdering = "fifo"
+)
+
+// TxContractWhitelist is the list of accounts allowed to call a contract.
+type TxContractWhitelist struct {
+	Contract common.Address
+	Senders  []common.Address
+}
+
+// PooledTx is a transaction tracked by the pool along with the metadata the
+// orderings may rely on.
+type PooledTx struct {
+	Tx   *types.Transaction
+	From common.Address // Sender of the transaction
+	Seq  uint64         // Sequence number of the arrival into the pool
+}
+
+// TxAdmissionPolicy decides which transactions the pool accepts, and which ones
+// may be evicted from it when it is full.
+type TxAdmissionPolicy interface {
+	// Admit checks whether a validated transaction is accepted into the pool.
+	// The minimum gas price is the one currently configured for the pool, local
+	// transactions are exempt from it by default.
+	Admit(tx *types.Transaction, from common.Address, local bool, minPrice *big.Int) error
+
+	// Replace checks whether a transaction may replace an already pooled one
+	// with the same sender and nonce.
+	Replace(old, tx *types.Transaction) bool
+
+	// Exempt reports whether the transactions of an account are exempt from
+	// the eviction rules, similarly to the local ones.
+	Exempt(from common.Address) bool
+}
+
+// TxOrdering decides the order in which pooled transactions are included into
+// blocks, the reverse of which is used for evicting them when the pool fills up
+// unless the ordering implements TxEvictionOrdering too. Transactions of the
+// same account are always ordered by nonce, the ordering only decides between
+// the executable heads of different accounts.
+type TxOrdering interface {
+	// Less reports whether a should be included into blocks before b.
+	Less(a, b *PooledTx) bool
+}
+
+// TxEvictionOrdering is implemented by the transaction orderings whose eviction
+// order is not the reverse of their inclusion order.
+type TxEvictionOrdering interface {
+	// Evict reports whether a should be evicted from a full pool before b.
+	Evict(a, b *PooledTx) bool
+}
+
+// evictBefore reports whether a should be evicted from a full pool before b
+// according to the ordering.
+func evictBefore(ordering TxOrdering, a, b *PooledTx) bool {
+	if eviction, ok := ordering.(TxEvictionOrdering); ok {
+		return eviction.Evict(a, b)
+	}
+	return ordering.Less(b, a)
+}
+
+// TxAdmissionConstructor creates an admission policy from the pool configs.
+type TxAdmissionConstructor func(config *TxPoolConfig) TxAdmissionPolicy
+
+// TxOrderingConstructor creates an ordering from the pool configs.
+type TxOrderingConstructor func(config *TxPoolConfig) TxOrdering
+
+var (
+	policyLock sync.RWMutex
+
+	admissions = map[string]TxAdmissionConstructor{
+		PriceTxAdmission:        newPriceAdmission,
+		PermissionedTxAdmission: newPermissionedAdmission,
+	}
+	orderings = map[string]TxOrderingConstructor{
+		PriceTxOrdering: func(*TxPoolConfig) TxOrdering { return priceOrdering{} },
+		FIFOTxOrdering:  func(*TxPoolConfig) TxOrdering { return fifoOrdering{} },
+	}
+)
+
+// RegisterTxAdmission makes an admission policy selectable by name through the
+// transaction pool configs. It panics if the name is already taken.
+func RegisterTxAdmission(name string, constructor TxAdmissionConstructor) {
+	policyLock.Lock()
+	defer policyLock.Unlock()
+
+	if _, ok := admissions[name]; ok {
+		panic(fmt.Sprintf("duplicate transaction admission policy %q", name))
+	}
+	admissions[name] = constructor
+}
+
+// RegisterTxOrdering makes a transaction ordering selectable by name through
+// the transaction pool configs. It panics if the name is already taken.
+func RegisterTxOrdering(name string, constructor TxOrderingConstructor) {
+	policyLock.Lock()
+	defer policyLock.Unlock()
+
+	if _, ok := orderings[name]; ok {
+		panic(fmt.Sprintf("duplicate transaction ordering %q", name))
+	}
+	orderings[name] = constructor
+}
+
+// TxAdmissions returns the names of the selectable admission policies.
+func TxAdmissions() []string {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+
+	names := make([]string, 0, len(admissions))
+	for name := range admissions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TxOrderings returns the names of the selectable transaction orderings.
+func TxOrderings() []string {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+
+	names := make([]string, 0, len(orderings))
+	for name := range orderings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupTxAdmission retrieves the constructor of a named admission policy.
+func lookupTxAdmission(name string) (TxAdmissionConstructor, bool) {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+
+	constructor, ok := admissions[name]
+	return constructor, ok
+}
+
+// lookupTxOrdering retrieves the constructor of a named transaction ordering.
+func lookupTxOrdering(name string) (TxOrderingConstructor, bool) {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+
+	constructor, ok := orderings[name]
+	return constructor, ok
+}
+
+// priceAdmission is the default admission policy, accepting remote transactions
+// paying at least the minimum gas price and replacements bumping the price by
+// the configured percentage.
+type priceAdmission struct {
+	priceBump uint64
+}
+
+// newPriceAdmission creates the default price based admission policy.
+func newPriceAdmission(config *TxPoolConfig) TxAdmissionPolicy {
+	return &priceAdmission{priceBump: config.PriceBump}
+}
+
+// Admit implements TxAdmissionPolicy, dropping remote transactions under the
+// minimal accepted gas price.
+func (p *priceAdmission) Admit(tx *types.Transaction, from common.Address, local bool, minPrice *big.Int) error {
+	if !local && minPrice.Cmp(tx.GasPrice()) > 0 {
+		return ErrUnderpriced
+	}
+	return nil
+}
+
+// Replace implements TxAdmissionPolicy, requiring the replacement to pay both a
+// higher gas price and at least the price bump percentage more.
+func (p *priceAdmission) Replace(old, tx *types.Transaction) bool {
+	threshold := new(big.Int).Div(new(big.Int).Mul(old.GasPrice(), big.NewInt(100+int64(p.priceBump))), big.NewInt(100))
+	// Have to ensure that the new gas price is higher than the old gas
+	// price as well as checking the percentage threshold to ensure that
+	// this is accurate for low (Wei-level) gas price replacements
+	return old.GasPrice().Cmp(tx.GasPrice()) < 0 && threshold.Cmp(tx.GasPrice()) <= 0
+}
+
+// Exempt implements TxAdmissionPolicy, only local accounts are exempt.
+func (p *priceAdmission) Exempt(from common.Address) bool {
+	return false
+}
+
+// permissionedAdmission is an admission policy for private networks, accepting
+// transactions only from allowed accounts and calls to whitelisted contracts
+// only from their listed callers. Privileged accounts are always allowed, may
+// transact for free and are never evicted.
+type permissionedAdmission struct {
+	priceAdmission
+
+	allowed    map[common.Address]struct{}                    // Accounts allowed to transact, nil allows anyone
+	privileged map[common.Address]struct{}                    // Accounts allowed to transact for free
+	contracts  map[common.Address]map[common.Address]struct{} // Allowed callers of whitelisted contracts
+}
+
+// newPermissionedAdmission creates a permissioned admission policy from the
+// account lists of the pool configs.
+func newPermissionedAdmission(config *TxPoolConfig) TxAdmissionPolicy {
+	p := &permissionedAdmission{
+		priceAdmission: priceAdmission{priceBump: config.PriceBump},
+		privileged:     make(map[common.Address]struct{}),
+		contracts:      make(map[common.Address]map[common.Address]struct{}),
+	}
+	if len(config.AllowedSenders) > 0 {
+		p.allowed = make(map[common.Address]struct{})
+		for _, addr := range config.AllowedSenders {
+			p.allowed[addr] = struct{}{}
+		}
+	}
+	for _, addr := range config.PrivilegedSenders {
+		p.privileged[addr] = struct{}{}
+	}
+	for _, list := range config.ContractWhitelists {
+		senders := p.contracts[list.Contract]
+		if senders == nil {
+			senders = make(map[common.Address]struct{})
+			p.contracts[list.Contract] = senders
+		}
+		for _, addr := range list.Senders {
+			senders[addr] = struct{}{}
+		}
+	}
+	return p
+}
+
+// Admit implements TxAdmissionPolicy, checking the sender against the allowed
+// accounts and the whitelist of the called contract, if any.
+func (p *permissionedAdmission) Admit(tx *types.Transaction, from common.Address, local bool, minPrice *big.Int) error {
+	if _, ok := p.privileged[from]; ok {
+		return nil
+	}
+	if p.allowed != nil {
+		if _, ok := p.allowed[from]; !ok {
+			return ErrSenderNotAllowed
+		}
+	}
+	if to := tx.To(); to != nil {
+		if senders, ok := p.contracts[*to]; ok {
+			if _, ok := senders[from]; !ok {
+				return ErrContractNotAllowed
+			}
+		}
+	}
+	return p.priceAdmission.Admit(tx, from, local, minPrice)
+}
+
+// Exempt implements TxAdmissionPolicy, privileged accounts are exempt.
+func (p *permissionedAdmission) Exempt(from common.Address) bool {
+	_, ok := p.privileged[from]
+	return ok
+}
+
+// priceOrdering is the default ordering, preferring higher gas prices.
+type priceOrdering struct{}
+
+// Less implements TxOrdering.
+func (priceOrdering) Less(a, b *PooledTx) bool {
+	return a.Tx.GasPrice().Cmp(b.Tx.GasPrice()) > 0
+}
+
+// fifoOrdering prefers the transactions arrived earlier into the pool, and
+// evicts the oldest ones first so that a full pool keeps accepting new ones.
+type fifoOrdering struct{}
+
+// Less implements TxOrdering.
+func (fifoOrdering) Less(a, b *PooledTx) bool {
+	return a.Seq < b.Seq
+}
+
+// Evict implements TxEvictionOrdering.
+func (fifoOrdering) Evict(a, b *PooledTx) bool {
+	return a.Seq < b.Seq
+}
+
+// TxIterator iterates over a set of transactions in the order they should be
+// included into a block, respecting the nonce order of each account.
+type TxIterator interface {
+	// Peek returns the next transaction, or nil if none is left.
+	Peek() *types.Transaction
+
+	// Shift replaces the current best head with the next one from the same account.
+	Shift()
+
+	// Pop removes the best transaction, *not* replacing it with the next one from
+	// the same account, as the remaining ones cannot be executed anymore.
+	Pop()
+}
+
+// orderedHeads is a heap of the executable heads of a set of accounts, sorted
+// by a transaction ordering.
+type orderedHeads struct {
+	ordering TxOrdering
+	items    []*PooledTx
+}
+
+func (h *orderedHeads) Len() int           { return len(h.items) }
+func (h *orderedHeads) Less(i, j int) bool { return h.ordering.Less(h.items[i], h.items[j]) }
+func (h *orderedHeads) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *orderedHeads) Push(x interface{}) {
+	h.items = append(h.items, x.(*PooledTx))
+}
+
+func (h *orderedHeads) Pop() interface{} {
+	old := h.items
+	n := len(old)
+	x := old[n-1]
+	h.items = old[0 : n-1]
+	return x
+}
+
+// orderedTxs is a TxIterator returning the nonce sorted transactions of the
+// accounts in the order of a transaction ordering.
+type orderedTxs struct {
+	txs   map[common.Address]types.Transactions // Per account nonce-sorted list of transactions
+	heads *orderedHeads                         // Next transaction for each unique account
+	seq   func(hash common.Hash) uint64         // Retriever of the pool arrival sequences
+}
+
+// newOrderedTxs creates a transaction iterator over the given nonce sorted
+// transactions of the accounts. The map is consumed during iteration.
+func newOrderedTxs(signer types.Signer, txs map[common.Address]types.Transactions, ordering TxOrdering, seq func(common.Hash) uint64) *orderedTxs {
+	heads := &orderedHeads{ordering: ordering, items: make([]*PooledTx, 0, len(txs))}
+	for from, accTxs := range txs {
+		// Ensure the sender address is from the signer
+		if acc, err := types.Sender(signer, accTxs[0]); err != nil || acc != from {
+			delete(txs, from)
+			continue
+		}
+		heads.items = append(heads.items, &PooledTx{Tx: accTxs[0], From: from, Seq: seq(accTxs[0].Hash())})
+		txs[from] = accTxs[1:]
+	}
+	heap.Init(heads)
+
+	return &orderedTxs{
+		txs:   txs,
+		heads: heads,
+		seq:   seq,
+	}
+}
+
+// Peek implements TxIterator.
+func (t *orderedTxs) Peek() *types.Transaction {
+	if t.heads.Len() == 0 {
+		return nil
+	}
+	return t.heads.items[0].Tx
+}
+
+// Shift implements TxIterator.
+func (t *orderedTxs) Shift() {
+	head := t.heads.items[0]
+	if txs, ok := t.txs[head.From]; ok && len(txs) > 0 {
+		t.heads.items[0] = &PooledTx{Tx: txs[0], From: head.From, Seq: t.seq(txs[0].Hash())}
+		t.txs[head.From] = txs[1:]
+		heap.Fix(t.heads, 0)
+		return
+	}
+	heap.Pop(t.heads)
+}
+
+// Pop implements TxIterator.
+func (t *orderedTxs) Pop() {
+	heap.Pop(t.heads)
+}
@@ -137,6 +137,18 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	Snapshot   string        // Snapshot of all pooled transactions to survive node restarts (empty = disabled)
+	Resnapshot time.Duration // Time interval to regenerate the transaction pool snapshot
+
+	PrivateLifetime uint64 // Number of blocks private transactions are kept for inclusion
+
+	Admission string // Name of the policy deciding which transactions are accepted
+	Ordering  string // Name of the ordering deciding which transactions are preferred
+
+	AllowedSenders     []common.Address      // Accounts allowed to transact by the permissioned policy (empty = all)
+	PrivilegedSenders  []common.Address      // Accounts transacting for free and exempt from eviction by the permissioned policy
+	ContractWhitelists []TxContractWhitelist // Accounts allowed to call specific contracts by the permissioned policy
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -154,6 +166,13 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	GlobalQueue:  1024,
 
 	Lifetime: 3 * time.Hour,
+
+	Resnapshot: time.Minute,
+
+	PrivateLifetime: 25,
+
+	Admission: PriceTxAdmission,
+	Ordering:  PriceTxOrdering,
 }
 
 // sanitize checks the provided user configurations and changes anything that's
@@ -164,6 +183,10 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool journal time", "provided", conf.Rejournal, "updated", time.Second)
 		conf.Rejournal = time.Second
 	}
+	if conf.Resnapshot < time.Second {
+		log.Warn("Sanitizing invalid txpool snapshot time", "provided", conf.Resnapshot, "updated", time.Second)
+		conf.Resnapshot = time.Second
+	}
 	if conf.PriceLimit < 1 {
 		log.Warn("Sanitizing invalid txpool price limit", "provided", conf.PriceLimit, "updated", DefaultTxPoolConfig.PriceLimit)
 		conf.PriceLimit = DefaultTxPoolConfig.PriceLimit
@@ -192,6 +215,22 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool lifetime", "provided", conf.Lifetime, "updated", DefaultTxPoolConfig.Lifetime)
 		conf.Lifetime = DefaultTxPoolConfig.Lifetime
 	}
+	if conf.PrivateLifetime < 1 {
+		log.Warn("Sanitizing invalid txpool private lifetime", "provided", conf.PrivateLifetime, "updated", DefaultTxPoolConfig.PrivateLifetime)
+		conf.PrivateLifetime = DefaultTxPoolConfig.PrivateLifetime
+	}
+	if _, ok := lookupTxAdmission(conf.Admission); !ok {
+		if conf.Admission != "" {
+			log.Warn("Sanitizing unknown txpool admission policy", "provided", conf.Admission, "updated", DefaultTxPoolConfig.Admission)
+		}
+		conf.Admission = DefaultTxPoolConfig.Admission
+	}
+	if _, ok := lookupTxOrdering(conf.Ordering); !ok {
+		if conf.Ordering != "" {
+			log.Warn("Sanitizing unknown txpool ordering", "provided", conf.Ordering, "updated", DefaultTxPoolConfig.Ordering)
+		}
+		conf.Ordering = DefaultTxPoolConfig.Ordering
+	}
 	return conf
 }
 
@@ -218,14 +257,20 @@ type TxPool struct {
 	pendingState  *state.ManagedState // Pending state tracking virtual nonces
 	currentMaxGas uint64              // Current gas limit for transaction caps
 
-	locals  *accountSet // Set of local transaction to exempt from eviction rules
-	journal *txJournal  // Journal of local transaction to back up to disk
+	locals   *accountSet // Set of local transaction to exempt from eviction rules
+	journal  *txJournal  // Journal of local transaction to back up to disk
+	snapshot *txSnapshot // Snapshot of all transactions to back up to disk
 
-	pending map[common.Address]*txList   // All currently processable transactions
-	queue   map[common.Address]*txList   // Queued but non-processable transactions
-	beats   map[common.Address]time.Time // Last heartbeat from each known account
-	all     *txLookup                    // All transactions to allow lookups
-	priced  *txPricedList                // All transactions sorted by price
+	admission TxAdmissionPolicy // Policy deciding which transactions are accepted
+	ordering  TxOrdering        // Ordering deciding which transactions are preferred
+
+	pending  map[common.Address]*txList   // All currently processable transactions
+	queue    map[common.Address]*txList   // Queued but non-processable transactions
+	beats    map[common.Address]time.Time // Last heartbeat from each known account
+	all      *txLookup                    // All transactions to allow lookups
+	priced   *txPricedList                // All transactions sorted by price
+	privates *txPrivates                  // Transactions never to be announced
+	events   *txEvents                    // Lifecycle events of the transactions
 
 	wg sync.WaitGroup // for shutdown sync
 
@@ -248,15 +293,21 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		queue:       make(map[common.Address]*txList),
 		beats:       make(map[common.Address]time.Time),
 		all:         newTxLookup(),
+		privates:    newTxPrivates(),
 		chainHeadCh: make(chan ChainHeadEvent, chainHeadChanSize),
 		gasPrice:    new(big.Int).SetUint64(config.PriceLimit),
 	}
+	pool.events = newTxEvents(&pool.wg)
 	pool.locals = newAccountSet(pool.signer)
 	for _, addr := range config.Locals {
 		log.Info("Setting new local account", "address", addr)
 		pool.locals.add(addr)
 	}
-	pool.priced = newTxPricedList(pool.all)
+	admission, _ := lookupTxAdmission(config.Admission)
+	ordering, _ := lookupTxOrdering(config.Ordering)
+	pool.admission, pool.ordering = admission(&config), ordering(&config)
+
+	pool.priced = newTxPricedList(pool.all, pool.signer, pool.ordering)
 	pool.reset(nil, chain.CurrentBlock().Header())
 
 	// If local transactions and journaling is enabled, load from disk
@@ -270,6 +321,14 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 			log.Warn("Failed to rotate transaction journal", "err", err)
 		}
 	}
+	// If the full pool snapshot is enabled, restore the remote transactions too
+	if config.Snapshot != "" {
+		pool.snapshot = newTxSnapshot(config.Snapshot)
+
+		if err := pool.snapshot.load(pool.restoreSnapshot); err != nil {
+			log.Warn("Failed to load transaction pool snapshot", "err", err)
+		}
+	}
 	// Subscribe events from blockchain
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
 
@@ -298,6 +357,9 @@ func (pool *TxPool) loop() {
 	journal := time.NewTicker(pool.config.Rejournal)
 	defer journal.Stop()
 
+	snapshot := time.NewTicker(pool.config.Resnapshot)
+	defer snapshot.Stop()
+
 	// Track the previous head headers for transaction reorgs
 	head := pool.chain.CurrentBlock()
 
@@ -336,13 +398,14 @@ func (pool *TxPool) loop() {
 		case <-evict.C:
 			pool.mu.Lock()
 			for addr := range pool.queue {
-				// Skip local transactions from the eviction mechanism
-				if pool.locals.contains(addr) {
+				// Skip local and exempt transactions from the eviction mechanism
+				if pool.exempt(addr) {
 					continue
 				}
 				// Any non-locals old enough should be removed
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
 					for _, tx := range pool.queue[addr].Flatten() {
+						pool.notify(TxEventDropped, tx, ErrQueueLifetime)
 						pool.removeTx(tx.Hash(), true)
 					}
 				}
@@ -358,6 +421,18 @@ func (pool *TxPool) loop() {
 				}
 				pool.mu.Unlock()
 			}
+
+		// Handle transaction pool snapshot regeneration
+		case <-snapshot.C:
+			if pool.snapshot != nil {
+				pool.mu.Lock()
+				txs := pool.snapshotContent()
+				pool.mu.Unlock()
+
+				if err := pool.snapshot.write(txs); err != nil {
+					log.Warn("Failed to write txpool snapshot", "err", err)
+				}
+			}
 		}
 	}
 }
@@ -375,7 +450,7 @@ func (pool *TxPool) lockedReset(oldHead, newHead *types.Header) {
 // of the transaction pool is valid with regard to the chain state.
 func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// If we're reorging an old state, reinject all dropped transactions
-	var reinject types.Transactions
+	var reinject, included types.Transactions
 
 	if oldHead != nil && oldHead.Hash() != newHead.ParentHash {
 		// If the reorg is too deep, avoid doing it (will happen during fast sync)
@@ -386,7 +461,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 			log.Debug("Skipping deep transaction reorg", "depth", depth)
 		} else {
 			// Reorg seems shallow enough to pull in all transactions into memory
-			var discarded, included types.Transactions
+			var discarded types.Transactions
 
 			var (
 				rem = pool.chain.GetBlock(oldHead.Hash(), oldHead.Number.Uint64())
@@ -420,6 +495,11 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 			}
 			reinject = types.TxDifference(discarded, included)
 		}
+	} else if oldHead != nil {
+		// Regular chain progression, the new head holds all the new transactions
+		if block := pool.chain.GetBlock(newHead.Hash(), newHead.Number.Uint64()); block != nil {
+			included = block.Transactions()
+		}
 	}
 	// Initialize the internal state to the current head
 	if newHead == nil {
@@ -443,12 +523,14 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// any transactions that have been included in the block or
 	// have been invalidated because of another transaction (e.g.
 	// higher gas price)
-	pool.demoteUnexecutables()
+	pool.demoteUnexecutables(included)
 
-	// Update all accounts to the latest known pending nonce
-	for addr, list := range pool.pending {
-		txs := list.Flatten() // Heavy but will be cached and is needed by the miner anyway
-		pool.pendingState.SetNonce(addr, txs[len(txs)-1].Nonce()+1)
+	// Drop the private transactions not included in time
+	pool.expirePrivates(newHead.Number.Uint64())
+
+	// Update all accounts to the latest known public pending nonce
+	for addr := range pool.pending {
+		pool.setPendingNonce(addr)
 	}
 	// Check the queue and move transactions over to the pending if possible
 	// or remove those that have become invalid
@@ -462,11 +544,21 @@ func (pool *TxPool) Stop() {
 
 	// Unsubscribe subscriptions registered from blockchain
 	pool.chainHeadSub.Unsubscribe()
+	pool.events.close()
 	pool.wg.Wait()
 
 	if pool.journal != nil {
 		pool.journal.close()
 	}
+	if pool.snapshot != nil {
+		pool.mu.Lock()
+		txs := pool.snapshotContent()
+		pool.mu.Unlock()
+
+		if err := pool.snapshot.write(txs); err != nil {
+			log.Warn("Failed to write txpool snapshot", "err", err)
+		}
+	}
 	log.Info("Transaction pool stopped")
 }
 
@@ -491,7 +583,8 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 	defer pool.mu.Unlock()
 
 	pool.gasPrice = price
-	for _, tx := range pool.priced.Cap(price, pool.locals) {
+	for _, tx := range pool.priced.Cap(price, pool.exempt) {
+		pool.notify(TxEventDropped, tx, ErrUnderpriced)
 		pool.removeTx(tx.Hash(), false)
 	}
 	log.Info("Transaction pool price threshold updated", "price", price)
@@ -506,12 +599,25 @@ func (pool *TxPool) State() *state.ManagedState {
 }
 
 // Stats retrieves the current pool stats, namely the number of pending and the
-// number of queued (non-executable) transactions.
+// number of queued (non-executable) transactions. Private transactions are not
+// counted.
 func (pool *TxPool) Stats() (int, int) {
-	pool.mu.RLock()
-	defer pool.mu.RUnlock()
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
 
-	return pool.stats()
+	if pool.privates.empty() {
+		return pool.stats()
+	}
+	pending := 0
+	for _, list := range pool.pending {
+		txs, _ := pool.privates.split(list.Flatten())
+		pending += len(txs)
+	}
+	queued := 0
+	for _, list := range pool.queue {
+		queued += len(pool.privates.filter(list.Flatten()))
+	}
+	return pending, queued
 }
 
 // stats retrieves the current pool stats, namely the number of pending and the
@@ -530,17 +636,22 @@ func (pool *TxPool) stats() (int, int) {
 
 // Content retrieves the data content of the transaction pool, returning all the
 // pending as well as queued transactions, grouped by account and sorted by nonce.
+// Private transactions are not included.
 func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
 	pending := make(map[common.Address]types.Transactions)
 	for addr, list := range pool.pending {
-		pending[addr] = list.Flatten()
+		if txs, _ := pool.privates.split(list.Flatten()); len(txs) > 0 {
+			pending[addr] = txs
+		}
 	}
 	queued := make(map[common.Address]types.Transactions)
 	for addr, list := range pool.queue {
-		queued[addr] = list.Flatten()
+		if txs := pool.privates.filter(list.Flatten()); len(txs) > 0 {
+			queued[addr] = txs
+		}
 	}
 	return pending, queued
 }
@@ -548,13 +659,18 @@ func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common
 // Pending retrieves all currently processable transactions, grouped by origin
 // account and sorted by nonce. The returned transaction set is a copy and can be
 // freely modified by calling code.
+//
+// Private transactions and the ones following them are not included, they are
+// retrieved separately through Private.
 func (pool *TxPool) Pending() (map[common.Address]types.Transactions, error) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
 	pending := make(map[common.Address]types.Transactions)
 	for addr, list := range pool.pending {
-		pending[addr] = list.Flatten()
+		if txs, _ := pool.privates.split(list.Flatten()); len(txs) > 0 {
+			pending[addr] = txs
+		}
 	}
 	return pending, nil
 }
@@ -583,6 +699,22 @@ func (pool *TxPool) local() map[common.Address]types.Transactions {
 	return txs
 }
 
+// exempt reports whether the transactions of an account are exempt from the
+// eviction rules, either being local or exempted by the admission policy.
+func (pool *TxPool) exempt(addr common.Address) bool {
+	return pool.locals.contains(addr) || pool.admission.Exempt(addr)
+}
+
+// Ordered returns an iterator over the given nonce sorted transactions of the
+// accounts, in the order the pool's transaction ordering prefers them to be
+// included into blocks. The map is consumed during iteration.
+func (pool *TxPool) Ordered(signer types.Signer, txs map[common.Address]types.Transactions) TxIterator {
+	if _, ok := pool.ordering.(priceOrdering); ok {
+		return types.NewTransactionsByPriceAndNonce(signer, txs)
+	}
+	return newOrderedTxs(signer, txs, pool.ordering, pool.all.Seq)
+}
+
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
@@ -604,10 +736,11 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if err != nil {
 		return ErrInvalidSender
 	}
-	// Drop non-local transactions under our own minimal accepted gas price
+	// Drop transactions not admitted by the policy, by default non-local ones
+	// under our own minimal accepted gas price
 	local = local || pool.locals.contains(from) // account may be local even if the transaction arrived from the network
-	if !local && pool.gasPrice.Cmp(tx.GasPrice()) > 0 {
-		return ErrUnderpriced
+	if err := pool.admission.Admit(tx, from, local, pool.gasPrice); err != nil {
+		return err
 	}
 	// Ensure the transaction adheres to nonce ordering
 	if pool.currentState.GetNonce(from) > tx.Nonce() {
@@ -647,21 +780,24 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 	if err := pool.validateTx(tx, local); err != nil {
 		log.Trace("Discarding invalid transaction", "hash", hash, "err", err)
 		invalidTxCounter.Inc(1)
+		pool.notify(TxEventRejected, tx, err)
 		return false, err
 	}
 	// If the transaction pool is full, discard underpriced transactions
 	if uint64(pool.all.Count()) >= pool.config.GlobalSlots+pool.config.GlobalQueue {
 		// If the new transaction is underpriced, don't accept it
-		if !local && pool.priced.Underpriced(tx, pool.locals) {
+		if !local && pool.priced.Underpriced(tx, pool.exempt) {
 			log.Trace("Discarding underpriced transaction", "hash", hash, "price", tx.GasPrice())
 			underpricedTxCounter.Inc(1)
+			pool.notify(TxEventRejected, tx, ErrUnderpriced)
 			return false, ErrUnderpriced
 		}
 		// New transaction is better than our worse ones, make room for it
-		drop := pool.priced.Discard(pool.all.Count()-int(pool.config.GlobalSlots+pool.config.GlobalQueue-1), pool.locals)
+		drop := pool.priced.Discard(pool.all.Count()-int(pool.config.GlobalSlots+pool.config.GlobalQueue-1), pool.exempt)
 		for _, tx := range drop {
 			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "price", tx.GasPrice())
 			underpricedTxCounter.Inc(1)
+			pool.notify(TxEventDropped, tx, ErrUnderpriced)
 			pool.removeTx(tx.Hash(), false)
 		}
 	}
@@ -669,9 +805,10 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 	from, _ := types.Sender(pool.signer, tx) // already validated
 	if list := pool.pending[from]; list != nil && list.Overlaps(tx) {
 		// Nonce already pending, check if required price bump is met
-		inserted, old := list.Add(tx, pool.config.PriceBump)
+		inserted, old := list.Add(tx, pool.admission)
 		if !inserted {
 			pendingDiscardCounter.Inc(1)
+			pool.notify(TxEventRejected, tx, ErrReplaceUnderpriced)
 			return false, ErrReplaceUnderpriced
 		}
 		// New transaction is better, replace old one
@@ -679,23 +816,29 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed()
 			pendingReplaceCounter.Inc(1)
+			pool.notifyReplaced(old, tx)
 		}
 		pool.all.Add(tx)
 		pool.priced.Put(tx)
 		pool.journalTx(from, tx)
+		pool.notify(TxEventPending, tx, nil)
 
 		log.Trace("Pooled new executable transaction", "hash", hash, "from", from, "to", tx.To())
 
 		// We've directly injected a replacement transaction, notify subsystems
-		go pool.txFeed.Send(NewTxsEvent{types.Transactions{tx}})
+		if !pool.privates.contains(hash) {
+			go pool.txFeed.Send(NewTxsEvent{types.Transactions{tx}})
+		}
 
 		return old != nil, nil
 	}
 	// New transaction isn't replacing a pending one, push into queue
 	replace, err := pool.enqueueTx(hash, tx)
 	if err != nil {
+		pool.notify(TxEventRejected, tx, err)
 		return false, err
 	}
+	pool.notify(TxEventQueued, tx, nil)
 	// Mark local addresses and journal local transactions
 	if local {
 		if !pool.locals.contains(from) {
@@ -718,7 +861,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 	if pool.queue[from] == nil {
 		pool.queue[from] = newTxList(false)
 	}
-	inserted, old := pool.queue[from].Add(tx, pool.config.PriceBump)
+	inserted, old := pool.queue[from].Add(tx, pool.admission)
 	if !inserted {
 		// An older transaction was better, discard this
 		queuedDiscardCounter.Inc(1)
@@ -729,6 +872,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed()
 		queuedReplaceCounter.Inc(1)
+		pool.notifyReplaced(old, tx)
 	}
 	if pool.all.Get(hash) == nil {
 		pool.all.Add(tx)
@@ -740,8 +884,8 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 // journalTx adds the specified transaction to the local disk journal if it is
 // deemed to have been sent from a local account.
 func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
-	// Only journal if it's enabled and the transaction is local
-	if pool.journal == nil || !pool.locals.contains(from) {
+	// Only journal if it's enabled and the transaction is local, but not private
+	if pool.journal == nil || !pool.locals.contains(from) || pool.privates.contains(tx.Hash()) {
 		return
 	}
 	if err := pool.journal.insert(tx); err != nil {
@@ -760,13 +904,14 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 	}
 	list := pool.pending[addr]
 
-	inserted, old := list.Add(tx, pool.config.PriceBump)
+	inserted, old := list.Add(tx, pool.admission)
 	if !inserted {
 		// An older transaction was better, discard this
 		pool.all.Remove(hash)
 		pool.priced.Removed()
 
 		pendingDiscardCounter.Inc(1)
+		pool.notify(TxEventDropped, tx, ErrReplaceUnderpriced)
 		return false
 	}
 	// Otherwise discard any previous transaction and mark this
@@ -775,6 +920,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.priced.Removed()
 
 		pendingReplaceCounter.Inc(1)
+		pool.notifyReplaced(old, tx)
 	}
 	// Failsafe to work around direct pending inserts (tests)
 	if pool.all.Get(hash) == nil {
@@ -783,11 +929,40 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 	}
 	// Set the potentially new pending nonce and notify any subsystems of the new tx
 	pool.beats[addr] = time.Now()
-	pool.pendingState.SetNonce(addr, tx.Nonce()+1)
+	if pool.privates.empty() {
+		pool.pendingState.SetNonce(addr, tx.Nonce()+1)
+	} else {
+		pool.setPendingNonce(addr)
+	}
+	pool.notify(TxEventPending, tx, nil)
 
 	return true
 }
 
+// setPendingNonce sets the nonce of the account in the pending state to follow
+// its pending transactions up to the first private one, as the private ones are
+// hidden from the public views of the pool.
+func (pool *TxPool) setPendingNonce(addr common.Address) {
+	list := pool.pending[addr]
+	if list == nil {
+		return
+	}
+	txs, _ := pool.privates.split(list.Flatten()) // Heavy but will be cached and is needed by the miner anyway
+	if len(txs) > 0 {
+		pool.pendingState.SetNonce(addr, txs[len(txs)-1].Nonce()+1)
+	}
+}
+
+// pendingNonce returns the nonce following all the pending transactions of the
+// account, including the private ones not reflected by the pending state.
+func (pool *TxPool) pendingNonce(addr common.Address) uint64 {
+	if list := pool.pending[addr]; list != nil && !list.Empty() {
+		txs := list.Flatten()
+		return txs[len(txs)-1].Nonce() + 1
+	}
+	return pool.currentState.GetNonce(addr)
+}
+
 // AddLocal enqueues a single transaction into the pool if it is valid, marking
 // the sender as a local one in the mean time, ensuring it goes around the local
 // pricing constraints.
@@ -875,6 +1050,9 @@ func (pool *TxPool) Status(hashes []common.Hash) []TxStatus {
 
 	status := make([]TxStatus, len(hashes))
 	for i, hash := range hashes {
+		if pool.privates.contains(hash) {
+			continue
+		}
 		if tx := pool.all.Get(hash); tx != nil {
 			from, _ := types.Sender(pool.signer, tx) // already validated
 			if pool.pending[from] != nil && pool.pending[from].txs.items[tx.Nonce()] != nil {
@@ -888,8 +1066,11 @@ func (pool *TxPool) Status(hashes []common.Hash) []TxStatus {
 }
 
 // Get returns a transaction if it is contained in the pool
-// and nil otherwise.
+// and nil otherwise. Private transactions are never returned.
 func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
+	if pool.privates.contains(hash) {
+		return nil
+	}
 	return pool.all.Get(hash)
 }
 
@@ -918,6 +1099,7 @@ func (pool *TxPool) removeTx(hash common.Hash, outofbound bool) {
 			}
 			// Postpone any invalidated transactions
 			for _, tx := range invalids {
+				pool.notify(TxEventDemoted, tx, ErrNonceGap)
 				pool.enqueueTx(tx.Hash(), tx)
 			}
 			// Update the account nonce if needed
@@ -962,6 +1144,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			log.Trace("Removed old queued transaction", "hash", hash)
 			pool.all.Remove(hash)
 			pool.priced.Removed()
+			pool.notify(TxEventDropped, tx, ErrNonceTooLow)
 		}
 		// Drop all transactions that are too costly (low balance or out of gas)
 		drops, _ := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas)
@@ -971,9 +1154,10 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			pool.all.Remove(hash)
 			pool.priced.Removed()
 			queuedNofundsCounter.Inc(1)
+			pool.notify(TxEventDropped, tx, pool.unpayable(tx))
 		}
 		// Gather all executable transactions and promote them
-		for _, tx := range list.Ready(pool.pendingState.GetNonce(addr)) {
+		for _, tx := range list.Ready(pool.pendingNonce(addr)) {
 			hash := tx.Hash()
 			if pool.promoteTx(addr, hash, tx) {
 				log.Trace("Promoting queued transaction", "hash", hash)
@@ -981,13 +1165,14 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			}
 		}
 		// Drop all transactions over the allowed limit
-		if !pool.locals.contains(addr) {
+		if !pool.exempt(addr) {
 			for _, tx := range list.Cap(int(pool.config.AccountQueue)) {
 				hash := tx.Hash()
 				pool.all.Remove(hash)
 				pool.priced.Removed()
 				queuedRateLimitCounter.Inc(1)
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
+				pool.notify(TxEventDropped, tx, ErrAccountLimit)
 			}
 		}
 		// Delete the entire queue entry if it became empty.
@@ -995,8 +1180,8 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			delete(pool.queue, addr)
 		}
 	}
-	// Notify subsystem for new promoted transactions.
-	if len(promoted) > 0 {
+	// Notify subsystem for new promoted transactions, keeping private ones silent.
+	if promoted = pool.privates.filter(promoted); len(promoted) > 0 {
 		go pool.txFeed.Send(NewTxsEvent{promoted})
 	}
 	// If the pending limit is overflown, start equalizing allowances
@@ -1010,7 +1195,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 		spammers := prque.New(nil)
 		for addr, list := range pool.pending {
 			// Only evict transactions from high rollers
-			if !pool.locals.contains(addr) && uint64(list.Len()) > pool.config.AccountSlots {
+			if !pool.exempt(addr) && uint64(list.Len()) > pool.config.AccountSlots {
 				spammers.Push(addr, int64(list.Len()))
 			}
 		}
@@ -1041,6 +1226,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 								pool.pendingState.SetNonce(offenders[i], nonce)
 							}
 							log.Trace("Removed fairness-exceeding pending transaction", "hash", hash)
+							pool.notify(TxEventDropped, tx, ErrPoolLimit)
 						}
 						pending--
 					}
@@ -1063,6 +1249,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 							pool.pendingState.SetNonce(addr, nonce)
 						}
 						log.Trace("Removed fairness-exceeding pending transaction", "hash", hash)
+						pool.notify(TxEventDropped, tx, ErrPoolLimit)
 					}
 					pending--
 				}
@@ -1079,7 +1266,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 		// Sort all accounts with queued transactions by heartbeat
 		addresses := make(addressesByHeartbeat, 0, len(pool.queue))
 		for addr := range pool.queue {
-			if !pool.locals.contains(addr) { // don't drop locals
+			if !pool.exempt(addr) { // don't drop locals
 				addresses = append(addresses, addressByHeartbeat{addr, pool.beats[addr]})
 			}
 		}
@@ -1095,6 +1282,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			// Drop all transactions if they are less than the overflow
 			if size := uint64(list.Len()); size <= drop {
 				for _, tx := range list.Flatten() {
+					pool.notify(TxEventDropped, tx, ErrPoolLimit)
 					pool.removeTx(tx.Hash(), true)
 				}
 				drop -= size
@@ -1104,6 +1292,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			// Otherwise drop only last few transactions
 			txs := list.Flatten()
 			for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
+				pool.notify(TxEventDropped, txs[i], ErrPoolLimit)
 				pool.removeTx(txs[i].Hash(), true)
 				drop--
 				queuedRateLimitCounter.Inc(1)
@@ -1115,7 +1304,14 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 // demoteUnexecutables removes invalid and processed transactions from the pools
 // executable/pending queue and any subsequent transactions that become unexecutable
 // are moved back into the future queue.
-func (pool *TxPool) demoteUnexecutables() {
+//
+// The transactions included by the new blocks are needed to tell those that were
+// mined apart from the ones invalidated by others using their nonces.
+func (pool *TxPool) demoteUnexecutables(included types.Transactions) {
+	mined := make(map[common.Hash]struct{}, len(included))
+	for _, tx := range included {
+		mined[tx.Hash()] = struct{}{}
+	}
 	// Iterate over all accounts and demote any non-executable transactions
 	for addr, list := range pool.pending {
 		nonce := pool.currentState.GetNonce(addr)
@@ -1126,6 +1322,11 @@ func (pool *TxPool) demoteUnexecutables() {
 			log.Trace("Removed old pending transaction", "hash", hash)
 			pool.all.Remove(hash)
 			pool.priced.Removed()
+			if _, ok := mined[hash]; ok {
+				pool.notify(TxEventMined, tx, nil)
+			} else {
+				pool.notify(TxEventDropped, tx, ErrNonceTooLow)
+			}
 		}
 		// Drop all transactions that are too costly (low balance or out of gas), and queue any invalids back for later
 		drops, invalids := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas)
@@ -1135,10 +1336,12 @@ func (pool *TxPool) demoteUnexecutables() {
 			pool.all.Remove(hash)
 			pool.priced.Removed()
 			pendingNofundsCounter.Inc(1)
+			pool.notify(TxEventDropped, tx, pool.unpayable(tx))
 		}
 		for _, tx := range invalids {
 			hash := tx.Hash()
 			log.Trace("Demoting pending transaction", "hash", hash)
+			pool.notify(TxEventDemoted, tx, ErrNonceGap)
 			pool.enqueueTx(hash, tx)
 		}
 		// If there's a gap in front, alert (should never happen) and postpone all transactions
@@ -1146,6 +1349,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			for _, tx := range list.Cap(0) {
 				hash := tx.Hash()
 				log.Error("Demoting invalidated transaction", "hash", hash)
+				pool.notify(TxEventDemoted, tx, ErrNonceGap)
 				pool.enqueueTx(hash, tx)
 			}
 		}
@@ -1230,14 +1434,19 @@ func (as *accountSet) flatten() []common.Address {
 // peeking into the pool in TxPool.Get without having to acquire the widely scoped
 // TxPool.mu mutex.
 type txLookup struct {
-	all  map[common.Hash]*types.Transaction
-	lock sync.RWMutex
+	all   map[common.Hash]*types.Transaction
+	seqs  map[common.Hash]uint64    // Arrival sequence numbers of the transactions
+	times map[common.Hash]time.Time // Arrival times of the transactions
+	seq   uint64                    // Sequence number of the next arriving transaction
+	lock  sync.RWMutex
 }
 
 // newTxLookup returns a new txLookup structure.
 func newTxLookup() *txLookup {
 	return &txLookup{
-		all: make(map[common.Hash]*types.Transaction),
+		all:   make(map[common.Hash]*types.Transaction),
+		seqs:  make(map[common.Hash]uint64),
+		times: make(map[common.Hash]time.Time),
 	}
 }
 
@@ -1253,6 +1462,19 @@ func (t *txLookup) Range(f func(hash common.Hash, tx *types.Transaction) bool) {
 	}
 }
 
+// RangeSeq calls f on each key and value present in the map, along with the
+// arrival sequence number of the transaction.
+func (t *txLookup) RangeSeq(f func(hash common.Hash, tx *types.Transaction, seq uint64) bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	for key, value := range t.all {
+		if !f(key, value, t.seqs[key]) {
+			break
+		}
+	}
+}
+
 // Get returns a transaction if it exists in the lookup, or nil if not found.
 func (t *txLookup) Get(hash common.Hash) *types.Transaction {
 	t.lock.RLock()
@@ -1275,6 +1497,47 @@ func (t *txLookup) Add(tx *types.Transaction) {
 	defer t.lock.Unlock()
 
 	t.all[tx.Hash()] = tx
+	t.seqs[tx.Hash()] = t.seq
+	t.times[tx.Hash()] = time.Now()
+	t.seq++
+}
+
+// Time returns the arrival time of a transaction in the lookup.
+func (t *txLookup) Time(hash common.Hash) time.Time {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.times[hash]
+}
+
+// SetTime overrides the arrival time of a transaction in the lookup.
+func (t *txLookup) SetTime(hash common.Hash, arrival time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.all[hash]; ok {
+		t.times[hash] = arrival
+	}
+}
+
+// Seq returns the arrival sequence number of a transaction in the lookup, or
+// the one of the next arriving transaction if not found.
+func (t *txLookup) Seq(hash common.Hash) uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if seq, ok := t.seqs[hash]; ok {
+		return seq
+	}
+	return t.seq
+}
+
+// NextSeq returns the sequence number of the next arriving transaction.
+func (t *txLookup) NextSeq() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.seq
 }
 
 // Remove removes a transaction from the lookup.
@@ -1283,4 +1546,6 @@ func (t *txLookup) Remove(hash common.Hash) {
 	defer t.lock.Unlock()
 
 	delete(t.all, hash)
+	delete(t.seqs, hash)
+	delete(t.times, hash)
 }
@@ -20,9 +20,11 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -102,15 +104,22 @@ func validateTxPoolInternals(pool *TxPool) error {
 	}
 	// Ensure the next nonce to assign is the correct one
 	for addr, txs := range pool.pending {
-		// Find the last transaction
-		var last uint64
+		// Find the last transaction before the first private one, as the private
+		// ones and their followers are hidden from the pending state
+		first := uint64(math.MaxUint64)
+		for nonce, tx := range txs.txs.items {
+			if nonce < first && pool.privates.contains(tx.Hash()) {
+				first = nonce
+			}
+		}
+		want := pool.currentState.GetNonce(addr)
 		for nonce := range txs.txs.items {
-			if last < nonce {
-				last = nonce
+			if nonce < first && want < nonce+1 {
+				want = nonce + 1
 			}
 		}
-		if nonce := pool.pendingState.GetNonce(addr); nonce != last+1 {
-			return fmt.Errorf("pending nonce mismatch: have %v, want %v", nonce, last+1)
+		if nonce := pool.pendingState.GetNonce(addr); nonce != want {
+			return fmt.Errorf("pending nonce mismatch: have %v, want %v", nonce, want)
 		}
 	}
 	return nil
@@ -1736,6 +1745,487 @@ func TestTransactionStatusCheck(t *testing.T) {
 	}
 }
 
+// Tests that both local and remote transactions survive node restarts if the
+// pool snapshot is enabled, retaining their arrival times and local flags, and
+// that restored transactions are revalidated and limited.
+func TestTransactionSnapshot(t *testing.T) {
+	t.Parallel()
+
+	// Create a temporary directory for the snapshot
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(sofdb.NewMemDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.Snapshot = filepath.Join(dir, "txpool.srlp")
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+	private, _ := crypto.GenerateKey()
+	for _, key := range []*ecdsa.PrivateKey{local, remote, private} {
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	}
+	// Add local, remote pending and queued, and private transactions
+	if errs := pool.AddLocals([]*types.Transaction{transaction(0, 100000, local), transaction(1, 100000, local)}); errs[0] != nil || errs[1] != nil {
+		t.Fatalf("failed to add local transactions: %v", errs)
+	}
+	queuedTx := transaction(2, 100000, remote)
+	if errs := pool.AddRemotes([]*types.Transaction{transaction(0, 100000, remote), queuedTx}); errs[0] != nil || errs[1] != nil {
+		t.Fatalf("failed to add remote transactions: %v", errs)
+	}
+	if err := pool.AddPrivate(transaction(0, 100000, private)); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	arrival := pool.all.Time(queuedTx.Hash())
+
+	// Terminate the old pool, bump the local nonce, create a new pool and ensure relevant transaction survive
+	pool.Stop()
+	statedb.SetNonce(crypto.PubkeyToAddress(local.PublicKey), 1)
+	blockchain = &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+
+	pending, queued := pool.Stats()
+	if pending != 2 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 2)
+	}
+	if queued != 1 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 1)
+	}
+	if !pool.locals.contains(crypto.PubkeyToAddress(local.PublicKey)) {
+		t.Errorf("local account not restored")
+	}
+	if pool.locals.contains(crypto.PubkeyToAddress(remote.PublicKey)) {
+		t.Errorf("remote account restored as local")
+	}
+	if have := pool.all.Time(queuedTx.Hash()); !have.Equal(arrival) {
+		t.Errorf("arrival time mismatch: have %v, want %v", have, arrival)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	pool.Stop()
+
+	// Restore into a smaller pool and ensure the limits are respected
+	config.GlobalSlots = 1
+	config.GlobalQueue = 1
+
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	if count := pool.all.Count(); count != 2 {
+		t.Fatalf("restored transaction count mismatch: have %d, want %d", count, 2)
+	}
+	if pool.all.Get(queuedTx.Hash()) != nil {
+		t.Errorf("latest arrived transaction restored over the limits")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that private transactions are neither announced nor exposed by the pool,
+// and are dropped if not included within their lifetime.
+func TestTransactionPrivate(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	other, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(other.PublicKey), big.NewInt(1000000))
+
+	events := make(chan NewTxsEvent, 32)
+	sub := pool.txFeed.Subscribe(events)
+	defer sub.Unsubscribe()
+
+	// Add a private transaction in between public ones, and a lone private one
+	public := []*types.Transaction{transaction(0, 100000, key), transaction(2, 100000, key)}
+	private := []*types.Transaction{transaction(1, 100000, key), transaction(0, 100000, other)}
+
+	if err := pool.AddRemote(public[0]); err != nil {
+		t.Fatalf("failed to add public transaction: %v", err)
+	}
+	for i, tx := range private {
+		if err := pool.AddPrivate(tx); err != nil {
+			t.Fatalf("failed to add private transaction %d: %v", i, err)
+		}
+	}
+	if err := pool.AddRemote(public[1]); err != nil {
+		t.Fatalf("failed to add public transaction: %v", err)
+	}
+	if err := pool.AddPrivate(private[0]); err == nil {
+		t.Fatalf("re-adding private transaction succeeded")
+	}
+	if err := validateEvents(events, 2); err != nil {
+		t.Fatalf("public transaction event firing failed: %v", err)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// Ensure the private transactions are only returned to the miner
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	pending, _ := pool.Pending()
+	if len(pending) != 1 || len(pending[from]) != 1 || pending[from][0] != public[0] {
+		t.Fatalf("pending transactions mismatch: have %v, want only %x", pending, public[0].Hash())
+	}
+	content, _ := pool.Content()
+	if len(content) != 1 || len(content[from]) != 1 {
+		t.Fatalf("pending content mismatch: have %v, want only %x", content, public[0].Hash())
+	}
+	if pendingCount, queuedCount := pool.Stats(); pendingCount != 1 || queuedCount != 0 {
+		t.Fatalf("stats mismatch: have %d pending and %d queued, want 1 and 0", pendingCount, queuedCount)
+	}
+	if nonce := pool.State().GetNonce(from); nonce != 1 {
+		t.Fatalf("pending nonce mismatch: have %d, want %d", nonce, 1)
+	}
+	if nonce := pool.State().GetNonce(crypto.PubkeyToAddress(other.PublicKey)); nonce != 0 {
+		t.Fatalf("private pending nonce exposed: have %d, want %d", nonce, 0)
+	}
+	if txs := pool.Private(); len(txs) != 2 || len(txs[from]) != 2 || txs[from][0] != private[0] || txs[from][1] != public[1] {
+		t.Fatalf("private transactions mismatch: have %v", txs)
+	}
+	for i, tx := range private {
+		if pool.Get(tx.Hash()) != nil {
+			t.Errorf("private transaction %d: exposed by lookup", i)
+		}
+		if status := pool.Status([]common.Hash{tx.Hash()}); status[0] != TxStatusUnknown {
+			t.Errorf("private transaction %d: exposed status %v", i, status[0])
+		}
+	}
+	// Reach the end of the private lifetime and ensure they are dropped
+	pool.lockedReset(nil, &types.Header{Number: new(big.Int).SetUint64(testTxPoolConfig.PrivateLifetime), GasLimit: 1000000})
+
+	if txs := pool.Private(); len(txs) != 0 {
+		t.Fatalf("private transactions not expired: %v", txs)
+	}
+	for i, tx := range private {
+		if pool.all.Get(tx.Hash()) != nil {
+			t.Errorf("private transaction %d: not dropped", i)
+		}
+	}
+	pendingCount, queuedCount := pool.Stats()
+	if pendingCount != 1 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pendingCount, 1)
+	}
+	if queuedCount != 1 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queuedCount, 1)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the permissioned admission policy only accepts transactions from
+// the allowed accounts, and that privileged ones may transact for free without
+// being evicted.
+func TestTransactionPermissionedAdmission(t *testing.T) {
+	t.Parallel()
+
+	// Create the test accounts and a contract only one of them may call
+	keys := make([]*ecdsa.PrivateKey, 4)
+	addrs := make([]common.Address, len(keys))
+	for i := 0; i < len(keys); i++ {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	contract := common.HexToAddress("0xc0ffee")
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(sofdb.NewMemDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.Admission = PermissionedTxAdmission
+	config.AllowedSenders = []common.Address{addrs[1], addrs[2]}
+	config.PrivilegedSenders = []common.Address{addrs[0]}
+	config.ContractWhitelists = []TxContractWhitelist{{Contract: contract, Senders: []common.Address{addrs[2]}}}
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	for _, addr := range addrs {
+		pool.currentState.AddBalance(addr, big.NewInt(1000000))
+	}
+	call := func(nonce uint64, gasprice *big.Int, key *ecdsa.PrivateKey) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, contract, big.NewInt(100), 100000, gasprice, nil), types.HomesteadSigner{}, key)
+		return tx
+	}
+	tests := []struct {
+		tx  *types.Transaction
+		err error
+	}{
+		{pricedTransaction(0, 100000, big.NewInt(0), keys[0]), nil},                 // Privileged, free
+		{pricedTransaction(0, 100000, big.NewInt(0), keys[1]), ErrUnderpriced},      // Allowed, free
+		{pricedTransaction(0, 100000, big.NewInt(1), keys[1]), nil},                 // Allowed, paying
+		{pricedTransaction(0, 100000, big.NewInt(1), keys[3]), ErrSenderNotAllowed}, // Not allowed
+		{call(1, big.NewInt(1), keys[1]), ErrContractNotAllowed},                    // Allowed, not whitelisted
+		{call(0, big.NewInt(1), keys[2]), nil},                                      // Allowed and whitelisted
+		{call(1, big.NewInt(0), keys[0]), nil},                                      // Privileged, not whitelisted
+	}
+	for i, tt := range tests {
+		if err := pool.AddRemote(tt.tx); err != tt.err {
+			t.Errorf("test %d: admission error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// Raise the minimum price and ensure only the privileged transactions remain
+	pool.SetGasPrice(big.NewInt(2))
+
+	pending, queued := pool.Stats()
+	if pending != 2 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 2)
+	}
+	if queued != 0 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 0)
+	}
+	if txs := pool.pending[addrs[0]]; txs == nil || txs.Len() != 2 {
+		t.Fatalf("privileged transactions evicted")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the FIFO ordering yields transactions to the miner in their order
+// of arrival, and evicts the older ones when the pool fills up.
+func TestTransactionFIFOOrdering(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(sofdb.NewMemDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.Ordering = FIFOTxOrdering
+	config.GlobalSlots = 2
+	config.GlobalQueue = 2
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	keys := make([]*ecdsa.PrivateKey, 5)
+	for i := 0; i < len(keys); i++ {
+		keys[i], _ = crypto.GenerateKey()
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000))
+	}
+	// Fill the pool with increasingly expensive transactions
+	var txs types.Transactions
+	for i := 0; i < 4; i++ {
+		tx := pricedTransaction(0, 100000, big.NewInt(int64(i+1)), keys[i])
+		if err := pool.AddRemote(tx); err != nil {
+			t.Fatalf("transaction %d: failed to add: %v", i, err)
+		}
+		txs = append(txs, tx)
+	}
+	// A newer transaction must evict the oldest one, regardless of their prices
+	tx := pricedTransaction(0, 100000, big.NewInt(1), keys[4])
+	if err := pool.AddRemote(tx); err != nil {
+		t.Fatalf("failed to add transaction to full pool: %v", err)
+	}
+	if pool.all.Get(txs[0].Hash()) != nil {
+		t.Fatalf("oldest transaction not evicted")
+	}
+	txs = append(txs[1:], tx)
+	// Ensure the miner gets the transactions in their order of arrival
+	pending, err := pool.Pending()
+	if err != nil {
+		t.Fatalf("failed to retrieve pending transactions: %v", err)
+	}
+	it := pool.Ordered(pool.signer, pending)
+	for i, tx := range txs {
+		if have := it.Peek(); have == nil || have.Hash() != tx.Hash() {
+			t.Fatalf("transaction %d: ordering mismatch: have %v, want %x", i, have, tx.Hash())
+		}
+		it.Shift()
+	}
+	if tx := it.Peek(); tx != nil {
+		t.Fatalf("unexpected transaction after the pending ones: %x", tx.Hash())
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the lifecycle changes of the transactions are reported by the pool
+// along with the reason of each change.
+func TestTransactionPoolEvents(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	events := make(chan TxPoolEvent, 32)
+	sub := pool.SubscribeTxPoolEvent(events)
+	defer sub.Unsubscribe()
+
+	// Add a transaction, a cheap and a proper replacement and a few followups
+	var (
+		first    = pricedTransaction(0, 100000, big.NewInt(1), key)
+		cheap    = pricedTransaction(0, 100001, big.NewInt(1), key)
+		replaced = pricedTransaction(0, 100000, big.NewInt(2), key)
+		dropped  = pricedTransaction(1, 100000, big.NewInt(1), key)
+		demoted  = pricedTransaction(2, 100000, big.NewInt(2), key)
+	)
+	if err := pool.AddRemote(first); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.AddRemote(cheap); err != ErrReplaceUnderpriced {
+		t.Fatalf("cheap replacement error mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	for _, tx := range []*types.Transaction{replaced, dropped, demoted} {
+		if err := pool.AddRemote(tx); err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	}
+	// Bump the gas price to drop the cheap followup, demoting the last one
+	pool.SetGasPrice(big.NewInt(2))
+
+	expected := []TxPoolEvent{
+		{Kind: TxEventQueued, Tx: first},
+		{Kind: TxEventPending, Tx: first},
+		{Kind: TxEventRejected, Tx: cheap, Reason: ErrReplaceUnderpriced},
+		{Kind: TxEventReplaced, Tx: first, Reason: ErrTxReplaced, Replacement: replaced.Hash()},
+		{Kind: TxEventPending, Tx: replaced},
+		{Kind: TxEventQueued, Tx: dropped},
+		{Kind: TxEventPending, Tx: dropped},
+		{Kind: TxEventQueued, Tx: demoted},
+		{Kind: TxEventPending, Tx: demoted},
+		{Kind: TxEventDropped, Tx: dropped, Reason: ErrUnderpriced},
+		{Kind: TxEventDemoted, Tx: demoted, Reason: ErrNonceGap},
+	}
+	for i, want := range expected {
+		select {
+		case have := <-events:
+			if have.Kind != want.Kind || have.Tx.Hash() != want.Tx.Hash() || have.Reason != want.Reason || have.Replacement != want.Replacement {
+				t.Fatalf("event %d mismatch: have %v %x (%v), want %v %x (%v)", i, have.Kind, have.Tx.Hash(), have.Reason, want.Kind, want.Tx.Hash(), want.Reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d (%v %x) not fired", i, want.Kind, want.Tx.Hash())
+		}
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event fired: %v %x", ev.Kind, ev.Tx.Hash())
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// minedTestBlockChain is a testBlockChain whose blocks hold a fixed set of
+// transactions.
+type minedTestBlockChain struct {
+	*testBlockChain
+	txs types.Transactions
+}
+
+func (bc *minedTestBlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	return types.NewBlock(&types.Header{GasLimit: bc.gasLimit}, bc.txs, nil, nil)
+}
+
+// Tests that mined transactions are reported as such instead of dropped, and
+// that private replacements are not disclosed.
+func TestTransactionPoolEventsMined(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(sofdb.NewMemDatabase()))
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+
+	var (
+		mined    = transaction(0, 100000, key)
+		dropped  = pricedTransaction(1, 100000, big.NewInt(1), key)
+		old      = transaction(0, 100000, other)
+		private  = pricedTransaction(0, 100000, big.NewInt(2), other)
+		competing = pricedTransaction(1, 100000, big.NewInt(2), key)
+	)
+	blockchain := &minedTestBlockChain{&testBlockChain{statedb, 1000000, new(event.Feed)}, types.Transactions{mined, competing}}
+
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(other.PublicKey), big.NewInt(1000000000))
+
+	events := make(chan TxPoolEvent, 32)
+	sub := pool.SubscribeTxPoolEvent(events)
+	defer sub.Unsubscribe()
+
+	for _, tx := range []*types.Transaction{mined, dropped, old} {
+		if err := pool.AddRemote(tx); err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	}
+	if err := pool.AddPrivate(private); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	// Include the first transaction and a competitor of the second one
+	statedb.SetNonce(crypto.PubkeyToAddress(key.PublicKey), 2)
+	pool.lockedReset(&types.Header{}, &types.Header{ParentHash: (&types.Header{}).Hash(), Number: big.NewInt(1), GasLimit: 1000000})
+
+	expected := []TxPoolEvent{
+		{Kind: TxEventQueued, Tx: mined},
+		{Kind: TxEventPending, Tx: mined},
+		{Kind: TxEventQueued, Tx: dropped},
+		{Kind: TxEventPending, Tx: dropped},
+		{Kind: TxEventQueued, Tx: old},
+		{Kind: TxEventPending, Tx: old},
+		{Kind: TxEventReplaced, Tx: old, Reason: ErrTxReplaced},
+		{Kind: TxEventMined, Tx: mined},
+		{Kind: TxEventDropped, Tx: dropped, Reason: ErrNonceTooLow},
+	}
+	for i, want := range expected {
+		select {
+		case have := <-events:
+			if have.Kind != want.Kind || have.Tx.Hash() != want.Tx.Hash() || have.Reason != want.Reason || have.Replacement != want.Replacement {
+				t.Fatalf("event %d mismatch: have %v %x (%v, %x), want %v %x (%v)", i, have.Kind, have.Tx.Hash(), have.Reason, have.Replacement, want.Kind, want.Tx.Hash(), want.Reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d (%v %x) not fired", i, want.Kind, want.Tx.Hash())
+		}
+	}
+}
+
+// Tests that a subscriber not consuming its events neither blocks the pool nor
+// the other subscribers.
+func TestTransactionPoolEventsSlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	slow := make(chan TxPoolEvent)
+	defer pool.SubscribeTxPoolEvent(slow).Unsubscribe()
+
+	events := make(chan TxPoolEvent, 64)
+	defer pool.SubscribeTxPoolEvent(events).Unsubscribe()
+
+	for i := uint64(0); i < 16; i++ {
+		if err := pool.AddRemote(transaction(i, 100000, key)); err != nil {
+			t.Fatalf("failed to add transaction %d: %v", i, err)
+		}
+	}
+	for i := 0; i < 32; i++ {
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			t.Fatalf("event %d not delivered", i)
+		}
+	}
+}
+
 // Benchmarks the speed of validating the contents of the pending queue of the
 // transaction pool.
 func BenchmarkPendingDemotion100(b *testing.B)   { benchmarkPendingDemotion(b, 100) }
@@ -1757,7 +2247,7 @@ func benchmarkPendingDemotion(b *testing.B, size int) {
 	// Benchmark the speed of pool validation
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		pool.demoteUnexecutables()
+		pool.demoteUnexecutables(nil)
 	}
 }
 
@@ -0,0 +1,187 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/log"
+)
+
+// txPrivates tracks the private transactions of the pool, which are only ever
+// included by the local miner and never announced to the rest of the system,
+// along with the block number after which they are dropped.
+//
+// Transactions are tracked by hash independently of their presence in the pool,
+// so that private transactions reinjected after a reorg stay private.
+type txPrivates struct {
+	deadlines map[common.Hash]uint64
+	lock      sync.RWMutex
+}
+
+// newTxPrivates creates an empty set of private transactions.
+func newTxPrivates() *txPrivates {
+	return &txPrivates{
+		deadlines: make(map[common.Hash]uint64),
+	}
+}
+
+// add marks a transaction private until the given block number.
+func (p *txPrivates) add(hash common.Hash, deadline uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.deadlines[hash] = deadline
+}
+
+// remove stops tracking a transaction as private.
+func (p *txPrivates) remove(hash common.Hash) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.deadlines, hash)
+}
+
+// contains checks whether a transaction is private.
+func (p *txPrivates) contains(hash common.Hash) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	_, ok := p.deadlines[hash]
+	return ok
+}
+
+// empty checks whether there are any private transactions tracked.
+func (p *txPrivates) empty() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return len(p.deadlines) == 0
+}
+
+// expire stops tracking all the transactions whose deadline passed by the given
+// block number, returning them for removal from the pool.
+func (p *txPrivates) expire(number uint64) []common.Hash {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var expired []common.Hash
+	for hash, deadline := range p.deadlines {
+		if deadline <= number {
+			expired = append(expired, hash)
+			delete(p.deadlines, hash)
+		}
+	}
+	return expired
+}
+
+// filter returns the transactions which are not private.
+func (p *txPrivates) filter(txs types.Transactions) types.Transactions {
+	if p.empty() {
+		return txs
+	}
+	public := make(types.Transactions, 0, len(txs))
+	for _, tx := range txs {
+		if !p.contains(tx.Hash()) {
+			public = append(public, tx)
+		}
+	}
+	return public
+}
+
+// split cuts a nonce sorted list of transactions of an account at the first
+// private one. Transactions following it are not executable without it, so they
+// are considered private too.
+func (p *txPrivates) split(txs types.Transactions) (types.Transactions, types.Transactions) {
+	if p.empty() {
+		return txs, nil
+	}
+	for i, tx := range txs {
+		if p.contains(tx.Hash()) {
+			return txs[:i], txs[i:]
+		}
+	}
+	return txs, nil
+}
+
+// AddPrivate enqueues a single transaction into the pool if it is valid, marking
+// it private. Private transactions are treated as local ones, but are never
+// announced to the rest of the system nor journaled, so they are only included
+// by the local miner. They are hidden from the public views of the pool and are
+// dropped once the configured number of blocks passed.
+func (pool *TxPool) AddPrivate(tx *types.Transaction) error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	// If the transaction is already known, discard it without touching its privacy
+	hash := tx.Hash()
+	if pool.all.Get(hash) != nil {
+		log.Trace("Discarding already known transaction", "hash", hash)
+		return fmt.Errorf("known transaction: %x", hash)
+	}
+	pool.privates.add(hash, pool.chain.CurrentBlock().NumberU64()+pool.config.PrivateLifetime)
+
+	// Try to inject the transaction and update any state
+	replace, err := pool.add(tx, !pool.config.NoLocals)
+	if err != nil {
+		pool.privates.remove(hash)
+		return err
+	}
+	// If we added a new transaction, run promotion checks and return
+	if !replace {
+		from, _ := types.Sender(pool.signer, tx) // already validated
+		pool.promoteExecutables([]common.Address{from})
+	}
+	return nil
+}
+
+// Private retrieves all currently processable private transactions, grouped by
+// origin account and sorted by nonce. Any transaction following a private one is
+// also returned here instead of by Pending, as it can only be executed after it.
+// The returned transaction set is a copy and can be freely modified by calling
+// code.
+func (pool *TxPool) Private() map[common.Address]types.Transactions {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	private := make(map[common.Address]types.Transactions)
+	if pool.privates.empty() {
+		return private
+	}
+	for addr, list := range pool.pending {
+		if _, txs := pool.privates.split(list.Flatten()); len(txs) > 0 {
+			private[addr] = txs
+		}
+	}
+	return private
+}
+
+// expirePrivates drops the private transactions which weren't included into a
+// block until their deadline.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) expirePrivates(number uint64) {
+	for _, hash := range pool.privates.expire(number) {
+		if pool.all.Get(hash) != nil {
+			log.Debug("Dropping expired private transaction", "hash", hash)
+			pool.removeTx(hash, true)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/log"
+	"github.com/susy-go/susy-graviton/srlp"
+)
+
+// snapshotTx is a pooled transaction as stored in the pool snapshot.
+type snapshotTx struct {
+	Tx    *types.Transaction
+	Time  uint64 // Arrival time into the pool, in nanoseconds since the epoch
+	Local bool   // Whether the transaction was local
+}
+
+// txSnapshot is a periodically regenerated dump of all the pending and queued
+// transactions of the pool, with the aim of allowing remote transactions too to
+// survive node restarts.
+type txSnapshot struct {
+	path string // Filesystem path to store the transactions at
+}
+
+// newTxSnapshot creates a new transaction pool snapshot.
+func newTxSnapshot(path string) *txSnapshot {
+	return &txSnapshot{
+		path: path,
+	}
+}
+
+// load parses a transaction pool snapshot from disk, loading its contents into
+// the specified pool in their order of arrival.
+func (snapshot *txSnapshot) load(add func([]*snapshotTx) []error) error {
+	// Skip the parsing if the snapshot file doesn't exist at all
+	if _, err := os.Stat(snapshot.path); os.IsNotExist(err) {
+		return nil
+	}
+	input, err := os.Open(snapshot.path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	// Parse all the transactions, the snapshot isn't ordered by arrival
+	var (
+		stream  = srlp.NewStream(input, 0)
+		txs     []*snapshotTx
+		failure error
+	)
+	for {
+		tx := new(snapshotTx)
+		if err = stream.Decode(tx); err != nil {
+			if err != io.EOF {
+				failure = err
+			}
+			break
+		}
+		txs = append(txs, tx)
+	}
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].Time < txs[j].Time })
+
+	// Inject all transactions into the pool in small-ish batches
+	total, dropped := len(txs), 0
+	for len(txs) > 0 {
+		batch := txs
+		if len(batch) > 1024 {
+			batch = batch[:1024]
+		}
+		txs = txs[len(batch):]
+
+		for _, err := range add(batch) {
+			if err != nil {
+				log.Debug("Failed to add snapshotted transaction", "err", err)
+				dropped++
+			}
+		}
+	}
+	log.Info("Loaded transaction pool snapshot", "transactions", total, "dropped", dropped)
+
+	return failure
+}
+
+// write regenerates the transaction pool snapshot from the given transactions.
+func (snapshot *txSnapshot) write(txs []*snapshotTx) error {
+	replacement, err := os.OpenFile(snapshot.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		if err = srlp.Encode(replacement, tx); err != nil {
+			replacement.Close()
+			return err
+		}
+	}
+	if err = replacement.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(snapshot.path+".new", snapshot.path); err != nil {
+		return err
+	}
+	log.Debug("Regenerated transaction pool snapshot", "transactions", len(txs))
+	return nil
+}
+
+// snapshotContent gathers all the pending and queued transactions of the pool
+// for the snapshot, except the private ones.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) snapshotContent() []*snapshotTx {
+	var txs []*snapshotTx
+	gather := func(lists map[common.Address]*txList) {
+		for addr, list := range lists {
+			local := pool.locals.contains(addr)
+			for _, tx := range list.Flatten() {
+				if pool.privates.contains(tx.Hash()) {
+					continue
+				}
+				txs = append(txs, &snapshotTx{
+					Tx:    tx,
+					Time:  uint64(pool.all.Time(tx.Hash()).UnixNano()),
+					Local: local,
+				})
+			}
+		}
+	}
+	gather(pool.pending)
+	gather(pool.queue)
+	return txs
+}
+
+// restoreSnapshot injects a batch of snapshotted transactions into the pool,
+// validating them against the current state and respecting the pool limits.
+// The arrival times are retained, so queued transactions aren't kept beyond
+// their lifetime across restarts.
+func (pool *TxPool) restoreSnapshot(txs []*snapshotTx) []error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	dirty := make(map[common.Address]struct{})
+	errs := make([]error, len(txs))
+
+	for i, stx := range txs {
+		var replace bool
+		if replace, errs[i] = pool.add(stx.Tx, stx.Local && !pool.config.NoLocals); errs[i] != nil {
+			continue
+		}
+		arrival := time.Unix(0, int64(stx.Time))
+		pool.all.SetTime(stx.Tx.Hash(), arrival)
+
+		from, _ := types.Sender(pool.signer, stx.Tx) // already validated
+		if pool.beats[from].Before(arrival) {
+			pool.beats[from] = arrival
+		}
+		if !replace {
+			dirty[from] = struct{}{}
+		}
+	}
+	if len(dirty) > 0 {
+		addrs := make([]common.Address, 0, len(dirty))
+		for addr := range dirty {
+			addrs = append(addrs, addr)
+		}
+		pool.promoteExecutables(addrs)
+	}
+	return errs
+}
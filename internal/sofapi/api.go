@@ -27,6 +27,7 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/susy-go/susy-graviton/accounts"
+	"github.com/susy-go/susy-graviton/accounts/abi"
 	"github.com/susy-go/susy-graviton/accounts/keystore"
 	"github.com/susy-go/susy-graviton/common"
 	"github.com/susy-go/susy-graviton/common/hexutil"
@@ -34,6 +35,7 @@ import (
 	"github.com/susy-go/susy-graviton/consensus/sofash"
 	"github.com/susy-go/susy-graviton/core"
 	"github.com/susy-go/susy-graviton/core/rawdb"
+	"github.com/susy-go/susy-graviton/core/state"
 	"github.com/susy-go/susy-graviton/core/types"
 	"github.com/susy-go/susy-graviton/core/vm"
 	"github.com/susy-go/susy-graviton/crypto"
@@ -683,13 +685,61 @@ type CallArgs struct {
 	Data     hexutil.Bytes   `json:"data"`
 }
 
-func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, timeout time.Duration, globalGasCap *big.Int) ([]byte, uint64, bool, error) {
-	defer func(start time.Time) { log.Debug("Executing SVM call finished", "runtime", time.Since(start)) }(time.Now())
+// OverrideAccount indicates the overriding fields of account during the execution
+// of a message call.
+// Note, state and stateDiff can't be specified at the same time. If state is
+// set, message execution will only use the data in the given state. Otherwise
+// if stateDiff is set, all diff will be applied first and then execute the call
+// message.
+type OverrideAccount struct {
+	Nonce     *hexutil.Uint64              `json:"nonce"`
+	Code      *hexutil.Bytes               `json:"code"`
+	Balance   *hexutil.Big                 `json:"balance"`
+	State     *map[common.Hash]common.Hash `json:"state"`
+	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
+}
 
-	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
-	if state == nil || err != nil {
-		return nil, 0, false, err
+// StateOverride is the collection of overridden accounts.
+type StateOverride map[common.Address]OverrideAccount
+
+// Apply overrides the fields of specified accounts into the given state.
+func (diff *StateOverride) Apply(state *state.StateDB) error {
+	if diff == nil {
+		return nil
+	}
+	for addr, account := range *diff {
+		// Override account nonce.
+		if account.Nonce != nil {
+			state.SetNonce(addr, uint64(*account.Nonce))
+		}
+		// Override account(contract) code.
+		if account.Code != nil {
+			state.SetCode(addr, *account.Code)
+		}
+		// Override account balance.
+		if account.Balance != nil {
+			state.SetBalance(addr, (*big.Int)(account.Balance))
+		}
+		if account.State != nil && account.StateDiff != nil {
+			return fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
+		}
+		// Replace entire state if caller requires.
+		if account.State != nil {
+			state.SetStorage(addr, *account.State)
+		}
+		// Apply state diff into specified accounts.
+		if account.StateDiff != nil {
+			for key, value := range *account.StateDiff {
+				state.SetState(addr, key, value)
+			}
+		}
 	}
+	return state.Error()
+}
+
+// toMessage converts the call arguments into a message executable by the SVM,
+// filling in the sender, gas and gas price defaults.
+func (s *PublicBlockChainAPI) toMessage(args CallArgs, globalGasCap *big.Int) types.Message {
 	// Set sender address or use a default if none specified
 	addr := args.From
 	if addr == (common.Address{}) {
@@ -713,20 +763,12 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 		gasPrice = new(big.Int).SetUint64(defaultGasPrice)
 	}
 	// Create new call message
-	msg := types.NewMessage(addr, args.To, 0, args.Value.ToInt(), gas, gasPrice, args.Data, false)
-
-	// Setup context so it may be cancelled the call has completed
-	// or, in case of unmetered gas, setup a context with a timeout.
-	var cancel context.CancelFunc
-	if timeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, timeout)
-	} else {
-		ctx, cancel = context.WithCancel(ctx)
-	}
-	// Make sure the context is cancelled when the call has completed
-	// this makes sure resources are cleaned up.
-	defer cancel()
+	return types.NewMessage(addr, args.To, 0, args.Value.ToInt(), gas, gasPrice, args.Data, false)
+}
 
+// applyMessage executes a single message on top of the given state and header,
+// aborting the SVM as soon as the context is done.
+func (s *PublicBlockChainAPI) applyMessage(ctx context.Context, msg types.Message, state *state.StateDB, header *types.Header) ([]byte, uint64, bool, error) {
 	// Get a new instance of the SVM.
 	svm, vmError, err := s.b.GetSVM(ctx, msg, state, header)
 	if err != nil {
@@ -749,13 +791,161 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	return res, gas, failed, err
 }
 
+func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride, timeout time.Duration, globalGasCap *big.Int) ([]byte, uint64, bool, error) {
+	defer func(start time.Time) { log.Debug("Executing SVM call finished", "runtime", time.Since(start)) }(time.Now())
+
+	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, 0, false, err
+	}
+	if err := overrides.Apply(state); err != nil {
+		return nil, 0, false, err
+	}
+	msg := s.toMessage(args, globalGasCap)
+
+	// Setup context so it may be cancelled the call has completed
+	// or, in case of unmetered gas, setup a context with a timeout.
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	// Make sure the context is cancelled when the call has completed
+	// this makes sure resources are cleaned up.
+	defer cancel()
+
+	return s.applyMessage(ctx, msg, state, header)
+}
+
 // Call executes the given transaction on the state for the given block number.
 // It doesn't make and changes in the state/blockchain and is useful to execute and retrieve values.
-func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
-	result, _, _, err := s.doCall(ctx, args, blockNr, 5*time.Second, s.b.RPCGasCap())
+//
+// Additionally, the caller can specify a batch of contract for fields overriding.
+func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride) (hexutil.Bytes, error) {
+	result, _, failed, err := s.doCall(ctx, args, blockNr, overrides, 5*time.Second, s.b.RPCGasCap())
+	if err == nil && failed && len(result) > 0 {
+		return nil, newRevertError(result)
+	}
 	return (hexutil.Bytes)(result), err
 }
 
+// revertError is an API error that encompasses an SVM revert with the JSON-RPC
+// error code and the hex encoded revert data. The message contains the decoded
+// revert reason if the data holds one.
+type revertError struct {
+	error
+	data string // revert data hex encoded
+}
+
+func newRevertError(data []byte) *revertError {
+	err := errors.New("execution reverted")
+	if reason, errUnpack := abi.UnpackRevert(data); errUnpack == nil {
+		err = fmt.Errorf("execution reverted: %v", reason)
+	}
+	return &revertError{
+		error: err,
+		data:  hexutil.Encode(data),
+	}
+}
+
+// ErrorCode returns the JSON-RPC error code for a revert.
+func (e *revertError) ErrorCode() int {
+	return 3
+}
+
+// ErrorData returns the hex encoded revert data.
+func (e *revertError) ErrorData() interface{} {
+	return e.data
+}
+
+// BundleCallResult is the outcome of a single call executed as part of a bundle.
+type BundleCallResult struct {
+	ReturnData   hexutil.Bytes  `json:"returnData"`
+	Logs         []*types.Log   `json:"logs"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	Failed       bool           `json:"failed"`
+	Error        string         `json:"error,omitempty"`
+	RevertReason string         `json:"revertReason,omitempty"`
+}
+
+// BundleResult is the outcome of executing an ordered bundle of calls.
+type BundleResult struct {
+	BlockNumber hexutil.Uint64      `json:"blockNumber"`
+	BlockHash   common.Hash         `json:"blockHash"`
+	GasUsed     hexutil.Uint64      `json:"gasUsed"`
+	Results     []*BundleCallResult `json:"results"`
+}
+
+// CallBundle executes the given calls in order on top of the state for the given
+// block number, with every call seeing the state changes of the previous ones.
+// The optional overrides are applied to the state before the first call. Like
+// Call, it doesn't make any changes in the state/blockchain.
+//
+// A call that fails or can't be executed does not abort the bundle, its error is
+// reported in the corresponding result instead.
+func (s *PublicBlockChainAPI) CallBundle(ctx context.Context, calls []CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride) (*BundleResult, error) {
+	defer func(start time.Time) { log.Debug("Executing SVM call bundle finished", "runtime", time.Since(start)) }(time.Now())
+
+	if len(calls) == 0 {
+		return nil, errors.New("empty call bundle")
+	}
+	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	if err := overrides.Apply(state); err != nil {
+		return nil, err
+	}
+	// The whole bundle shares the same time allowance as a single call
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var (
+		gasCap      = s.b.RPCGasCap()
+		deleteEmpty = s.b.ChainConfig().IsSIP158(header.Number)
+		result      = &BundleResult{
+			BlockNumber: hexutil.Uint64(header.Number.Uint64()),
+			BlockHash:   header.Hash(),
+			Results:     make([]*BundleCallResult, 0, len(calls)),
+		}
+	)
+	for i, args := range calls {
+		// Calls have no transaction hash, key their logs by bundle position instead
+		callHash := common.BigToHash(big.NewInt(int64(i)))
+		state.Prepare(callHash, result.BlockHash, i)
+
+		res, gas, failed, err := s.applyMessage(ctx, s.toMessage(args, gasCap), state, header)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("execution aborted (timeout = 5s) at call %d", i)
+		}
+		call := &BundleCallResult{
+			ReturnData: res,
+			Logs:       state.GetLogs(callHash),
+			GasUsed:    hexutil.Uint64(gas),
+			Failed:     failed || err != nil,
+		}
+		if call.Logs == nil {
+			call.Logs = []*types.Log{}
+		}
+		if err != nil {
+			call.Error = err.Error()
+		} else if failed {
+			call.Error = "execution reverted"
+			if reason, err := abi.UnpackRevert(res); err == nil {
+				call.RevertReason = reason
+			}
+		}
+		result.GasUsed += call.GasUsed
+		result.Results = append(result.Results, call)
+
+		// Finalise the call like a transaction of a block, so that refunds,
+		// suicides and touched accounts don't leak into the next one
+		state.Finalise(deleteEmpty)
+	}
+	return result, nil
+}
+
 // EstimateGas returns an estimate of the amount of gas needed to execute the
 // given transaction against the current pending block.
 func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (hexutil.Uint64, error) {
@@ -783,19 +973,19 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (h
 	cap = hi
 
 	// Create a helper to check if a gas allowance results in an executable transaction
-	executable := func(gas uint64) bool {
+	executable := func(gas uint64) (bool, []byte) {
 		args.Gas = hexutil.Uint64(gas)
 
-		_, _, failed, err := s.doCall(ctx, args, rpc.PendingBlockNumber, 0, gasCap)
+		res, _, failed, err := s.doCall(ctx, args, rpc.PendingBlockNumber, nil, 0, gasCap)
 		if err != nil || failed {
-			return false
+			return false, res
 		}
-		return true
+		return true, nil
 	}
 	// Execute the binary search and hone in on an executable gas limit
 	for lo+1 < hi {
 		mid := (hi + lo) / 2
-		if !executable(mid) {
+		if ok, _ := executable(mid); !ok {
 			lo = mid
 		} else {
 			hi = mid
@@ -803,7 +993,10 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (h
 	}
 	// Reject the transaction as invalid if it still fails at the highest allowance
 	if hi == cap {
-		if !executable(hi) {
+		if ok, res := executable(hi); !ok {
+			if len(res) > 0 {
+				return 0, newRevertError(res)
+			}
 			return 0, fmt.Errorf("gas required exceeds allowance (%d) or always failing transaction", cap)
 		}
 	}
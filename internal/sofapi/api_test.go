@@ -0,0 +1,192 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package sofapi
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/common/hexutil"
+	"github.com/susy-go/susy-graviton/common/math"
+	"github.com/susy-go/susy-graviton/core"
+	"github.com/susy-go/susy-graviton/core/state"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/core/vm"
+	"github.com/susy-go/susy-graviton/params"
+	"github.com/susy-go/susy-graviton/rpc"
+	"github.com/susy-go/susy-graviton/sofdb"
+)
+
+var (
+	callSender = common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	// increments storage slot 0 and returns its new value
+	counterAddr = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	counterCode = common.FromHex("0x6000546001018060005560005260206000f3")
+
+	// clears storage slot 0, which earns a refund if it was set
+	clearAddr = common.HexToAddress("0x3000000000000000000000000000000000000003")
+	clearCode = common.FromHex("0x600060005500")
+
+	// reverts without data
+	revertAddr = common.HexToAddress("0x4000000000000000000000000000000000000004")
+	revertCode = common.FromHex("0x60006000fd")
+
+	recipientAddr = common.HexToAddress("0x5000000000000000000000000000000000000005")
+)
+
+// callTestBackend serves calls on top of a fixed state, the methods of the
+// backend not needed by calls are left unimplemented
+type callTestBackend struct {
+	Backend
+	state  *state.StateDB
+	header *types.Header
+}
+
+func newCallTestBackend(t *testing.T) *callTestBackend {
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(sofdb.NewMemDatabase()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb.SetCode(counterAddr, counterCode)
+	statedb.SetCode(clearAddr, clearCode)
+	statedb.SetCode(revertAddr, revertCode)
+	return &callTestBackend{
+		state: statedb,
+		header: &types.Header{
+			Number:     big.NewInt(1),
+			Difficulty: big.NewInt(1),
+			GasLimit:   params.GenesisGasLimit,
+		},
+	}
+}
+
+func (b *callTestBackend) ChainConfig() *params.ChainConfig {
+	return params.TestChainConfig
+}
+
+func (b *callTestBackend) RPCGasCap() *big.Int {
+	return nil
+}
+
+func (b *callTestBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	return b.state.Copy(), b.header, nil
+}
+
+func (b *callTestBackend) GetSVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header) (*vm.SVM, func() error, error) {
+	state.SetBalance(msg.From(), math.MaxBig256)
+	context := core.NewSVMContext(msg, header, nil, &header.Coinbase)
+	return vm.NewSVM(context, state, b.ChainConfig(), vm.Config{}), func() error { return nil }, nil
+}
+
+func callTo(addr common.Address) CallArgs {
+	return CallArgs{From: callSender, To: &addr}
+}
+
+func TestStateOverride(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(sofdb.NewMemDatabase()))
+	statedb.SetState(counterAddr, common.Hash{1}, common.Hash{1})
+	statedb.SetState(counterAddr, common.Hash{2}, common.Hash{2})
+
+	var (
+		nonce   = hexutil.Uint64(7)
+		code    = hexutil.Bytes(counterCode)
+		balance = (*hexutil.Big)(big.NewInt(42))
+		storage = map[common.Hash]common.Hash{{3}: {3}}
+		diff    = map[common.Hash]common.Hash{{2}: {4}}
+	)
+	overrides := StateOverride{
+		counterAddr: OverrideAccount{Nonce: &nonce, Code: &code, Balance: balance, StateDiff: &diff},
+		clearAddr:   OverrideAccount{State: &storage},
+	}
+	if err := overrides.Apply(statedb); err != nil {
+		t.Fatal(err)
+	}
+	if n := statedb.GetNonce(counterAddr); n != 7 {
+		t.Errorf("nonce mismatch: have %d, want 7", n)
+	}
+	if c := statedb.GetCode(counterAddr); !bytes.Equal(c, counterCode) {
+		t.Errorf("code mismatch: have %x, want %x", c, counterCode)
+	}
+	if b := statedb.GetBalance(counterAddr); b.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("balance mismatch: have %v, want 42", b)
+	}
+	// a state diff keeps the other slots
+	if v := statedb.GetState(counterAddr, common.Hash{1}); v != (common.Hash{1}) {
+		t.Errorf("untouched slot mismatch: have %x, want %x", v, common.Hash{1})
+	}
+	if v := statedb.GetState(counterAddr, common.Hash{2}); v != (common.Hash{4}) {
+		t.Errorf("diffed slot mismatch: have %x, want %x", v, common.Hash{4})
+	}
+	if v := statedb.GetState(clearAddr, common.Hash{3}); v != (common.Hash{3}) {
+		t.Errorf("replaced slot mismatch: have %x, want %x", v, common.Hash{3})
+	}
+
+	overrides = StateOverride{
+		counterAddr: OverrideAccount{State: &storage, StateDiff: &diff},
+	}
+	if err := overrides.Apply(statedb); err == nil {
+		t.Error("expected error for both state and state diff")
+	}
+}
+
+func TestCallBundle(t *testing.T) {
+	b := newCallTestBackend(t)
+	api := NewPublicBlockChainAPI(b)
+
+	// calls see the state changes of the previous ones
+	res, err := api.CallBundle(context.Background(), []CallArgs{callTo(counterAddr), callTo(counterAddr), callTo(revertAddr)}, rpc.LatestBlockNumber, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 3 {
+		t.Fatalf("result count mismatch: have %d, want 3", len(res.Results))
+	}
+	for i, want := range []int64{1, 2} {
+		if have := new(big.Int).SetBytes(res.Results[i].ReturnData); have.Int64() != want {
+			t.Errorf("call %d: return mismatch: have %v, want %d", i, have, want)
+		}
+	}
+	if r := res.Results[2]; !r.Failed || r.Error != "execution reverted" {
+		t.Errorf("expected reverted call, have failed %v, error %q", r.Failed, r.Error)
+	}
+	if res.BlockHash != b.header.Hash() {
+		t.Errorf("block hash mismatch: have %x, want %x", res.BlockHash, b.header.Hash())
+	}
+	// the state of the backend is left untouched
+	if v := b.state.GetState(counterAddr, common.Hash{}); v != (common.Hash{}) {
+		t.Errorf("bundle modified the state: slot 0 is %x", v)
+	}
+
+	// the refund of a call doesn't leak into the next one
+	slot := map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(1))}
+	overrides := &StateOverride{clearAddr: OverrideAccount{StateDiff: &slot}}
+	res, err = api.CallBundle(context.Background(), []CallArgs{callTo(clearAddr), callTo(recipientAddr)}, rpc.LatestBlockNumber, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gas := res.Results[1].GasUsed; gas != hexutil.Uint64(params.TxGas) {
+		t.Errorf("transfer gas mismatch: have %d, want %d", gas, params.TxGas)
+	}
+
+	if _, err := api.CallBundle(context.Background(), nil, rpc.LatestBlockNumber, nil); err == nil {
+		t.Error("expected error for empty bundle")
+	}
+}
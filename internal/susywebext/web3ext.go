@@ -20,6 +20,7 @@ package susywebext
 var Modules = map[string]string{
 	"accounting": Accounting_JS,
 	"admin":      Admin_JS,
+	"bft":        BFT_JS,
 	"chequebook": Chequebook_JS,
 	"clique":     Clique_JS,
 	"sofash":     Sofash_JS,
@@ -65,6 +66,47 @@ susyweb._extend({
 });
 `
 
+const BFT_JS = `
+susyweb._extend({
+	property: 'bft',
+	methods: [
+		new susyweb._extend.Method({
+			name: 'getSnapshot',
+			call: 'bft_getSnapshot',
+			params: 1,
+			inputFormatter: [null]
+		}),
+		new susyweb._extend.Method({
+			name: 'getValidators',
+			call: 'bft_getValidators',
+			params: 1,
+			inputFormatter: [null]
+		}),
+		new susyweb._extend.Method({
+			name: 'getValidatorsAtHash',
+			call: 'bft_getValidatorsAtHash',
+			params: 1
+		}),
+		new susyweb._extend.Method({
+			name: 'propose',
+			call: 'bft_propose',
+			params: 2
+		}),
+		new susyweb._extend.Method({
+			name: 'discard',
+			call: 'bft_discard',
+			params: 1
+		}),
+	],
+	properties: [
+		new susyweb._extend.Property({
+			name: 'proposals',
+			getter: 'bft_proposals'
+		}),
+	]
+});
+`
+
 const Clique_JS = `
 susyweb._extend({
 	property: 'clique',
@@ -415,6 +457,12 @@ susyweb._extend({
 			params: 2,
 			inputFormatter: [null, null]
 		}),
+		new susyweb._extend.Method({
+			name: 'revertReason',
+			call: 'debug_revertReason',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
 		new susyweb._extend.Method({
 			name: 'preimage',
 			call: 'debug_preimage',
@@ -500,6 +548,23 @@ susyweb._extend({
 			params: 3,
 			inputFormatter: [susyweb._extend.formatters.inputAddressFormatter, null, susyweb._extend.formatters.inputBlockNumberFormatter]
 		}),
+		new susyweb._extend.Method({
+			name: 'callBundle',
+			call: 'sof_callBundle',
+			params: 3,
+			inputFormatter: [null, susyweb._extend.formatters.inputBlockNumberFormatter, null]
+		}),
+		new susyweb._extend.Method({
+			name: 'sendPrivateTransaction',
+			call: 'sof_sendPrivateTransaction',
+			params: 1
+		}),
+		new susyweb._extend.Method({
+			name: 'sendBundle',
+			call: 'sof_sendBundle',
+			params: 2,
+			inputFormatter: [null, susyweb._extend.utils.fromDecimal]
+		}),
 	],
 	properties: [
 		new susyweb._extend.Property({
@@ -18,6 +18,7 @@ package les
 
 import (
 	"context"
+	"errors"
 	"math/big"
 
 	"github.com/susy-go/susy-graviton/accounts"
@@ -38,6 +39,11 @@ import (
 	"github.com/susy-go/susy-graviton/rpc"
 )
 
+var (
+	errFinalizedNotAvailable = errors.New("finalized block not available")
+	errSafeNotAvailable      = errors.New("safe block not available")
+)
+
 type LesApiBackend struct {
 	sof *LightSophon
 	gpo *gasprice.Oracle
@@ -57,8 +63,19 @@ func (b *LesApiBackend) SetHead(number uint64) {
 }
 
 func (b *LesApiBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
-	if blockNr == rpc.LatestBlockNumber || blockNr == rpc.PendingBlockNumber {
+	switch blockNr {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
 		return b.sof.blockchain.CurrentHeader(), nil
+	case rpc.FinalizedBlockNumber:
+		if header := b.sof.blockchain.CurrentFinalizedHeader(); header != nil {
+			return header, nil
+		}
+		return nil, errFinalizedNotAvailable
+	case rpc.SafeBlockNumber:
+		if header := b.sof.blockchain.CurrentSafeHeader(); header != nil {
+			return header, nil
+		}
+		return nil, errSafeNotAvailable
 	}
 	return b.sof.blockchain.GetHeaderByNumberOdr(ctx, uint64(blockNr))
 }
@@ -159,6 +176,10 @@ func (b *LesApiBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscri
 	return b.sof.blockchain.SubscribeLogsEvent(ch)
 }
 
+func (b *LesApiBackend) SubscribeChainFinalizedEvent(ch chan<- core.ChainFinalizedEvent) event.Subscription {
+	return b.sof.blockchain.SubscribeChainFinalizedEvent(ch)
+}
+
 func (b *LesApiBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
 	return b.sof.blockchain.SubscribeRemovedLogsEvent(ch)
 }
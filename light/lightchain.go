@@ -54,12 +54,16 @@ type LightChain struct {
 	chainFeed     event.Feed
 	chainSideFeed event.Feed
 	chainHeadFeed event.Feed
+	finalizedFeed event.Feed
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
 
 	mu      sync.RWMutex
 	chainmu sync.RWMutex
 
+	finalized     *types.Header // Last finalized header announced to the subscribers
+	finalizedLock sync.Mutex    // Lock protecting the finalized header announcements
+
 	bodyCache    *lru.Cache // Cache for the most recent block bodies
 	bodyRLPCache *lru.Cache // Cache for the most recent block bodies in RLP encoded format
 	blockCache   *lru.Cache // Cache for the most recent entire blocks
@@ -335,6 +339,7 @@ func (self *LightChain) postChainEvents(events []interface{}) {
 		case core.ChainEvent:
 			if self.CurrentHeader().Hash() == ev.Hash {
 				self.chainHeadFeed.Send(core.ChainHeadEvent{Block: ev.Block})
+				self.postFinalized()
 			}
 			self.chainFeed.Send(ev)
 		case core.ChainSideEvent:
@@ -343,6 +348,24 @@ func (self *LightChain) postChainEvents(events []interface{}) {
 	}
 }
 
+// postFinalized announces the finalized header of the canonical chain if it
+// advanced since the last announcement.
+func (self *LightChain) postFinalized() {
+	header := self.CurrentFinalizedHeader()
+	if header == nil {
+		return
+	}
+	self.finalizedLock.Lock()
+	if self.finalized != nil && header.Number.Cmp(self.finalized.Number) <= 0 {
+		self.finalizedLock.Unlock()
+		return
+	}
+	self.finalized = header
+	self.finalizedLock.Unlock()
+
+	self.finalizedFeed.Send(core.ChainFinalizedEvent{Header: header})
+}
+
 // InsertHeaderChain attempts to insert the given header chain in to the local
 // chain, possibly creating a reorg. If an error is returned, it will return the
 // index number of the failing header as well an error describing what went wrong.
@@ -399,6 +422,26 @@ func (self *LightChain) CurrentHeader() *types.Header {
 	return self.hc.CurrentHeader()
 }
 
+// CurrentFinalizedHeader retrieves the most recent header of the canonical chain
+// the consensus engine deems irreversible, or nil if there's none or the engine
+// has no notion of finality.
+func (self *LightChain) CurrentFinalizedHeader() *types.Header {
+	if finality, ok := self.engine.(consensus.Finality); ok {
+		return finality.FinalizedHeader(self.hc, self.hc.CurrentHeader())
+	}
+	return nil
+}
+
+// CurrentSafeHeader retrieves the most recent header of the canonical chain the
+// consensus engine deems unlikely to be reverted, or nil if there's none or the
+// engine has no notion of finality.
+func (self *LightChain) CurrentSafeHeader() *types.Header {
+	if finality, ok := self.engine.(consensus.Finality); ok {
+		return finality.SafeHeader(self.hc, self.hc.CurrentHeader())
+	}
+	return nil
+}
+
 // GetTd retrieves a block's total difficulty in the canonical chain from the
 // database by hash and number, caching it if found.
 func (self *LightChain) GetTd(hash common.Hash, number uint64) *big.Int {
@@ -522,6 +565,11 @@ func (self *LightChain) SubscribeChainSideEvent(ch chan<- core.ChainSideEvent) e
 	return self.scope.Track(self.chainSideFeed.Subscribe(ch))
 }
 
+// SubscribeChainFinalizedEvent registers a subscription of ChainFinalizedEvent.
+func (self *LightChain) SubscribeChainFinalizedEvent(ch chan<- core.ChainFinalizedEvent) event.Subscription {
+	return self.scope.Track(self.finalizedFeed.Subscribe(ch))
+}
+
 // SubscribeLogsEvent implements the interface of filters.Backend
 // LightChain does not send logs events, so return an empty subscription.
 func (self *LightChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
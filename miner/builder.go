@@ -0,0 +1,223 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/core"
+	"github.com/susy-go/susy-graviton/core/state"
+	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/core/vm"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/log"
+	"github.com/susy-go/susy-graviton/params"
+)
+
+const (
+	// bundleLimit is the maximum number of bundles waiting for inclusion.
+	bundleLimit = 256
+
+	// bundleHorizon is the maximum number of blocks ahead of the head a bundle
+	// may target.
+	bundleHorizon = 32
+)
+
+var (
+	// errBundleEmpty is returned if a bundle without transactions is submitted.
+	errBundleEmpty = errors.New("empty bundle")
+
+	// errBundleStale is returned if a bundle targets an already mined block.
+	errBundleStale = errors.New("bundle targets past block")
+
+	// errBundleFuture is returned if a bundle targets a block too far ahead of
+	// the head.
+	errBundleFuture = errors.New("bundle targets block too far in the future")
+
+	// errBundleLimit is returned if too many bundles are waiting for inclusion.
+	errBundleLimit = errors.New("bundle limit reached")
+
+	// errBundleReverted is returned if a transaction of a bundle fails during
+	// execution.
+	errBundleReverted = errors.New("bundle transaction reverted")
+
+	// errReplayProtection is returned if a replay protected transaction is built
+	// into a block before replay protection is enabled.
+	errReplayProtection = errors.New("replay protection not enabled")
+)
+
+// Builder constructs a part of the payload of the blocks mined locally. Before
+// filling a block with the transactions of the pool, the worker asks each of its
+// builders in turn for an ordered list of transactions to put at its top.
+//
+// The builder receives the parent block, a copy of the header template and a
+// copy of the state the block is built on, both of which it may freely modify,
+// e.g. to simulate the transactions. The returned transactions are included
+// atomically: if any of them fails to execute, none of them is included.
+type Builder interface {
+	Build(parent *types.Block, header *types.Header, statedb *state.StateDB) (types.Transactions, error)
+}
+
+// Bundle is an ordered set of transactions which must be included into a given
+// block atomically, or not at all.
+type Bundle struct {
+	Txs    types.Transactions // Transactions to include, in order
+	Number uint64             // Number of the block to include the bundle in
+}
+
+// Hash returns the identifier of the bundle, the hash of its transaction hashes.
+func (b *Bundle) Hash() common.Hash {
+	hashes := make([][]byte, len(b.Txs))
+	for i, tx := range b.Txs {
+		hashes[i] = tx.Hash().Bytes()
+	}
+	return crypto.Keccak256Hash(hashes...)
+}
+
+// BundleBuilder is a block builder placing externally submitted bundles at the
+// top of the blocks they target. Bundles are simulated in their order of arrival
+// and any one failing or reverting is left out.
+type BundleBuilder struct {
+	config *params.ChainConfig
+	chain  core.ChainContext
+	signer types.Signer
+
+	bundles []*Bundle // Bundles waiting for their block
+	lock    sync.Mutex
+}
+
+// NewBundleBuilder creates a block builder including bundles.
+func NewBundleBuilder(config *params.ChainConfig, chain core.ChainContext) *BundleBuilder {
+	return &BundleBuilder{
+		config: config,
+		chain:  chain,
+		signer: types.NewSIP155Signer(config.ChainID),
+	}
+}
+
+// Add submits a bundle for inclusion into the block it targets, given the number
+// of the current head block. Only the next bundleHorizon blocks may be targeted.
+func (b *BundleBuilder) Add(bundle *Bundle, head uint64) error {
+	if len(bundle.Txs) == 0 {
+		return errBundleEmpty
+	}
+	if bundle.Number <= head {
+		return errBundleStale
+	}
+	if bundle.Number > head+bundleHorizon {
+		return errBundleFuture
+	}
+	for i, tx := range bundle.Txs {
+		if _, err := types.Sender(b.signer, tx); err != nil {
+			return fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// Drop any bundles already passed before checking the limit
+	live := b.bundles[:0]
+	for _, old := range b.bundles {
+		if old.Number > head {
+			live = append(live, old)
+		}
+	}
+	b.bundles = live
+
+	if len(b.bundles) >= bundleLimit {
+		return errBundleLimit
+	}
+	b.bundles = append(b.bundles, bundle)
+	return nil
+}
+
+// Bundles returns the bundles waiting for inclusion.
+func (b *BundleBuilder) Bundles() []*Bundle {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return append([]*Bundle(nil), b.bundles...)
+}
+
+// Build implements Builder, returning the transactions of all the bundles that
+// target the block and execute successfully on top of each other.
+func (b *BundleBuilder) Build(parent *types.Block, header *types.Header, statedb *state.StateDB) (types.Transactions, error) {
+	number := header.Number.Uint64()
+
+	// Drop the bundles already passed and gather the ones targeting this block
+	b.lock.Lock()
+	var bundles []*Bundle
+	live := b.bundles[:0]
+	for _, bundle := range b.bundles {
+		if bundle.Number < number {
+			continue
+		}
+		live = append(live, bundle)
+		if bundle.Number == number {
+			bundles = append(bundles, bundle)
+		}
+	}
+	b.bundles = live
+	b.lock.Unlock()
+
+	// Simulate the bundles one after the other, leaving out the failing ones
+	var (
+		txs types.Transactions
+		gp  = new(core.GasPool).AddGas(header.GasLimit - header.GasUsed)
+	)
+	for _, bundle := range bundles {
+		// Transactions finalise the state, so revert to a copy instead of a snapshot
+		var (
+			backup = statedb.Copy()
+			gas    = gp.Gas()
+			used   = header.GasUsed
+		)
+		if err := b.simulate(bundle, header, statedb, gp); err != nil {
+			log.Debug("Skipping failing bundle", "hash", bundle.Hash(), "number", number, "err", err)
+
+			statedb = backup
+			gp = new(core.GasPool).AddGas(gas)
+			header.GasUsed = used
+			continue
+		}
+		txs = append(txs, bundle.Txs...)
+	}
+	return txs, nil
+}
+
+// simulate executes the transactions of a bundle, failing if any of them fails
+// or reverts.
+func (b *BundleBuilder) simulate(bundle *Bundle, header *types.Header, statedb *state.StateDB, gp *core.GasPool) error {
+	for i, tx := range bundle.Txs {
+		if tx.Protected() && !b.config.IsSIP155(header.Number) {
+			return fmt.Errorf("transaction %d: %v", i, errReplayProtection)
+		}
+		statedb.Prepare(tx.Hash(), common.Hash{}, i)
+
+		receipt, _, err := core.ApplyTransaction(b.config, b.chain, &header.Coinbase, gp, statedb, header, tx, &header.GasUsed, vm.Config{})
+		if err != nil {
+			return fmt.Errorf("transaction %d: %v", i, err)
+		}
+		if receipt.Status == types.ReceiptStatusFailed {
+			return fmt.Errorf("transaction %d: %v", i, errBundleReverted)
+		}
+	}
+	return nil
+}
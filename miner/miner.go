@@ -46,6 +46,7 @@ type Miner struct {
 	coinbase common.Address
 	sof      Backend
 	engine   consensus.Engine
+	bundles  *BundleBuilder
 	exitCh   chan struct{}
 
 	canStart    int32 // can start indicates whether we can start the mining operation
@@ -59,8 +60,10 @@ func New(sof Backend, config *params.ChainConfig, mux *event.TypeMux, engine con
 		engine:   engine,
 		exitCh:   make(chan struct{}),
 		worker:   newWorker(config, engine, sof, mux, recommit, gasFloor, gasCeil, isLocalBlock),
+		bundles:  NewBundleBuilder(config, sof.BlockChain()),
 		canStart: 1,
 	}
+	miner.worker.addBuilder(miner.bundles)
 	go miner.update()
 
 	return miner
@@ -168,3 +171,15 @@ func (self *Miner) SetSophybase(addr common.Address) {
 	self.coinbase = addr
 	self.worker.setSophybase(addr)
 }
+
+// AddBuilder registers a block builder placing its transactions at the top of
+// the mined blocks, before the ones of the transaction pool. Builders are asked
+// for transactions in the order of registration, after the bundle builder.
+func (self *Miner) AddBuilder(builder Builder) {
+	self.worker.addBuilder(builder)
+}
+
+// Bundles returns the builder including the bundles submitted to the miner.
+func (self *Miner) Bundles() *BundleBuilder {
+	return self.bundles
+}
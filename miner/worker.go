@@ -86,6 +86,7 @@ type environment struct {
 	uncles    mapset.Set     // uncle set
 	tcount    int            // tx count in cycle
 	gasPool   *core.GasPool  // available gas used to pack transactions
+	private   bool           // whether private transactions were packed
 
 	header   *types.Header
 	txs      []*types.Transaction
@@ -153,9 +154,10 @@ type worker struct {
 	remoteUncles map[common.Hash]*types.Block // A set of side blocks as the possible uncle blocks.
 	unconfirmed  *unconfirmedBlocks           // A set of locally mined blocks pending canonicalness confirmations.
 
-	mu       sync.RWMutex // The lock used to protect the coinbase and extra fields
+	mu       sync.RWMutex // The lock used to protect the coinbase, extra and builder fields
 	coinbase common.Address
 	extra    []byte
+	builders []Builder // Block builders placing transactions before the pooled ones
 
 	pendingMu    sync.RWMutex
 	pendingTasks map[common.Hash]*task
@@ -240,6 +242,13 @@ func (w *worker) setExtra(extra []byte) {
 	w.extra = extra
 }
 
+// addBuilder registers a block builder to consult for new work.
+func (w *worker) addBuilder(builder Builder) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.builders = append(w.builders, builder)
+}
+
 // setRecommitInterval updates the interval for miner sealing work recommitting.
 func (w *worker) setRecommitInterval(interval time.Duration) {
 	w.resubmitIntervalCh <- interval
@@ -464,7 +473,7 @@ func (w *worker) mainLoop() {
 					acc, _ := types.Sender(w.current.signer, tx)
 					txs[acc] = append(txs[acc], tx)
 				}
-				txset := types.NewTransactionsByPriceAndNonce(w.current.signer, txs)
+				txset := w.sof.TxPool().Ordered(w.current.signer, txs)
 				w.commitTransactions(txset, coinbase, nil)
 				w.updateSnapshot()
 			} else {
@@ -655,9 +664,13 @@ func (w *worker) commitUncle(env *environment, uncle *types.Header) error {
 	return nil
 }
 
-// updateSnapshot updates pending snapshot block and state.
+// updateSnapshot updates pending snapshot block and state. Once private
+// transactions are packed, the snapshot is frozen so that they never leak.
 // Note this function assumes the current variable is thread safe.
 func (w *worker) updateSnapshot() {
+	if w.current.private {
+		return
+	}
 	w.snapshotMu.Lock()
 	defer w.snapshotMu.Unlock()
 
@@ -702,7 +715,66 @@ func (w *worker) commitTransaction(tx *types.Transaction, coinbase common.Addres
 	return receipt.Logs, nil
 }
 
-func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coinbase common.Address, interrupt *int32) bool {
+// postPendingLogs posts the logs of the transactions committed to the pending
+// block.
+func (w *worker) postPendingLogs(logs []*types.Log) {
+	if !w.isRunning() && len(logs) > 0 {
+		// We don't push the pendingLogsEvent while we are mining. The reason is that
+		// when we are mining, the worker will regenerate a mining block every 3 seconds.
+		// In order to avoid pushing the repeated pendingLog, we disable the pending log pushing.
+
+		// make a copy, the state caches the logs and these logs get "upgraded" from pending to mined
+		// logs by filling in the block hash when the block was mined by the local miner. This can
+		// cause a race condition if a log was "upgraded" before the PendingLogsEvent is processed.
+		cpy := make([]*types.Log, len(logs))
+		for i, l := range logs {
+			cpy[i] = new(types.Log)
+			*cpy[i] = *l
+		}
+		go w.mux.Post(core.PendingLogsEvent{Logs: cpy})
+	}
+}
+
+// commitBuilt commits the transactions returned by a block builder, all of them
+// or none at all, returning their logs.
+func (w *worker) commitBuilt(txs types.Transactions, coinbase common.Address) ([]*types.Log, error) {
+	if w.current.gasPool == nil {
+		w.current.gasPool = new(core.GasPool).AddGas(w.current.header.GasLimit)
+	}
+	// Transactions finalise the state, so revert to a copy instead of a snapshot
+	var (
+		backup = w.current.state.Copy()
+		gas    = w.current.gasPool.Gas()
+		used   = w.current.header.GasUsed
+		count  = w.current.tcount
+		logs   []*types.Log
+	)
+	for _, tx := range txs {
+		w.current.state.Prepare(tx.Hash(), common.Hash{}, w.current.tcount)
+
+		var (
+			txLogs []*types.Log
+			err    = errReplayProtection
+		)
+		if !tx.Protected() || w.config.IsSIP155(w.current.header.Number) {
+			txLogs, err = w.commitTransaction(tx, coinbase)
+		}
+		if err != nil {
+			w.current.state = backup
+			w.current.gasPool = new(core.GasPool).AddGas(gas)
+			w.current.header.GasUsed = used
+			w.current.txs = w.current.txs[:count]
+			w.current.receipts = w.current.receipts[:count]
+			w.current.tcount = count
+			return nil, err
+		}
+		logs = append(logs, txLogs...)
+		w.current.tcount++
+	}
+	return logs, nil
+}
+
+func (w *worker) commitTransactions(txs core.TxIterator, coinbase common.Address, interrupt *int32) bool {
 	// Short circuit if current is nil
 	if w.current == nil {
 		return true
@@ -792,21 +864,11 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		}
 	}
 
-	if !w.isRunning() && len(coalescedLogs) > 0 {
-		// We don't push the pendingLogsEvent while we are mining. The reason is that
-		// when we are mining, the worker will regenerate a mining block every 3 seconds.
-		// In order to avoid pushing the repeated pendingLog, we disable the pending log pushing.
-
-		// make a copy, the state caches the logs and these logs get "upgraded" from pending to mined
-		// logs by filling in the block hash when the block was mined by the local miner. This can
-		// cause a race condition if a log was "upgraded" before the PendingLogsEvent is processed.
-		cpy := make([]*types.Log, len(coalescedLogs))
-		for i, l := range coalescedLogs {
-			cpy[i] = new(types.Log)
-			*cpy[i] = *l
-		}
-		go w.mux.Post(core.PendingLogsEvent{Logs: cpy})
+	// The logs of private transactions must stay unannounced, like the transactions
+	if !w.current.private {
+		w.postPendingLogs(coalescedLogs)
 	}
+
 	// Notify resubmit loop to decrease resubmitting interval if current interval is larger
 	// than the user-specified one.
 	if interrupt != nil {
@@ -908,14 +970,35 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		w.commit(uncles, nil, false, tstart)
 	}
 
+	// Place the transactions of the block builders at the top of the block.
+	built := false
+	for _, builder := range w.builders {
+		txs, err := builder.Build(parent, types.CopyHeader(env.header), env.state.Copy())
+		if err != nil {
+			log.Warn("Block builder failed", "err", err)
+			continue
+		}
+		if len(txs) == 0 {
+			continue
+		}
+		logs, err := w.commitBuilt(txs, w.coinbase)
+		if err != nil {
+			log.Warn("Failed to commit built transactions", "count", len(txs), "err", err)
+			continue
+		}
+		w.postPendingLogs(logs)
+		built = true
+	}
 	// Fill the block with all available pending transactions.
 	pending, err := w.sof.TxPool().Pending()
 	if err != nil {
 		log.Error("Failed to fetch pending transactions", "err", err)
 		return
 	}
+	private := w.sof.TxPool().Private()
+
 	// Short circuit if there is no available pending transactions
-	if len(pending) == 0 {
+	if len(pending) == 0 && len(private) == 0 && !built {
 		w.updateSnapshot()
 		return
 	}
@@ -928,13 +1011,23 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		}
 	}
 	if len(localTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, localTxs)
+		txs := w.sof.TxPool().Ordered(w.current.signer, localTxs)
 		if w.commitTransactions(txs, w.coinbase, interrupt) {
 			return
 		}
 	}
 	if len(remoteTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, remoteTxs)
+		txs := w.sof.TxPool().Ordered(w.current.signer, remoteTxs)
+		if w.commitTransactions(txs, w.coinbase, interrupt) {
+			return
+		}
+	}
+	// Pack the private transactions last, after snapshotting the public pending state
+	if len(private) > 0 {
+		w.updateSnapshot()
+		w.current.private = true
+
+		txs := w.sof.TxPool().Ordered(w.current.signer, private)
 		if w.commitTransactions(txs, w.coinbase, interrupt) {
 			return
 		}
@@ -170,6 +170,142 @@ func testPendingStateAndBlock(t *testing.T, chainConfig *params.ChainConfig, eng
 	}
 }
 
+// Tests that private transactions are packed into the mining block, but never
+// appear in the pending block and state.
+func TestPrivateTransactionsHidden(t *testing.T) {
+	engine := sofash.NewFaker()
+	defer engine.Close()
+
+	backend := newTestWorkerBackend(t, sofashChainConfig, engine, 0)
+	backend.txPool.AddLocals(pendingTxs)
+	if err := backend.txPool.AddPrivate(newTxs[0]); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	w := newWorker(sofashChainConfig, engine, backend, new(event.TypeMux), time.Second, params.GenesisGasLimit, params.GenesisGasLimit, nil)
+	w.setSophybase(testBankAddress)
+	defer w.close()
+
+	// Ensure snapshot has been updated.
+	time.Sleep(100 * time.Millisecond)
+	block, state := w.pending()
+	if txs := len(block.Transactions()); txs != 1 {
+		t.Errorf("pending transaction count mismatch: have %d, want %d", txs, 1)
+	}
+	if balance := state.GetBalance(testUserAddress); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("account balance mismatch: have %d, want %d", balance, 1000)
+	}
+	w.mu.Lock()
+	txs := w.current.tcount
+	w.mu.Unlock()
+	if txs != 2 {
+		t.Errorf("mining transaction count mismatch: have %d, want %d", txs, 2)
+	}
+}
+
+// Tests that the logs of private transactions are never posted as pending logs.
+func TestPrivateTransactionLogsHidden(t *testing.T) {
+	engine := sofash.NewFaker()
+	defer engine.Close()
+
+	backend := newTestWorkerBackend(t, sofashChainConfig, engine, 0)
+	backend.txPool.AddLocals(pendingTxs)
+	logger, _ := types.SignTx(types.NewContractCreation(1, big.NewInt(0), 100000, nil, common.FromHex("0x60006000a0")), types.HomesteadSigner{}, testBankKey)
+	if err := backend.txPool.AddPrivate(logger); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	mux := new(event.TypeMux)
+	logs := mux.Subscribe(core.PendingLogsEvent{})
+	defer logs.Unsubscribe()
+
+	w := newWorker(sofashChainConfig, engine, backend, mux, time.Second, params.GenesisGasLimit, params.GenesisGasLimit, nil)
+	w.setSophybase(testBankAddress)
+	defer w.close()
+
+	timeout := time.After(500 * time.Millisecond)
+	for {
+		select {
+		case ev := <-logs.Chan():
+			for _, l := range ev.Data.(core.PendingLogsEvent).Logs {
+				if l.TxHash == logger.Hash() {
+					t.Fatalf("pending logs of the private transaction posted")
+				}
+			}
+		case <-timeout:
+			// The work is committed holding the read lock
+			w.mu.Lock()
+			txs := w.current.tcount
+			w.mu.Unlock()
+			if txs != 2 {
+				t.Fatalf("mining transaction count mismatch: have %d, want %d", txs, 2)
+			}
+			return
+		}
+	}
+}
+
+// Tests that the transactions of the block builders are placed at the top of the
+// block with their logs posted, and that failing bundles are left out entirely.
+func TestBundleBuilder(t *testing.T) {
+	engine := sofash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, sofashChainConfig, engine, 0)
+	defer w.close()
+
+	// Create a bundle funding the user and returning part of it, and a failing one
+	fund, _ := types.SignTx(types.NewTransaction(0, testUserAddress, big.NewInt(5000), params.TxGas, nil, nil), types.HomesteadSigner{}, testBankKey)
+	refund, _ := types.SignTx(types.NewTransaction(0, testBankAddress, big.NewInt(1000), params.TxGas, nil, nil), types.HomesteadSigner{}, testUserKey)
+	spend, _ := types.SignTx(types.NewTransaction(1, testBankAddress, big.NewInt(1000), params.TxGas, nil, nil), types.HomesteadSigner{}, testUserKey)
+	gapped, _ := types.SignTx(types.NewTransaction(5, testBankAddress, big.NewInt(1000), params.TxGas, nil, nil), types.HomesteadSigner{}, testUserKey)
+	logger, _ := types.SignTx(types.NewContractCreation(1, big.NewInt(0), 100000, nil, common.FromHex("0x60006000a0")), types.HomesteadSigner{}, testUserKey)
+
+	logs := w.mux.Subscribe(core.PendingLogsEvent{})
+	defer logs.Unsubscribe()
+
+	bundles := NewBundleBuilder(sofashChainConfig, b.chain)
+	if err := bundles.Add(&Bundle{Txs: types.Transactions{fund, refund, logger}, Number: 1}, 0); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	if err := bundles.Add(&Bundle{Txs: types.Transactions{spend, gapped}, Number: 1}, 0); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	if err := bundles.Add(&Bundle{Txs: types.Transactions{spend}, Number: 0}, 0); err != errBundleStale {
+		t.Fatalf("stale bundle error mismatch: have %v, want %v", err, errBundleStale)
+	}
+	if err := bundles.Add(&Bundle{Txs: types.Transactions{spend}, Number: bundleHorizon + 1}, 0); err != errBundleFuture {
+		t.Fatalf("future bundle error mismatch: have %v, want %v", err, errBundleFuture)
+	}
+	w.addBuilder(bundles)
+
+	// Ensure the first work has finished, then recreate it with the bundles
+	time.Sleep(100 * time.Millisecond)
+	w.startCh <- struct{}{}
+	time.Sleep(100 * time.Millisecond)
+
+	block, state := w.pending()
+	if txs := block.Transactions(); len(txs) != 3 || txs[0].Hash() != fund.Hash() || txs[1].Hash() != refund.Hash() || txs[2].Hash() != logger.Hash() {
+		t.Fatalf("pending transactions mismatch: have %d, want bundle of %d", len(txs), 3)
+	}
+	if balance := state.GetBalance(testUserAddress); balance.Cmp(big.NewInt(4000)) != 0 {
+		t.Errorf("account balance mismatch: have %d, want %d", balance, 4000)
+	}
+	// The pooled transaction clashing with the bundle must have been skipped
+	if nonce := state.GetNonce(testBankAddress); nonce != 1 {
+		t.Errorf("bank nonce mismatch: have %d, want %d", nonce, 1)
+	}
+	// The logs of the bundle must have been posted as pending ones
+	for {
+		select {
+		case ev := <-logs.Chan():
+			if pending := ev.Data.(core.PendingLogsEvent).Logs; len(pending) == 1 && pending[0].TxHash == logger.Hash() {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("pending logs of the bundle not posted")
+		}
+	}
+}
+
 func TestEmptyWorkSofash(t *testing.T) {
 	testEmptyWork(t, sofashChainConfig, sofash.NewFaker())
 }
@@ -18,6 +18,8 @@ package node
 
 import (
 	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -25,11 +27,13 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/susy-go/susy-graviton/accounts"
 	"github.com/susy-go/susy-graviton/accounts/keystore"
 	"github.com/susy-go/susy-graviton/accounts/usbwallet"
 	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/common/hexutil"
 	"github.com/susy-go/susy-graviton/crypto"
 	"github.com/susy-go/susy-graviton/log"
 	"github.com/susy-go/susy-graviton/p2p"
@@ -125,6 +129,19 @@ type Config struct {
 	// interface.
 	HTTPTimeouts rpc.HTTPTimeouts
 
+	// HTTPPathPrefix is the path prefix under which JSON-RPC is served over HTTP,
+	// allowing it to coexist with other handlers behind a single reverse proxy.
+	// If empty, JSON-RPC is served on every path not claimed by another handler.
+	HTTPPathPrefix string `toml:",omitempty"`
+
+	// HTTPMetricsPath is the path on the HTTP server at which the metrics of the
+	// node are exposed. If empty, metrics are not served over the RPC port.
+	HTTPMetricsPath string `toml:",omitempty"`
+
+	// HTTPHealthPath is the path on the HTTP server at which the health of the node
+	// is reported. If empty, no health endpoint is served.
+	HTTPHealthPath string `toml:",omitempty"`
+
 	// WSHost is the host interface on which to start the websocket RPC server. If
 	// this field is empty, no websocket API endpoint will be started.
 	WSHost string `toml:",omitempty"`
@@ -151,6 +168,26 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// WSPathPrefix is the path prefix under which WebSocket handshakes are
+	// accepted. If the websocket endpoint is the same as the HTTP one, both are
+	// served by a single listener, telling WebSocket upgrades and plain HTTP
+	// requests apart.
+	WSPathPrefix string `toml:",omitempty"`
+
+	// RPCLimits configures the batch, response size, concurrency and rate limits
+	// enforced on the clients of the HTTP and WebSocket RPC interfaces.
+	RPCLimits rpc.Limits `toml:",omitempty"`
+
+	// JWTSecret is the path of the file holding the hex encoded secret which the
+	// clients of the HTTP and WebSocket RPC interfaces must sign their HS256 tokens
+	// with. If the file doesn't exist, a new secret is generated and stored in it.
+	// Authentication is disabled if the path is empty.
+	JWTSecret string `toml:",omitempty"`
+
+	// JWTFreshness is the maximum distance between the issued-at claim of a token
+	// and the local time. If zero, rpc.DefaultJWTFreshness is used.
+	JWTFreshness time.Duration `toml:",omitempty"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
@@ -342,6 +379,45 @@ func (c *Config) NodeKey() *ecdsa.PrivateKey {
 	return key
 }
 
+// JWTConfig loads the secret authenticating the clients of the HTTP and WebSocket
+// RPC interfaces. If the configured secret file doesn't exist, a new secret is
+// generated and persisted.
+func (c *Config) JWTConfig() (rpc.JWTConfig, error) {
+	if c.JWTSecret == "" {
+		return rpc.JWTConfig{}, nil
+	}
+	config := rpc.JWTConfig{Freshness: c.JWTFreshness}
+
+	path := c.ResolvePath(c.JWTSecret)
+	if data, err := ioutil.ReadFile(path); err == nil {
+		secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+		if err != nil {
+			return rpc.JWTConfig{}, fmt.Errorf("invalid JWT secret in %s: %v", path, err)
+		}
+		if len(secret) < 32 {
+			return rpc.JWTConfig{}, fmt.Errorf("JWT secret in %s too short (%d bytes < 32)", path, len(secret))
+		}
+		config.Secret = secret
+		return config, nil
+	} else if !os.IsNotExist(err) {
+		return rpc.JWTConfig{}, err
+	}
+	// No secret found, generate and store a new one
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return rpc.JWTConfig{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return rpc.JWTConfig{}, err
+	}
+	if err := ioutil.WriteFile(path, []byte(hexutil.Encode(secret)), 0600); err != nil {
+		return rpc.JWTConfig{}, err
+	}
+	log.Info("Generated JWT secret", "path", path)
+	config.Secret = secret
+	return config, nil
+}
+
 // StaticNodes returns a list of node enode URLs configured as static nodes.
 func (c *Config) StaticNodes() []*enode.Node {
 	return c.parsePersistentNodes(&c.staticNodesWarning, c.ResolvePath(datadirStaticNodes))
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -31,6 +32,8 @@ import (
 	"github.com/susy-go/susy-graviton/event"
 	"github.com/susy-go/susy-graviton/internal/debug"
 	"github.com/susy-go/susy-graviton/log"
+	"github.com/susy-go/susy-graviton/metrics"
+	"github.com/susy-go/susy-graviton/metrics/exp"
 	"github.com/susy-go/susy-graviton/p2p"
 	"github.com/susy-go/susy-graviton/rpc"
 	"github.com/promsofeus/promsofeus/util/flock"
@@ -67,6 +70,11 @@ type Node struct {
 	wsListener net.Listener // Websocket RPC listener socket to server API requests
 	wsHandler  *rpc.Server  // Websocket RPC request handler to process the API requests
 
+	httpHandlers     map[string]http.Handler // Custom HTTP handlers mounted on the HTTP listener, keyed by path
+	httpHandlerNames map[string]string       // Names of the custom HTTP handlers for logging, keyed by path
+
+	jwtConfig rpc.JWTConfig // JWT authentication of the HTTP and websocket RPC clients
+
 	stop chan struct{} // Channel to wait for termination notifications
 	lock sync.RWMutex
 
@@ -108,7 +116,7 @@ func New(conf *Config) (*Node, error) {
 	}
 	// Note: any interaction with Config that would create/touch files
 	// in the data directory or instance directory is delayed until Start.
-	return &Node{
+	node := &Node{
 		accman:            am,
 		ephemeralKeystore: ephemeralKeystore,
 		config:            conf,
@@ -118,7 +126,19 @@ func New(conf *Config) (*Node, error) {
 		wsEndpoint:        conf.WSEndpoint(),
 		eventmux:          new(event.TypeMux),
 		log:               conf.Logger,
-	}, nil
+	}
+	// Mount the built-in handlers sharing the HTTP RPC listener
+	if conf.HTTPMetricsPath != "" {
+		if err := node.RegisterHandler("metrics", conf.HTTPMetricsPath, exp.ExpHandler(metrics.DefaultRegistry)); err != nil {
+			return nil, err
+		}
+	}
+	if conf.HTTPHealthPath != "" {
+		if err := node.RegisterHandler("health", conf.HTTPHealthPath, node.healthHandler()); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
 }
 
 // Register injects a new service into the node's stack. The service created by
@@ -255,6 +275,13 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	for _, service := range services {
 		apis = append(apis, service.APIs()...)
 	}
+	// Load the secret authenticating the HTTP and websocket clients
+	jwtConfig, err := n.config.JWTConfig()
+	if err != nil {
+		return err
+	}
+	n.jwtConfig = jwtConfig
+
 	// Start the various API endpoints, terminating all in case of errors
 	if err := n.startInProc(apis); err != nil {
 		return err
@@ -330,21 +357,77 @@ func (n *Node) stopIPC() {
 	}
 }
 
-// startHTTP initializes and starts the HTTP RPC endpoint.
+// newRPCServer creates an RPC server for a network endpoint, registering the
+// whitelisted modules or all the public ones if the whitelist is empty.
+func (n *Node) newRPCServer(kind string, apis []rpc.API, modules []string, exposeAll bool) (*rpc.Server, error) {
+	// Generate the whitelist based on the allowed modules
+	whitelist := make(map[string]bool)
+	for _, module := range modules {
+		whitelist[module] = true
+	}
+	// Register all the APIs exposed by the services
+	handler := rpc.NewServer()
+	handler.SetLimits(n.config.RPCLimits)
+	for _, api := range apis {
+		if exposeAll || whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
+			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
+				handler.Stop()
+				return nil, err
+			}
+			n.log.Debug(kind+" registered", "namespace", api.Namespace)
+		}
+	}
+	return handler, nil
+}
+
+// startHTTP initializes and starts the HTTP RPC endpoint along with the custom
+// HTTP handlers. If the websocket endpoint is the same as the HTTP one, websocket
+// RPC is served by the same listener.
 func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors []string, vhosts []string, timeouts rpc.HTTPTimeouts) error {
 	// Short circuit if the HTTP endpoint isn't being exposed
 	if endpoint == "" {
 		return nil
 	}
-	listener, handler, err := rpc.StartHTTPEndpoint(endpoint, apis, modules, cors, vhosts, timeouts)
+	handler, err := n.newRPCServer("HTTP", apis, modules, false)
+	if err != nil {
+		return err
+	}
+	router := &httpRouter{
+		rpcPrefix: cleanPathPrefix(n.config.HTTPPathPrefix),
+		rpc:       rpc.NewHTTPHandlerStack(handler, cors, vhosts, n.jwtConfig),
+		handlers:  n.handlerMux(),
+	}
+	if router.handlers != nil {
+		router.custom = rpc.NewHTTPHandlerStack(router.handlers, cors, vhosts, n.jwtConfig)
+	}
+	var wsHandler *rpc.Server
+	if endpoint == n.wsEndpoint {
+		if wsHandler, err = n.newRPCServer("WebSocket", apis, n.config.WSModules, n.config.WSExposeAll); err != nil {
+			handler.Stop()
+			return err
+		}
+		router.wsPrefix = cleanPathPrefix(n.config.WSPathPrefix)
+		router.ws = rpc.NewWSHandlerStack(wsHandler.WebsocketHandler(n.config.WSOrigins), n.jwtConfig)
+	}
+	listener, err := net.Listen("tcp", endpoint)
 	if err != nil {
+		handler.Stop()
+		if wsHandler != nil {
+			wsHandler.Stop()
+		}
 		return err
 	}
-	n.log.Info("HTTP endpoint opened", "url", fmt.Sprintf("http://%s", endpoint), "cors", strings.Join(cors, ","), "vhosts", strings.Join(vhosts, ","))
+	go rpc.NewTimeoutHTTPServer(timeouts, router).Serve(listener)
+
+	n.log.Info("HTTP endpoint opened", "url", fmt.Sprintf("http://%s%s", endpoint, router.rpcPrefix), "cors", strings.Join(cors, ","), "vhosts", strings.Join(vhosts, ","), "auth", len(n.jwtConfig.Secret) > 0)
+	if wsHandler != nil {
+		n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%s%s", listener.Addr(), router.wsPrefix), "auth", len(n.jwtConfig.Secret) > 0, "shared", true)
+	}
 	// All listeners booted successfully
 	n.httpEndpoint = endpoint
 	n.httpListener = listener
 	n.httpHandler = handler
+	n.wsHandler = wsHandler
 
 	return nil
 }
@@ -363,17 +446,29 @@ func (n *Node) stopHTTP() {
 	}
 }
 
-// startWS initializes and starts the websocket RPC endpoint.
+// startWS initializes and starts the websocket RPC endpoint, unless it is served
+// by the HTTP listener already.
 func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrigins []string, exposeAll bool) error {
-	// Short circuit if the WS endpoint isn't being exposed
-	if endpoint == "" {
+	// Short circuit if the WS endpoint isn't being exposed or shares the HTTP listener
+	if endpoint == "" || endpoint == n.httpEndpoint {
 		return nil
 	}
-	listener, handler, err := rpc.StartWSEndpoint(endpoint, apis, modules, wsOrigins, exposeAll)
+	handler, err := n.newRPCServer("WebSocket", apis, modules, exposeAll)
+	if err != nil {
+		return err
+	}
+	router := &httpRouter{
+		wsPrefix: cleanPathPrefix(n.config.WSPathPrefix),
+		ws:       rpc.NewWSHandlerStack(handler.WebsocketHandler(wsOrigins), n.jwtConfig),
+	}
+	listener, err := net.Listen("tcp", endpoint)
 	if err != nil {
+		handler.Stop()
 		return err
 	}
-	n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%s", listener.Addr()))
+	go (&http.Server{Handler: router}).Serve(listener)
+
+	n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%s%s", listener.Addr(), router.wsPrefix), "auth", len(n.jwtConfig.Secret) > 0)
 	// All listeners booted successfully
 	n.wsEndpoint = endpoint
 	n.wsListener = listener
@@ -566,6 +661,9 @@ func (n *Node) WSEndpoint() string {
 	if n.wsListener != nil {
 		return n.wsListener.Addr().String()
 	}
+	if n.httpListener != nil && n.wsHandler != nil && n.wsEndpoint == n.httpEndpoint {
+		return n.httpListener.Addr().String()
+	}
 	return n.wsEndpoint
 }
 
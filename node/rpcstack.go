@@ -0,0 +1,141 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/susy-go/susy-graviton/rpc"
+)
+
+// httpRouter serves all the HTTP based endpoints of a node on a single listener.
+// WebSocket handshakes are dispatched to the WebSocket RPC handler, requests
+// matching a registered path to their handler and the rest to the HTTP RPC one.
+type httpRouter struct {
+	rpcPrefix string       // Path prefix of the HTTP RPC handler
+	rpc       http.Handler // HTTP RPC handler, nil if not served on this listener
+	wsPrefix  string       // Path prefix of the WebSocket RPC handler
+	ws        http.Handler // WebSocket RPC handler, nil if not served on this listener
+
+	handlers *http.ServeMux // Custom handlers registered on the node, used for matching paths
+	custom   http.Handler   // Custom handlers wrapped with the checks of the listener
+}
+
+// ServeHTTP implements http.Handler.
+func (r *httpRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.ws != nil && rpc.IsWebsocket(req) && hasPathPrefix(req.URL.Path, r.wsPrefix) {
+		r.ws.ServeHTTP(w, req)
+		return
+	}
+	if r.handlers != nil {
+		if _, pattern := r.handlers.Handler(req); pattern != "" {
+			r.custom.ServeHTTP(w, req)
+			return
+		}
+	}
+	if r.rpc != nil && hasPathPrefix(req.URL.Path, r.rpcPrefix) {
+		r.rpc.ServeHTTP(w, req)
+		return
+	}
+	http.NotFound(w, req)
+}
+
+// cleanPathPrefix normalizes a configured path prefix to start with a slash and
+// end without one. The root path is normalized to the empty prefix.
+func cleanPathPrefix(prefix string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
+
+// hasPathPrefix reports whether the request path lies under the given cleaned
+// path prefix.
+func hasPathPrefix(path, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// RegisterHandler mounts an HTTP handler on the HTTP RPC listener of the node,
+// serving all requests under the given path. It allows GraphQL, metrics and
+// similar endpoints to share the port of the RPC interface, behind the same
+// authentication, CORS and virtual host checks. Handlers must be registered
+// before the node is started, and only if the HTTP endpoint is enabled.
+func (n *Node) RegisterHandler(name, path string, handler http.Handler) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.server != nil {
+		return ErrNodeRunning
+	}
+	if n.httpEndpoint == "" {
+		return fmt.Errorf("%s handler cannot be mounted: %v", name, ErrHTTPDisabled)
+	}
+	path = cleanPathPrefix(path)
+	if path == "" {
+		return fmt.Errorf("%s handler cannot be mounted on the root path", name)
+	}
+	if _, exists := n.httpHandlers[path]; exists {
+		return fmt.Errorf("duplicate HTTP handler for path %s", path)
+	}
+	if n.httpHandlers == nil {
+		n.httpHandlers = make(map[string]http.Handler)
+		n.httpHandlerNames = make(map[string]string)
+	}
+	n.httpHandlers[path] = handler
+	n.httpHandlerNames[path] = name
+	return nil
+}
+
+// handlerMux assembles the custom HTTP handlers registered on the node, or nil
+// if there are none.
+func (n *Node) handlerMux() *http.ServeMux {
+	if len(n.httpHandlers) == 0 {
+		return nil
+	}
+	mux := http.NewServeMux()
+	for path, handler := range n.httpHandlers {
+		mux.Handle(path, handler)
+		mux.Handle(path+"/", handler)
+		n.log.Debug("HTTP handler registered", "name", n.httpHandlerNames[path], "path", path)
+	}
+	return mux
+}
+
+// healthHandler reports whether the node is running and how many peers it is
+// connected to.
+func (n *Node) healthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.lock.RLock()
+		server := n.server
+		n.lock.RUnlock()
+
+		w.Header().Set("content-type", "application/json")
+		if server == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{"status": "stopped"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "peers": server.PeerCount()})
+	})
+}
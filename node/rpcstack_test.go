@@ -0,0 +1,163 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/susy-go/susy-graviton/rpc"
+)
+
+// Tests that the HTTP and websocket RPC endpoints can share a single listener
+// with custom handlers, dispatched by path prefix.
+func TestSharedHTTPListener(t *testing.T) {
+	config := testNodeConfig()
+	config.HTTPHost, config.WSHost = "127.0.0.1", "127.0.0.1"
+	config.HTTPPathPrefix = "/rpc"
+	config.WSPathPrefix = "/ws/"
+	config.HTTPHealthPath = "/health"
+	config.HTTPMetricsPath = "debug/metrics"
+
+	stack, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	custom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("custom")) })
+	if err := stack.RegisterHandler("custom", "/custom", custom); err != nil {
+		t.Fatalf("failed to register handler: %v", err)
+	}
+	if err := stack.RegisterHandler("custom", "/custom", custom); err == nil {
+		t.Fatalf("duplicate handler registered")
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+	defer stack.Stop()
+
+	if stack.HTTPEndpoint() != stack.WSEndpoint() {
+		t.Fatalf("endpoint mismatch: http %s, ws %s", stack.HTTPEndpoint(), stack.WSEndpoint())
+	}
+	if err := stack.RegisterHandler("late", "/late", custom); err != ErrNodeRunning {
+		t.Fatalf("handler registration error mismatch: have %v, want %v", err, ErrNodeRunning)
+	}
+	base := "http://" + stack.HTTPEndpoint()
+
+	// JSON-RPC should only be served under its prefix, over both transports
+	var version string
+	for _, url := range []string{base + "/rpc", "ws://" + stack.WSEndpoint() + "/ws"} {
+		client, err := rpc.Dial(url)
+		if err != nil {
+			t.Fatalf("%s: failed to dial: %v", url, err)
+		}
+		if err := client.Call(&version, "susyweb_clientVersion"); err != nil {
+			t.Errorf("%s: call failed: %v", url, err)
+		}
+		client.Close()
+	}
+	client, err := rpc.Dial(base + "/other")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+	if err := client.Call(&version, "susyweb_clientVersion"); err == nil {
+		t.Errorf("call outside of the RPC prefix succeeded")
+	}
+	// The custom handlers should be served next to the RPC endpoints
+	if body := httpGet(t, base+"/custom/sub"); body != "custom" {
+		t.Errorf("custom handler response mismatch: have %q, want %q", body, "custom")
+	}
+	var health map[string]interface{}
+	if err := json.Unmarshal([]byte(httpGet(t, base+"/health")), &health); err != nil {
+		t.Fatalf("failed to decode health report: %v", err)
+	}
+	if health["status"] != "ok" {
+		t.Errorf("health status mismatch: have %v, want ok", health["status"])
+	}
+	if body := httpGet(t, base+"/debug/metrics"); !strings.HasPrefix(body, "{") {
+		t.Errorf("metrics response mismatch: have %q", body)
+	}
+	// The custom handlers should be behind the checks of the listener
+	req, _ := http.NewRequest("GET", base+"/health", nil)
+	req.Host = "evil.example"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to fetch health report: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("health status code mismatch for invalid host: have %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
+
+// Tests that custom handlers can't be registered if they would not be served.
+func TestRegisterHandlerHTTPDisabled(t *testing.T) {
+	config := testNodeConfig()
+	config.HTTPHealthPath = "/health"
+
+	if _, err := New(config); err == nil {
+		t.Fatalf("protocol stack created with a handler but no HTTP endpoint")
+	}
+	config.HTTPHealthPath = ""
+
+	stack, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	custom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	if err := stack.RegisterHandler("custom", "/custom", custom); err == nil {
+		t.Fatalf("handler registered without an HTTP endpoint")
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		path, prefix string
+		match        bool
+	}{
+		{"/", "", true},
+		{"/anything", cleanPathPrefix("/"), true},
+		{"/rpc", cleanPathPrefix("rpc"), true},
+		{"/rpc/", cleanPathPrefix("/rpc/"), true},
+		{"/rpc/sub", "/rpc", true},
+		{"/rpcs", "/rpc", false},
+		{"/", "/rpc", false},
+	}
+	for i, tt := range tests {
+		if match := hasPathPrefix(tt.path, tt.prefix); match != tt.match {
+			t.Errorf("test %d: %q under %q mismatch: have %v, want %v", i, tt.path, tt.prefix, match, tt.match)
+		}
+	}
+}
+
+// httpGet retrieves the body of an HTTP resource, failing the test on errors.
+func httpGet(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("failed to fetch %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", url, err)
+	}
+	return string(body)
+}
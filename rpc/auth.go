@@ -0,0 +1,187 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// DefaultJWTFreshness is the default maximum distance between the issued-at
+// claim of a token and the local time.
+const DefaultJWTFreshness = 60 * time.Second
+
+var (
+	errMissingToken = errors.New("missing token")
+	errStaleToken   = errors.New("stale token")
+	errExpiredToken = errors.New("token is expired")
+)
+
+// JWTConfig configures the HS256 JWT authentication of HTTP and WebSocket
+// clients.
+type JWTConfig struct {
+	Secret    []byte        // Shared secret signing the tokens, authentication is disabled if empty
+	Freshness time.Duration // Maximum distance between the issued-at claim and the local time
+}
+
+// jwtClaims are the claims of the tokens presented by authenticated clients.
+type jwtClaims struct {
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	Modules   []string `json:"modules,omitempty"`
+}
+
+// Valid implements jwt.Claims. The claims are validated by the authentication
+// handler, which knows the configured freshness window.
+func (c *jwtClaims) Valid() error {
+	return nil
+}
+
+// validate checks that the token was issued within the freshness window around
+// the given time and that it hasn't expired yet.
+func (c *jwtClaims) validate(now time.Time, freshness time.Duration) error {
+	if c.IssuedAt == 0 {
+		return errors.New("missing issued-at claim")
+	}
+	if diff := now.Sub(time.Unix(c.IssuedAt, 0)); diff > freshness || diff < -freshness {
+		return errStaleToken
+	}
+	if c.ExpiresAt != 0 && now.Unix() >= c.ExpiresAt {
+		return errExpiredToken
+	}
+	return nil
+}
+
+// jwtModulesKey is the context key of the modules an authenticated client is
+// allowed to access.
+type jwtModulesKey struct{}
+
+// jwtHandler is an http.Handler which rejects requests without a valid token
+// and restricts the modules available to the ones allowed by the token.
+type jwtHandler struct {
+	config JWTConfig
+	next   http.Handler
+}
+
+// newJWTHandler wraps the given handler with JWT authentication if a secret is
+// configured.
+func newJWTHandler(config JWTConfig, next http.Handler) http.Handler {
+	if len(config.Secret) == 0 {
+		return next
+	}
+	if config.Freshness <= 0 {
+		config.Freshness = DefaultJWTFreshness
+	}
+	return &jwtHandler{config: config, next: next}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *jwtHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// CORS preflight requests never carry credentials
+	if r.Method == http.MethodOptions {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	claims, err := h.authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if len(claims.Modules) > 0 {
+		modules := make(map[string]bool)
+		for _, module := range claims.Modules {
+			modules[module] = true
+		}
+		r = r.WithContext(context.WithValue(r.Context(), jwtModulesKey{}, modules))
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// authenticate parses and verifies the bearer token of the request.
+func (h *jwtHandler) authenticate(r *http.Request) (*jwtClaims, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, errMissingToken
+	}
+	claims := new(jwtClaims)
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}}
+
+	_, err := parser.ParseWithClaims(strings.TrimPrefix(auth, "Bearer "), claims, func(*jwt.Token) (interface{}, error) {
+		return h.config.Secret, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+	if err := claims.validate(time.Now(), h.config.Freshness); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// moduleAllowed reports whether the authenticated client of the request context
+// may access the given module. Requests without module restrictions may access
+// every module exposed by the server.
+func moduleAllowed(ctx context.Context, module string) bool {
+	modules, ok := ctx.Value(jwtModulesKey{}).(map[string]bool)
+	if !ok || module == MetadataApi {
+		return true
+	}
+	return modules[module]
+}
+
+// HTTPAuth is a function that adds authentication headers to the HTTP requests
+// made by a client, including WebSocket handshakes. It is invoked for every
+// request so it can issue fresh credentials.
+type HTTPAuth func(h http.Header) error
+
+// NewJWTAuth creates an HTTPAuth attaching a freshly issued HS256 token, signed
+// with the given secret, to every request. If modules are given, the tokens only
+// grant access to them.
+func NewJWTAuth(secret []byte, modules ...string) HTTPAuth {
+	return func(h http.Header) error {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwtClaims{
+			IssuedAt: time.Now().Unix(),
+			Modules:  modules,
+		})
+		signed, err := token.SignedString(secret)
+		if err != nil {
+			return err
+		}
+		h.Set("Authorization", "Bearer "+signed)
+		return nil
+	}
+}
+
+// DialWithAuth creates a new RPC client for an HTTP or WebSocket endpoint, just
+// like DialContext, attaching the credentials produced by auth to every HTTP
+// request and WebSocket handshake.
+func DialWithAuth(ctx context.Context, rawurl string, auth HTTPAuth) (*Client, error) {
+	switch {
+	case strings.HasPrefix(rawurl, "http://"), strings.HasPrefix(rawurl, "https://"):
+		return dialHTTP(rawurl, new(http.Client), auth)
+	case strings.HasPrefix(rawurl, "ws://"), strings.HasPrefix(rawurl, "wss://"):
+		return dialWebsocket(ctx, rawurl, "", auth)
+	default:
+		return nil, fmt.Errorf("no authenticated transport for URL %q", rawurl)
+	}
+}
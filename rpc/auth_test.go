@@ -0,0 +1,138 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var testJWTSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// newJWTTestServer starts an HTTP and a WebSocket server requiring JWT
+// authentication around a test RPC server.
+func newJWTTestServer(t *testing.T) (*Server, *httptest.Server, *httptest.Server) {
+	server := newTestServer("service", new(Service))
+	config := JWTConfig{Secret: testJWTSecret, Freshness: 5 * time.Second}
+
+	return server, httptest.NewServer(newJWTHandler(config, server)), httptest.NewServer(newJWTHandler(config, server.WebsocketHandler([]string{"*"})))
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	server, httpsrv, wssrv := newJWTTestServer(t)
+	defer server.Stop()
+	defer httpsrv.Close()
+	defer wssrv.Close()
+
+	for _, endpoint := range []string{httpsrv.URL, "ws" + strings.TrimPrefix(wssrv.URL, "http")} {
+		// Authenticated clients should be served
+		client, err := DialWithAuth(context.Background(), endpoint, NewJWTAuth(testJWTSecret))
+		if err != nil {
+			t.Fatalf("%s: failed to dial: %v", endpoint, err)
+		}
+		var resp Result
+		if err := client.Call(&resp, "service_echo", "hello", 10, &Args{"world"}); err != nil {
+			t.Errorf("%s: authenticated call failed: %v", endpoint, err)
+		}
+		client.Close()
+
+		// Clients with a wrong secret should be rejected
+		client, err = DialWithAuth(context.Background(), endpoint, NewJWTAuth([]byte("wrong secret")))
+		if err == nil {
+			if err := client.Call(&resp, "service_echo", "hello", 10, &Args{"world"}); err == nil {
+				t.Errorf("%s: call with invalid token succeeded", endpoint)
+			}
+			client.Close()
+		}
+	}
+	// Unauthenticated HTTP clients should be rejected
+	client, err := DialHTTP(httpsrv.URL)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	var resp Result
+	if err := client.Call(&resp, "service_echo", "hello", 10, &Args{"world"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("unauthenticated call error mismatch: have %v, want 401", err)
+	}
+}
+
+func TestJWTModuleRestriction(t *testing.T) {
+	server, httpsrv, wssrv := newJWTTestServer(t)
+	defer server.Stop()
+	defer httpsrv.Close()
+	defer wssrv.Close()
+
+	client, err := DialWithAuth(context.Background(), httpsrv.URL, NewJWTAuth(testJWTSecret, "other"))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	var resp Result
+	err = client.Call(&resp, "service_echo", "hello", 10, &Args{"world"})
+	if _, ok := err.(Error); !ok || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("restricted call error mismatch: have %v", err)
+	}
+	// The metadata module should always be available
+	var modules map[string]string
+	if err := client.Call(&modules, "rpc_modules"); err != nil {
+		t.Fatalf("metadata call failed: %v", err)
+	}
+}
+
+func TestJWTFreshness(t *testing.T) {
+	handler := newJWTHandler(JWTConfig{Secret: testJWTSecret, Freshness: 5 * time.Second}, http.NotFoundHandler()).(*jwtHandler)
+
+	tests := []struct {
+		claims *jwtClaims
+		valid  bool
+	}{
+		{&jwtClaims{IssuedAt: time.Now().Unix()}, true},
+		{&jwtClaims{IssuedAt: time.Now().Add(3 * time.Second).Unix()}, true},
+		{&jwtClaims{IssuedAt: time.Now().Add(-time.Minute).Unix()}, false},
+		{&jwtClaims{IssuedAt: time.Now().Add(time.Minute).Unix()}, false},
+		{&jwtClaims{IssuedAt: time.Now().Unix(), ExpiresAt: time.Now().Add(-time.Second).Unix()}, false},
+		{&jwtClaims{}, false},
+	}
+	for i, tt := range tests {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tt.claims).SignedString(testJWTSecret)
+		if err != nil {
+			t.Fatalf("test %d: failed to sign token: %v", i, err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "http://url.com", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		if _, err := handler.authenticate(req); (err == nil) != tt.valid {
+			t.Errorf("test %d: validity mismatch: have %v, want %v", i, err, tt.valid)
+		}
+	}
+	// Tokens signed with other algorithms should be rejected
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, &jwtClaims{IssuedAt: time.Now().Unix()}).SignedString(testJWTSecret)
+	req := httptest.NewRequest(http.MethodPost, "http://url.com", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if _, err := handler.authenticate(req); err == nil {
+		t.Error("token signed with HS512 accepted")
+	}
+}
@@ -49,6 +49,31 @@ func TestClientRequest(t *testing.T) {
 	}
 }
 
+func TestClientErrorData(t *testing.T) {
+	server := newTestServer("service", new(Service))
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var resp interface{}
+	err := client.Call(&resp, "service_returnError")
+	if err == nil {
+		t.Fatal("no error")
+	}
+	// Check code.
+	if e, ok := err.(Error); !ok {
+		t.Fatalf("client did not return rpc.Error, got %#v", e)
+	} else if e.ErrorCode() != (&dataError{}).ErrorCode() {
+		t.Fatalf("wrong error code %d, want %d", e.ErrorCode(), (&dataError{}).ErrorCode())
+	}
+	// Check data.
+	if e, ok := err.(DataError); !ok {
+		t.Fatalf("client did not return rpc.DataError, got %#v", e)
+	} else if e.ErrorData() != (&dataError{data: "testError data"}).ErrorData() {
+		t.Fatalf("wrong error data %#v, want %#v", e.ErrorData(), "testError data")
+	}
+}
+
 func TestClientBatchRequest(t *testing.T) {
 	server := newTestServer("service", new(Service))
 	defer server.Stop()
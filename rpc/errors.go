@@ -64,3 +64,19 @@ type shutdownError struct{}
 func (e *shutdownError) ErrorCode() int { return -32000 }
 
 func (e *shutdownError) Error() string { return "server is shutting down" }
+
+// request rejected because it exceeds one of the server's limits
+type limitExceededError struct{ message string }
+
+func (e *limitExceededError) ErrorCode() int { return -32005 }
+
+func (e *limitExceededError) Error() string { return e.message }
+
+// request for a module the authenticated client has no access to
+type moduleNotAllowedError struct{ module string }
+
+func (e *moduleNotAllowedError) ErrorCode() int { return -32601 }
+
+func (e *moduleNotAllowedError) Error() string {
+	return fmt.Sprintf("access to the %s module is not allowed", e.module)
+}
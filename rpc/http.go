@@ -49,6 +49,7 @@ var (
 type httpConn struct {
 	client    *http.Client
 	req       *http.Request
+	auth      HTTPAuth
 	closeOnce sync.Once
 	closed    chan struct{}
 }
@@ -106,6 +107,11 @@ var DefaultHTTPTimeouts = HTTPTimeouts{
 // DialHTTPWithClient creates a new RPC client that connects to an RPC server over HTTP
 // using the provided HTTP Client.
 func DialHTTPWithClient(endpoint string, client *http.Client) (*Client, error) {
+	return dialHTTP(endpoint, client, nil)
+}
+
+// dialHTTP creates a new HTTP RPC client, optionally authenticating requests.
+func dialHTTP(endpoint string, client *http.Client, auth HTTPAuth) (*Client, error) {
 	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
 	if err != nil {
 		return nil, err
@@ -115,7 +121,7 @@ func DialHTTPWithClient(endpoint string, client *http.Client) (*Client, error) {
 
 	initctx := context.Background()
 	return newClient(initctx, func(context.Context) (net.Conn, error) {
-		return &httpConn{client: client, req: req, closed: make(chan struct{})}, nil
+		return &httpConn{client: client, req: req, auth: auth, closed: make(chan struct{})}, nil
 	})
 }
 
@@ -165,6 +171,15 @@ func (c *Client) sendBatchHTTP(ctx context.Context, op *requestOp, msgs []*jsonr
 	return nil
 }
 
+// copyHeader returns a deep copy of the header.
+func copyHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
 func (hc *httpConn) doRequest(ctx context.Context, msg interface{}) (io.ReadCloser, error) {
 	body, err := json.Marshal(msg)
 	if err != nil {
@@ -174,6 +189,14 @@ func (hc *httpConn) doRequest(ctx context.Context, msg interface{}) (io.ReadClos
 	req.Body = ioutil.NopCloser(bytes.NewReader(body))
 	req.ContentLength = int64(len(body))
 
+	if hc.auth != nil {
+		// The headers are shared with concurrent requests, don't modify them
+		req.Header = copyHeader(hc.req.Header)
+		if err := hc.auth(req.Header); err != nil {
+			return nil, err
+		}
+	}
+
 	resp, err := hc.client.Do(req)
 	if err != nil {
 		return nil, err
@@ -199,10 +222,22 @@ func (t *httpReadWriteNopCloser) Close() error {
 //
 // Deprecated: Server implements http.Handler
 func NewHTTPServer(cors []string, vhosts []string, timeouts HTTPTimeouts, srv *Server) *http.Server {
+	return newHTTPServer(cors, vhosts, timeouts, srv)
+}
+
+// newHTTPServer creates a new HTTP server around the given RPC handler, wrapping
+// it with the CORS and virtual host checks.
+func newHTTPServer(cors []string, vhosts []string, timeouts HTTPTimeouts, srv http.Handler) *http.Server {
 	// Wrap the CORS-handler within a host-handler
 	handler := newCorsHandler(srv, cors)
 	handler = newVHostHandler(vhosts, handler)
 
+	return NewTimeoutHTTPServer(timeouts, handler)
+}
+
+// NewTimeoutHTTPServer creates an HTTP server around an arbitrary handler,
+// enforcing the given timeouts after sanitizing them.
+func NewTimeoutHTTPServer(timeouts HTTPTimeouts, handler http.Handler) *http.Server {
 	// Make sure timeout values are meaningful
 	if timeouts.ReadTimeout < time.Second {
 		log.Warn("Sanitizing invalid HTTP read timeout", "provided", timeouts.ReadTimeout, "updated", DefaultHTTPTimeouts.ReadTimeout)
@@ -225,6 +260,25 @@ func NewHTTPServer(cors []string, vhosts []string, timeouts HTTPTimeouts, srv *S
 	}
 }
 
+// NewHTTPHandlerStack wraps an HTTP RPC handler with the authentication, CORS
+// and virtual host checks of an HTTP endpoint.
+func NewHTTPHandlerStack(srv http.Handler, cors []string, vhosts []string, jwt JWTConfig) http.Handler {
+	handler := newCorsHandler(newJWTHandler(jwt, srv), cors)
+	return newVHostHandler(vhosts, handler)
+}
+
+// NewWSHandlerStack wraps a WebSocket RPC handler with the authentication checks
+// of a WebSocket endpoint. The allowed origins are enforced by the handler itself.
+func NewWSHandlerStack(srv http.Handler, jwt JWTConfig) http.Handler {
+	return newJWTHandler(jwt, srv)
+}
+
+// IsWebsocket reports whether the HTTP request is a WebSocket upgrade handshake.
+func IsWebsocket(r *http.Request) bool {
+	return strings.ToLower(r.Header.Get("Upgrade")) == "websocket" &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
 // ServeHTTP serves JSON-RPC requests over HTTP.
 func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Permit dumb empty requests for remote health-checks (AWS)
@@ -284,7 +338,7 @@ func validateRequest(r *http.Request) (int, error) {
 	return http.StatusUnsupportedMediaType, err
 }
 
-func newCorsHandler(srv *Server, allowedOrigins []string) http.Handler {
+func newCorsHandler(srv http.Handler, allowedOrigins []string) http.Handler {
 	// disable CORS support if user has not specified a custom CORS configuration
 	if len(allowedOrigins) == 0 {
 		return srv
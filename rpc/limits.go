@@ -0,0 +1,233 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRateBuckets is the number of token buckets the rate limiter tracks before
+// it starts dropping the ones belonging to idle clients.
+const maxRateBuckets = 16384
+
+// Rate is a token bucket configuration: requests are allowed at Limit per second
+// on average, with bursts of up to Burst requests.
+type Rate struct {
+	Limit float64 // Average number of requests allowed per second
+	Burst int     // Maximum number of requests allowed at once
+}
+
+// Limits configures the resource limits a Server enforces on its clients. The
+// zero value of any field disables the corresponding limit.
+type Limits struct {
+	// BatchItems is the maximum number of requests allowed in a batch.
+	BatchItems int `toml:",omitempty"`
+
+	// ResponseSize is the maximum size in bytes of a single response. For batch
+	// requests the limit applies to the sum of the responses.
+	ResponseSize int `toml:",omitempty"`
+
+	// ConcurrentRequests is the maximum number of requests served at the same
+	// time on a single connection (WebSocket and IPC).
+	ConcurrentRequests int `toml:",omitempty"`
+
+	// ClientRate is the request rate allowed for a single remote IP address
+	// across all methods (HTTP and WebSocket).
+	ClientRate Rate `toml:",omitempty"`
+
+	// MethodRates are the request rates allowed for a method (sof_getLogs) or a
+	// whole namespace (debug). Method rates take precedence over namespace ones
+	// and are tracked per remote IP address for HTTP and WebSocket clients.
+	MethodRates map[string]Rate `toml:",omitempty"`
+}
+
+// ParseRates parses a comma separated list of rate limits in the format
+// name=limit[:burst] as used on the command line. The burst defaults to the
+// limit rounded up.
+func ParseRates(input string) (map[string]Rate, error) {
+	rates := make(map[string]Rate)
+	for _, entry := range strings.Split(input, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid rate limit %q, want name=limit[:burst]", entry)
+		}
+		rate, err := ParseRate(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit %q: %v", entry, err)
+		}
+		rates[parts[0]] = rate
+	}
+	return rates, nil
+}
+
+// ParseRate parses a single rate limit in the format limit[:burst].
+func ParseRate(input string) (Rate, error) {
+	parts := strings.SplitN(input, ":", 2)
+
+	limit, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || limit <= 0 {
+		return Rate{}, fmt.Errorf("invalid limit %q", parts[0])
+	}
+	burst := int(math.Ceil(limit))
+	if len(parts) == 2 {
+		if burst, err = strconv.Atoi(parts[1]); err != nil || burst <= 0 {
+			return Rate{}, fmt.Errorf("invalid burst %q", parts[1])
+		}
+	}
+	return Rate{Limit: limit, Burst: burst}, nil
+}
+
+// tokenBucket is a single rate limited resource.
+type tokenBucket struct {
+	rate   Rate
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens accumulated since the last access to the bucket.
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate.Limit
+	if b.tokens > float64(b.rate.Burst) {
+		b.tokens = float64(b.rate.Burst)
+	}
+	b.last = now
+}
+
+// take tries to consume a token from the bucket.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// bucketKey identifies the token bucket of a client for a limited resource.
+type bucketKey struct {
+	remote string // remote IP address, empty for local transports
+	name   string // method or namespace name, empty for the client-wide limit
+}
+
+// rateLimiter tracks the token buckets of the method and client rate limits.
+type rateLimiter struct {
+	client  Rate
+	methods map[string]Rate
+
+	buckets map[bucketKey]*tokenBucket
+	lock    sync.Mutex
+}
+
+// newRateLimiter creates a rate limiter from the configured limits, or nil if
+// no rate limits are configured.
+func newRateLimiter(limits Limits) *rateLimiter {
+	if limits.ClientRate.Limit <= 0 && len(limits.MethodRates) == 0 {
+		return nil
+	}
+	return &rateLimiter{
+		client:  limits.ClientRate,
+		methods: limits.MethodRates,
+		buckets: make(map[bucketKey]*tokenBucket),
+	}
+}
+
+// allow checks whether a request from the given remote address to the given
+// method may be served, consuming tokens from the matching buckets.
+func (rl *rateLimiter) allow(remote, service, method string) Error {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	now := time.Now()
+	if rl.client.Limit > 0 && remote != "" {
+		if !rl.bucket(bucketKey{remote: remote}, rl.client, now).take(now) {
+			return &limitExceededError{"client rate limit exceeded"}
+		}
+	}
+	name := service + serviceMethodSeparator + method
+	rate, ok := rl.methods[name]
+	if !ok {
+		if rate, ok = rl.methods[service]; !ok {
+			return nil
+		}
+		name = service
+	}
+	if !rl.bucket(bucketKey{remote: remote, name: name}, rate, now).take(now) {
+		return &limitExceededError{fmt.Sprintf("rate limit exceeded for %s", name)}
+	}
+	return nil
+}
+
+// bucket retrieves the token bucket for the given key, creating a full one if
+// none exists yet.
+func (rl *rateLimiter) bucket(key bucketKey, rate Rate, now time.Time) *tokenBucket {
+	if b, ok := rl.buckets[key]; ok {
+		return b
+	}
+	if len(rl.buckets) >= maxRateBuckets {
+		rl.prune(now)
+	}
+	b := &tokenBucket{rate: rate, tokens: float64(rate.Burst), last: now}
+	rl.buckets[key] = b
+	return b
+}
+
+// prune drops the buckets that refilled completely, as they carry no state that
+// differs from a freshly created bucket.
+func (rl *rateLimiter) prune(now time.Time) {
+	for key, b := range rl.buckets {
+		if b.refill(now); b.tokens >= float64(b.rate.Burst) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// errResponseTooLarge is returned in place of responses exceeding the size limit.
+var errResponseTooLarge = &limitExceededError{"response too large"}
+
+// responseSize returns the size of the JSON encoding of a response.
+func responseSize(response interface{}) int {
+	blob, err := json.Marshal(response)
+	if err != nil {
+		return 0
+	}
+	return len(blob)
+}
+
+// remoteIP extracts the IP address of the remote peer from the request context,
+// returning an empty string for transports without one (IPC, in-process).
+func remoteIP(ctx context.Context) string {
+	remote, _ := ctx.Value("remote").(string)
+	if remote == "" {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return remote
+}
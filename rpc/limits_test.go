@@ -0,0 +1,163 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newLimitedTestServer(limits Limits) *Server {
+	server := NewServer()
+	server.SetLimits(limits)
+	if err := server.RegisterName("service", new(Service)); err != nil {
+		panic(err)
+	}
+	return server
+}
+
+func TestParseRates(t *testing.T) {
+	rates, err := ParseRates("sof_getLogs=5:10, debug=0.5,")
+	if err != nil {
+		t.Fatalf("failed to parse rates: %v", err)
+	}
+	want := map[string]Rate{
+		"sof_getLogs": {Limit: 5, Burst: 10},
+		"debug":       {Limit: 0.5, Burst: 1},
+	}
+	if !reflect.DeepEqual(rates, want) {
+		t.Fatalf("rates mismatch: have %v, want %v", rates, want)
+	}
+	for _, input := range []string{"sof_getLogs", "=5", "debug=0", "debug=1:0", "debug=x"} {
+		if _, err := ParseRates(input); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	var (
+		now    = time.Now()
+		bucket = &tokenBucket{rate: Rate{Limit: 2, Burst: 2}, tokens: 2, last: now}
+	)
+	if !bucket.take(now) || !bucket.take(now) {
+		t.Fatal("burst not allowed")
+	}
+	if bucket.take(now) {
+		t.Fatal("allowed request above burst")
+	}
+	if !bucket.take(now.Add(500 * time.Millisecond)) {
+		t.Fatal("bucket not refilled")
+	}
+	if bucket.take(now.Add(500 * time.Millisecond)) {
+		t.Fatal("bucket refilled too much")
+	}
+}
+
+func TestBatchLimit(t *testing.T) {
+	server := newLimitedTestServer(Limits{BatchItems: 2})
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	batch := make([]BatchElem, 3)
+	for i := range batch {
+		batch[i] = BatchElem{Method: "service_echo", Args: []interface{}{"hello", i, &Args{"world"}}, Result: new(Result)}
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	for i, elem := range batch {
+		if e, ok := elem.Error.(Error); !ok || e.ErrorCode() != (&limitExceededError{}).ErrorCode() {
+			t.Errorf("batch element %d: expected limit error, got %v", i, elem.Error)
+		}
+		batch[i].Error = nil
+	}
+	if err := client.BatchCall(batch[:2]); err != nil {
+		t.Fatal(err)
+	}
+	for i, elem := range batch[:2] {
+		if elem.Error != nil {
+			t.Errorf("batch element %d failed within the limit: %v", i, elem.Error)
+		}
+	}
+}
+
+func TestResponseSizeLimit(t *testing.T) {
+	server := newLimitedTestServer(Limits{ResponseSize: 128})
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var resp Result
+	if err := client.Call(&resp, "service_echo", "hello", 1, &Args{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	err := client.Call(&resp, "service_echo", strings.Repeat("x", 256), 1, &Args{"world"})
+	if e, ok := err.(Error); !ok || e.ErrorCode() != (&limitExceededError{}).ErrorCode() {
+		t.Fatalf("expected limit error, got %v", err)
+	}
+}
+
+func TestMethodRateLimit(t *testing.T) {
+	server := newLimitedTestServer(Limits{
+		MethodRates: map[string]Rate{
+			"service_echo": {Limit: 0.001, Burst: 2},
+			"service":      {Limit: 0.001, Burst: 1},
+		},
+	})
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var resp Result
+	for i := 0; i < 2; i++ {
+		if err := client.Call(&resp, "service_echo", "hello", i, &Args{"world"}); err != nil {
+			t.Fatalf("request %d failed within burst: %v", i, err)
+		}
+	}
+	err := client.Call(&resp, "service_echo", "hello", 2, &Args{"world"})
+	if e, ok := err.(Error); !ok || e.ErrorCode() != (&limitExceededError{}).ErrorCode() {
+		t.Fatalf("expected limit error, got %v", err)
+	}
+	// Methods without an explicit rate fall back to their namespace
+	if err := client.Call(nil, "service_noArgsRets"); err != nil {
+		t.Fatalf("namespace request failed within burst: %v", err)
+	}
+	if err := client.Call(nil, "service_noArgsRets"); err == nil {
+		t.Fatal("expected namespace limit error")
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	limiter := newRateLimiter(Limits{ClientRate: Rate{Limit: 0.001, Burst: 1}})
+
+	if err := limiter.allow("10.0.0.1", "service", "echo"); err != nil {
+		t.Fatalf("first request rejected: %v", err)
+	}
+	if err := limiter.allow("10.0.0.1", "service", "echo"); err == nil {
+		t.Fatal("second request allowed above the client rate")
+	}
+	if err := limiter.allow("10.0.0.2", "service", "echo"); err != nil {
+		t.Fatalf("request from other client rejected: %v", err)
+	}
+	if err := limiter.allow("", "service", "echo"); err != nil {
+		t.Fatalf("local request rejected: %v", err)
+	}
+}
@@ -58,6 +58,13 @@ func NewServer() *Server {
 	return server
 }
 
+// SetLimits configures the resource limits enforced on the clients of the server.
+// It must be called before the server starts serving requests.
+func (s *Server) SetLimits(limits Limits) {
+	s.limits = limits
+	s.limiter = newRateLimiter(limits)
+}
+
 // RPCService gives meta information about the server.
 // e.g. gives information about the loaded modules.
 type RPCService struct {
@@ -155,9 +162,14 @@ func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, singleShot
 	s.codecs.Add(codec)
 	s.codecsMu.Unlock()
 
+	// limit the number of requests served in parallel on this connection
+	var slots chan struct{}
+	if s.limits.ConcurrentRequests > 0 {
+		slots = make(chan struct{}, s.limits.ConcurrentRequests)
+	}
 	// test if the server is ordered to stop
 	for atomic.LoadInt32(&s.run) == 1 {
-		reqs, batch, err := s.readRequest(codec)
+		reqs, batch, err := s.readRequest(ctx, codec)
 		if err != nil {
 			// If a parsing error occurred, send an error
 			if err.Error() != "EOF" {
@@ -172,16 +184,7 @@ func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, singleShot
 		// check if server is ordered to shutdown and return an error
 		// telling the client that his request failed.
 		if atomic.LoadInt32(&s.run) != 1 {
-			err = &shutdownError{}
-			if batch {
-				resps := make([]interface{}, len(reqs))
-				for i, r := range reqs {
-					resps[i] = codec.CreateErrorResponse(&r.id, err)
-				}
-				codec.Write(resps)
-			} else {
-				codec.Write(codec.CreateErrorResponse(&reqs[0].id, err))
-			}
+			s.reject(codec, reqs, batch, &shutdownError{})
 			return nil
 		}
 		// If a single shot request is executing, run and return immediately
@@ -193,11 +196,23 @@ func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, singleShot
 			}
 			return nil
 		}
-		// For multi-shot connections, start a goroutine to serve and loop back
+		// For multi-shot connections, reject the requests if too many are in flight
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			default:
+				s.reject(codec, reqs, batch, &limitExceededError{"too many concurrent requests"})
+				continue
+			}
+		}
+		// Start a goroutine to serve and loop back
 		pend.Add(1)
 
 		go func(reqs []*serverRequest, batch bool) {
 			defer pend.Done()
+			if slots != nil {
+				defer func() { <-slots }()
+			}
 			if batch {
 				s.execBatch(ctx, codec, reqs)
 			} else {
@@ -237,6 +252,19 @@ func (s *Server) Stop() {
 	}
 }
 
+// reject responds to all the given requests with the same error.
+func (s *Server) reject(codec ServerCodec, reqs []*serverRequest, batch bool, err Error) {
+	if batch {
+		resps := make([]interface{}, len(reqs))
+		for i, r := range reqs {
+			resps[i] = codec.CreateErrorResponse(&r.id, err)
+		}
+		codec.Write(resps)
+	} else {
+		codec.Write(codec.CreateErrorResponse(&reqs[0].id, err))
+	}
+}
+
 // createSubscription will call the subscription callback and returns the subscription id or error.
 func (s *Server) createSubscription(ctx context.Context, c ServerCodec, req *serverRequest) (ID, error) {
 	// subscription have as first argument the context following optional arguments
@@ -313,8 +341,16 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 	if req.callb.errPos >= 0 { // test if method returned an error
 		if !reply[req.callb.errPos].IsNil() {
 			e := reply[req.callb.errPos].Interface().(error)
-			res := codec.CreateErrorResponse(&req.id, &callbackError{e.Error()})
-			return res, nil
+
+			// Preserve the error code and data of errors that carry them
+			var rpcErr Error = &callbackError{e.Error()}
+			if ec, ok := e.(Error); ok {
+				rpcErr = ec
+			}
+			if de, ok := e.(DataError); ok {
+				return codec.CreateErrorResponseWithInfo(&req.id, rpcErr, de.ErrorData()), nil
+			}
+			return codec.CreateErrorResponse(&req.id, rpcErr), nil
 		}
 	}
 	return codec.CreateResponse(req.id, reply[0].Interface()), nil
@@ -329,6 +365,9 @@ func (s *Server) exec(ctx context.Context, codec ServerCodec, req *serverRequest
 	} else {
 		response, callback = s.handle(ctx, codec, req)
 	}
+	if s.limits.ResponseSize > 0 && responseSize(response) > s.limits.ResponseSize {
+		response, callback = codec.CreateErrorResponse(&req.id, errResponseTooLarge), nil
+	}
 
 	if err := codec.Write(response); err != nil {
 		log.Error(fmt.Sprintf("%v\n", err))
@@ -346,15 +385,27 @@ func (s *Server) exec(ctx context.Context, codec ServerCodec, req *serverRequest
 func (s *Server) execBatch(ctx context.Context, codec ServerCodec, requests []*serverRequest) {
 	responses := make([]interface{}, len(requests))
 	var callbacks []func()
+	var size int
 	for i, req := range requests {
+		// Once the size limit is hit, stop executing the rest of the batch
+		if s.limits.ResponseSize > 0 && size > s.limits.ResponseSize {
+			responses[i] = codec.CreateErrorResponse(&req.id, errResponseTooLarge)
+			continue
+		}
+		var callback func()
 		if req.err != nil {
 			responses[i] = codec.CreateErrorResponse(&req.id, req.err)
 		} else {
-			var callback func()
-			if responses[i], callback = s.handle(ctx, codec, req); callback != nil {
-				callbacks = append(callbacks, callback)
+			responses[i], callback = s.handle(ctx, codec, req)
+		}
+		if s.limits.ResponseSize > 0 {
+			if size += responseSize(responses[i]); size > s.limits.ResponseSize {
+				responses[i], callback = codec.CreateErrorResponse(&req.id, errResponseTooLarge), nil
 			}
 		}
+		if callback != nil {
+			callbacks = append(callbacks, callback)
+		}
 	}
 
 	if err := codec.Write(responses); err != nil {
@@ -371,11 +422,22 @@ func (s *Server) execBatch(ctx context.Context, codec ServerCodec, requests []*s
 // readRequest requests the next (batch) request from the codec. It will return the collection
 // of requests, an indication if the request was a batch, the invalid request identifier and an
 // error when the request could not be read/parsed.
-func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error) {
+func (s *Server) readRequest(ctx context.Context, codec ServerCodec) ([]*serverRequest, bool, Error) {
 	reqs, batch, err := codec.ReadRequestHeaders()
 	if err != nil {
 		return nil, batch, err
 	}
+	// Reject all requests of an oversized batch without looking at their content
+	if batch && s.limits.BatchItems > 0 && len(reqs) > s.limits.BatchItems {
+		err := &limitExceededError{fmt.Sprintf("batch too large (%d>%d)", len(reqs), s.limits.BatchItems)}
+
+		requests := make([]*serverRequest, len(reqs))
+		for i, r := range reqs {
+			requests[i] = &serverRequest{id: r.id, err: err}
+		}
+		return requests, batch, nil
+	}
+	remote := remoteIP(ctx)
 
 	requests := make([]*serverRequest, len(reqs))
 
@@ -405,8 +467,19 @@ func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error)
 			continue
 		}
 
+		if !moduleAllowed(ctx, r.service) { // authenticated client may not access the module
+			requests[i] = &serverRequest{id: r.id, err: &moduleNotAllowedError{r.service}}
+			continue
+		}
+
 		if r.isPubSub { // sof_subscribe, r.method contains the subscription method name
 			if callb, ok := svc.subscriptions[r.method]; ok {
+				if s.limiter != nil {
+					if err := s.limiter.allow(remote, r.service, r.method); err != nil {
+						requests[i] = &serverRequest{id: r.id, err: err}
+						continue
+					}
+				}
 				requests[i] = &serverRequest{id: r.id, svcname: svc.name, callb: callb}
 				if r.params != nil && len(callb.argTypes) > 0 {
 					argTypes := []reflect.Type{reflect.TypeOf("")}
@@ -424,6 +497,12 @@ func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error)
 		}
 
 		if callb, ok := svc.callbacks[r.method]; ok { // lookup RPC method
+			if s.limiter != nil {
+				if err := s.limiter.allow(remote, r.service, r.method); err != nil {
+					requests[i] = &serverRequest{id: r.id, err: err}
+					continue
+				}
+			}
 			requests[i] = &serverRequest{id: r.id, svcname: svc.name, callb: callb}
 			if r.params != nil && len(callb.argTypes) > 0 {
 				if args, err := codec.ParseRequestArguments(callb.argTypes, r.params); err == nil {
@@ -71,6 +71,19 @@ func (s *Service) InvalidRets3() (string, string, error) {
 	return "", "", nil
 }
 
+type dataError struct {
+	message string
+	data    interface{}
+}
+
+func (e *dataError) Error() string          { return e.message }
+func (e *dataError) ErrorCode() int         { return 444 }
+func (e *dataError) ErrorData() interface{} { return e.data }
+
+func (s *Service) ReturnError() (string, error) {
+	return "", &dataError{"testError", "testError data"}
+}
+
 func (s *Service) Subscription(ctx context.Context) (*Subscription, error) {
 	return nil, nil
 }
@@ -92,8 +105,8 @@ func TestServerRegisterName(t *testing.T) {
 		t.Fatalf("Expected service calc to be registered")
 	}
 
-	if len(svc.callbacks) != 5 {
-		t.Errorf("Expected 5 callbacks for service 'calc', got %d", len(svc.callbacks))
+	if len(svc.callbacks) != 6 {
+		t.Errorf("Expected 6 callbacks for service 'calc', got %d", len(svc.callbacks))
 	}
 
 	if len(svc.subscriptions) != 1 {
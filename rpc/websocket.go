@@ -63,13 +63,26 @@ func (srv *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
 			// Create a custom encode/decode pair to enforce payload size and number encoding
 			conn.MaxPayloadBytes = maxRequestContentLength
 
+			// Drop the request timeouts inherited from HTTP servers shared with
+			// plain requests, the connection is long lived
+			conn.SetDeadline(time.Time{})
+
 			encoder := func(v interface{}) error {
 				return websocketJSONCodec.Send(conn, v)
 			}
 			decoder := func(v interface{}) error {
 				return websocketJSONCodec.Receive(conn, v)
 			}
-			srv.ServeCodec(NewCodec(conn, encoder, decoder), OptionMethodInvocation|OptionSubscriptions)
+			// Remember the remote address for the per-client rate limits and
+			// the modules the client was authenticated for
+			ctx := context.WithValue(context.Background(), "remote", conn.Request().RemoteAddr)
+			if modules := conn.Request().Context().Value(jwtModulesKey{}); modules != nil {
+				ctx = context.WithValue(ctx, jwtModulesKey{}, modules)
+			}
+
+			codec := NewCodec(conn, encoder, decoder)
+			defer codec.Close()
+			srv.serveRequest(ctx, codec, false, OptionMethodInvocation|OptionSubscriptions)
 		},
 	}
 }
@@ -150,13 +163,27 @@ func wsGetConfig(endpoint, origin string) (*websocket.Config, error) {
 // The context is used for the initial connection establishment. It does not
 // affect subsequent interactions with the client.
 func DialWebsocket(ctx context.Context, endpoint, origin string) (*Client, error) {
+	return dialWebsocket(ctx, endpoint, origin, nil)
+}
+
+// dialWebsocket creates a new WebSocket RPC client, optionally authenticating
+// the handshake of every (re)connection.
+func dialWebsocket(ctx context.Context, endpoint, origin string, auth HTTPAuth) (*Client, error) {
 	config, err := wsGetConfig(endpoint, origin)
 	if err != nil {
 		return nil, err
 	}
 
 	return newClient(ctx, func(ctx context.Context) (net.Conn, error) {
-		return wsDialContext(ctx, config)
+		if auth == nil {
+			return wsDialContext(ctx, config)
+		}
+		authed := *config
+		authed.Header = copyHeader(config.Header)
+		if err := auth(authed.Header); err != nil {
+			return nil, err
+		}
+		return wsDialContext(ctx, &authed)
 	})
 }
 
@@ -35,6 +35,8 @@ import (
 	"github.com/susy-go/susy-graviton/core/state"
 	"github.com/susy-go/susy-graviton/core/types"
 	"github.com/susy-go/susy-graviton/internal/sofapi"
+	"github.com/susy-go/susy-graviton/log"
+	"github.com/susy-go/susy-graviton/miner"
 	"github.com/susy-go/susy-graviton/params"
 	"github.com/susy-go/susy-graviton/srlp"
 	"github.com/susy-go/susy-graviton/rpc"
@@ -76,6 +78,124 @@ func (api *PublicSophonAPI) ChainId() hexutil.Uint64 {
 	return (hexutil.Uint64)(chainID.Uint64())
 }
 
+// SendPrivateTransaction adds the signed transaction to the transaction pool as
+// a private one, to be included only by the local miner. It is never broadcast to
+// the network nor exposed by the public pool queries, and is dropped unless it is
+// included within the configured number of blocks.
+func (api *PublicSophonAPI) SendPrivateTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := srlp.DecodeBytes(encodedTx, tx); err != nil {
+		return common.Hash{}, err
+	}
+	if err := api.e.txPool.AddPrivate(tx); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Submitted private transaction", "fullhash", tx.Hash().Hex(), "recipient", tx.To())
+	return tx.Hash(), nil
+}
+
+// SendBundle submits an ordered set of signed transactions to the local block
+// builder, to be included at the top of the given block atomically, or not at
+// all. Only the next few blocks may be targeted. The transactions are neither
+// added to the pool nor broadcast to the network. It returns the hash identifying
+// the bundle.
+func (api *PublicSophonAPI) SendBundle(ctx context.Context, encodedTxs []hexutil.Bytes, blockNumber hexutil.Uint64) (common.Hash, error) {
+	bundle := &miner.Bundle{
+		Txs:    make(types.Transactions, len(encodedTxs)),
+		Number: uint64(blockNumber),
+	}
+	for i, encodedTx := range encodedTxs {
+		tx := new(types.Transaction)
+		if err := srlp.DecodeBytes(encodedTx, tx); err != nil {
+			return common.Hash{}, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		bundle.Txs[i] = tx
+	}
+	if err := api.e.Miner().Bundles().Add(bundle, api.e.blockchain.CurrentBlock().NumberU64()); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Submitted transaction bundle", "hash", bundle.Hash(), "txs", len(bundle.Txs), "number", bundle.Number)
+	return bundle.Hash(), nil
+}
+
+// PublicTxPoolEventAPI provides an API to follow the lifecycle of the
+// transactions in the transaction pool.
+type PublicTxPoolEventAPI struct {
+	e *Sophon
+}
+
+// NewPublicTxPoolEventAPI creates a new transaction pool event API.
+func NewPublicTxPoolEventAPI(e *Sophon) *PublicTxPoolEventAPI {
+	return &PublicTxPoolEventAPI{e}
+}
+
+// TxPoolEventResult is a transaction lifecycle change in the pool as reported
+// over the RPC subscription.
+type TxPoolEventResult struct {
+	Kind        string         `json:"kind"`
+	Hash        common.Hash    `json:"hash"`
+	From        common.Address `json:"from"`
+	Nonce       hexutil.Uint64 `json:"nonce"`
+	GasPrice    *hexutil.Big   `json:"gasPrice"`
+	Reason      string         `json:"reason,omitempty"`
+	Replacement *common.Hash   `json:"replacement,omitempty"`
+}
+
+// newTxPoolEventResult converts a transaction pool event into its RPC form.
+func newTxPoolEventResult(signer types.Signer, ev core.TxPoolEvent) *TxPoolEventResult {
+	from, _ := types.Sender(signer, ev.Tx)
+
+	result := &TxPoolEventResult{
+		Kind:     ev.Kind.String(),
+		Hash:     ev.Tx.Hash(),
+		From:     from,
+		Nonce:    hexutil.Uint64(ev.Tx.Nonce()),
+		GasPrice: (*hexutil.Big)(ev.Tx.GasPrice()),
+	}
+	if ev.Reason != nil {
+		result.Reason = ev.Reason.Error()
+	}
+	if ev.Replacement != (common.Hash{}) {
+		result.Replacement = &ev.Replacement
+	}
+	return result
+}
+
+// Events sends a notification each time a transaction is queued, promoted,
+// replaced, demoted, dropped, rejected or mined by the transaction pool, along
+// with the reason of the change. Notifications are dropped if the subscriber
+// falls too far behind.
+func (api *PublicTxPoolEventAPI) Events(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		events := make(chan core.TxPoolEvent, 128)
+		sub := api.e.txPool.SubscribeTxPoolEvent(events)
+		defer sub.Unsubscribe()
+
+		signer := types.NewSIP155Signer(api.e.chainConfig.ChainID)
+		for {
+			select {
+			case ev := <-events:
+				notifier.Notify(rpcSub.ID, newTxPoolEventResult(signer, ev))
+			case <-sub.Err():
+				return
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // PublicMinerAPI provides an API to control the miner.
 // It offers only methods that operate on data that pose no security risk when it is publicly accessible.
 type PublicMinerAPI struct {
@@ -270,9 +390,15 @@ func (api *PublicDebugAPI) DumpBlock(blockNr rpc.BlockNumber) (state.Dump, error
 		return stateDb.RawDump(), nil
 	}
 	var block *types.Block
-	if blockNr == rpc.LatestBlockNumber {
+	switch blockNr {
+	case rpc.LatestBlockNumber:
 		block = api.sof.blockchain.CurrentBlock()
-	} else {
+	case rpc.FinalizedBlockNumber, rpc.SafeBlockNumber:
+		var err error
+		if block, err = api.sof.APIBackend.BlockByNumber(context.Background(), blockNr); err != nil {
+			return state.Dump{}, err
+		}
+	default:
 		block = api.sof.blockchain.GetBlockByNumber(uint64(blockNr))
 	}
 	if block == nil {
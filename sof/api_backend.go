@@ -18,6 +18,7 @@ package sof
 
 import (
 	"context"
+	"errors"
 	"math/big"
 
 	"github.com/susy-go/susy-graviton/accounts"
@@ -36,6 +37,16 @@ import (
 	"github.com/susy-go/susy-graviton/rpc"
 )
 
+var (
+	// errFinalizedNotAvailable is returned for the finalized block if the chain
+	// has none yet or the consensus engine has no notion of finality.
+	errFinalizedNotAvailable = errors.New("finalized block not available")
+
+	// errSafeNotAvailable is returned for the safe block if the chain has none
+	// yet or the consensus engine has no notion of finality.
+	errSafeNotAvailable = errors.New("safe block not available")
+)
+
 // SofAPIBackend implements sofapi.Backend for full nodes
 type SofAPIBackend struct {
 	sof *Sophon
@@ -63,8 +74,19 @@ func (b *SofAPIBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNum
 		return block.Header(), nil
 	}
 	// Otherwise resolve and return the block
-	if blockNr == rpc.LatestBlockNumber {
+	switch blockNr {
+	case rpc.LatestBlockNumber:
 		return b.sof.blockchain.CurrentBlock().Header(), nil
+	case rpc.FinalizedBlockNumber:
+		if header := b.sof.blockchain.CurrentFinalizedHeader(); header != nil {
+			return header, nil
+		}
+		return nil, errFinalizedNotAvailable
+	case rpc.SafeBlockNumber:
+		if header := b.sof.blockchain.CurrentSafeHeader(); header != nil {
+			return header, nil
+		}
+		return nil, errSafeNotAvailable
 	}
 	return b.sof.blockchain.GetHeaderByNumber(uint64(blockNr)), nil
 }
@@ -80,8 +102,15 @@ func (b *SofAPIBackend) BlockByNumber(ctx context.Context, blockNr rpc.BlockNumb
 		return block, nil
 	}
 	// Otherwise resolve and return the block
-	if blockNr == rpc.LatestBlockNumber {
+	switch blockNr {
+	case rpc.LatestBlockNumber:
 		return b.sof.blockchain.CurrentBlock(), nil
+	case rpc.FinalizedBlockNumber, rpc.SafeBlockNumber:
+		header, err := b.HeaderByNumber(ctx, blockNr)
+		if header == nil || err != nil {
+			return nil, err
+		}
+		return b.sof.blockchain.GetBlock(header.Hash(), header.Number.Uint64()), nil
 	}
 	return b.sof.blockchain.GetBlockByNumber(uint64(blockNr)), nil
 }
@@ -137,6 +166,10 @@ func (b *SofAPIBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEven
 	return b.sof.BlockChain().SubscribeRemovedLogsEvent(ch)
 }
 
+func (b *SofAPIBackend) SubscribeChainFinalizedEvent(ch chan<- core.ChainFinalizedEvent) event.Subscription {
+	return b.sof.BlockChain().SubscribeChainFinalizedEvent(ch)
+}
+
 func (b *SofAPIBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
 	return b.sof.BlockChain().SubscribeChainEvent(ch)
 }
@@ -28,6 +28,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/susy-go/susy-graviton/accounts/abi"
 	"github.com/susy-go/susy-graviton/common"
 	"github.com/susy-go/susy-graviton/common/hexutil"
 	"github.com/susy-go/susy-graviton/core"
@@ -110,6 +111,11 @@ func (api *PrivateDebugAPI) TraceChain(ctx context.Context, start, end rpc.Block
 		from = api.sof.miner.PendingBlock()
 	case rpc.LatestBlockNumber:
 		from = api.sof.blockchain.CurrentBlock()
+	case rpc.FinalizedBlockNumber, rpc.SafeBlockNumber:
+		var err error
+		if from, err = api.sof.APIBackend.BlockByNumber(ctx, start); err != nil {
+			return nil, err
+		}
 	default:
 		from = api.sof.blockchain.GetBlockByNumber(uint64(start))
 	}
@@ -118,6 +124,11 @@ func (api *PrivateDebugAPI) TraceChain(ctx context.Context, start, end rpc.Block
 		to = api.sof.miner.PendingBlock()
 	case rpc.LatestBlockNumber:
 		to = api.sof.blockchain.CurrentBlock()
+	case rpc.FinalizedBlockNumber, rpc.SafeBlockNumber:
+		var err error
+		if to, err = api.sof.APIBackend.BlockByNumber(ctx, end); err != nil {
+			return nil, err
+		}
 	default:
 		to = api.sof.blockchain.GetBlockByNumber(uint64(end))
 	}
@@ -361,6 +372,11 @@ func (api *PrivateDebugAPI) TraceBlockByNumber(ctx context.Context, number rpc.B
 		block = api.sof.miner.PendingBlock()
 	case rpc.LatestBlockNumber:
 		block = api.sof.blockchain.CurrentBlock()
+	case rpc.FinalizedBlockNumber, rpc.SafeBlockNumber:
+		var err error
+		if block, err = api.sof.APIBackend.BlockByNumber(ctx, number); err != nil {
+			return nil, err
+		}
 	default:
 		block = api.sof.blockchain.GetBlockByNumber(uint64(number))
 	}
@@ -710,6 +726,46 @@ func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, hash common.Ha
 	return api.traceTx(ctx, msg, vmctx, statedb, config)
 }
 
+// RevertResult is the outcome of replaying a mined transaction to recover why
+// its execution failed.
+type RevertResult struct {
+	Failed     bool          `json:"failed"`
+	ReturnData hexutil.Bytes `json:"returnData"`
+	Reason     string        `json:"reason,omitempty"`
+}
+
+// RevertReason replays a mined transaction on top of its parent state and
+// returns whether it failed, along with the revert data and the decoded revert
+// reason if the contract provided one.
+func (api *PrivateDebugAPI) RevertReason(ctx context.Context, hash common.Hash, reexec *uint64) (*RevertResult, error) {
+	// Retrieve the transaction and assemble its SVM context
+	tx, blockHash, _, index := rawdb.ReadTransaction(api.sof.ChainDb(), hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	if reexec == nil {
+		reexec = new(uint64)
+		*reexec = defaultTraceReexec
+	}
+	msg, vmctx, statedb, err := api.computeTxEnv(blockHash, int(index), *reexec)
+	if err != nil {
+		return nil, err
+	}
+	// Replay the transaction and decode the revert reason if it failed
+	vmenv := vm.NewSVM(vmctx, statedb, api.config, vm.Config{})
+
+	ret, _, failed, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas()))
+	if err != nil {
+		return nil, fmt.Errorf("replay failed: %v", err)
+	}
+	result := &RevertResult{Failed: failed}
+	if failed {
+		result.ReturnData = ret
+		result.Reason, _ = abi.UnpackRevert(ret)
+	}
+	return result, nil
+}
+
 // traceTx configures a new tracer according to the provided configuration, and
 // executes the given message in the provided environment. The return value will
 // be tracer dependent.
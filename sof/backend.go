@@ -29,11 +29,13 @@ import (
 	"github.com/susy-go/susy-graviton/common"
 	"github.com/susy-go/susy-graviton/common/hexutil"
 	"github.com/susy-go/susy-graviton/consensus"
+	"github.com/susy-go/susy-graviton/consensus/bft"
 	"github.com/susy-go/susy-graviton/consensus/clique"
 	"github.com/susy-go/susy-graviton/consensus/sofash"
 	"github.com/susy-go/susy-graviton/core"
 	"github.com/susy-go/susy-graviton/core/bloombits"
 	"github.com/susy-go/susy-graviton/core/rawdb"
+	"github.com/susy-go/susy-graviton/core/state/pruner"
 	"github.com/susy-go/susy-graviton/core/types"
 	"github.com/susy-go/susy-graviton/core/vm"
 	"github.com/susy-go/susy-graviton/sof/downloader"
@@ -118,6 +120,12 @@ func New(ctx *node.ServiceContext, config *Config) (*Sophon, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Finish any interrupted offline state pruning before touching the database
+	if db, ok := chainDb.(*sofdb.LDBDatabase); ok {
+		if err := pruner.RecoverPruning(db, ctx.ResolvePath(pruner.BloomFileName)); err != nil {
+			return nil, err
+		}
+	}
 	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlockWithOverride(chainDb, config.Genesis, config.ConstantinopleOverride)
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
@@ -156,12 +164,16 @@ func New(ctx *node.ServiceContext, config *Config) (*Sophon, error) {
 			EWASMInterpreter:        config.EWASMInterpreter,
 			SVMInterpreter:          config.SVMInterpreter,
 		}
-		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieCleanLimit: config.TrieCleanCache, TrieDirtyLimit: config.TrieDirtyCache, TrieTimeLimit: config.TrieTimeout}
+		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieCleanLimit: config.TrieCleanCache, TrieDirtyLimit: config.TrieDirtyCache, TrieTimeLimit: config.TrieTimeout, TrieRefcount: config.TrieRefcount, TrieRetention: config.TrieRetention}
 	)
 	sof.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, sof.chainConfig, sof.engine, vmConfig, sof.shouldPreserve)
 	if err != nil {
 		return nil, err
 	}
+	// Let clique read the signers from the governance contract, if configured
+	if clique, ok := sof.engine.(*clique.Clique); ok {
+		clique.SetStateFn(sof.blockchain.StateAt)
+	}
 	// Rewind the chain in case of an incompatible config upgrade.
 	if compat, ok := genesisErr.(*params.ConfigCompatError); ok {
 		log.Warn("Rewinding chain to upgrade configuration", "err", compat)
@@ -173,6 +185,9 @@ func New(ctx *node.ServiceContext, config *Config) (*Sophon, error) {
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = ctx.ResolvePath(config.TxPool.Journal)
 	}
+	if config.TxPool.Snapshot != "" {
+		config.TxPool.Snapshot = ctx.ResolvePath(config.TxPool.Snapshot)
+	}
 	sof.txPool = core.NewTxPool(config.TxPool, sof.chainConfig, sof.blockchain)
 
 	if sof.protocolManager, err = NewProtocolManager(sof.chainConfig, config.SyncMode, config.NetworkId, sof.eventMux, sof.txPool, sof.engine, sof.blockchain, chainDb, config.Whitelist); err != nil {
@@ -227,6 +242,10 @@ func CreateConsensusEngine(ctx *node.ServiceContext, chainConfig *params.ChainCo
 	if chainConfig.Clique != nil {
 		return clique.New(chainConfig.Clique, db)
 	}
+	// If byzantine fault tolerance is requested, set it up
+	if chainConfig.BFT != nil {
+		return bft.New(chainConfig.BFT, db)
+	}
 	// Otherwise assume proof-of-work
 	switch config.PowMode {
 	case sofash.ModeFake:
@@ -277,6 +296,11 @@ func (s *Sophon) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   downloader.NewPublicDownloaderAPI(s.protocolManager.downloader, s.eventMux),
 			Public:    true,
+		}, {
+			Namespace: "txpool",
+			Version:   "1.0",
+			Service:   NewPublicTxPoolEventAPI(s),
+			Public:    true,
 		}, {
 			Namespace: "miner",
 			Version:   "1.0",
@@ -436,6 +460,14 @@ func (s *Sophon) StartMining(threads int) error {
 			}
 			clique.Authorize(eb, wallet.SignHash)
 		}
+		if bft, ok := s.engine.(*bft.BFT); ok {
+			wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
+			if wallet == nil || err != nil {
+				log.Error("Sophybase account unavailable locally", "err", err)
+				return fmt.Errorf("validator missing: %v", err)
+			}
+			bft.Authorize(eb, wallet.SignHash)
+		}
 		// If mining is started, we can disable the transaction rejection mechanism
 		// introduced to speed sync times.
 		atomic.StoreUint32(&s.protocolManager.acceptTxs, 1)
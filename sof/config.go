@@ -101,6 +101,8 @@ type Config struct {
 	TrieCleanCache     int
 	TrieDirtyCache     int
 	TrieTimeout        time.Duration
+	TrieRefcount       bool
+	TrieRetention      uint64
 
 	// Mining-related options
 	Sophybase      common.Address `toml:",omitempty"`
@@ -233,6 +233,37 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 	return rpcSub, nil
 }
 
+// FinalizedHeads send a notification each time the consensus engine deems a newer
+// block of the chain irreversible.
+func (api *PublicFilterAPI) FinalizedHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		headers := make(chan *types.Header)
+		headersSub := api.events.SubscribeFinalizedHeads(headers)
+
+		for {
+			select {
+			case h := <-headers:
+				notifier.Notify(rpcSub.ID, h)
+			case <-rpcSub.Err():
+				headersSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				headersSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
 func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
@@ -282,6 +313,8 @@ type FilterCriteria sophon.FilterQuery
 // Default criteria for the from and to block are "latest".
 // Using "latest" as block number will return logs for mined blocks.
 // Using "pending" as block number returns logs for not yet mined (pending) blocks.
+// Using "finalized" or "safe" as block number fixes the number of the block they
+// stand for when the filter is created.
 // In case logs are removed (chain reorg) previously returned logs are returned
 // again but with the removed property set to true.
 //
@@ -289,6 +322,12 @@ type FilterCriteria sophon.FilterQuery
 //
 // https://github.com/susy-go/wiki/wiki/JSON-RPC#sof_newfilter
 func (api *PublicFilterAPI) NewFilter(crit FilterCriteria) (rpc.ID, error) {
+	resolved, err := resolveCriteria(api.backend, sophon.FilterQuery(crit))
+	if err != nil {
+		return rpc.ID(""), err
+	}
+	crit = FilterCriteria(resolved)
+
 	logs := make(chan []*types.Log)
 	logsSub, err := api.events.SubscribeLogs(sophon.FilterQuery(crit), logs)
 	if err != nil {
@@ -19,6 +19,7 @@ package filters
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math/big"
 
 	"github.com/susy-go/susy-graviton/common"
@@ -40,6 +41,7 @@ type Backend interface {
 
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
+	SubscribeChainFinalizedEvent(ch chan<- core.ChainFinalizedEvent) event.Subscription
 	SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription
 	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
 
@@ -128,6 +130,14 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 		}
 		return f.blockLogs(ctx, header)
 	}
+	// Resolve the finalized and safe tags before figuring out the range
+	var err error
+	if f.begin, err = resolveBlockNumber(ctx, f.backend, f.begin); err != nil {
+		return nil, err
+	}
+	if f.end, err = resolveBlockNumber(ctx, f.backend, f.end); err != nil {
+		return nil, err
+	}
 	// Figure out the limits of the filter range
 	header, _ := f.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
 	if header == nil {
@@ -143,10 +153,7 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 		end = head
 	}
 	// Gather all indexed logs, and finish with non indexed ones
-	var (
-		logs []*types.Log
-		err  error
-	)
+	var logs []*types.Log
 	size, sections := f.backend.BloomStatus()
 	if indexed := sections * size; indexed > uint64(f.begin) {
 		if indexed > end {
@@ -163,6 +170,28 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 	return logs, err
 }
 
+// resolveBlockNumber resolves the finalized and safe block tags into the numbers
+// of the blocks they currently stand for, leaving any other number untouched.
+func resolveBlockNumber(ctx context.Context, backend Backend, number int64) (int64, error) {
+	var name string
+	switch rpc.BlockNumber(number) {
+	case rpc.FinalizedBlockNumber:
+		name = "finalized"
+	case rpc.SafeBlockNumber:
+		name = "safe"
+	default:
+		return number, nil
+	}
+	header, err := backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+	if err != nil {
+		return 0, err
+	}
+	if header == nil {
+		return 0, fmt.Errorf("%s block not available", name)
+	}
+	return header.Number.Int64(), nil
+}
+
 // indexedLogs returns the logs matching the filter criteria based on the bloom
 // bits indexed available locally or via the network.
 func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
@@ -22,6 +22,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/big"
 	"sync"
 	"time"
 
@@ -53,6 +54,8 @@ const (
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// FinalizedBlocksSubscription queries headers for blocks that become final
+	FinalizedBlocksSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -68,6 +71,8 @@ const (
 	logsChanSize = 10
 	// chainEvChanSize is the size of channel listening to ChainEvent.
 	chainEvChanSize = 10
+	// finalizedEvChanSize is the size of channel listening to ChainFinalizedEvent.
+	finalizedEvChanSize = 10
 )
 
 var (
@@ -99,15 +104,17 @@ type EventSystem struct {
 	logsSub       event.Subscription         // Subscription for new log event
 	rmLogsSub     event.Subscription         // Subscription for removed log event
 	chainSub      event.Subscription         // Subscription for new chain event
+	finalizedSub  event.Subscription         // Subscription for chain finality event
 	pendingLogSub *event.TypeMuxSubscription // Subscription for pending log event
 
 	// Channels
-	install   chan *subscription         // install filter for event notification
-	uninstall chan *subscription         // remove filter for event notification
-	txsCh     chan core.NewTxsEvent      // Channel to receive new transactions event
-	logsCh    chan []*types.Log          // Channel to receive new log event
-	rmLogsCh  chan core.RemovedLogsEvent // Channel to receive removed log event
-	chainCh   chan core.ChainEvent       // Channel to receive new chain event
+	install     chan *subscription            // install filter for event notification
+	uninstall   chan *subscription            // remove filter for event notification
+	txsCh       chan core.NewTxsEvent         // Channel to receive new transactions event
+	logsCh      chan []*types.Log             // Channel to receive new log event
+	rmLogsCh    chan core.RemovedLogsEvent    // Channel to receive removed log event
+	chainCh     chan core.ChainEvent          // Channel to receive new chain event
+	finalizedCh chan core.ChainFinalizedEvent // Channel to receive chain finality event
 }
 
 // NewEventSystem creates a new manager that listens for event on the given mux,
@@ -118,15 +125,16 @@ type EventSystem struct {
 // or by stopping the given mux.
 func NewEventSystem(mux *event.TypeMux, backend Backend, lightMode bool) *EventSystem {
 	m := &EventSystem{
-		mux:       mux,
-		backend:   backend,
-		lightMode: lightMode,
-		install:   make(chan *subscription),
-		uninstall: make(chan *subscription),
-		txsCh:     make(chan core.NewTxsEvent, txChanSize),
-		logsCh:    make(chan []*types.Log, logsChanSize),
-		rmLogsCh:  make(chan core.RemovedLogsEvent, rmLogsChanSize),
-		chainCh:   make(chan core.ChainEvent, chainEvChanSize),
+		mux:         mux,
+		backend:     backend,
+		lightMode:   lightMode,
+		install:     make(chan *subscription),
+		uninstall:   make(chan *subscription),
+		txsCh:       make(chan core.NewTxsEvent, txChanSize),
+		logsCh:      make(chan []*types.Log, logsChanSize),
+		rmLogsCh:    make(chan core.RemovedLogsEvent, rmLogsChanSize),
+		chainCh:     make(chan core.ChainEvent, chainEvChanSize),
+		finalizedCh: make(chan core.ChainFinalizedEvent, finalizedEvChanSize),
 	}
 
 	// Subscribe events
@@ -134,12 +142,13 @@ func NewEventSystem(mux *event.TypeMux, backend Backend, lightMode bool) *EventS
 	m.logsSub = m.backend.SubscribeLogsEvent(m.logsCh)
 	m.rmLogsSub = m.backend.SubscribeRemovedLogsEvent(m.rmLogsCh)
 	m.chainSub = m.backend.SubscribeChainEvent(m.chainCh)
+	m.finalizedSub = m.backend.SubscribeChainFinalizedEvent(m.finalizedCh)
 	// TODO(rjl493456442): use feed to subscribe pending log event
 	m.pendingLogSub = m.mux.Subscribe(core.PendingLogsEvent{})
 
 	// Make sure none of the subscriptions are empty
 	if m.txsSub == nil || m.logsSub == nil || m.rmLogsSub == nil || m.chainSub == nil ||
-		m.pendingLogSub.Closed() {
+		m.finalizedSub == nil || m.pendingLogSub.Closed() {
 		log.Crit("Subscribe for event system failed")
 	}
 
@@ -194,8 +203,14 @@ func (es *EventSystem) subscribe(sub *subscription) *Subscription {
 
 // SubscribeLogs creates a subscription that will write all logs matching the
 // given criteria to the given logs channel. Default value for the from and to
-// block is "latest". If the fromBlock > toBlock an error is returned.
+// block is "latest". The "finalized" and "safe" blocks are resolved to the
+// numbers they stand for at the time of subscribing. If the fromBlock > toBlock
+// an error is returned.
 func (es *EventSystem) SubscribeLogs(crit sophon.FilterQuery, logs chan []*types.Log) (*Subscription, error) {
+	crit, err := resolveCriteria(es.backend, crit)
+	if err != nil {
+		return nil, err
+	}
 	var from, to rpc.BlockNumber
 	if crit.FromBlock == nil {
 		from = rpc.LatestBlockNumber
@@ -231,6 +246,26 @@ func (es *EventSystem) SubscribeLogs(crit sophon.FilterQuery, logs chan []*types
 	return nil, fmt.Errorf("invalid from and to block combination: from > to")
 }
 
+// resolveCriteria returns the criteria with the finalized and safe block tags
+// resolved into the numbers of the blocks they currently stand for.
+func resolveCriteria(backend Backend, crit sophon.FilterQuery) (sophon.FilterQuery, error) {
+	if crit.FromBlock != nil {
+		from, err := resolveBlockNumber(context.Background(), backend, crit.FromBlock.Int64())
+		if err != nil {
+			return crit, err
+		}
+		crit.FromBlock = big.NewInt(from)
+	}
+	if crit.ToBlock != nil {
+		to, err := resolveBlockNumber(context.Background(), backend, crit.ToBlock.Int64())
+		if err != nil {
+			return crit, err
+		}
+		crit.ToBlock = big.NewInt(to)
+	}
+	return crit, nil
+}
+
 // subscribeMinedPendingLogs creates a subscription that returned mined and
 // pending logs that match the given criteria.
 func (es *EventSystem) subscribeMinedPendingLogs(crit sophon.FilterQuery, logs chan []*types.Log) *Subscription {
@@ -298,6 +333,22 @@ func (es *EventSystem) SubscribeNewHeads(headers chan *types.Header) *Subscripti
 	return es.subscribe(sub)
 }
 
+// SubscribeFinalizedHeads creates a subscription that writes the header of a
+// block that the consensus engine deems irreversible.
+func (es *EventSystem) SubscribeFinalizedHeads(headers chan *types.Header) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       FinalizedBlocksSubscription,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		hashes:    make(chan []common.Hash),
+		headers:   headers,
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
 // SubscribePendingTxs creates a subscription that writes transaction hashes for
 // transactions that enter the transaction pool.
 func (es *EventSystem) SubscribePendingTxs(hashes chan []common.Hash) *Subscription {
@@ -368,6 +419,10 @@ func (es *EventSystem) broadcast(filters filterIndex, ev interface{}) {
 				}
 			})
 		}
+	case core.ChainFinalizedEvent:
+		for _, f := range filters[FinalizedBlocksSubscription] {
+			f.headers <- e.Header
+		}
 	}
 }
 
@@ -453,6 +508,7 @@ func (es *EventSystem) eventLoop() {
 		es.logsSub.Unsubscribe()
 		es.rmLogsSub.Unsubscribe()
 		es.chainSub.Unsubscribe()
+		es.finalizedSub.Unsubscribe()
 	}()
 
 	index := make(filterIndex)
@@ -471,6 +527,8 @@ func (es *EventSystem) eventLoop() {
 			es.broadcast(index, ev)
 		case ev := <-es.chainCh:
 			es.broadcast(index, ev)
+		case ev := <-es.finalizedCh:
+			es.broadcast(index, ev)
 		case ev, active := <-es.pendingLogSub.Chan():
 			if !active { // system stopped
 				return
@@ -506,6 +564,8 @@ func (es *EventSystem) eventLoop() {
 			return
 		case <-es.chainSub.Err():
 			return
+		case <-es.finalizedSub.Err():
+			return
 		}
 	}
 }
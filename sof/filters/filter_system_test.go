@@ -38,6 +38,13 @@ import (
 	"github.com/susy-go/susy-graviton/rpc"
 )
 
+// The test backend deems the blocks testFinalizedDepth behind the head finalized
+// and those testSafeDepth behind the head safe.
+const (
+	testFinalizedDepth = 10
+	testSafeDepth      = 1
+)
+
 type testBackend struct {
 	mux        *event.TypeMux
 	db         sofdb.Database
@@ -46,6 +53,7 @@ type testBackend struct {
 	rmLogsFeed *event.Feed
 	logsFeed   *event.Feed
 	chainFeed  *event.Feed
+	finalFeed  *event.Feed
 }
 
 func (b *testBackend) ChainDb() sofdb.Database {
@@ -61,14 +69,28 @@ func (b *testBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumbe
 		hash common.Hash
 		num  uint64
 	)
-	if blockNr == rpc.LatestBlockNumber {
+	switch blockNr {
+	case rpc.LatestBlockNumber, rpc.FinalizedBlockNumber, rpc.SafeBlockNumber:
 		hash = rawdb.ReadHeadBlockHash(b.db)
 		number := rawdb.ReadHeaderNumber(b.db, hash)
 		if number == nil {
 			return nil, nil
 		}
 		num = *number
-	} else {
+
+		depth := uint64(0)
+		switch blockNr {
+		case rpc.FinalizedBlockNumber:
+			depth = testFinalizedDepth
+		case rpc.SafeBlockNumber:
+			depth = testSafeDepth
+		}
+		if num < depth {
+			return nil, nil
+		}
+		num -= depth
+		hash = rawdb.ReadCanonicalHash(b.db, num)
+	default:
 		num = uint64(blockNr)
 		hash = rawdb.ReadCanonicalHash(b.db, num)
 	}
@@ -120,6 +142,10 @@ func (b *testBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subsc
 	return b.chainFeed.Subscribe(ch)
 }
 
+func (b *testBackend) SubscribeChainFinalizedEvent(ch chan<- core.ChainFinalizedEvent) event.Subscription {
+	return b.finalFeed.Subscribe(ch)
+}
+
 func (b *testBackend) BloomStatus() (uint64, uint64) {
 	return params.BloomBitsBlocks, b.sections
 }
@@ -166,7 +192,7 @@ func TestBlockSubscription(t *testing.T) {
 		rmLogsFeed  = new(event.Feed)
 		logsFeed    = new(event.Feed)
 		chainFeed   = new(event.Feed)
-		backend     = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend     = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api         = NewPublicFilterAPI(backend, false)
 		genesis     = new(core.Genesis).MustCommit(db)
 		chain, _    = core.GenerateChain(params.TestChainConfig, genesis, sofash.NewFaker(), db, 10, func(i int, gen *core.BlockGen) {})
@@ -212,6 +238,41 @@ func TestBlockSubscription(t *testing.T) {
 	<-sub1.Err()
 }
 
+// TestFinalizedHeadsSubscription tests if a finalized heads subscription returns
+// the headers deemed final by the consensus engine in order.
+func TestFinalizedHeadsSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux       = new(event.TypeMux)
+		db        = sofdb.NewMemDatabase()
+		finalFeed = new(event.Feed)
+		backend   = &testBackend{mux, db, 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), finalFeed}
+		api       = NewPublicFilterAPI(backend, false)
+		genesis   = new(core.Genesis).MustCommit(db)
+		chain, _  = core.GenerateChain(params.TestChainConfig, genesis, sofash.NewFaker(), db, 10, func(i int, gen *core.BlockGen) {})
+		headers   = make(chan *types.Header)
+		sub       = api.events.SubscribeFinalizedHeads(headers)
+		done      = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for i := 0; i < len(chain); i++ {
+			if header := <-headers; header.Hash() != chain[i].Hash() {
+				t.Errorf("received invalid hash on index %d, want %x, got %x", i, chain[i].Hash(), header.Hash())
+			}
+		}
+		sub.Unsubscribe()
+	}()
+
+	time.Sleep(1 * time.Second)
+	for _, block := range chain {
+		finalFeed.Send(core.ChainFinalizedEvent{Header: block.Header()})
+	}
+	<-done
+	<-sub.Err()
+}
+
 // TestPendingTxFilter tests whether pending tx filters retrieve all pending transactions that are posted to the event mux.
 func TestPendingTxFilter(t *testing.T) {
 	t.Parallel()
@@ -223,7 +284,7 @@ func TestPendingTxFilter(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 
 		transactions = []*types.Transaction{
@@ -283,7 +344,7 @@ func TestLogFilterCreation(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 
 		testCases = []struct {
@@ -306,8 +367,21 @@ func TestLogFilterCreation(t *testing.T) {
 			{FilterCriteria{FromBlock: big.NewInt(rpc.PendingBlockNumber.Int64()), ToBlock: big.NewInt(100)}, false},
 			// from block "higher" than to block
 			{FilterCriteria{FromBlock: big.NewInt(rpc.PendingBlockNumber.Int64()), ToBlock: big.NewInt(rpc.LatestBlockNumber.Int64())}, false},
+			// finalized block to new mined blocks
+			{FilterCriteria{FromBlock: big.NewInt(rpc.FinalizedBlockNumber.Int64()), ToBlock: big.NewInt(rpc.LatestBlockNumber.Int64())}, true},
+			// block range up to the safe block
+			{FilterCriteria{FromBlock: big.NewInt(1), ToBlock: big.NewInt(rpc.SafeBlockNumber.Int64())}, true},
+			// safe block "higher" than finalized block
+			{FilterCriteria{FromBlock: big.NewInt(rpc.SafeBlockNumber.Int64()), ToBlock: big.NewInt(rpc.FinalizedBlockNumber.Int64())}, false},
 		}
 	)
+	// Write a chain of headers for the finalized and safe blocks to resolve to
+	for i := int64(0); i <= 2*testFinalizedDepth; i++ {
+		header := &types.Header{Number: big.NewInt(i)}
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), header.Number.Uint64())
+		rawdb.WriteHeadBlockHash(db, header.Hash())
+	}
 
 	for i, test := range testCases {
 		_, err := api.NewFilter(test.crit)
@@ -332,7 +406,7 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 	)
 
@@ -359,7 +433,7 @@ func TestInvalidGetLogsRequest(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 		blockHash  = common.HexToHash("0x1111111111111111111111111111111111111111111111111111111111111111")
 	)
@@ -389,7 +463,7 @@ func TestLogFilter(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
@@ -508,7 +582,7 @@ func TestPendingLogsSubscription(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		api        = NewPublicFilterAPI(backend, false)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
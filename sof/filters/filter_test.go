@@ -32,6 +32,7 @@ import (
 	"github.com/susy-go/susy-graviton/sofdb"
 	"github.com/susy-go/susy-graviton/event"
 	"github.com/susy-go/susy-graviton/params"
+	"github.com/susy-go/susy-graviton/rpc"
 )
 
 func makeReceipt(addr common.Address) *types.Receipt {
@@ -57,7 +58,7 @@ func BenchmarkFilters(b *testing.B) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		key1, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
 		addr1      = crypto.PubkeyToAddress(key1.PublicKey)
 		addr2      = common.BytesToAddress([]byte("jeff"))
@@ -116,7 +117,7 @@ func TestFilters(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		key1, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
 		addr       = crypto.PubkeyToAddress(key1.PublicKey)
 
@@ -229,4 +230,29 @@ func TestFilters(t *testing.T) {
 	if len(logs) != 0 {
 		t.Error("expected 0 log, got", len(logs))
 	}
+
+	// The finalized and safe blocks are resolved to the numbers they stand for
+	api := NewPublicFilterAPI(backend, false)
+	for i, test := range []struct {
+		from, to *big.Int
+		topics   []common.Hash
+	}{
+		{big.NewInt(rpc.FinalizedBlockNumber.Int64()), nil, []common.Hash{hash3, hash4}},
+		{big.NewInt(0), big.NewInt(rpc.FinalizedBlockNumber.Int64()), []common.Hash{hash1, hash2}},
+		{big.NewInt(rpc.FinalizedBlockNumber.Int64()), big.NewInt(rpc.SafeBlockNumber.Int64()), []common.Hash{hash3}},
+		{big.NewInt(rpc.SafeBlockNumber.Int64()), big.NewInt(rpc.LatestBlockNumber.Int64()), []common.Hash{hash3, hash4}},
+	} {
+		logs, err := api.GetLogs(context.Background(), FilterCriteria{FromBlock: test.from, ToBlock: test.to, Addresses: []common.Address{addr}})
+		if err != nil {
+			t.Fatalf("test %d: failed to get logs: %v", i, err)
+		}
+		if len(logs) != len(test.topics) {
+			t.Fatalf("test %d: expected %d logs, got %d", i, len(test.topics), len(logs))
+		}
+		for j, log := range logs {
+			if log.Topics[0] != test.topics[j] {
+				t.Errorf("test %d: expected log[%d].Topics[0] to be %x, got %x", i, j, test.topics[j], log.Topics[0])
+			}
+		}
+	}
 }
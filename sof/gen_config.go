@@ -31,6 +31,8 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		TrieCleanCache          int
 		TrieDirtyCache          int
 		TrieTimeout             time.Duration
+		TrieRefcount            bool
+		TrieRetention           uint64
 		Sophybase               common.Address `toml:",omitempty"`
 		MinerNotify             []string       `toml:",omitempty"`
 		MinerExtraData          hexutil.Bytes  `toml:",omitempty"`
@@ -60,6 +62,8 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.TrieCleanCache = c.TrieCleanCache
 	enc.TrieDirtyCache = c.TrieDirtyCache
 	enc.TrieTimeout = c.TrieTimeout
+	enc.TrieRefcount = c.TrieRefcount
+	enc.TrieRetention = c.TrieRetention
 	enc.Sophybase = c.Sophybase
 	enc.MinerNotify = c.MinerNotify
 	enc.MinerExtraData = c.MinerExtraData
@@ -93,6 +97,8 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		TrieCleanCache          *int
 		TrieDirtyCache          *int
 		TrieTimeout             *time.Duration
+		TrieRefcount            *bool
+		TrieRetention           *uint64
 		Sophybase               *common.Address `toml:",omitempty"`
 		MinerNotify             []string        `toml:",omitempty"`
 		MinerExtraData          *hexutil.Bytes  `toml:",omitempty"`
@@ -149,6 +155,12 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.TrieTimeout != nil {
 		c.TrieTimeout = *dec.TrieTimeout
 	}
+	if dec.TrieRefcount != nil {
+		c.TrieRefcount = *dec.TrieRefcount
+	}
+	if dec.TrieRetention != nil {
+		c.TrieRetention = *dec.TrieRetention
+	}
 	if dec.Sophybase != nil {
 		c.Sophybase = *dec.Sophybase
 	}
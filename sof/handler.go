@@ -30,6 +30,7 @@ import (
 	"github.com/susy-go/susy-graviton/consensus"
 	"github.com/susy-go/susy-graviton/core"
 	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/crypto"
 	"github.com/susy-go/susy-graviton/sof/downloader"
 	"github.com/susy-go/susy-graviton/sof/fetcher"
 	"github.com/susy-go/susy-graviton/sofdb"
@@ -82,6 +83,7 @@ type ProtocolManager struct {
 	downloader *downloader.Downloader
 	fetcher    *fetcher.Fetcher
 	peers      *peerSet
+	consensus  consensus.Handler // Consensus engine exchanging messages, if any
 
 	SubProtocols []p2p.Protocol
 
@@ -140,6 +142,10 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		if mode == downloader.FastSync && version < sof63 {
 			continue
 		}
+		// Only offer the consensus messages if the engine exchanges any
+		if _, ok := engine.(consensus.Handler); !ok && version >= sof64 {
+			continue
+		}
 		// Compatible; initialise the sub-protocol
 		version := version // Closure for the run
 		manager.SubProtocols = append(manager.SubProtocols, p2p.Protocol{
@@ -191,6 +197,11 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	}
 	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, inserter, manager.removePeer)
 
+	// If the consensus engine exchanges messages of its own, carry them
+	if handler, ok := engine.(consensus.Handler); ok {
+		manager.consensus = handler
+		handler.SetBroadcaster(blockchain, manager)
+	}
 	return manager, nil
 }
 
@@ -701,6 +712,26 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		}
 		pm.txpool.AddRemotes(txs)
 
+	case p.version >= sof64 && msg.Code == ConsensusMsg:
+		// Consensus message arrived, ignore it if the engine doesn't speak any
+		if pm.consensus == nil {
+			break
+		}
+		var payload []byte
+		if err := msg.Decode(&payload); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		p.MarkConsensus(crypto.Keccak256Hash(payload))
+
+		// Feed the message to the engine and relay it further if new
+		relay, err := pm.consensus.HandleMsg(payload)
+		if err != nil {
+			return errResp(ErrDecode, "consensus msg: %v", err)
+		}
+		if relay {
+			pm.BroadcastConsensus(payload)
+		}
+
 	default:
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
 	}
@@ -747,6 +778,27 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 	}
 }
 
+// BroadcastConsensus implements consensus.Broadcaster, propagating a consensus
+// message to all peers not known to already have it.
+func (pm *ProtocolManager) BroadcastConsensus(payload []byte) {
+	hash := crypto.Keccak256Hash(payload)
+
+	peers := pm.peers.PeersWithoutConsensus(hash)
+	for _, peer := range peers {
+		peer.AsyncSendConsensus(payload)
+	}
+	log.Trace("Broadcast consensus message", "hash", hash, "recipients", len(peers))
+}
+
+// EnqueueBlock implements consensus.Broadcaster, scheduling a block finalised by
+// the consensus engine for import and propagation.
+func (pm *ProtocolManager) EnqueueBlock(block *types.Block) {
+	block.ReceivedAt = time.Now()
+	if err := pm.fetcher.Enqueue("consensus", block); err != nil {
+		log.Warn("Failed to enqueue committed block", "number", block.Number(), "hash", block.Hash(), "err", err)
+	}
+}
+
 // BroadcastTxs will propagate a batch of transactions to all peers which are not known to
 // already have the given transaction.
 func (pm *ProtocolManager) BroadcastTxs(txs types.Transactions) {
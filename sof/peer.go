@@ -26,6 +26,7 @@ import (
 	mapset "github.com/deckarep/golang-set"
 	"github.com/susy-go/susy-graviton/common"
 	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/crypto"
 	"github.com/susy-go/susy-graviton/p2p"
 	"github.com/susy-go/susy-graviton/srlp"
 )
@@ -39,6 +40,7 @@ var (
 const (
 	maxKnownTxs    = 32768 // Maximum transactions hashes to keep in the known list (prevent DOS)
 	maxKnownBlocks = 1024  // Maximum block hashes to keep in the known list (prevent DOS)
+	maxKnownMsgs   = 4096  // Maximum consensus message hashes to keep in the known list (prevent DOS)
 
 	// maxQueuedTxs is the maximum number of transaction lists to queue up before
 	// dropping broadcasts. This is a sensitive number as a transaction list might
@@ -55,6 +57,11 @@ const (
 	// above some healthy uncle limit, so use that.
 	maxQueuedAnns = 4
 
+	// maxQueuedMsgs is the maximum number of consensus messages to queue up before
+	// dropping broadcasts. A round takes a few messages from every validator, so
+	// the queue must hold a few rounds of a large validator set.
+	maxQueuedMsgs = 256
+
 	handshakeTimeout = 5 * time.Second
 )
 
@@ -87,9 +94,11 @@ type peer struct {
 
 	knownTxs    mapset.Set                // Set of transaction hashes known to be known by this peer
 	knownBlocks mapset.Set                // Set of block hashes known to be known by this peer
+	knownMsgs   mapset.Set                // Set of consensus message hashes known to be known by this peer
 	queuedTxs   chan []*types.Transaction // Queue of transactions to broadcast to the peer
 	queuedProps chan *propEvent           // Queue of blocks to broadcast to the peer
 	queuedAnns  chan *types.Block         // Queue of blocks to announce to the peer
+	queuedMsgs  chan []byte               // Queue of consensus messages to broadcast to the peer
 	term        chan struct{}             // Termination channel to stop the broadcaster
 }
 
@@ -101,15 +110,17 @@ func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
 		id:          fmt.Sprintf("%x", p.ID().Bytes()[:8]),
 		knownTxs:    mapset.NewSet(),
 		knownBlocks: mapset.NewSet(),
+		knownMsgs:   mapset.NewSet(),
 		queuedTxs:   make(chan []*types.Transaction, maxQueuedTxs),
 		queuedProps: make(chan *propEvent, maxQueuedProps),
 		queuedAnns:  make(chan *types.Block, maxQueuedAnns),
+		queuedMsgs:  make(chan []byte, maxQueuedMsgs),
 		term:        make(chan struct{}),
 	}
 }
 
-// broadcast is a write loop that multiplexes block propagations, announcements
-// and transaction broadcasts into the remote peer. The goal is to have an async
+// broadcast is a write loop that multiplexes block propagations, announcements,
+// transaction and consensus message broadcasts into the remote peer. The goal is to have an async
 // writer that does not lock up node internals.
 func (p *peer) broadcast() {
 	for {
@@ -132,6 +143,12 @@ func (p *peer) broadcast() {
 			}
 			p.Log().Trace("Announced block", "number", block.Number(), "hash", block.Hash())
 
+		case payload := <-p.queuedMsgs:
+			if err := p.SendConsensus(payload); err != nil {
+				return
+			}
+			p.Log().Trace("Broadcast consensus message", "size", len(payload))
+
 		case <-p.term:
 			return
 		}
@@ -193,6 +210,16 @@ func (p *peer) MarkTransaction(hash common.Hash) {
 	p.knownTxs.Add(hash)
 }
 
+// MarkConsensus marks a consensus message as known for the peer, ensuring that
+// it will never be propagated to this particular peer.
+func (p *peer) MarkConsensus(hash common.Hash) {
+	// If we reached the memory allowance, drop a previously known message hash
+	for p.knownMsgs.Cardinality() >= maxKnownMsgs {
+		p.knownMsgs.Pop()
+	}
+	p.knownMsgs.Add(hash)
+}
+
 // SendTransactions sends transactions to the peer and includes the hashes
 // in its transaction hash set for future reference.
 func (p *peer) SendTransactions(txs types.Transactions) error {
@@ -258,6 +285,24 @@ func (p *peer) AsyncSendNewBlock(block *types.Block, td *big.Int) {
 	}
 }
 
+// SendConsensus sends a consensus message to the peer and includes its hash in
+// its message hash set for future reference.
+func (p *peer) SendConsensus(payload []byte) error {
+	p.MarkConsensus(crypto.Keccak256Hash(payload))
+	return p2p.Send(p.rw, ConsensusMsg, payload)
+}
+
+// AsyncSendConsensus queues a consensus message for propagation to a remote
+// peer. If the peer's broadcast queue is full, the event is silently dropped.
+func (p *peer) AsyncSendConsensus(payload []byte) {
+	select {
+	case p.queuedMsgs <- payload:
+		p.MarkConsensus(crypto.Keccak256Hash(payload))
+	default:
+		p.Log().Debug("Dropping consensus message propagation", "size", len(payload))
+	}
+}
+
 // SendBlockHeaders sends a batch of block headers to the remote peer.
 func (p *peer) SendBlockHeaders(headers []*types.Header) error {
 	return p2p.Send(p.rw, BlockHeadersMsg, headers)
@@ -492,6 +537,21 @@ func (ps *peerSet) PeersWithoutTx(hash common.Hash) []*peer {
 	return list
 }
 
+// PeersWithoutConsensus retrieves a list of peers speaking the consensus messages
+// that do not have a given message in their set of known hashes.
+func (ps *peerSet) PeersWithoutConsensus(hash common.Hash) []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		if p.version >= sof64 && !p.knownMsgs.Contains(hash) {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
 // BestPeer retrieves the known peer with the currently highest total difficulty.
 func (ps *peerSet) BestPeer() *peer {
 	ps.lock.RLock()
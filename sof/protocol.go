@@ -32,16 +32,19 @@ import (
 const (
 	sof62 = 62
 	sof63 = 63
+	sof64 = 64
 )
 
 // ProtocolName is the official short name of the protocol used during capability negotiation.
 var ProtocolName = "sof"
 
 // ProtocolVersions are the supported versions of the sof protocol (first is primary).
-var ProtocolVersions = []uint{sof63, sof62}
+// Version sof64 only adds the consensus messages, so it is offered solely by the
+// nodes running a consensus engine exchanging messages of its own.
+var ProtocolVersions = []uint{sof64, sof63, sof62}
 
 // ProtocolLengths are the number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = []uint64{17, 8}
+var ProtocolLengths = []uint64{18, 17, 8}
 
 const ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
 
@@ -62,6 +65,9 @@ const (
 	NodeDataMsg    = 0x0e
 	GetReceiptsMsg = 0x0f
 	ReceiptsMsg    = 0x10
+
+	// Protocol messages belonging to sof/64
+	ConsensusMsg = 0x11
 )
 
 type errCode int
@@ -25,6 +25,7 @@ import (
 	"math/big"
 
 	"github.com/susy-go/susy-graviton"
+	"github.com/susy-go/susy-graviton/accounts/abi"
 	"github.com/susy-go/susy-graviton/common"
 	"github.com/susy-go/susy-graviton/common/hexutil"
 	"github.com/susy-go/susy-graviton/core/types"
@@ -451,6 +452,9 @@ func (ec *Client) PendingTransactionCount(ctx context.Context) (uint, error) {
 // blockNumber selects the block height at which the call runs. It can be nil, in which
 // case the code is taken from the latest known block. Note that state from very old
 // blocks might not be available.
+//
+// If the call reverts, the returned error carries the revert data, which can be
+// extracted with RevertData.
 func (ec *Client) CallContract(ctx context.Context, msg sophon.CallMsg, blockNumber *big.Int) ([]byte, error) {
 	var hex hexutil.Bytes
 	err := ec.c.CallContext(ctx, &hex, "sof_call", toCallArg(msg), toBlockNumArg(blockNumber))
@@ -460,6 +464,33 @@ func (ec *Client) CallContract(ctx context.Context, msg sophon.CallMsg, blockNum
 	return hex, nil
 }
 
+// revertErrorCode is the JSON-RPC error code the node uses for reverted calls.
+const revertErrorCode = 3
+
+// RevertData extracts the raw revert data and the decoded revert reason from an
+// error returned by CallContract, PendingCallContract or EstimateGas. The reason
+// is empty if the data isn't an abi-encoded Error(string). The returned flag is
+// false if the error wasn't caused by a reverted execution.
+func RevertData(err error) ([]byte, string, bool) {
+	if e, ok := err.(rpc.Error); !ok || e.ErrorCode() != revertErrorCode {
+		return nil, "", false
+	}
+	de, ok := err.(rpc.DataError)
+	if !ok {
+		return nil, "", false
+	}
+	hex, ok := de.ErrorData().(string)
+	if !ok {
+		return nil, "", false
+	}
+	data, err := hexutil.Decode(hex)
+	if err != nil {
+		return nil, "", false
+	}
+	reason, _ := abi.UnpackRevert(data)
+	return data, reason, true
+}
+
 // PendingCallContract executes a message call transaction using the SVM.
 // The state seen by the contract call is the pending state.
 func (ec *Client) PendingCallContract(ctx context.Context, msg sophon.CallMsg) ([]byte, error) {
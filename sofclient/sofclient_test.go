@@ -17,6 +17,7 @@
 package sofclient
 
 import (
+	"bytes"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -150,3 +151,45 @@ func TestToFilterArg(t *testing.T) {
 		})
 	}
 }
+
+type testRevertError struct {
+	code int
+	data interface{}
+}
+
+func (e *testRevertError) Error() string          { return "execution reverted" }
+func (e *testRevertError) ErrorCode() int         { return e.code }
+func (e *testRevertError) ErrorData() interface{} { return e.data }
+
+func TestRevertData(t *testing.T) {
+	reverted := "0x08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000d72657665727420726561736f6e00000000000000000000000000000000000000"
+
+	for _, testCase := range []struct {
+		name   string
+		err    error
+		reason string
+		ok     bool
+	}{
+		{"plain error", fmt.Errorf("execution reverted"), "", false},
+		{"other code", &testRevertError{-32000, reverted}, "", false},
+		{"no data", &testRevertError{3, nil}, "", false},
+		{"empty reason", &testRevertError{3, "0x"}, "", true},
+		{"reason", &testRevertError{3, reverted}, "revert reason", true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			data, reason, ok := RevertData(testCase.err)
+			if ok != testCase.ok {
+				t.Fatalf("ok mismatch: have %v, want %v", ok, testCase.ok)
+			}
+			if reason != testCase.reason {
+				t.Fatalf("reason mismatch: have %q, want %q", reason, testCase.reason)
+			}
+			if !ok {
+				return
+			}
+			if want := testCase.err.(*testRevertError).data.(string); !bytes.Equal(data, common.FromHex(want)) {
+				t.Fatalf("data mismatch: have %x, want %s", data, want)
+			}
+		})
+	}
+}
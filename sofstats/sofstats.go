@@ -367,6 +367,17 @@ type authMsg struct {
 	Secret string   `json:"secret"`
 }
 
+// protocolVersion returns the highest version of the named protocol offered by
+// the node, which may be below the highest version the protocol implements.
+func (s *Service) protocolVersion(name string) uint {
+	for _, proto := range s.server.Protocols {
+		if proto.Name == name {
+			return proto.Version
+		}
+	}
+	return 0
+}
+
 // login tries to authorize the client at the remote server.
 func (s *Service) login(conn *websocket.Conn) error {
 	// Construct and send the login authentication
@@ -375,7 +386,7 @@ func (s *Service) login(conn *websocket.Conn) error {
 	var network, protocol string
 	if info := infos.Protocols["sof"]; info != nil {
 		network = fmt.Sprintf("%d", info.(*sof.NodeInfo).Network)
-		protocol = fmt.Sprintf("sof/%d", sof.ProtocolVersions[0])
+		protocol = fmt.Sprintf("sof/%d", s.protocolVersion(sof.ProtocolName))
 	} else {
 		network = fmt.Sprintf("%d", infos.Protocols["les"].(*les.NodeInfo).Network)
 		protocol = fmt.Sprintf("les/%d", les.ClientProtocolVersions[0])
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"crypto/rand"
@@ -9,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"time"
 
@@ -27,6 +29,8 @@ var (
 	ErrDecrypt                = errors.New("cant decrypt - forbidden")
 	ErrUnknownAccessType      = errors.New("unknown access type (or not implemented)")
 	ErrDecryptDomainForbidden = errors.New("decryption request domain forbidden - can only decrypt on localhost")
+	ErrNotPublisher           = errors.New("not the publisher of the access control trie")
+	ErrNoACTGrantees          = errors.New("access control trie does not record its grantees - it has to be recreated to revoke access")
 	AllowedDecryptDomains     = []string{
 		"localhost",
 		"127.0.0.1",
@@ -206,15 +210,7 @@ func (a *API) doDecrypt(ctx context.Context, credentials string, pk *ecdsa.Priva
 			return nil
 		}
 
-		allowed := false
-		requestDomain := sctx.GetHost(ctx)
-		for _, v := range AllowedDecryptDomains {
-			if strings.Contains(requestDomain, v) {
-				allowed = true
-			}
-		}
-
-		if !allowed {
+		if !decryptAllowed(ctx) {
 			return ErrDecryptDomainForbidden
 		}
 
@@ -271,8 +267,11 @@ func (a *API) doDecrypt(ctx context.Context, credentials string, pk *ecdsa.Priva
 			return nil
 		case "act":
 			var (
-				sessionKey []byte
-				err        error
+				sessionKey    []byte
+				found         bool
+				ciphertext    []byte
+				decryptionKey []byte
+				err           error
 			)
 
 			publisherBytes, err := hex.DecodeString(m.Access.Publisher)
@@ -284,14 +283,17 @@ func (a *API) doDecrypt(ctx context.Context, credentials string, pk *ecdsa.Priva
 				return ErrDecrypt
 			}
 
-			sessionKey, err = NewSessionKeyPK(pk, publisher, m.Access.Salt)
-			if err != nil {
-				return ErrDecrypt
-			}
+			// nodes without a key can only decrypt with a password
+			if pk != nil {
+				sessionKey, err = NewSessionKeyPK(pk, publisher, m.Access.Salt)
+				if err != nil {
+					return ErrDecrypt
+				}
 
-			found, ciphertext, decryptionKey, err := a.getACTDecryptionKey(ctx, storage.Address(common.Hex2Bytes(m.Access.Act)), sessionKey)
-			if err != nil {
-				return err
+				found, ciphertext, decryptionKey, err = a.getACTDecryptionKey(ctx, storage.Address(common.Hex2Bytes(m.Access.Act)), sessionKey)
+				if err != nil {
+					return err
+				}
 			}
 			if !found {
 				// try to fall back to password
@@ -335,6 +337,18 @@ func (a *API) doDecrypt(ctx context.Context, credentials string, pk *ecdsa.Priva
 	}
 }
 
+// decryptAllowed returns whether the request domain of the context is one of
+// the AllowedDecryptDomains
+func decryptAllowed(ctx context.Context) bool {
+	requestDomain := sctx.GetHost(ctx)
+	for _, v := range AllowedDecryptDomains {
+		if strings.Contains(requestDomain, v) {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *API) getACTDecryptionKey(ctx context.Context, actManifestAddress storage.Address, sessionKey []byte) (found bool, ciphertext, decryptionKey []byte, err error) {
 	hasher := sha3.NewLegacyKeccak256()
 	hasher.Write(append(sessionKey, 0))
@@ -440,6 +454,7 @@ func DoACT(ctx *cli.Context, privateKey *ecdsa.PrivateKey, salt []byte, grantees
 	}
 
 	lookupPathEncryptedAccessKeyMap := make(map[string]string)
+	sessionKeys := [][]byte{}
 	i := 0
 	for _, v := range grantees {
 		i++
@@ -461,6 +476,7 @@ func DoACT(ctx *cli.Context, privateKey *ecdsa.PrivateKey, salt []byte, grantees
 		if err != nil {
 			return nil, nil, nil, err
 		}
+		sessionKeys = append(sessionKeys, sessionKey)
 
 		hasher := sha3.NewLegacyKeccak256()
 		hasher.Write(append(sessionKey, 0))
@@ -484,6 +500,7 @@ func DoACT(ctx *cli.Context, privateKey *ecdsa.PrivateKey, salt []byte, grantees
 		if err != nil {
 			return nil, nil, nil, err
 		}
+		sessionKeys = append(sessionKeys, sessionKey)
 		hasher := sha3.NewLegacyKeccak256()
 		hasher.Write(append(sessionKey, 0))
 		lookupKey := hasher.Sum(nil)
@@ -501,6 +518,18 @@ func DoACT(ctx *cli.Context, privateKey *ecdsa.PrivateKey, salt []byte, grantees
 		lookupPathEncryptedAccessKeyMap[hex.EncodeToString(lookupKey)] = hex.EncodeToString(encryptedAccessKey)
 	}
 
+	// record the session keys of the grantees for the publisher, so that
+	// access can be revoked later on
+	publisherSessionKey, err := NewSessionKeyPK(privateKey, &privateKey.PublicKey, salt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	granteesEntry, err := newACTGranteesEntry(publisherSessionKey, sessionKeys)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	lookupPathEncryptedAccessKeyMap[granteesEntry.Path] = granteesEntry.Hash
+
 	m := &Manifest{
 		Entries: []ManifestEntry{},
 	}
@@ -536,3 +565,304 @@ func DoPassword(ctx *cli.Context, password string, salt []byte) (sessionKey []by
 	}
 	return sessionKey, ae, nil
 }
+
+// ACTUpdate lists the grantees to add to and to remove from an ACT. Grantees
+// are given by their hex encoded compressed public keys or by their passwords
+type ACTUpdate struct {
+	Grant           []string `json:"grant,omitempty"`
+	GrantPasswords  []string `json:"grant_passwords,omitempty"`
+	Revoke          []string `json:"revoke,omitempty"`
+	RevokePasswords []string `json:"revoke_passwords,omitempty"`
+}
+
+// actHash returns the hash of the session key with the given suffix, which
+// derives the lookup key (0) and the access key encryption key (1) of the
+// ACT entry of a grantee, and the lookup key (2) and the encryption key (3)
+// of the entry recording the grantees for the publisher
+func actHash(sessionKey []byte, suffix byte) []byte {
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(sessionKey)
+	hasher.Write([]byte{suffix})
+	return hasher.Sum(nil)
+}
+
+// newACTEntry returns the ACT manifest entry of the grantee with the given
+// session key
+func newACTEntry(sessionKey, accessKey []byte) (ManifestEntry, error) {
+	enc := NewRefEncryption(len(accessKey))
+	encryptedAccessKey, err := enc.Encrypt(accessKey, actHash(sessionKey, 1))
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	return ManifestEntry{
+		Path:        hex.EncodeToString(actHash(sessionKey, 0)),
+		Hash:        hex.EncodeToString(encryptedAccessKey),
+		ContentType: "text/plain",
+	}, nil
+}
+
+// newACTGranteesEntry returns the ACT manifest entry which records the session
+// keys of the grantees, encrypted for the publisher
+func newACTGranteesEntry(publisherSessionKey []byte, sessionKeys [][]byte) (ManifestEntry, error) {
+	var keys []byte
+	for _, sessionKey := range sessionKeys {
+		keys = append(keys, sessionKey...)
+	}
+	enc := NewRefEncryption(len(keys))
+	encryptedKeys, err := enc.Encrypt(keys, actHash(publisherSessionKey, 3))
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	return ManifestEntry{
+		Path:        hex.EncodeToString(actHash(publisherSessionKey, 2)),
+		Hash:        hex.EncodeToString(encryptedKeys),
+		ContentType: "text/plain",
+	}, nil
+}
+
+// decryptACTEntry decrypts the hash of an ACT manifest entry with the given key
+func decryptACTEntry(entry ManifestEntry, key []byte) ([]byte, error) {
+	ciphertext, err := hex.DecodeString(entry.Hash)
+	if err != nil || len(ciphertext) < 8 {
+		return nil, ErrDecrypt
+	}
+	enc := NewRefEncryption(len(ciphertext) - 8)
+	plaintext, err := enc.Decrypt(ciphertext, key)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// granteeSessionKeys returns the session keys of the grantees with the given
+// public keys and passwords
+func granteeSessionKeys(privateKey *ecdsa.PrivateKey, ae *AccessEntry, grantees []string, passwords []string) ([][]byte, error) {
+	var sessionKeys [][]byte
+	for _, v := range grantees {
+		b, err := hex.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding grantee public key %q: %v", v, err)
+		}
+		granteePub, err := crypto.DecompressPubkey(b)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing grantee public key %q: %v", v, err)
+		}
+		sessionKey, err := NewSessionKeyPK(privateKey, granteePub, ae.Salt)
+		if err != nil {
+			return nil, err
+		}
+		sessionKeys = append(sessionKeys, sessionKey)
+	}
+	for _, pass := range passwords {
+		sessionKey, err := NewSessionKeyPassword(pass, ae)
+		if err != nil {
+			return nil, err
+		}
+		sessionKeys = append(sessionKeys, sessionKey)
+	}
+	return sessionKeys, nil
+}
+
+func indexOfKey(keys [][]byte, key []byte) int {
+	for i, k := range keys {
+		if bytes.Equal(k, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// actAccessEntry returns the access entry of an ACT protected root access manifest
+func actAccessEntry(root *Manifest) (*AccessEntry, error) {
+	if len(root.Entries) != 1 || root.Entries[0].Access == nil || root.Entries[0].Access.Type != AccessTypeACT {
+		return nil, errors.New("not an ACT protected root access manifest")
+	}
+	return root.Entries[0].Access, nil
+}
+
+// DoACTUpdate is a helper function which handles the business logic of granting and revoking access to the
+// content of an ACT protected root access manifest, given the publisher's private key and the entries of the current
+// ACT manifest. It returns the new root access manifest and ACT manifest; the ACT manifest has to be uploaded and its
+// address set as the Act of the access entry of the root access manifest before uploading it.
+// Granting access keeps the access key. Revoking access rotates it and replaces the content reference by the one
+// returned by reencrypt, which has to store a copy of the content encrypted with new keys, so that revoked grantees
+// can neither decrypt the new access key nor read the new version of the content with the keys they know.
+func DoACTUpdate(privateKey *ecdsa.PrivateKey, root *Manifest, act *Manifest, update *ACTUpdate, reencrypt func(ref []byte) ([]byte, error)) (newRoot *Manifest, newAct *Manifest, err error) {
+	ae, err := actAccessEntry(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ae.Publisher != hex.EncodeToString(crypto.CompressPubkey(&privateKey.PublicKey)) {
+		return nil, nil, ErrNotPublisher
+	}
+	publisherSessionKey, err := NewSessionKeyPK(privateKey, &privateKey.PublicKey, ae.Salt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := make(map[string]ManifestEntry)
+	for _, e := range act.Entries {
+		entries[e.Path] = e
+	}
+
+	// the publisher is always a grantee
+	publisherEntry, ok := entries[hex.EncodeToString(actHash(publisherSessionKey, 0))]
+	if !ok {
+		return nil, nil, ErrDecrypt
+	}
+	accessKey, err := decryptACTEntry(publisherEntry, actHash(publisherSessionKey, 1))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revoking := len(update.Revoke) > 0 || len(update.RevokePasswords) > 0
+	granteesPath := hex.EncodeToString(actHash(publisherSessionKey, 2))
+	var sessionKeys [][]byte
+	if e, ok := entries[granteesPath]; ok {
+		keys, err := decryptACTEntry(e, actHash(publisherSessionKey, 3))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(keys)%32 != 0 {
+			return nil, nil, errors.New("invalid grantees entry in access control trie")
+		}
+		for i := 0; i < len(keys); i += 32 {
+			sessionKeys = append(sessionKeys, keys[i:i+32])
+		}
+	} else if revoking {
+		return nil, nil, ErrNoACTGrantees
+	}
+
+	granted, err := granteeSessionKeys(privateKey, ae, update.Grant, update.GrantPasswords)
+	if err != nil {
+		return nil, nil, err
+	}
+	revoked, err := granteeSessionKeys(privateKey, ae, update.Revoke, update.RevokePasswords)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(granted) == 0 && len(revoked) == 0 {
+		return nil, nil, errors.New("did not get any grantees to grant or revoke access")
+	}
+
+	for _, sessionKey := range granted {
+		if sessionKeys != nil && indexOfKey(sessionKeys, sessionKey) < 0 {
+			sessionKeys = append(sessionKeys, sessionKey)
+		}
+	}
+	for i, sessionKey := range revoked {
+		grantee := "password"
+		if i < len(update.Revoke) {
+			grantee = update.Revoke[i]
+		}
+		if bytes.Equal(sessionKey, publisherSessionKey) {
+			return nil, nil, errors.New("cannot revoke access of the publisher")
+		}
+		j := indexOfKey(sessionKeys, sessionKey)
+		if j < 0 {
+			return nil, nil, fmt.Errorf("%s is not a grantee", grantee)
+		}
+		sessionKeys = append(sessionKeys[:j], sessionKeys[j+1:]...)
+	}
+
+	rootEntry := root.Entries[0]
+	newAccessEntry := *ae
+	newAccessEntry.Act = ""
+	rootEntry.Access = &newAccessEntry
+	rootEntry.ModTime = time.Now()
+
+	if revoking {
+		ref, err := decryptACTEntry(rootEntry, accessKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		ref, err = reencrypt(ref)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		accessKey = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, accessKey); err != nil {
+			panic("reading from crypto/rand failed: " + err.Error())
+		}
+		enc := NewRefEncryption(len(ref))
+		encrypted, err := enc.Encrypt(ref, accessKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		rootEntry.Hash = hex.EncodeToString(encrypted)
+
+		// none of the entries of the revoked grantees are kept
+		entries = make(map[string]ManifestEntry)
+		granted = sessionKeys
+	}
+	for _, sessionKey := range granted {
+		e, err := newACTEntry(sessionKey, accessKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries[e.Path] = e
+	}
+	if sessionKeys != nil {
+		e, err := newACTGranteesEntry(publisherSessionKey, sessionKeys)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries[e.Path] = e
+	}
+
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	newAct = &Manifest{
+		Entries: make([]ManifestEntry, len(paths)),
+	}
+	for i, path := range paths {
+		newAct.Entries[i] = entries[path]
+	}
+
+	return &Manifest{Entries: []ManifestEntry{rootEntry}}, newAct, nil
+}
+
+// UpdateACT grants and revokes access to the content of the ACT protected root access manifest at addr with the node
+// as the publisher, see DoACTUpdate. It stores the new ACT manifest and root access manifest and returns the address
+// of the root access manifest. Like decryption it is only allowed on localhost.
+func (a *API) UpdateACT(ctx context.Context, addr storage.Address, update *ACTUpdate) (storage.Address, error) {
+	if !decryptAllowed(ctx) {
+		return nil, ErrDecryptDomainForbidden
+	}
+	if a.privateKey == nil {
+		return nil, ErrNotPublisher
+	}
+	root, err := a.getManifest(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	ae, err := actAccessEntry(root)
+	if err != nil {
+		return nil, err
+	}
+	list, err := a.GetManifestList(ctx, NOOPDecrypt, storage.Address(common.Hex2Bytes(ae.Act)), "")
+	if err != nil {
+		return nil, err
+	}
+	act := &Manifest{}
+	for _, e := range list.Entries {
+		act.Entries = append(act.Entries, *e)
+	}
+
+	root, act, err = DoACTUpdate(a.privateKey, root, act, update, func(ref []byte) ([]byte, error) {
+		return a.Reencrypt(ctx, ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+	actAddr, err := a.putManifest(ctx, act)
+	if err != nil {
+		return nil, err
+	}
+	root.Entries[0].Access.Act = actAddr.Hex()
+	return a.putManifest(ctx, root)
+}
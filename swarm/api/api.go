@@ -50,6 +50,10 @@ import (
 	opentracing "github.com/opentracing/opentracing-go"
 )
 
+// RedundancyHeaderName is the HTTP header setting the redundancy level of the
+// erasure coding of uploads, from 0 (none) to 4 (paranoid)
+const RedundancyHeaderName = "X-Swarm-Redundancy"
+
 var (
 	apiResolveCount        = metrics.NewRegisteredCounter("api.resolve.count", nil)
 	apiResolveFail         = metrics.NewRegisteredCounter("api.resolve.fail", nil)
@@ -189,6 +193,9 @@ type API struct {
 	fileStore *storage.FileStore
 	dns       Resolver
 	Decryptor func(context.Context, string) DecryptFunc
+	pins      *pinning
+
+	privateKey *ecdsa.PrivateKey // publisher key of ACT updates
 }
 
 // NewAPI the api constructor initialises a new API instance.
@@ -200,6 +207,7 @@ func NewAPI(fileStore *storage.FileStore, dns Resolver, feedHandler *feed.Handle
 		Decryptor: func(ctx context.Context, credentials string) DecryptFunc {
 			return self.doDecrypt(ctx, credentials, pk)
 		},
+		privateKey: pk,
 	}
 	return
 }
@@ -326,13 +334,24 @@ func (a *API) Put(ctx context.Context, content string, contentType string, toEnc
 // to resolve basePath to content using FileStore retrieve
 // it returns a section reader, mimeType, status, the key of the actual content and an error
 func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage.Address, path string) (reader storage.LazySectionReader, mimeType string, status int, contentAddr storage.Address, err error) {
-	log.Debug("api.get", "key", manifestAddr, "path", path)
+	reader, mimeType, status, contentAddr, _, err = a.GetVersion(ctx, decrypt, manifestAddr, path, 0, lookup.NoClue)
+	return
+}
+
+// GetVersion is like Get, but resolves the feeds of feed manifests to their
+// last update on or before timeLimit, so that earlier versions of mutable
+// content can be retrieved. A timeLimit of 0 selects the latest update.
+// The hint is the epoch of a known update of the feed, it speeds up the lookup.
+// It also reports whether the path was resolved through a feed, in which case
+// the content may change.
+func (a *API) GetVersion(ctx context.Context, decrypt DecryptFunc, manifestAddr storage.Address, path string, timeLimit uint64, hint lookup.Epoch) (reader storage.LazySectionReader, mimeType string, status int, contentAddr storage.Address, isFeed bool, err error) {
+	log.Debug("api.get", "key", manifestAddr, "path", path, "time", timeLimit)
 	apiGetCount.Inc(1)
 	trie, err := loadManifest(ctx, a.fileStore, manifestAddr, nil, decrypt)
 	if err != nil {
 		apiGetNotFound.Inc(1)
 		status = http.StatusNotFound
-		return nil, "", http.StatusNotFound, nil, err
+		return nil, "", http.StatusNotFound, nil, false, err
 	}
 
 	log.Debug("trie getting entry", "key", manifestAddr, "path", path)
@@ -345,22 +364,23 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 			log.Debug("entry is manifest", "key", manifestAddr, "new key", entry.Hash)
 			adr, err := hex.DecodeString(entry.Hash)
 			if err != nil {
-				return nil, "", 0, nil, err
+				return nil, "", 0, nil, false, err
 			}
-			return a.Get(ctx, decrypt, adr, entry.Path)
+			return a.GetVersion(ctx, decrypt, adr, entry.Path, timeLimit, hint)
 		}
 
 		// we need to do some extra work if this is a Swarm feed manifest
 		if entry.ContentType == FeedContentType {
+			isFeed = true
 			if entry.Feed == nil {
-				return reader, mimeType, status, nil, fmt.Errorf("Cannot decode Feed in manifest")
+				return reader, mimeType, status, nil, isFeed, fmt.Errorf("Cannot decode Feed in manifest")
 			}
-			_, err := a.feed.Lookup(ctx, feed.NewQueryLatest(entry.Feed, lookup.NoClue))
+			_, err := a.feed.Lookup(ctx, feed.NewQuery(entry.Feed, timeLimit, hint))
 			if err != nil {
 				apiGetNotFound.Inc(1)
 				status = http.StatusNotFound
 				log.Debug(fmt.Sprintf("get feed update content error: %v", err))
-				return reader, mimeType, status, nil, err
+				return reader, mimeType, status, nil, isFeed, err
 			}
 			// get the data of the update
 			_, contentAddr, err := a.feed.GetContent(entry.Feed)
@@ -368,7 +388,7 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 				apiGetNotFound.Inc(1)
 				status = http.StatusNotFound
 				log.Warn(fmt.Sprintf("get feed update content error: %v", err))
-				return reader, mimeType, status, nil, err
+				return reader, mimeType, status, nil, isFeed, err
 			}
 
 			// extract content hash
@@ -377,7 +397,7 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 				status = http.StatusUnprocessableEntity
 				errorMessage := fmt.Sprintf("invalid swarm hash in feed update. Expected %d bytes. Got %d", storage.AddressLength, len(contentAddr))
 				log.Warn(errorMessage)
-				return reader, mimeType, status, nil, errors.New(errorMessage)
+				return reader, mimeType, status, nil, isFeed, errors.New(errorMessage)
 			}
 			manifestAddr = storage.Address(contentAddr)
 			log.Trace("feed update contains swarm hash", "key", manifestAddr)
@@ -388,7 +408,7 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 				apiGetNotFound.Inc(1)
 				status = http.StatusNotFound
 				log.Warn(fmt.Sprintf("loadManifestTrie (feed update) error: %v", err))
-				return reader, mimeType, status, nil, err
+				return reader, mimeType, status, nil, isFeed, err
 			}
 
 			// finally, get the manifest entry
@@ -399,7 +419,7 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 				apiGetNotFound.Inc(1)
 				err = fmt.Errorf("manifest (feed update) entry for '%s' not found", path)
 				log.Trace("manifest (feed update) entry not found", "key", manifestAddr, "path", path)
-				return reader, mimeType, status, nil, err
+				return reader, mimeType, status, nil, isFeed, err
 			}
 		}
 
@@ -409,7 +429,7 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 		status = entry.Status
 		if status == http.StatusMultipleChoices {
 			apiGetHTTP300.Inc(1)
-			return nil, entry.ContentType, status, contentAddr, err
+			return nil, entry.ContentType, status, contentAddr, isFeed, err
 		}
 		mimeType = entry.ContentType
 		log.Debug("content lookup key", "key", contentAddr, "mimetype", mimeType)
@@ -941,13 +961,40 @@ func (a *API) ResolveFeedManifest(ctx context.Context, addr storage.Address) (*f
 	}
 
 	entry, _ := trie.getEntry("")
-	if entry.ContentType != FeedContentType {
+	if entry == nil || entry.ContentType != FeedContentType {
 		return nil, ErrNotAFeedManifest
 	}
 
 	return entry.Feed, nil
 }
 
+// ResolveManifestVersion returns the address of the manifest which the feed
+// of a feed manifest pointed to in its last update on or before timeLimit, or
+// in its latest update if timeLimit is 0. The hint is the epoch of a known
+// update of the feed. Addresses of other manifests are returned unchanged.
+func (a *API) ResolveManifestVersion(ctx context.Context, addr storage.Address, timeLimit uint64, hint lookup.Epoch) (storage.Address, error) {
+	fd, err := a.ResolveFeedManifest(ctx, addr)
+	if err == ErrNotAFeedManifest || err == ErrCannotLoadFeedManifest {
+		// encrypted manifests can not be loaded without credentials, but
+		// feed manifests are never encrypted
+		return addr, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.feed.Lookup(ctx, feed.NewQuery(fd, timeLimit, hint)); err != nil {
+		return nil, err
+	}
+	_, contentAddr, err := a.feed.GetContent(fd)
+	if err != nil {
+		return nil, err
+	}
+	if len(contentAddr) != storage.AddressLength {
+		return nil, fmt.Errorf("invalid swarm hash in feed update. Expected %d bytes. Got %d", storage.AddressLength, len(contentAddr))
+	}
+	return storage.Address(contentAddr), nil
+}
+
 // ErrCannotResolveFeedURI is returned when the ENS resolver is not able to translate a name to a Swarm feed
 var ErrCannotResolveFeedURI = errors.New("Cannot resolve Feed URI")
 
@@ -19,6 +19,8 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
@@ -30,6 +32,7 @@ import (
 
 	"github.com/susy-go/susy-graviton/common"
 	"github.com/susy-go/susy-graviton/core/types"
+	"github.com/susy-go/susy-graviton/crypto"
 	"github.com/susy-go/susy-graviton/log"
 	"github.com/susy-go/susy-graviton/swarm/sctx"
 	"github.com/susy-go/susy-graviton/swarm/storage"
@@ -435,6 +438,133 @@ func TestDecryptOrigin(t *testing.T) {
 	}
 }
 
+// TestUpdateACT tests granting and revoking access to the content of an ACT
+// protected root access manifest
+func TestUpdateACT(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "bzz-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+	fileStore, err := storage.NewLocalFileStore(datadir, make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	grantees := make([]*ecdsa.PrivateKey, 3)
+	granteeKeys := make([]string, 3)
+	for i := range grantees {
+		if grantees[i], err = crypto.GenerateKey(); err != nil {
+			t.Fatal(err)
+		}
+		granteeKeys[i] = hex.EncodeToString(crypto.CompressPubkey(&grantees[i].PublicKey))
+	}
+	a := NewAPI(fileStore, nil, nil, publisher)
+	ctx := sctx.SetHost(context.TODO(), "localhost")
+
+	contentAddr, wait, err := a.Put(ctx, "hello", "text/plain", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// grant the first two grantees access
+	accessKey, ae, act, err := DoACT(nil, publisher, make([]byte, 32), []string{granteeKeys[0], granteeKeys[1]}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actAddr, err := a.putManifest(ctx, act)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ae.Act = actAddr.Hex()
+	root, err := GenerateAccessControlManifest(nil, contentAddr.Hex(), accessKey, ae)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootAddr, err := a.putManifest(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// checkAccess checks which of the grantees can decrypt the root access
+	// manifest and returns the decrypted content address
+	checkAccess := func(rootAddr storage.Address, granted ...bool) string {
+		root, err := a.getManifest(ctx, rootAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hash string
+		for i, key := range append([]*ecdsa.PrivateKey{publisher}, grantees...) {
+			entry := root.Entries[0]
+			err := NewAPI(fileStore, nil, nil, key).Decryptor(ctx, "")(&entry)
+			if i > 0 && !granted[i-1] {
+				if err != ErrDecrypt {
+					t.Fatalf("expected grantee %d to fail with %v, got %v", i-1, ErrDecrypt, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("grantee %d cannot decrypt: %v", i-1, err)
+			}
+			if hash != "" && entry.Hash != hash {
+				t.Fatalf("grantee %d decrypted %s, expected %s", i-1, entry.Hash, hash)
+			}
+			hash = entry.Hash
+		}
+		resp := testGet(t, a, hash, "")
+		checkResponse(t, resp, expResponse("hello", "text/plain", 0))
+		return hash
+	}
+	if hash := checkAccess(rootAddr, true, true, false); hash != contentAddr.Hex() {
+		t.Fatalf("expected content address %s, got %s", contentAddr, hash)
+	}
+
+	// granting access keeps the content address
+	rootAddr, err = a.UpdateACT(ctx, rootAddr, &ACTUpdate{Grant: granteeKeys[2:]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash := checkAccess(rootAddr, true, true, true); hash != contentAddr.Hex() {
+		t.Fatalf("expected content address %s, got %s", contentAddr, hash)
+	}
+
+	// revoking access re-encrypts the content
+	rootAddr, err = a.UpdateACT(ctx, rootAddr, &ACTUpdate{Revoke: granteeKeys[:1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash := checkAccess(rootAddr, false, true, true); hash == contentAddr.Hex() || len(hash) != 128 {
+		t.Fatalf("expected content to be re-encrypted, got address %s", hash)
+	}
+
+	for _, update := range []*ACTUpdate{
+		{Revoke: granteeKeys[:1]},
+		{Revoke: []string{hex.EncodeToString(crypto.CompressPubkey(&publisher.PublicKey))}},
+		{},
+	} {
+		if _, err := a.UpdateACT(ctx, rootAddr, update); err == nil {
+			t.Fatalf("expected error for update %v", update)
+		}
+	}
+	if _, err := NewAPI(fileStore, nil, nil, grantees[1]).UpdateACT(ctx, rootAddr, &ACTUpdate{Grant: granteeKeys[:1]}); err != ErrNotPublisher {
+		t.Fatalf("expected error %v, got %v", ErrNotPublisher, err)
+	}
+	gatewayCtx := sctx.SetHost(context.TODO(), "swarm-gateways.net")
+	if _, err := a.UpdateACT(gatewayCtx, rootAddr, &ACTUpdate{Grant: granteeKeys[:1]}); err != ErrDecryptDomainForbidden {
+		t.Fatalf("expected error %v, got %v", ErrDecryptDomainForbidden, err)
+	}
+	if _, err := a.Reencrypt(gatewayCtx, contentAddr); err != ErrDecryptDomainForbidden {
+		t.Fatalf("expected error %v, got %v", ErrDecryptDomainForbidden, err)
+	}
+}
+
 func TestDetectContentType(t *testing.T) {
 	for _, tc := range []struct {
 		file                string
@@ -40,6 +40,7 @@ import (
 	"github.com/susy-go/susy-graviton/log"
 	"github.com/susy-go/susy-graviton/metrics"
 	"github.com/susy-go/susy-graviton/swarm/api"
+	"github.com/susy-go/susy-graviton/swarm/chunk"
 	"github.com/susy-go/susy-graviton/swarm/spancontext"
 	"github.com/susy-go/susy-graviton/swarm/storage/feed"
 	"github.com/pborman/uuid"
@@ -58,6 +59,13 @@ func NewClient(gateway string) *Client {
 // Client wraps interaction with a swarm HTTP gateway.
 type Client struct {
 	Gateway string
+
+	// UploadTag is the uid of the tag uploads are counted in, if it is 0
+	// the gateway creates a new tag for each upload
+	UploadTag uint32
+
+	// Redundancy is the redundancy level of the erasure coding of uploads
+	Redundancy uint8
 }
 
 // UploadRaw uploads raw data to swarm and returns the resulting hash. If toEncrypt is true it
@@ -75,6 +83,7 @@ func (c *Client) UploadRaw(r io.Reader, size int64, toEncrypt bool) (string, err
 		return "", err
 	}
 	req.ContentLength = size
+	c.setUploadHeaders(req)
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", err
@@ -393,7 +402,18 @@ func (c *Client) DownloadManifest(hash string) (*api.Manifest, bool, error) {
 //
 // where entries ending with "/" are common prefixes.
 func (c *Client) List(hash, prefix, credentials string) (*api.ManifestList, error) {
-	req, err := http.NewRequest(http.MethodGet, c.Gateway+"/bzz-list:/"+hash+"/"+prefix, nil)
+	return c.ListVersion(hash, prefix, credentials, 0)
+}
+
+// ListVersion is like List, but lists the version of a feed manifest's
+// content which was current at the given unix time. A time of 0 lists the
+// latest version.
+func (c *Client) ListVersion(hash, prefix, credentials string, time uint64) (*api.ManifestList, error) {
+	uri := c.Gateway + "/bzz-list:/" + hash + "/" + prefix
+	if time != 0 {
+		uri += "?time=" + strconv.FormatUint(time, 10)
+	}
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -419,6 +439,38 @@ func (c *Client) List(hash, prefix, credentials string) (*api.ManifestList, erro
 	return &list, nil
 }
 
+// Diff returns the differences between the entries with the given prefix of
+// the manifests with hashes from and to. Feed manifests are resolved to the
+// version of their content at fromTime and toTime respectively, a time of 0
+// selects the latest version.
+func (c *Client) Diff(from, to, prefix string, fromTime, toTime uint64) (*api.ManifestDiff, error) {
+	query := url.Values{}
+	query.Set("diff", from)
+	if fromTime != 0 {
+		query.Set("diff.time", strconv.FormatUint(fromTime, 10))
+	}
+	if toTime != 0 {
+		query.Set("time", strconv.FormatUint(toTime, 10))
+	}
+	res, err := http.Get(c.Gateway + "/bzz-list:/" + to + "/" + prefix + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, ErrUnauthorized
+	default:
+		return nil, fmt.Errorf("unexpected HTTP status: %s", res.Status)
+	}
+	var diff api.ManifestDiff
+	if err := json.NewDecoder(res.Body).Decode(&diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
 // Uploader uploads files to swarm using a provided UploadFn
 type Uploader interface {
 	Upload(UploadFn) error
@@ -503,6 +555,7 @@ func (c *Client) TarUpload(hash string, uploader Uploader, defaultPath string, t
 	transport := http.DefaultTransport
 
 	req.Header.Set("Content-Type", "application/x-tar")
+	c.setUploadHeaders(req)
 	if defaultPath != "" {
 		q := req.URL.Query()
 		q.Set("defaultpath", defaultPath)
@@ -574,6 +627,7 @@ func (c *Client) MultipartUpload(hash string, uploader Uploader) (string, error)
 
 	mw := multipart.NewWriter(reqW)
 	req.Header.Set("Content-Type", fmt.Sprintf("multipart/form-data; boundary=%q", mw.Boundary()))
+	c.setUploadHeaders(req)
 
 	// define an UploadFn which adds files to the multipart form
 	uploadFn := func(file *File) error {
@@ -742,6 +796,141 @@ func (c *Client) GetFeedRequest(query *feed.Query, manifestAddressOrDomain strin
 	return &metadata, nil
 }
 
+// Pin pins the content under the given hash in the local store of the node,
+// protecting it and everything it references from garbage collection
+func (c *Client) Pin(hash string) error {
+	return c.pinRequest(http.MethodPost, hash)
+}
+
+// Unpin releases a pin of the content under the given hash
+func (c *Client) Unpin(hash string) error {
+	return c.pinRequest(http.MethodDelete, hash)
+}
+
+func (c *Client) pinRequest(method, hash string) error {
+	req, err := http.NewRequest(method, c.Gateway+"/bzz-pin:/"+hash, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status: %s", res.Status)
+	}
+	return nil
+}
+
+// Pins returns the list of content pinned in the local store of the node
+func (c *Client) Pins() ([]api.PinInfo, error) {
+	res, err := http.DefaultClient.Get(c.Gateway + "/bzz-pin:/")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", res.Status)
+	}
+	var pins []api.PinInfo
+	if err := json.NewDecoder(res.Body).Decode(&pins); err != nil {
+		return nil, err
+	}
+	return pins, nil
+}
+
+// UpdateACT grants and revokes access to the content of the ACT protected
+// root access manifest with the given hash, with the gateway node as the
+// publisher, and returns the hash of the new root access manifest
+func (c *Client) UpdateACT(hash string, update *api.ACTUpdate) (string, error) {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return "", err
+	}
+	return c.accessRequest(hash, bytes.NewReader(data))
+}
+
+// Reencrypt stores an encrypted copy of the manifest with the given hash and
+// of the content of its entries and returns the hash of the copy
+func (c *Client) Reencrypt(hash string) (string, error) {
+	return c.accessRequest(hash+"/reencrypt", nil)
+}
+
+func (c *Client) accessRequest(uri string, body io.Reader) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, c.Gateway+"/bzz-access:/"+uri, body)
+	if err != nil {
+		return "", err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return "", ErrUnauthorized
+	default:
+		return "", fmt.Errorf("unexpected HTTP status: %s", res.Status)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// CreateTag creates an upload tag with the given name on the gateway
+func (c *Client) CreateTag(name string) (*chunk.Tag, error) {
+	req, err := http.NewRequest(http.MethodPost, c.Gateway+"/tags/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(api.TagNameHeaderName, name)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", res.Status)
+	}
+	tag := new(chunk.Tag)
+	if err := json.NewDecoder(res.Body).Decode(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// GetTag returns the upload tag with the uid from the gateway
+func (c *Client) GetTag(uid uint32) (*chunk.Tag, error) {
+	res, err := http.DefaultClient.Get(fmt.Sprintf("%s/tags/%d", c.Gateway, uid))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", res.Status)
+	}
+	tag := new(chunk.Tag)
+	if err := json.NewDecoder(res.Body).Decode(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// setUploadHeaders sets the upload tag header of the request if the client
+// has an upload tag and the redundancy header if it has a redundancy level
+func (c *Client) setUploadHeaders(req *http.Request) {
+	if c.UploadTag != 0 {
+		req.Header.Set(api.TagHeaderName, strconv.FormatUint(uint64(c.UploadTag), 10))
+	}
+	if c.Redundancy != 0 {
+		req.Header.Set(api.RedundancyHeaderName, strconv.FormatUint(uint64(c.Redundancy), 10))
+	}
+}
+
 func GetClientTrace(traceMsg, metricPrefix, ruid string, tn *time.Time) *httptrace.ClientTrace {
 	trace := &httptrace.ClientTrace{
 		GetConn: func(_ string) {
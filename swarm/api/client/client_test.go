@@ -18,7 +18,10 @@ package client
 
 import (
 	"bytes"
+	"crypto/rand"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -32,6 +35,7 @@ import (
 	"github.com/susy-go/susy-graviton/crypto"
 	"github.com/susy-go/susy-graviton/swarm/api"
 	swarmhttp "github.com/susy-go/susy-graviton/swarm/api/http"
+	"github.com/susy-go/susy-graviton/swarm/chunk"
 	"github.com/susy-go/susy-graviton/swarm/storage/feed"
 )
 
@@ -243,6 +247,217 @@ func TestClientUploadDownloadDirectory(t *testing.T) {
 	}
 }
 
+// TestClientPin tests pinning an uploaded directory protects all of its
+// chunks and that pins are counted
+func TestClientPin(t *testing.T) {
+	srv := swarmhttp.NewTestSwarmServer(t, serverFunc, nil)
+	defer srv.Close()
+
+	dir := newTestDirectory(t)
+	defer os.RemoveAll(dir)
+
+	client := NewClient(srv.URL)
+	hash, err := client.UploadDirectory(dir, "", "", false)
+	if err != nil {
+		t.Fatalf("error uploading directory: %s", err)
+	}
+	list, err := client.List(hash, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbStore := srv.FileStore.ChunkStore.(*storage.LocalStore).DbStore
+
+	// checkPins checks the pin counters of the root and the file chunks
+	checkPins := func(want uint64) {
+		if have := dbStore.PinCount(storage.Address(common.Hex2Bytes(hash))); have != want {
+			t.Fatalf("expected root pin count %d, got %d", want, have)
+		}
+		for _, entry := range list.Entries {
+			if have := dbStore.PinCount(storage.Address(common.Hex2Bytes(entry.Hash))); have != want {
+				t.Fatalf("expected pin count %d for %s, got %d", want, entry.Path, have)
+			}
+		}
+	}
+	for i := 1; i <= 2; i++ {
+		if err := client.Pin(hash); err != nil {
+			t.Fatal(err)
+		}
+		checkPins(uint64(i))
+	}
+	pins, err := client.Pins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].Address.Hex() != hash || pins[0].Counter != 2 {
+		t.Fatalf("unexpected pins: %v", pins)
+	}
+	if pins[0].Chunks <= len(list.Entries) {
+		t.Fatalf("expected more than %d pinned chunks, got %d", len(list.Entries), pins[0].Chunks)
+	}
+
+	for i := 1; i >= 0; i-- {
+		if err := client.Unpin(hash); err != nil {
+			t.Fatal(err)
+		}
+		checkPins(uint64(i))
+	}
+	if pins, err = client.Pins(); err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 0 {
+		t.Fatalf("expected no pins, got %v", pins)
+	}
+	if err := client.Unpin(hash); err == nil {
+		t.Fatal("expected error unpinning content which is not pinned")
+	}
+}
+
+// TestClientUpdateACT tests revoking access to the content of an ACT
+// protected root access manifest with the publisher's key on the client
+func TestClientUpdateACT(t *testing.T) {
+	// cheaper session keys of password grantees
+	defer func(kdfParams *api.KdfParams) {
+		api.DefaultKdfParams = kdfParams
+	}(api.DefaultKdfParams)
+	api.DefaultKdfParams = api.NewKdfParams(1024, 1, 1)
+
+	srv := swarmhttp.NewTestSwarmServer(t, serverFunc, nil)
+	defer srv.Close()
+
+	dir := newTestDirectory(t)
+	defer os.RemoveAll(dir)
+
+	client := NewClient(srv.URL)
+	hash, err := client.UploadDirectory(dir, "", "", false)
+	if err != nil {
+		t.Fatalf("error uploading directory: %s", err)
+	}
+	list, err := client.List(hash, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessKey, ae, act, err := api.DoACT(nil, publisher, make([]byte, 32), nil, []string{"pass1", "pass2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ae.Act, err = client.UploadManifest(act, false); err != nil {
+		t.Fatal(err)
+	}
+	root, err := api.GenerateAccessControlManifest(nil, hash, accessKey, ae)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootHash, err := client.UploadManifest(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pass := range []string{"pass1", "pass2"} {
+		if _, err := client.List(rootHash, "", pass); err != nil {
+			t.Fatalf("cannot list with password %s: %v", pass, err)
+		}
+	}
+
+	// the node is not the publisher
+	if _, err := client.UpdateACT(rootHash, &api.ACTUpdate{RevokePasswords: []string{"pass1"}}); err == nil {
+		t.Fatal("expected error updating the ACT with the node's key")
+	}
+
+	actList, err := client.List(ae.Act, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	act = &api.Manifest{}
+	for _, e := range actList.Entries {
+		act.Entries = append(act.Entries, *e)
+	}
+	root, act, err = api.DoACTUpdate(publisher, root, act, &api.ACTUpdate{RevokePasswords: []string{"pass1"}}, func(ref []byte) ([]byte, error) {
+		hash, err := client.Reencrypt(common.Bytes2Hex(ref))
+		if err != nil {
+			return nil, err
+		}
+		return common.Hex2Bytes(hash), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Entries[0].Access.Act, err = client.UploadManifest(act, false); err != nil {
+		t.Fatal(err)
+	}
+	if rootHash, err = client.UploadManifest(root, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.List(rootHash, "", "pass1"); err != ErrUnauthorized {
+		t.Fatalf("expected error %v, got %v", ErrUnauthorized, err)
+	}
+	newList, err := client.List(rootHash, "", "pass2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newList.Entries) != len(list.Entries) {
+		t.Fatalf("expected %d entries, got %d", len(list.Entries), len(newList.Entries))
+	}
+	for i, entry := range newList.Entries {
+		if entry.Path != list.Entries[i].Path {
+			t.Fatalf("expected entry %s, got %s", list.Entries[i].Path, entry.Path)
+		}
+		if entry.Hash == list.Entries[i].Hash {
+			t.Fatalf("entry %s is not re-encrypted", entry.Path)
+		}
+	}
+}
+
+// TestClientUploadTag tests that uploads are counted in the given upload tag
+// and that uploads without a tag get a new one
+func TestClientUploadTag(t *testing.T) {
+	srv := swarmhttp.NewTestSwarmServer(t, serverFunc, nil)
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+	tag, err := client.CreateTag("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Name != "test" || tag.Total() != 0 {
+		t.Fatalf("unexpected new tag %q with total %d", tag.Name, tag.Total())
+	}
+
+	// 10000 bytes are split into 3 data chunks and a root chunk
+	client.UploadTag = tag.Uid
+	data := make([]byte, 10000)
+	rand.Read(data)
+	hash, err := client.UploadRaw(bytes.NewReader(data), int64(len(data)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag, err = client.GetTag(tag.Uid); err != nil {
+		t.Fatal(err)
+	}
+	if common.Bytes2Hex(tag.Address()) != hash {
+		t.Fatalf("expected tag address %s, got %x", hash, tag.Address())
+	}
+	if tag.Total() != 4 || !tag.Done(chunk.StateSplit) || !tag.Done(chunk.StateStored) {
+		t.Fatalf("expected 4 chunks split and stored, got split %d, stored %d of %d", tag.Get(chunk.StateSplit), tag.Get(chunk.StateStored), tag.Total())
+	}
+
+	client.UploadTag = 0
+	if _, err := client.UploadRaw(bytes.NewReader(data), int64(len(data)), false); err != nil {
+		t.Fatal(err)
+	}
+	if tags := srv.FileStore.Tags().All(); len(tags) != 2 {
+		t.Fatalf("expected 2 tags, got %d", len(tags))
+	}
+
+	if _, err := client.GetTag(tag.Uid + 1); err == nil {
+		t.Fatal("expected error getting unknown tag")
+	}
+}
+
 // TestClientFileList tests listing files in a swarm manifest
 func TestClientFileList(t *testing.T) {
 	testClientFileList(false, t)
@@ -587,3 +802,123 @@ func TestClientCreateUpdateFeed(t *testing.T) {
 		t.Fatalf("Expected: %v, got %v", databytes, gotData)
 	}
 }
+
+// TestClientFeedVersions tests that earlier versions of a directory published
+// to a feed can be retrieved, listed and compared with later versions
+func TestClientFeedVersions(t *testing.T) {
+	signer, _ := newTestSigner()
+
+	srv := swarmhttp.NewTestSwarmServer(t, serverFunc, nil)
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	dir := newTestDirectory(t)
+	defer os.RemoveAll(dir)
+
+	// publish the first version of the directory
+	hash, err := client.UploadDirectory(dir, "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, _ := feed.NewTopic("versions", nil)
+	request := feed.NewFirstRequest(topic)
+	request.SetData(common.FromHex(hash))
+	if err := request.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	feedManifest, err := client.CreateFeedWithManifest(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstTime := srv.CurrentTime
+
+	// publish the second version, with a file added, removed and modified
+	if err := ioutil.WriteFile(filepath.Join(dir, "file1.txt"), []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "dir1/file9.txt"), []byte("added"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "dir2/file5.txt")); err != nil {
+		t.Fatal(err)
+	}
+	hash, err = client.UploadDirectory(dir, "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.CurrentTime += 100
+	request, err = client.GetFeedRequest(nil, feedManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.SetData(common.FromHex(hash))
+	if err := request.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UpdateFeed(request); err != nil {
+		t.Fatal(err)
+	}
+
+	// check the feed manifest resolves to either version
+	for _, x := range []struct {
+		query    string
+		expected string
+	}{
+		{"", "modified"},
+		{fmt.Sprintf("?time=%d", firstTime+50), "file1.txt"},
+		{fmt.Sprintf("?time=%d", srv.CurrentTime), "modified"},
+	} {
+		res, err := http.Get(srv.URL + "/bzz:/" + feedManifest + "/file1.txt" + x.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %s for query %q", res.Status, x.query)
+		}
+		if string(data) != x.expected {
+			t.Fatalf("expected %q for query %q, got %q", x.expected, x.query, data)
+		}
+	}
+
+	// check the removed file is only listed in the first version
+	list, err := client.ListVersion(feedManifest, "dir2/", "", firstTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Entries) != 1 || list.Entries[0].Path != "dir2/file5.txt" {
+		t.Fatalf("unexpected list of first version: %v", list.Entries)
+	}
+	list, err = client.List(feedManifest, "dir2/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Entries) != 0 {
+		t.Fatalf("unexpected list of latest version: %v", list.Entries)
+	}
+
+	// check the diff between the versions
+	diff, err := client.Diff(feedManifest, feedManifest, "", firstTime, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := func(entries []api.ManifestEntry) (paths []string) {
+		for _, entry := range entries {
+			paths = append(paths, entry.Path)
+		}
+		return paths
+	}
+	if added := paths(diff.Added); !reflect.DeepEqual(added, []string{"dir1/file9.txt"}) {
+		t.Fatalf("unexpected added entries %v", added)
+	}
+	if removed := paths(diff.Removed); !reflect.DeepEqual(removed, []string{"dir2/file5.txt"}) {
+		t.Fatalf("unexpected removed entries %v", removed)
+	}
+	if modified := paths(diff.Modified); !reflect.DeepEqual(modified, []string{"file1.txt"}) {
+		t.Fatalf("unexpected modified entries %v", modified)
+	}
+}
@@ -72,6 +72,10 @@ type Config struct {
 	Cors                 string
 	BzzAccount           string
 	GlobalStoreAPI       string
+	GatewayMode          bool          // disable writes of unauthenticated clients and enforce bandwidth quotas
+	GatewayAuthTokens    []string      // bearer tokens of the clients allowed to write in gateway mode
+	GatewayQuota         uint64        // bytes served to an IP address in GatewayQuotaPeriod, 0 is unlimited
+	GatewayQuotaPeriod   time.Duration // period of the gateway bandwidth quotas
 	privateKey           *ecdsa.PrivateKey
 }
 
@@ -98,6 +102,7 @@ func NewConfig() (c *Config) {
 		DeliverySkipCheck:    true,
 		SyncUpdateDelay:      15 * time.Second,
 		SwapAPI:              "",
+		GatewayQuotaPeriod:   time.Hour,
 	}
 
 	return
@@ -0,0 +1,238 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/susy-go/susy-graviton/metrics"
+	"github.com/susy-go/susy-graviton/swarm/log"
+)
+
+var (
+	gatewayRequestCount  = metrics.NewRegisteredCounter("api.http.gateway.request.count", nil)
+	gatewayWriteCount    = metrics.NewRegisteredCounter("api.http.gateway.write.count", nil)
+	gatewayWriteDenied   = metrics.NewRegisteredCounter("api.http.gateway.write.denied", nil)
+	gatewayQuotaExceeded = metrics.NewRegisteredCounter("api.http.gateway.quota.exceeded", nil)
+	gatewayBytesServed   = metrics.NewRegisteredMeter("api.http.gateway.bytes.served", nil)
+	gatewayClients       = metrics.NewRegisteredGauge("api.http.gateway.clients", nil)
+)
+
+// DefaultGatewayQuotaPeriod is the default period of the bandwidth quotas of
+// gateway clients
+const DefaultGatewayQuotaPeriod = time.Hour
+
+// errQuotaExceeded is returned by the writes of responses which exceed the
+// quota of the client
+var errQuotaExceeded = errors.New("bandwidth quota exceeded")
+
+// GatewayParams configures the gateway mode of the HTTP server
+type GatewayParams struct {
+	// AuthTokens are the bearer tokens of the clients which are allowed to
+	// write, writes are disabled if there are none
+	AuthTokens []string
+	// Quota is the number of bytes served to an IP address in QuotaPeriod,
+	// 0 is unlimited. Authenticated clients have no quota.
+	Quota       uint64
+	QuotaPeriod time.Duration
+}
+
+// gateway restricts the requests of a server in gateway mode
+type gateway struct {
+	params *GatewayParams
+
+	mu      sync.Mutex
+	usage   map[string]*quotaUsage // quota usage by IP address
+	swept   time.Time              // last time expired usage was removed
+	nowFunc func() time.Time
+}
+
+// quotaUsage is the number of bytes served to an IP address since start
+type quotaUsage struct {
+	bytes uint64
+	start time.Time
+}
+
+func newGateway(params *GatewayParams) *gateway {
+	if params.QuotaPeriod == 0 {
+		params.QuotaPeriod = DefaultGatewayQuotaPeriod
+	}
+	return &gateway{
+		params:  params,
+		usage:   make(map[string]*quotaUsage),
+		swept:   time.Now(),
+		nowFunc: time.Now,
+	}
+}
+
+// Handler returns a handler which serves the requests allowed by the gateway
+// with h. Writes need an auth token and the responses of other requests are
+// counted in the quota of the client IP address as they are written, they are
+// cut off once it is used up.
+func (g *gateway) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gatewayRequestCount.Inc(1)
+
+		authenticated := g.authenticated(r)
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !authenticated {
+				gatewayWriteDenied.Inc(1)
+				if len(g.params.AuthTokens) == 0 {
+					respondError(w, r, "writes are disabled on this gateway", http.StatusForbidden)
+					return
+				}
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				respondError(w, r, "writes to this gateway need an auth token", http.StatusUnauthorized)
+				return
+			}
+			gatewayWriteCount.Inc(1)
+		}
+		if authenticated || g.params.Quota == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+		if retry := g.exceeded(ip); retry > 0 {
+			gatewayQuotaExceeded.Inc(1)
+			log.Debug("gateway quota exceeded", "ruid", GetRUID(r.Context()), "ip", ip)
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(retry/time.Second)+1, 10))
+			respondError(w, r, fmt.Sprintf("bandwidth quota of %d bytes exceeded", g.params.Quota), http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(&countingResponseWriter{ResponseWriter: w, gateway: g, ip: ip}, r)
+	})
+}
+
+// authenticated returns whether the request has the bearer token of one of
+// the auth tokens
+func (g *gateway) authenticated(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := []byte(strings.TrimPrefix(auth, "Bearer "))
+	for _, t := range g.params.AuthTokens {
+		if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// exceeded returns the time until the quota of the IP address is reset if it
+// is exceeded, and 0 otherwise
+func (g *gateway) exceeded(ip string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.nowFunc()
+	u, ok := g.usage[ip]
+	if !ok || now.Sub(u.start) >= g.params.QuotaPeriod || u.bytes < g.params.Quota {
+		return 0
+	}
+	return u.start.Add(g.params.QuotaPeriod).Sub(now)
+}
+
+// reserve counts up to the given number of bytes to be served to the IP
+// address in its quota and returns the number of bytes counted, which is less
+// if the rest of the quota is less
+func (g *gateway) reserve(ip string, bytes uint64) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.nowFunc()
+	// remove the usage of the quota periods which are over
+	if now.Sub(g.swept) >= g.params.QuotaPeriod {
+		for k, u := range g.usage {
+			if now.Sub(u.start) >= g.params.QuotaPeriod {
+				delete(g.usage, k)
+			}
+		}
+		g.swept = now
+	}
+	u, ok := g.usage[ip]
+	if !ok || now.Sub(u.start) >= g.params.QuotaPeriod {
+		u = &quotaUsage{start: now}
+		g.usage[ip] = u
+	}
+	gatewayClients.Update(int64(len(g.usage)))
+	if u.bytes >= g.params.Quota {
+		return 0
+	}
+	if rest := g.params.Quota - u.bytes; bytes > rest {
+		bytes = rest
+	}
+	u.bytes += bytes
+	return bytes
+}
+
+// release gives back bytes counted in the quota of the IP address which were
+// not served
+func (g *gateway) release(ip string, bytes uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if u, ok := g.usage[ip]; ok {
+		if bytes > u.bytes {
+			bytes = u.bytes
+		}
+		u.bytes -= bytes
+	}
+}
+
+// clientIP returns the IP address of the client of the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// countingResponseWriter counts the bytes of the response body in the quota
+// of the client IP address and stops writing once it is used up
+type countingResponseWriter struct {
+	http.ResponseWriter
+	gateway *gateway
+	ip      string
+}
+
+func (w *countingResponseWriter) Write(b []byte) (int, error) {
+	allowed := w.gateway.reserve(w.ip, uint64(len(b)))
+	n, err := w.ResponseWriter.Write(b[:allowed])
+	if uint64(n) < allowed {
+		w.gateway.release(w.ip, allowed-uint64(n))
+	}
+	gatewayBytesServed.Mark(int64(n))
+	if err == nil && allowed < uint64(len(b)) {
+		gatewayQuotaExceeded.Inc(1)
+		log.Debug("gateway quota exceeded while writing", "ip", w.ip)
+		err = errQuotaExceeded
+	}
+	return n, err
+}
@@ -0,0 +1,206 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/susy-go/susy-graviton/swarm/api"
+	"github.com/susy-go/susy-graviton/swarm/testutil"
+)
+
+const testGatewayToken = "secret"
+
+func gatewayServerFunc(params *GatewayParams) func(*api.API) TestServer {
+	return func(api *api.API) TestServer {
+		return NewGatewayServer(api, "", params)
+	}
+}
+
+// gatewayRequest sends a request with the given headers to the test server
+// and returns the response with its body
+func gatewayRequest(t *testing.T, method, url string, body []byte, headers map[string]string) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, resBody
+}
+
+// gatewayUpload uploads data as the file "data" without content type through
+// the gateway with the auth token and returns the manifest hash
+func gatewayUpload(t *testing.T, srv *TestSwarmServer, data []byte) string {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	part, err := mw.CreateFormField("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	mw.Close()
+
+	res, hash := gatewayRequest(t, http.MethodPost, srv.URL+"/bzz:/", body.Bytes(), map[string]string{
+		"Authorization": "Bearer " + testGatewayToken,
+		"Content-Type":  mw.FormDataContentType(),
+	})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.StatusCode, hash)
+	}
+	return string(hash)
+}
+
+// TestGatewayWrites tests that a gateway denies writes of clients without an
+// auth token
+func TestGatewayWrites(t *testing.T) {
+	srv := NewTestSwarmServer(t, gatewayServerFunc(&GatewayParams{}), nil)
+	defer srv.Close()
+
+	res, body := gatewayRequest(t, http.MethodPost, srv.URL+"/bzz-raw:/", []byte("data"), nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusForbidden, res.StatusCode, body)
+	}
+
+	srv = NewTestSwarmServer(t, gatewayServerFunc(&GatewayParams{AuthTokens: []string{testGatewayToken}}), nil)
+	defer srv.Close()
+
+	for _, token := range []string{"", "wrong"} {
+		res, body = gatewayRequest(t, http.MethodPost, srv.URL+"/bzz-raw:/", []byte("data"), map[string]string{
+			"Authorization": "Bearer " + token,
+		})
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusUnauthorized, res.StatusCode, body)
+		}
+		if auth := res.Header.Get("WWW-Authenticate"); auth != "Bearer" {
+			t.Fatalf("expected WWW-Authenticate header Bearer, got %q", auth)
+		}
+	}
+	res, body = gatewayRequest(t, http.MethodPost, srv.URL+"/bzz-raw:/", []byte("data"), map[string]string{
+		"Authorization": "Bearer " + testGatewayToken,
+	})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.StatusCode, body)
+	}
+
+	// reads are allowed without a token
+	res, body = gatewayRequest(t, http.MethodGet, srv.URL+"/bzz-raw:/"+string(body), nil, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.StatusCode, body)
+	}
+	if !bytes.Equal(body, []byte("data")) {
+		t.Fatalf("expected body %q, got %q", "data", body)
+	}
+}
+
+// TestGatewayRange tests that immutable content is cached and that ranges of
+// large files are served
+func TestGatewayRange(t *testing.T) {
+	srv := NewTestSwarmServer(t, gatewayServerFunc(&GatewayParams{AuthTokens: []string{testGatewayToken}}), nil)
+	defer srv.Close()
+
+	data := testutil.RandomBytes(1, 3*getFileBufferSize)
+	hash := gatewayUpload(t, srv, data)
+
+	res, body := gatewayRequest(t, http.MethodGet, srv.URL+"/bzz:/"+hash+"/data", nil, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.StatusCode, body)
+	}
+	if !bytes.Equal(body, data) {
+		t.Fatal("content mismatch")
+	}
+	if cc := res.Header.Get("Cache-Control"); cc != "max-age=2147483648, immutable" {
+		t.Fatalf("unexpected Cache-Control header %q", cc)
+	}
+
+	res, body = gatewayRequest(t, http.MethodGet, srv.URL+"/bzz:/"+hash+"/data", nil, map[string]string{
+		"Range": "bytes=200000-200099",
+	})
+	if res.StatusCode != http.StatusPartialContent {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusPartialContent, res.StatusCode, body)
+	}
+	if !bytes.Equal(body, data[200000:200100]) {
+		t.Fatal("range content mismatch")
+	}
+	if cr := res.Header.Get("Content-Range"); cr != "bytes 200000-200099/393216" {
+		t.Fatalf("unexpected Content-Range header %q", cr)
+	}
+}
+
+// TestGatewayQuota tests that a gateway stops serving an IP address which
+// used up its quota, also within a response, and keeps serving authenticated
+// clients
+func TestGatewayQuota(t *testing.T) {
+	srv := NewTestSwarmServer(t, gatewayServerFunc(&GatewayParams{
+		AuthTokens: []string{testGatewayToken},
+		Quota:      1000,
+	}), nil)
+	defer srv.Close()
+
+	data := testutil.RandomBytes(1, 1500)
+	hash := gatewayUpload(t, srv, data)
+	url := srv.URL + "/bzz:/" + hash + "/data"
+
+	res, body := gatewayRequest(t, http.MethodGet, url, nil, map[string]string{"Range": "bytes=0-499"})
+	if res.StatusCode != http.StatusPartialContent {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusPartialContent, res.StatusCode, body)
+	}
+	// the response is cut off once the quota is used up
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	body, err = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err == nil {
+		t.Fatal("expected error reading the response over the quota")
+	}
+	if !bytes.Equal(body, data[:500]) {
+		t.Fatalf("expected the first 500 bytes of the content, got %d bytes", len(body))
+	}
+	res, body = gatewayRequest(t, http.MethodGet, url, nil, nil)
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusTooManyRequests, res.StatusCode, body)
+	}
+	if res.Header.Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After header")
+	}
+
+	res, body = gatewayRequest(t, http.MethodGet, url, nil, map[string]string{
+		"Authorization": "Bearer " + testGatewayToken,
+	})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.StatusCode, body)
+	}
+}
@@ -4,14 +4,17 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/susy-go/susy-graviton/metrics"
 	"github.com/susy-go/susy-graviton/swarm/api"
+	"github.com/susy-go/susy-graviton/swarm/chunk"
 	"github.com/susy-go/susy-graviton/swarm/log"
 	"github.com/susy-go/susy-graviton/swarm/sctx"
 	"github.com/susy-go/susy-graviton/swarm/spancontext"
+	"github.com/susy-go/susy-graviton/swarm/storage"
 	"github.com/pborman/uuid"
 )
 
@@ -72,6 +75,68 @@ func ParseURI(h http.Handler) http.Handler {
 	})
 }
 
+// InitUploadTag returns a middleware counting the upload in a tag. The tag is
+// the one given by uid in the request tag header, or a new tag named after
+// the request tag name header. Its uid is set in the response tag header.
+func InitUploadTag(a *api.API) Adapter {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				tag *chunk.Tag
+				err error
+			)
+			if v := r.Header.Get(api.TagHeaderName); v != "" {
+				uid, perr := strconv.ParseUint(v, 10, 32)
+				if perr != nil {
+					respondError(w, r, fmt.Sprintf("invalid tag %q", v), http.StatusBadRequest)
+					return
+				}
+				tag, err = a.GetTag(uint32(uid))
+			} else {
+				name := r.Header.Get(api.TagNameHeaderName)
+				if name == "" {
+					name = fmt.Sprintf("unnamed_tag_%d", time.Now().Unix())
+				}
+				tag, err = a.NewTag(name)
+			}
+			switch err {
+			case nil:
+			case api.ErrTagsDisabled:
+				// uploads are not tracked
+				h.ServeHTTP(w, r)
+				return
+			case chunk.ErrTagNotFound:
+				respondError(w, r, err.Error(), http.StatusNotFound)
+				return
+			default:
+				respondError(w, r, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			log.Debug("upload tag", "ruid", GetRUID(r.Context()), "tag", tag.Uid, "name", tag.Name)
+
+			w.Header().Set(api.TagHeaderName, strconv.FormatUint(uint64(tag.Uid), 10))
+			r = r.WithContext(sctx.SetTag(r.Context(), tag.Uid))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// InitUploadRedundancy sets the redundancy level of the upload given by the
+// request redundancy header in the request context
+func InitUploadRedundancy(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get(api.RedundancyHeaderName); v != "" {
+			level, err := strconv.ParseUint(v, 10, 8)
+			if err != nil || !storage.RedundancyLevel(level).Valid() {
+				respondError(w, r, fmt.Sprintf("invalid redundancy level %q", v), http.StatusBadRequest)
+				return
+			}
+			r = r.WithContext(sctx.SetRedundancy(r.Context(), uint8(level)))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 func InitLoggingResponseWriter(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tn := time.Now()
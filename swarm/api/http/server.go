@@ -29,6 +29,7 @@ import (
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"strconv"
@@ -41,6 +42,7 @@ import (
 	"github.com/susy-go/susy-graviton/swarm/log"
 	"github.com/susy-go/susy-graviton/swarm/storage"
 	"github.com/susy-go/susy-graviton/swarm/storage/feed"
+	"github.com/susy-go/susy-graviton/swarm/storage/feed/lookup"
 	"github.com/rs/cors"
 )
 
@@ -58,6 +60,12 @@ var (
 	getFileFail     = metrics.NewRegisteredCounter("api.http.get.file.fail", nil)
 	getListCount    = metrics.NewRegisteredCounter("api.http.get.list.count", nil)
 	getListFail     = metrics.NewRegisteredCounter("api.http.get.list.fail", nil)
+	pinCount        = metrics.NewRegisteredCounter("api.http.pin.count", nil)
+	pinFail         = metrics.NewRegisteredCounter("api.http.pin.fail", nil)
+	unpinCount      = metrics.NewRegisteredCounter("api.http.unpin.count", nil)
+	unpinFail       = metrics.NewRegisteredCounter("api.http.unpin.fail", nil)
+	accessCount     = metrics.NewRegisteredCounter("api.http.access.count", nil)
+	accessFail      = metrics.NewRegisteredCounter("api.http.access.fail", nil)
 )
 
 type methodHandler map[string]http.Handler
@@ -72,6 +80,13 @@ func (m methodHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 }
 
 func NewServer(api *api.API, corsString string) *Server {
+	return NewGatewayServer(api, corsString, nil)
+}
+
+// NewGatewayServer creates a server which runs in gateway mode if gatewayParams is
+// not nil. In gateway mode writes are allowed only to the clients with an
+// auth token and bandwidth quotas are enforced per IP address.
+func NewGatewayServer(api *api.API, corsString string, gatewayParams *GatewayParams) *Server {
 	var allowedOrigins []string
 	for _, domain := range strings.Split(corsString, ",") {
 		allowedOrigins = append(allowedOrigins, strings.TrimSpace(domain))
@@ -94,6 +109,17 @@ func NewServer(api *api.API, corsString string) *Server {
 		InstrumentOpenTracing,
 	}
 
+	uploadMiddlewares := []Adapter{
+		RecoverPanic,
+		SetRequestID,
+		SetRequestHost,
+		InitLoggingResponseWriter,
+		ParseURI,
+		InitUploadTag(api),
+		InitUploadRedundancy,
+		InstrumentOpenTracing,
+	}
+
 	mux := http.NewServeMux()
 	mux.Handle("/bzz:/", methodHandler{
 		"GET": Adapt(
@@ -102,7 +128,7 @@ func NewServer(api *api.API, corsString string) *Server {
 		),
 		"POST": Adapt(
 			http.HandlerFunc(server.HandlePostFiles),
-			defaultMiddlewares...,
+			uploadMiddlewares...,
 		),
 		"DELETE": Adapt(
 			http.HandlerFunc(server.HandleDelete),
@@ -116,7 +142,7 @@ func NewServer(api *api.API, corsString string) *Server {
 		),
 		"POST": Adapt(
 			http.HandlerFunc(server.HandlePostRaw),
-			defaultMiddlewares...,
+			uploadMiddlewares...,
 		),
 	})
 	mux.Handle("/bzz-immutable:/", methodHandler{
@@ -147,6 +173,40 @@ func NewServer(api *api.API, corsString string) *Server {
 			defaultMiddlewares...,
 		),
 	})
+	mux.Handle("/bzz-pin:/", methodHandler{
+		"GET": Adapt(
+			http.HandlerFunc(server.HandleGetPins),
+			defaultMiddlewares...,
+		),
+		"POST": Adapt(
+			http.HandlerFunc(server.HandlePin),
+			defaultMiddlewares...,
+		),
+		"DELETE": Adapt(
+			http.HandlerFunc(server.HandleUnpin),
+			defaultMiddlewares...,
+		),
+	})
+	mux.Handle("/bzz-access:/", methodHandler{
+		"POST": Adapt(
+			http.HandlerFunc(server.HandlePostAccess),
+			defaultMiddlewares...,
+		),
+	})
+	mux.Handle("/tags/", methodHandler{
+		"GET": Adapt(
+			http.HandlerFunc(server.HandleGetTag),
+			RecoverPanic,
+			SetRequestID,
+			InitLoggingResponseWriter,
+		),
+		"POST": Adapt(
+			http.HandlerFunc(server.HandlePostTag),
+			RecoverPanic,
+			SetRequestID,
+			InitLoggingResponseWriter,
+		),
+	})
 
 	mux.Handle("/", methodHandler{
 		"GET": Adapt(
@@ -155,7 +215,11 @@ func NewServer(api *api.API, corsString string) *Server {
 			InitLoggingResponseWriter,
 		),
 	})
-	server.Handler = c.Handler(mux)
+	if gatewayParams != nil {
+		server.Handler = c.Handler(newGateway(gatewayParams).Handler(mux))
+	} else {
+		server.Handler = c.Handler(mux)
+	}
 
 	return server
 }
@@ -256,12 +320,19 @@ func (s *Server) HandlePostRaw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	addr, _, err := s.api.Store(r.Context(), r.Body, r.ContentLength, toEncrypt)
+	addr, wait, err := s.api.Store(r.Context(), r.Body, r.ContentLength, toEncrypt)
 	if err != nil {
 		postRawFail.Inc(1)
 		respondError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// wait for the chunks to be stored before the request context is
+	// cancelled so that all of them are counted in the upload tag
+	if err := wait(r.Context()); err != nil {
+		postRawFail.Inc(1)
+		respondError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	log.Debug("stored content", "ruid", ruid, "key", addr)
 
@@ -635,7 +706,11 @@ func (s *Server) HandleGet(w http.ResponseWriter, r *http.Request) {
 		respondError(w, r, fmt.Sprintf("cannot resolve %s: %s", uri.Addr, err), http.StatusNotFound)
 		return
 	}
-	w.Header().Set("Cache-Control", "max-age=2147483648, immutable") // url was of type bzz://<hex key>/path, so we are sure it is immutable.
+	if uri.Address() != nil {
+		w.Header().Set("Cache-Control", "max-age=2147483648, immutable") // url was of type bzz://<hex key>/path, so we are sure it is immutable.
+	} else {
+		w.Header().Set("Cache-Control", "no-cache") // url was resolved through ENS, which can change.
+	}
 
 	log.Debug("handle.get: resolved", "ruid", ruid, "key", addr)
 
@@ -701,6 +776,29 @@ func (s *Server) HandleGetList(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Debug("handle.get.list: resolved", "ruid", ruid, "key", addr)
 
+	timeLimit, hint, err := feedVersion(r.URL.Query(), "")
+	if err != nil {
+		getListFail.Inc(1)
+		respondError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// list the version of the content of feed manifests at the given time
+	addr, err = s.api.ResolveManifestVersion(r.Context(), addr, timeLimit, hint)
+	if err != nil {
+		getListFail.Inc(1)
+		respondError(w, r, fmt.Sprintf("cannot resolve feed version of %s: %s", uri.Addr, err), http.StatusNotFound)
+		return
+	}
+
+	// if a diff is requested, respond with the differences of the listed
+	// version to the diff manifest, which defaults to another version of
+	// the same feed manifest
+	query := r.URL.Query()
+	if query.Get("diff") != "" || query.Get("diff.time") != "" {
+		s.handleGetListDiff(w, r, addr, credentials)
+		return
+	}
+
 	list, err := s.api.GetManifestList(r.Context(), s.api.Decryptor(r.Context(), credentials), addr, uri.Path)
 	if err != nil {
 		getListFail.Inc(1)
@@ -736,6 +834,252 @@ func (s *Server) HandleGetList(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(&list)
 }
 
+// handleGetListDiff responds with the differences between the entries under
+// the request path of the manifest given by the "diff" query parameter at the
+// version given by "diff.time", "diff.hint.time" and "diff.hint.level", and
+// the entries of the manifest at addr
+func (s *Server) handleGetListDiff(w http.ResponseWriter, r *http.Request, addr storage.Address, credentials string) {
+	uri := GetURI(r.Context())
+	query := r.URL.Query()
+
+	from := uri.Addr
+	if query.Get("diff") != "" {
+		from = query.Get("diff")
+	}
+	fromAddr, err := s.api.Resolve(r.Context(), from)
+	if err != nil {
+		getListFail.Inc(1)
+		respondError(w, r, fmt.Sprintf("cannot resolve %s: %s", from, err), http.StatusNotFound)
+		return
+	}
+	timeLimit, hint, err := feedVersion(query, "diff.")
+	if err != nil {
+		getListFail.Inc(1)
+		respondError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fromAddr, err = s.api.ResolveManifestVersion(r.Context(), fromAddr, timeLimit, hint)
+	if err != nil {
+		getListFail.Inc(1)
+		respondError(w, r, fmt.Sprintf("cannot resolve feed version of %s: %s", from, err), http.StatusNotFound)
+		return
+	}
+
+	decrypt := s.api.Decryptor(r.Context(), credentials)
+	diff, err := s.api.DiffManifests(r.Context(), decrypt, fromAddr, addr, uri.Path)
+	if err != nil {
+		getListFail.Inc(1)
+		if isDecryptError(err) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", addr.String()))
+			respondError(w, r, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		respondError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+// feedVersion parses the time limit and lookup hint selecting a version of a
+// feed from the "time", "hint.time" and "hint.level" query parameters, each
+// name prepended with prefix
+func feedVersion(query url.Values, prefix string) (timeLimit uint64, hint lookup.Epoch, err error) {
+	if v := query.Get(prefix + "time"); v != "" {
+		if timeLimit, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return 0, hint, fmt.Errorf("invalid %stime: %s", prefix, v)
+		}
+	}
+	if v := query.Get(prefix + "hint.time"); v != "" {
+		if hint.Time, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return 0, hint, fmt.Errorf("invalid %shint.time: %s", prefix, v)
+		}
+	}
+	if v := query.Get(prefix + "hint.level"); v != "" {
+		level, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return 0, hint, fmt.Errorf("invalid %shint.level: %s", prefix, v)
+		}
+		hint.Level = uint8(level)
+	}
+	return timeLimit, hint, nil
+}
+
+// HandlePin handles a POST request to bzz-pin:/<addr>, pinning the content
+// under <addr> and everything it references in the local store
+func (s *Server) HandlePin(w http.ResponseWriter, r *http.Request) {
+	ruid := GetRUID(r.Context())
+	uri := GetURI(r.Context())
+	log.Debug("handle.pin", "ruid", ruid, "uri", uri)
+	pinCount.Inc(1)
+
+	addr, err := s.api.Resolve(r.Context(), uri.Addr)
+	if err != nil {
+		pinFail.Inc(1)
+		respondError(w, r, fmt.Sprintf("cannot resolve %s: %s", uri.Addr, err), http.StatusNotFound)
+		return
+	}
+	if err := s.api.Pin(r.Context(), addr); err != nil {
+		pinFail.Inc(1)
+		respondError(w, r, fmt.Sprintf("cannot pin %s: %s", addr, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, addr)
+}
+
+// HandleUnpin handles a DELETE request to bzz-pin:/<addr>, releasing one pin
+// of the content under <addr>
+func (s *Server) HandleUnpin(w http.ResponseWriter, r *http.Request) {
+	ruid := GetRUID(r.Context())
+	uri := GetURI(r.Context())
+	log.Debug("handle.unpin", "ruid", ruid, "uri", uri)
+	unpinCount.Inc(1)
+
+	addr, err := s.api.Resolve(r.Context(), uri.Addr)
+	if err != nil {
+		unpinFail.Inc(1)
+		respondError(w, r, fmt.Sprintf("cannot resolve %s: %s", uri.Addr, err), http.StatusNotFound)
+		return
+	}
+	if err := s.api.Unpin(r.Context(), addr); err != nil {
+		unpinFail.Inc(1)
+		if err == api.ErrNotPinned {
+			respondError(w, r, err.Error(), http.StatusNotFound)
+			return
+		}
+		respondError(w, r, fmt.Sprintf("cannot unpin %s: %s", addr, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, addr)
+}
+
+// HandleGetPins handles a GET request to bzz-pin:/ and returns the list of
+// pinned root addresses as JSON
+func (s *Server) HandleGetPins(w http.ResponseWriter, r *http.Request) {
+	log.Debug("handle.get.pins", "ruid", GetRUID(r.Context()))
+
+	pins, err := s.api.Pins()
+	if err != nil {
+		respondError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pins)
+}
+
+// HandlePostAccess handles a POST request to bzz-access:/<addr>. It applies
+// the ACT update in the JSON request body to the ACT protected root access
+// manifest at <addr> with the node as the publisher, or if the path is
+// reencrypt stores an encrypted copy of the manifest at <addr> and its
+// content. The resulting manifest hash is returned as a text/plain response.
+func (s *Server) HandlePostAccess(w http.ResponseWriter, r *http.Request) {
+	ruid := GetRUID(r.Context())
+	uri := GetURI(r.Context())
+	log.Debug("handle.post.access", "ruid", ruid, "uri", uri)
+	accessCount.Inc(1)
+
+	if uri.Path != "" && uri.Path != "reencrypt" {
+		accessFail.Inc(1)
+		respondError(w, r, "access POST request path can only be empty or \"reencrypt\"", http.StatusBadRequest)
+		return
+	}
+	addr, err := s.api.Resolve(r.Context(), uri.Addr)
+	if err != nil {
+		accessFail.Inc(1)
+		respondError(w, r, fmt.Sprintf("cannot resolve %s: %s", uri.Addr, err), http.StatusNotFound)
+		return
+	}
+
+	var newAddr storage.Address
+	if uri.Path == "reencrypt" {
+		newAddr, err = s.api.Reencrypt(r.Context(), addr)
+	} else {
+		var update api.ACTUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			accessFail.Inc(1)
+			respondError(w, r, fmt.Sprintf("invalid ACT update: %s", err), http.StatusBadRequest)
+			return
+		}
+		newAddr, err = s.api.UpdateACT(r.Context(), addr, &update)
+	}
+	if err != nil {
+		accessFail.Inc(1)
+		switch {
+		case err == api.ErrDecryptDomainForbidden || err == api.ErrNotPublisher:
+			respondError(w, r, err.Error(), http.StatusForbidden)
+		case isDecryptError(err):
+			respondError(w, r, err.Error(), http.StatusUnauthorized)
+		default:
+			respondError(w, r, fmt.Sprintf("cannot update access to %s: %s", addr, err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, newAddr)
+}
+
+// HandleGetTag handles a GET request to /tags/<uid> and responds with the
+// upload tag as JSON, or to /tags/ and responds with the list of all tags
+func (s *Server) HandleGetTag(w http.ResponseWriter, r *http.Request) {
+	log.Debug("handle.get.tag", "ruid", GetRUID(r.Context()), "path", r.URL.Path)
+
+	v := strings.TrimPrefix(r.URL.Path, "/tags/")
+	if v == "" {
+		tags := s.api.Tags()
+		if tags == nil {
+			respondError(w, r, api.ErrTagsDisabled.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tags.All())
+		return
+	}
+	uid, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		respondError(w, r, fmt.Sprintf("invalid tag %q", v), http.StatusBadRequest)
+		return
+	}
+	tag, err := s.api.GetTag(uint32(uid))
+	if err != nil {
+		respondError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// HandlePostTag handles a POST request to /tags/ creating an upload tag
+// named after the tag name header and responds with the tag as JSON
+func (s *Server) HandlePostTag(w http.ResponseWriter, r *http.Request) {
+	log.Debug("handle.post.tag", "ruid", GetRUID(r.Context()))
+
+	if r.URL.Path != "/tags/" {
+		respondError(w, r, "tag POST request cannot contain a uid", http.StatusBadRequest)
+		return
+	}
+	tag, err := s.api.NewTag(r.Header.Get(api.TagNameHeaderName))
+	if err != nil {
+		respondError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(api.TagHeaderName, strconv.FormatUint(uint64(tag.Uid), 10))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
 // HandleGetFile handles a GET request to bzz://<manifest>/<path> and responds
 // with the content of the file at <path> from the given <manifest>
 func (s *Server) HandleGetFile(w http.ResponseWriter, r *http.Request) {
@@ -760,13 +1104,26 @@ func (s *Server) HandleGetFile(w http.ResponseWriter, r *http.Request) {
 			respondError(w, r, fmt.Sprintf("cannot resolve %s: %s", uri.Addr, err), http.StatusNotFound)
 			return
 		}
-	} else {
-		w.Header().Set("Cache-Control", "max-age=2147483648, immutable") // url was of type bzz://<hex key>/path, so we are sure it is immutable.
 	}
 
 	log.Debug("handle.get.file: resolved", "ruid", ruid, "key", manifestAddr)
 
-	reader, contentType, status, contentKey, err := s.api.Get(r.Context(), s.api.Decryptor(r.Context(), credentials), manifestAddr, uri.Path)
+	// feeds in the manifest resolve to their version at the given time
+	timeLimit, hint, err := feedVersion(r.URL.Query(), "")
+	if err != nil {
+		getFileFail.Inc(1)
+		respondError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reader, contentType, status, contentKey, isFeed, err := s.api.GetVersion(r.Context(), s.api.Decryptor(r.Context(), credentials), manifestAddr, uri.Path, timeLimit, hint)
+	if uri.Address() == nil {
+		w.Header().Set("Cache-Control", "no-cache") // url was resolved through ENS, which can change.
+	} else if isFeed {
+		w.Header().Set("Cache-Control", "no-cache") // the path was resolved through a feed, which is updated.
+	} else {
+		w.Header().Set("Cache-Control", "max-age=2147483648, immutable") // url was of type bzz://<hex key>/path and not resolved through a feed, so we are sure it is immutable.
+	}
 
 	etag := common.Bytes2Hex(contentKey)
 	noneMatchEtag := r.Header.Get("If-None-Match")
@@ -847,8 +1204,8 @@ const getFileBufferSize = 4 * 32 * 1024
 // bufferedReadSeeker wraps bufio.Reader to expose Seek method
 // from the provied io.ReadSeeker in newBufferedReadSeeker.
 type bufferedReadSeeker struct {
-	r io.Reader
-	s io.Seeker
+	r *bufio.Reader
+	s io.ReadSeeker
 }
 
 // newBufferedReadSeeker creates a new instance of bufferedReadSeeker,
@@ -864,8 +1221,12 @@ func (b bufferedReadSeeker) Read(p []byte) (n int, err error) {
 	return b.r.Read(p)
 }
 
+// Seek seeks the underlying io.ReadSeeker and discards the buffered data,
+// which is not at the new offset.
 func (b bufferedReadSeeker) Seek(offset int64, whence int) (int64, error) {
-	return b.s.Seek(offset, whence)
+	n, err := b.s.Seek(offset, whence)
+	b.r.Reset(b.s)
+	return n, err
 }
 
 type loggingResponseWriter struct {
@@ -24,6 +24,8 @@ import (
 	"testing"
 
 	"github.com/susy-go/susy-graviton/swarm/api"
+	"github.com/susy-go/susy-graviton/swarm/chunk"
+	"github.com/susy-go/susy-graviton/swarm/state"
 	"github.com/susy-go/susy-graviton/swarm/storage"
 	"github.com/susy-go/susy-graviton/swarm/storage/feed"
 )
@@ -46,7 +48,7 @@ func NewTestSwarmServer(t *testing.T, serverFunc func(*api.API) TestServer, reso
 		os.RemoveAll(dir)
 		t.Fatal(err)
 	}
-	fileStore := storage.NewFileStore(localStore, storage.NewFileStoreParams())
+	fileStore := storage.NewFileStore(localStore, storage.NewFileStoreParams(), chunk.NewTags())
 
 	// Swarm feeds test setup
 	feedsDir, err := ioutil.TempDir("", "swarm-feeds-test")
@@ -61,6 +63,7 @@ func NewTestSwarmServer(t *testing.T, serverFunc func(*api.API) TestServer, reso
 	}
 
 	a := api.NewAPI(fileStore, resolver, rh.Handler, nil)
+	a.SetPinning(localStore, state.NewInmemoryStore())
 	srv := httptest.NewServer(serverFunc(a))
 	tss := &TestSwarmServer{
 		Server:    srv,
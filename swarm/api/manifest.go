@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
@@ -205,6 +206,146 @@ func (m *ManifestWalker) walk(trie *manifestTrie, prefix string, walkFn WalkFn)
 	return nil
 }
 
+// ManifestDiff represents the differences between the entries of two
+// manifests, modified entries are those of the second manifest
+type ManifestDiff struct {
+	Added    []ManifestEntry `json:"added,omitempty"`
+	Removed  []ManifestEntry `json:"removed,omitempty"`
+	Modified []ManifestEntry `json:"modified,omitempty"`
+}
+
+// DiffManifests compares the entries with the given path prefix of two
+// manifests, including their submanifests. Entries are matched by path and
+// are modified if their content hash or content type differ.
+func (a *API) DiffManifests(ctx context.Context, decrypt DecryptFunc, from, to storage.Address, prefix string) (*ManifestDiff, error) {
+	fromEntries, err := a.manifestEntries(ctx, decrypt, from, prefix)
+	if err != nil {
+		return nil, err
+	}
+	toEntries, err := a.manifestEntries(ctx, decrypt, to, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ManifestDiff{}
+	for path, entry := range toEntries {
+		old, ok := fromEntries[path]
+		if !ok {
+			diff.Added = append(diff.Added, entry)
+			continue
+		}
+		if old.Hash != entry.Hash || old.ContentType != entry.ContentType {
+			diff.Modified = append(diff.Modified, entry)
+		}
+	}
+	for path, entry := range fromEntries {
+		if _, ok := toEntries[path]; !ok {
+			diff.Removed = append(diff.Removed, entry)
+		}
+	}
+	for _, entries := range [][]ManifestEntry{diff.Added, diff.Removed, diff.Modified} {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Path < entries[j].Path
+		})
+	}
+	return diff, nil
+}
+
+// manifestEntries returns the non-manifest entries with the given path prefix
+// of a manifest and its submanifests, indexed by path
+func (a *API) manifestEntries(ctx context.Context, decrypt DecryptFunc, addr storage.Address, prefix string) (map[string]ManifestEntry, error) {
+	walker, err := a.NewManifestWalker(ctx, addr, decrypt, nil)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]ManifestEntry)
+	err = walker.Walk(func(entry *ManifestEntry) error {
+		if entry.ContentType == ManifestType {
+			// only recurse into submanifests which may contain the prefix
+			if strings.HasPrefix(prefix, entry.Path) || strings.HasPrefix(entry.Path, prefix) {
+				return nil
+			}
+			return ErrSkipManifest
+		}
+		if strings.HasPrefix(entry.Path, prefix) {
+			entries[entry.Path] = *entry
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Reencrypt stores an encrypted copy of the manifest at addr and of the content
+// of all its entries and returns the address of the copy. The copy is
+// encrypted with new keys, so the references of the original do not decrypt it.
+// As the address is the decrypted reference of the content, it is only allowed
+// on localhost like decryption.
+func (a *API) Reencrypt(ctx context.Context, addr storage.Address) (storage.Address, error) {
+	if !decryptAllowed(ctx) {
+		return nil, ErrDecryptDomainForbidden
+	}
+	entries, err := a.manifestEntries(ctx, NOOPDecrypt, addr, "")
+	if err != nil {
+		return nil, err
+	}
+	manifestAddr, err := a.NewManifest(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	mw, err := a.NewManifestWriter(ctx, manifestAddr, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		reader, _ := a.Retrieve(ctx, storage.Address(common.Hex2Bytes(entry.Hash)))
+		size, err := reader.Size(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving %q: %v", entry.Path, err)
+		}
+		entry.Hash = ""
+		entry.Size = size
+		if _, err := mw.AddEntry(ctx, io.NewSectionReader(reader, 0, size), &entry); err != nil {
+			return nil, err
+		}
+	}
+	return mw.Store()
+}
+
+// getManifest retrieves the manifest at addr as it is stored, without
+// loading its submanifests
+func (a *API) getManifest(ctx context.Context, addr storage.Address) (*Manifest, error) {
+	reader, _ := a.Retrieve(ctx, addr)
+	size, err := reader.Size(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Manifest not Found")
+	}
+	if size > manifestSizeLimit {
+		return nil, fmt.Errorf("Manifest size of %v bytes exceeds the %v byte limit", size, manifestSizeLimit)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(io.NewSectionReader(reader, 0, size)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("Manifest %v is malformed: %v", addr.Log(), err)
+	}
+	return &manifest, nil
+}
+
+// putManifest stores the manifest unencrypted and returns its address
+func (a *API) putManifest(ctx context.Context, manifest *Manifest) (storage.Address, error) {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	addr, wait, err := a.Store(ctx, bytes.NewReader(data), int64(len(data)), false)
+	if err != nil {
+		return nil, err
+	}
+	err = wait(ctx)
+	return addr, err
+}
+
 type manifestTrie struct {
 	fileStore *storage.FileStore
 	entries   [257]*manifestTrieEntry // indexed by first character of basePath, entries[256] is the empty basePath entry
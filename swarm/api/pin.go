@@ -0,0 +1,317 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/swarm/log"
+	"github.com/susy-go/susy-graviton/swarm/state"
+	"github.com/susy-go/susy-graviton/swarm/storage"
+	"github.com/susy-go/susy-graviton/swarm/storage/feed"
+	"github.com/susy-go/susy-graviton/swarm/storage/feed/lookup"
+)
+
+const (
+	pinsKey      = "pins"
+	pinKeyPrefix = "pin-"
+)
+
+var (
+	// ErrPinningDisabled is returned when pinning is requested from an API
+	// without a pinning capable store
+	ErrPinningDisabled = errors.New("pinning is not enabled")
+	// ErrNotPinned is returned when unpinning content which is not pinned
+	ErrNotPinned = errors.New("content is not pinned")
+)
+
+// PinInfo describes a pinned root address
+type PinInfo struct {
+	Address storage.Address `json:"address"`
+	Counter uint64          `json:"counter"`
+	Chunks  int             `json:"chunks"`
+}
+
+// pinRecord is the persisted state of a pinned root address. The chunks
+// reachable from the root are recorded at the first pin, so that unpinning
+// releases exactly the same chunks even if a referenced feed moved on.
+type pinRecord struct {
+	Counter uint64            `json:"counter"`
+	Chunks  []storage.Address `json:"chunks"`
+}
+
+// pinning holds the store that protects chunks from garbage collection and
+// the state store keeping the pinned root addresses
+type pinning struct {
+	pinner storage.Pinner
+	store  state.Store
+	lock   sync.Mutex
+}
+
+// SetPinning enables pinning content in the given store, persisting the list
+// of pinned root addresses in the state store
+func (a *API) SetPinning(pinner storage.Pinner, store state.Store) {
+	a.pins = &pinning{
+		pinner: pinner,
+		store:  store,
+	}
+}
+
+// Pin protects every chunk reachable from the given root address from garbage
+// collection. The root can be a raw file, a manifest or a feed manifest, in
+// which case the latest update of the feed and the content it references are
+// pinned. Pinning the same root again increments its pin counter.
+func (a *API) Pin(ctx context.Context, addr storage.Address) error {
+	if a.pins == nil {
+		return ErrPinningDisabled
+	}
+	key := pinKeyPrefix + addr.Hex()
+
+	// the chunks of a new pin are retrieved without holding the lock, as they
+	// may need to be fetched from the network
+	var (
+		record pinRecord
+		chunks []storage.Address
+		walked bool
+	)
+	for {
+		a.pins.lock.Lock()
+		err := a.pins.store.Get(key, &record)
+		if err == nil || (err == state.ErrNotFound && walked) {
+			break
+		}
+		a.pins.lock.Unlock()
+		if err != state.ErrNotFound {
+			return err
+		}
+		if chunks, err = a.pinnedChunks(ctx, addr); err != nil {
+			return err
+		}
+		walked = true
+	}
+	defer a.pins.lock.Unlock()
+
+	if record.Counter == 0 {
+		record.Chunks = chunks
+	}
+	for i, chunk := range record.Chunks {
+		if err := a.pins.pinner.PinChunk(ctx, chunk); err != nil {
+			for _, pinned := range record.Chunks[:i] {
+				a.pins.pinner.UnpinChunk(ctx, pinned)
+			}
+			return fmt.Errorf("error pinning chunk %s: %v", chunk, err)
+		}
+	}
+	if record.Counter == 0 {
+		var pins []storage.Address
+		if err := a.pins.store.Get(pinsKey, &pins); err != nil && err != state.ErrNotFound {
+			return err
+		}
+		if err := a.pins.store.Put(pinsKey, append(pins, addr)); err != nil {
+			return err
+		}
+	}
+	record.Counter++
+	log.Debug("api.pin", "addr", addr, "counter", record.Counter, "chunks", len(record.Chunks))
+	return a.pins.store.Put(key, &record)
+}
+
+// Unpin releases one pin of the given root address, handing its chunks back
+// to garbage collection when the last pin is released
+func (a *API) Unpin(ctx context.Context, addr storage.Address) error {
+	if a.pins == nil {
+		return ErrPinningDisabled
+	}
+	a.pins.lock.Lock()
+	defer a.pins.lock.Unlock()
+
+	key := pinKeyPrefix + addr.Hex()
+	var record pinRecord
+	if err := a.pins.store.Get(key, &record); err != nil {
+		if err == state.ErrNotFound {
+			return ErrNotPinned
+		}
+		return err
+	}
+	for _, chunk := range record.Chunks {
+		if err := a.pins.pinner.UnpinChunk(ctx, chunk); err != nil {
+			log.Warn("api.unpin: failed to unpin chunk", "chunk", chunk, "err", err)
+		}
+	}
+	record.Counter--
+	log.Debug("api.unpin", "addr", addr, "counter", record.Counter)
+	if record.Counter > 0 {
+		return a.pins.store.Put(key, &record)
+	}
+	var pins []storage.Address
+	if err := a.pins.store.Get(pinsKey, &pins); err != nil && err != state.ErrNotFound {
+		return err
+	}
+	for i, pin := range pins {
+		if pin.Hex() == addr.Hex() {
+			pins = append(pins[:i], pins[i+1:]...)
+			break
+		}
+	}
+	if err := a.pins.store.Put(pinsKey, pins); err != nil {
+		return err
+	}
+	return a.pins.store.Delete(key)
+}
+
+// Pins lists the pinned root addresses
+func (a *API) Pins() ([]PinInfo, error) {
+	if a.pins == nil {
+		return nil, ErrPinningDisabled
+	}
+	a.pins.lock.Lock()
+	defer a.pins.lock.Unlock()
+
+	var pins []storage.Address
+	if err := a.pins.store.Get(pinsKey, &pins); err != nil && err != state.ErrNotFound {
+		return nil, err
+	}
+	infos := make([]PinInfo, 0, len(pins))
+	for _, addr := range pins {
+		var record pinRecord
+		if err := a.pins.store.Get(pinKeyPrefix+addr.Hex(), &record); err != nil {
+			return nil, err
+		}
+		infos = append(infos, PinInfo{
+			Address: addr,
+			Counter: record.Counter,
+			Chunks:  len(record.Chunks),
+		})
+	}
+	return infos, nil
+}
+
+// pinnedChunks retrieves the content under the given root address, returning
+// the addresses of all the chunks it is made of
+func (a *API) pinnedChunks(ctx context.Context, addr storage.Address) ([]storage.Address, error) {
+	recorder := newChunkRecorder(a.fileStore.ChunkStore)
+	fileStore := storage.NewFileStore(recorder, storage.NewFileStoreParams(), nil)
+	if err := a.walkChunks(ctx, fileStore, recorder, addr); err != nil {
+		return nil, err
+	}
+	return recorder.addrs, nil
+}
+
+// walkChunks reads the content under the given address through a recording
+// file store, descending into manifests and feeds
+func (a *API) walkChunks(ctx context.Context, fileStore *storage.FileStore, recorder *chunkRecorder, addr storage.Address) error {
+	trie, err := loadManifest(ctx, fileStore, addr, nil, NOOPDecrypt)
+	if err != nil {
+		// not a manifest, the root is a plain file
+		return readChunks(ctx, fileStore, addr)
+	}
+	walker := &ManifestWalker{api: a, trie: trie}
+	return walker.Walk(func(entry *ManifestEntry) error {
+		switch {
+		case entry.ContentType == ManifestType:
+			// submanifests are loaded by the walker
+			return nil
+		case entry.Access != nil:
+			return fmt.Errorf("cannot pin access controlled entry %q", entry.Path)
+		case entry.ContentType == FeedContentType:
+			return a.walkFeed(ctx, fileStore, recorder, entry.Feed)
+		case entry.Hash == "":
+			return nil
+		}
+		return readChunks(ctx, fileStore, storage.Address(common.Hex2Bytes(entry.Hash)))
+	})
+}
+
+// walkFeed records the latest update of a feed and, if the update holds a
+// swarm reference, the content it references
+func (a *API) walkFeed(ctx context.Context, fileStore *storage.FileStore, recorder *chunkRecorder, fd *feed.Feed) error {
+	if a.feed == nil || fd == nil {
+		return nil
+	}
+	if _, err := a.feed.Lookup(ctx, feed.NewQueryLatest(fd, lookup.NoClue)); err != nil {
+		return fmt.Errorf("error looking up feed %s: %v", fd.Hex(), err)
+	}
+	updateAddr, data, err := a.feed.GetContent(fd)
+	if err != nil {
+		return err
+	}
+	recorder.record(updateAddr)
+
+	if len(data) != fileStore.HashSize() && len(data) != 2*fileStore.HashSize() {
+		return nil
+	}
+	if err := a.walkChunks(ctx, fileStore, recorder, storage.Address(data)); err != nil {
+		log.Debug("api.pin: feed update is not a reference", "feed", fd.Hex(), "err", err)
+	}
+	return nil
+}
+
+// readChunks reads the whole file under the given address
+func readChunks(ctx context.Context, fileStore *storage.FileStore, addr storage.Address) error {
+	reader, _ := fileStore.Retrieve(ctx, addr)
+	size, err := reader.Size(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving %s: %v", addr, err)
+	}
+	if _, err := io.Copy(ioutil.Discard, io.NewSectionReader(reader, 0, size)); err != nil {
+		return fmt.Errorf("error retrieving %s: %v", addr, err)
+	}
+	return nil
+}
+
+// chunkRecorder is a ChunkStore recording the addresses of the chunks
+// retrieved through it
+type chunkRecorder struct {
+	storage.ChunkStore
+	addrs []storage.Address
+	seen  map[string]bool
+	lock  sync.Mutex
+}
+
+func newChunkRecorder(store storage.ChunkStore) *chunkRecorder {
+	return &chunkRecorder{
+		ChunkStore: store,
+		seen:       make(map[string]bool),
+	}
+}
+
+// Get retrieves the chunk from the wrapped store, recording its address
+func (r *chunkRecorder) Get(ctx context.Context, addr storage.Address) (storage.Chunk, error) {
+	chunk, err := r.ChunkStore.Get(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	r.record(chunk.Address())
+	return chunk, nil
+}
+
+func (r *chunkRecorder) record(addr storage.Address) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.seen[string(addr)] {
+		return
+	}
+	r.seen[string(addr)] = true
+	r.addrs = append(r.addrs, append(storage.Address{}, addr...))
+}
@@ -0,0 +1,60 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"errors"
+
+	"github.com/susy-go/susy-graviton/swarm/chunk"
+)
+
+const (
+	// TagHeaderName is the HTTP header carrying the uid of the upload tag,
+	// set on upload responses and accepted on upload requests to count the
+	// upload in an existing tag
+	TagHeaderName = "X-Swarm-Tag"
+	// TagNameHeaderName is the HTTP header naming the tag created for an upload
+	TagNameHeaderName = "X-Swarm-Tag-Name"
+)
+
+// ErrTagsDisabled is returned when tags are requested from an API whose
+// FileStore has no tag registry
+var ErrTagsDisabled = errors.New("upload tags are not enabled")
+
+// Tags returns the registry of the upload tags, or nil if the FileStore has
+// no tag registry
+func (a *API) Tags() *chunk.Tags {
+	return a.fileStore.Tags()
+}
+
+// NewTag creates an upload tag with the given name
+func (a *API) NewTag(name string) (*chunk.Tag, error) {
+	tags := a.Tags()
+	if tags == nil {
+		return nil, ErrTagsDisabled
+	}
+	return tags.New(name, 0)
+}
+
+// GetTag returns the upload tag with the uid
+func (a *API) GetTag(uid uint32) (*chunk.Tag, error) {
+	tags := a.Tags()
+	if tags == nil {
+		return nil, ErrTagsDisabled
+	}
+	return tags.Get(uid)
+}
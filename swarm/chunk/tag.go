@@ -0,0 +1,207 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package chunk
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errNA    = errors.New("not available yet")
+	errNoETA = errors.New("unable to calculate ETA")
+)
+
+// State is the state of a chunk of an upload
+type State = uint32
+
+// States of the chunks of an upload, in the order they are reached
+const (
+	StateSplit  State = iota // chunk has been produced by the chunker
+	StateStored              // chunk has been stored locally
+	StateSent                // chunk has been sent to its neighbourhood
+	StateSynced              // chunk has a receipt from its neighbourhood
+)
+
+// Tag tracks the progress of an upload through the counts of its chunks in
+// each state. The counters are updated concurrently and are read atomically.
+type Tag struct {
+	// counters are accessed atomically, they are kept at the start of the
+	// struct to ensure 64bit alignment on 32bit architectures
+	total  int64 // number of chunks of the upload, 0 until splitting is done
+	split  int64
+	stored int64
+	sent   int64
+	synced int64
+
+	Uid       uint32    // unique identifier of the tag
+	Name      string    // name of the tag given on upload
+	StartedAt time.Time // time the tag was created
+
+	address []byte // root address of the upload, set once splitting is done
+	lock    sync.RWMutex
+}
+
+// NewTag creates a tag with the given uid and name. The total number of
+// chunks may be 0 if it is not known in advance.
+func NewTag(uid uint32, name string, total int64) *Tag {
+	return &Tag{
+		Uid:       uid,
+		Name:      name,
+		StartedAt: time.Now(),
+		total:     total,
+	}
+}
+
+// Inc increments the counter of the state
+func (t *Tag) Inc(state State) {
+	atomic.AddInt64(t.counter(state), 1)
+}
+
+// Get returns the counter of the state
+func (t *Tag) Get(state State) int64 {
+	return atomic.LoadInt64(t.counter(state))
+}
+
+// Total returns the number of chunks of the upload
+func (t *Tag) Total() int64 {
+	return atomic.LoadInt64(&t.total)
+}
+
+// DoneSplit sets the root address of the upload and the total number of
+// chunks to the number of chunks split. It returns the total.
+func (t *Tag) DoneSplit(address []byte) int64 {
+	total := atomic.LoadInt64(&t.split)
+	atomic.StoreInt64(&t.total, total)
+
+	t.lock.Lock()
+	t.address = address
+	t.lock.Unlock()
+	return total
+}
+
+// Address returns the root address of the upload, or nil if splitting is
+// not done yet
+func (t *Tag) Address() []byte {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.address
+}
+
+// Done returns whether all chunks of the upload reached the state
+func (t *Tag) Done(state State) bool {
+	n, total, err := t.Status(state)
+	return err == nil && n == total
+}
+
+// Status returns the counter of the state and the total number of chunks,
+// or an error if the total is not known yet
+func (t *Tag) Status(state State) (int64, int64, error) {
+	count, total := t.Get(state), t.Total()
+	if total == 0 {
+		return count, total, errNA
+	}
+	return count, total, nil
+}
+
+// ETA returns the estimated time all chunks of the upload reach the state,
+// extrapolating from the progress since the tag was created
+func (t *Tag) ETA(state State) (time.Time, error) {
+	count, total, err := t.Status(state)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if count == 0 {
+		return time.Time{}, errNoETA
+	}
+	diff := time.Since(t.StartedAt)
+	dur := time.Duration(total) * diff / time.Duration(count)
+	return t.StartedAt.Add(dur), nil
+}
+
+// MarshalJSON encodes the tag with its counters
+func (t *Tag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&tagJSON{
+		Uid:       t.Uid,
+		Name:      t.Name,
+		Address:   hex.EncodeToString(t.Address()),
+		StartedAt: t.StartedAt,
+		Total:     t.Total(),
+		Split:     t.Get(StateSplit),
+		Stored:    t.Get(StateStored),
+		Sent:      t.Get(StateSent),
+		Synced:    t.Get(StateSynced),
+	})
+}
+
+// UnmarshalJSON decodes a tag encoded by MarshalJSON
+func (t *Tag) UnmarshalJSON(data []byte) error {
+	var v tagJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	address, err := hex.DecodeString(v.Address)
+	if err != nil {
+		return err
+	}
+	t.Uid = v.Uid
+	t.Name = v.Name
+	t.StartedAt = v.StartedAt
+	atomic.StoreInt64(&t.total, v.Total)
+	atomic.StoreInt64(&t.split, v.Split)
+	atomic.StoreInt64(&t.stored, v.Stored)
+	atomic.StoreInt64(&t.sent, v.Sent)
+	atomic.StoreInt64(&t.synced, v.Synced)
+
+	t.lock.Lock()
+	t.address = address
+	t.lock.Unlock()
+	return nil
+}
+
+// tagJSON is the JSON representation of a tag
+type tagJSON struct {
+	Uid       uint32    `json:"uid"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	Total     int64     `json:"total"`
+	Split     int64     `json:"split"`
+	Stored    int64     `json:"stored"`
+	Sent      int64     `json:"sent"`
+	Synced    int64     `json:"synced"`
+}
+
+// counter returns the counter of the state
+func (t *Tag) counter(state State) *int64 {
+	switch state {
+	case StateSplit:
+		return &t.split
+	case StateStored:
+		return &t.stored
+	case StateSent:
+		return &t.sent
+	case StateSynced:
+		return &t.synced
+	}
+	panic("unknown chunk state")
+}
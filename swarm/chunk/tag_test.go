@@ -0,0 +1,177 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package chunk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/susy-go/susy-graviton/swarm/sctx"
+)
+
+var allStates = []State{StateSplit, StateStored, StateSent, StateSynced}
+
+// TestTagConcurrentIncrements tests that the counters of a tag are safe to
+// increment concurrently
+func TestTagConcurrentIncrements(t *testing.T) {
+	tag := NewTag(1, "test", 0)
+	n := 100
+	var wg sync.WaitGroup
+	for _, state := range allStates {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(state State) {
+				defer wg.Done()
+				tag.Inc(state)
+			}(state)
+		}
+	}
+	wg.Wait()
+
+	for _, state := range allStates {
+		if got := tag.Get(state); got != int64(n) {
+			t.Fatalf("state %d: expected %d, got %d", state, n, got)
+		}
+	}
+}
+
+// TestTagStatus tests that the status of a tag is not available until the
+// total is known and that splitting sets it
+func TestTagStatus(t *testing.T) {
+	tag := NewTag(1, "test", 0)
+	for i := 0; i < 10; i++ {
+		tag.Inc(StateSplit)
+	}
+	if _, _, err := tag.Status(StateSplit); err != errNA {
+		t.Fatalf("expected error %v, got %v", errNA, err)
+	}
+	if _, err := tag.ETA(StateSplit); err != errNA {
+		t.Fatalf("expected error %v, got %v", errNA, err)
+	}
+
+	addr := []byte{1, 2, 3}
+	if total := tag.DoneSplit(addr); total != 10 {
+		t.Fatalf("expected total 10, got %d", total)
+	}
+	if !bytes.Equal(tag.Address(), addr) {
+		t.Fatalf("expected address %x, got %x", addr, tag.Address())
+	}
+	if !tag.Done(StateSplit) {
+		t.Fatal("expected splitting to be done")
+	}
+
+	tag.Inc(StateStored)
+	count, total, err := tag.Status(StateStored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || total != 10 {
+		t.Fatalf("expected 1 of 10 stored, got %d of %d", count, total)
+	}
+	if tag.Done(StateStored) {
+		t.Fatal("expected storing not to be done")
+	}
+	if _, err := tag.ETA(StateSynced); err != errNoETA {
+		t.Fatalf("expected error %v, got %v", errNoETA, err)
+	}
+	eta, err := tag.ETA(StateStored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eta.Before(time.Now()) {
+		t.Fatalf("expected ETA in the future, got %v", eta)
+	}
+}
+
+// TestTagJSON tests that a tag survives a JSON roundtrip with its counters
+func TestTagJSON(t *testing.T) {
+	tag := NewTag(42, "test", 0)
+	for i, state := range allStates {
+		for j := 0; j <= i; j++ {
+			tag.Inc(state)
+		}
+	}
+	tag.DoneSplit([]byte{1, 2, 3})
+
+	data, err := json.Marshal(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Tag
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Uid != tag.Uid || got.Name != tag.Name || !got.StartedAt.Equal(tag.StartedAt) {
+		t.Fatalf("expected tag %d %q %v, got %d %q %v", tag.Uid, tag.Name, tag.StartedAt, got.Uid, got.Name, got.StartedAt)
+	}
+	if !bytes.Equal(got.Address(), tag.Address()) {
+		t.Fatalf("expected address %x, got %x", tag.Address(), got.Address())
+	}
+	if got.Total() != tag.Total() {
+		t.Fatalf("expected total %d, got %d", tag.Total(), got.Total())
+	}
+	for _, state := range allStates {
+		if got.Get(state) != tag.Get(state) {
+			t.Fatalf("state %d: expected %d, got %d", state, tag.Get(state), got.Get(state))
+		}
+	}
+}
+
+// TestTags tests creating tags and getting them by uid and from a context
+func TestTags(t *testing.T) {
+	ts := NewTags()
+	first, err := ts.New("first", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ts.New("second", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ts.Get(first.Uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != first {
+		t.Fatalf("expected tag %d, got %d", first.Uid, got.Uid)
+	}
+	got, err = ts.GetFromContext(sctx.SetTag(context.Background(), second.Uid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != second {
+		t.Fatalf("expected tag %d, got %d", second.Uid, got.Uid)
+	}
+	if _, err := ts.GetFromContext(context.Background()); err != ErrTagNotFound {
+		t.Fatalf("expected error %v, got %v", ErrTagNotFound, err)
+	}
+
+	all := ts.All()
+	if len(all) != 2 {
+		t.Fatalf("expected 2 tags, got %d", len(all))
+	}
+
+	ts.Delete(first.Uid)
+	if _, err := ts.Get(first.Uid); err != ErrTagNotFound {
+		t.Fatalf("expected error %v, got %v", ErrTagNotFound, err)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package chunk
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/susy-go/susy-graviton/swarm/sctx"
+)
+
+var (
+	// ErrTagNotFound is returned for a tag uid not in the registry
+	ErrTagNotFound = errors.New("tag not found")
+	errTagExists   = errors.New("tag already exists")
+)
+
+// Tags is the registry of the tags of a node
+type Tags struct {
+	tags map[uint32]*Tag
+	rng  *rand.Rand
+	lock sync.RWMutex
+}
+
+// NewTags creates an empty tag registry
+func NewTags() *Tags {
+	return &Tags{
+		tags: make(map[uint32]*Tag),
+		rng:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// New creates a tag with a random uid and adds it to the registry
+func (ts *Tags) New(name string, total int64) (*Tag, error) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	// uid 0 stands for no tag in contexts
+	uid := ts.rng.Uint32()
+	if _, ok := ts.tags[uid]; ok || uid == 0 {
+		return nil, errTagExists
+	}
+	t := NewTag(uid, name, total)
+	ts.tags[uid] = t
+	return t, nil
+}
+
+// Get returns the tag with the uid
+func (ts *Tags) Get(uid uint32) (*Tag, error) {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+
+	t, ok := ts.tags[uid]
+	if !ok {
+		return nil, ErrTagNotFound
+	}
+	return t, nil
+}
+
+// GetFromContext returns the tag with the uid set in the context by
+// sctx.SetTag
+func (ts *Tags) GetFromContext(ctx context.Context) (*Tag, error) {
+	uid := sctx.GetTag(ctx)
+	if uid == 0 {
+		return nil, ErrTagNotFound
+	}
+	return ts.Get(uid)
+}
+
+// All returns the tags of the registry, in the order they were created
+func (ts *Tags) All() []*Tag {
+	ts.lock.RLock()
+	tags := make([]*Tag, 0, len(ts.tags))
+	for _, t := range ts.tags {
+		tags = append(tags, t)
+	}
+	ts.lock.RUnlock()
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].StartedAt.Before(tags[j].StartedAt)
+	})
+	return tags
+}
+
+// Delete removes the tag with the uid from the registry
+func (ts *Tags) Delete(uid uint32) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	delete(ts.tags, uid)
+}
@@ -19,6 +19,7 @@ package client
 import (
 	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"math/rand"
@@ -188,6 +189,65 @@ func TestClientHandshake(t *testing.T) {
 	}
 }
 
+// request and response through the pss api of two nodes
+func TestClientRequest(t *testing.T) {
+	clients, err := setupNetwork(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lpsc, err := NewClientWithRPC(clients[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lpsc.Close()
+	rpsc, err := NewClientWithRPC(clients[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rpsc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	topic := pss.BytesToTopic([]byte("echo"))
+	handler := func(ctx context.Context, keyid string, req []byte) ([]byte, error) {
+		if string(req) == "fail" {
+			return nil, errors.New("failed")
+		}
+		return bytes.ToUpper(req), nil
+	}
+	if err := rpsc.HandleRequests(ctx, topic, handler); err != nil {
+		t.Fatal(err)
+	}
+
+	var roaddr string
+	err = clients[1].Call(&roaddr, "pss_baseAddr")
+	if err != nil {
+		t.Fatalf("rpc get node 2 baseaddr fail: %v", err)
+	}
+	var rpubkey string
+	err = clients[1].Call(&rpubkey, "pss_getPublicKey")
+	if err != nil {
+		t.Fatalf("rpc get node 2 pubkey fail: %v", err)
+	}
+	err = clients[0].Call(nil, "pss_setPeerPublicKey", rpubkey, topic.String(), roaddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := lpsc.Request(ctx, rpubkey, topic, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != "FOO" {
+		t.Fatalf("expected response %q, got %q", "FOO", resp)
+	}
+	if _, err := lpsc.Request(ctx, rpubkey, topic, []byte("fail")); err == nil || err.Error() != "failed" {
+		t.Fatalf("expected error %q, got %v", "failed", err)
+	}
+}
+
 func setupNetwork(numnodes int) (clients []*rpc.Client, err error) {
 	nodes := make([]*simulations.Node, numnodes)
 	clients = make([]*rpc.Client, numnodes)
@@ -271,6 +331,7 @@ func newServices() adapters.Services {
 			if err != nil {
 				return nil, fmt.Errorf("handshake controller fail: %v", err)
 			}
+			pss.SetRequestController(ps, pss.NewRequestParams())
 			return ps, nil
 		},
 		"bzz": func(ctx *adapters.ServiceContext) (node.Service, error) {
@@ -0,0 +1,100 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !noclient,!noprotocol
+
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/susy-go/susy-graviton/common/hexutil"
+	"github.com/susy-go/susy-graviton/srlp"
+	"github.com/susy-go/susy-graviton/swarm/log"
+	"github.com/susy-go/susy-graviton/swarm/pss"
+)
+
+// Request sends a request on the topic through the pss node to the peer
+// with the public key or symmetric key keyid, and returns its response.
+//
+// The key must exist in the key store of the pss node. The request is
+// resent until a response arrives or the deadline of the context, or the
+// default timeout of the node if there is none, passes.
+func (c *Client) Request(ctx context.Context, keyid string, topic pss.Topic, msg []byte) ([]byte, error) {
+	var resp hexutil.Bytes
+	err := c.rpc.CallContext(ctx, &resp, "pss_request", keyid, topic.String(), hexutil.Encode(msg))
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Call sends the srlp encoding of req as a request on the topic to the peer
+// with the key keyid and decodes the response into resp
+func (c *Client) Call(ctx context.Context, keyid string, topic pss.Topic, req interface{}, resp interface{}) error {
+	msg, err := srlp.EncodeToBytes(req)
+	if err != nil {
+		return err
+	}
+	data, err := c.Request(ctx, keyid, topic, msg)
+	if err != nil {
+		return err
+	}
+	return srlp.DecodeBytes(data, resp)
+}
+
+// HandleRequests serves the requests the pss node receives on the topic
+// with the handler, until the client is closed. Typed handlers are created
+// with pss.NewTypedRequestHandler.
+func (c *Client) HandleRequests(ctx context.Context, topic pss.Topic, handler pss.RequestHandler) error {
+	msgC := make(chan pss.RequestAPIMsg)
+	sub, err := c.rpc.Subscribe(ctx, "pss", msgC, "receiveRequests", topic.String())
+	if err != nil {
+		return fmt.Errorf("pss request subscription failed: %v", err)
+	}
+	c.subs = append(c.subs, sub)
+
+	go func() {
+		for {
+			select {
+			case msg := <-msgC:
+				go c.respond(handler, msg)
+			case err := <-sub.Err():
+				if err != nil {
+					log.Warn("pss request subscription failed", "topic", topic, "err", err)
+				}
+				return
+			case <-c.quitC:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// respond serves a request with the handler and passes the response to the
+// pss node
+func (c *Client) respond(handler pss.RequestHandler, msg pss.RequestAPIMsg) {
+	var errmsg string
+	resp, err := handler(context.TODO(), msg.Key, msg.Msg)
+	if err != nil {
+		errmsg = err.Error()
+	}
+	if err := c.rpc.Call(nil, "pss_respond", msg.ID, hexutil.Bytes(resp), errmsg); err != nil {
+		log.Warn("pss response failed", "id", msg.ID, "err", err)
+	}
+}
@@ -58,4 +58,16 @@
 //
 // If it is a "new" connection, the protocol will be "run" on the remote peer, in the same manner as if it was pre-emptively added.
 //
+// REQUESTS
+//
+// The RequestController adds request and response messaging on top of pss. Requests carry an id and a prefix of the overlay address of the requester, and the response is sent back to that address prefix with the same id and the same kind of encryption as the request. Requests are resent until a response arrives or their deadline passes, and the peer serves resent requests only once.
+//
+// Requests are served by one handler per topic, which can be registered by RPC clients through `pss_receiveRequests` and `pss_respond`, and sent with `pss_request`.
+//
+// MAILBOX
+//
+// Messages for recipients which are offline can be left in their mailbox in swarm, which is implemented in the mailbox package. The messages are stored encrypted and published on a feed of the sender with a topic derived from the keys of the sender and the recipient, which the recipient follows once it is online.
+//
+// Messages are sent with `pss_mailboxSend`, and the recipient fetches them with `pss_mailboxFetch` until it acknowledges them with `pss_mailboxAck`.
+//
 package pss
@@ -0,0 +1,77 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package mailbox
+
+import (
+	"context"
+
+	"github.com/susy-go/susy-graviton/common/hexutil"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/rpc"
+)
+
+// API exposes the mailbox in the pss namespace of the RPC API
+type API struct {
+	mailbox *Mailbox
+}
+
+// NewAPI creates the RPC API of the mailbox
+func NewAPI(mailbox *Mailbox) *API {
+	return &API{mailbox: mailbox}
+}
+
+// APIs returns the RPC API descriptors of the mailbox
+func (m *Mailbox) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "pss",
+			Version:   "1.0",
+			Service:   NewAPI(m),
+			Public:    true,
+		},
+	}
+}
+
+// MailboxSend stores the message in the mailbox of the recipient with the
+// public key and returns its sequence number
+func (api *API) MailboxSend(ctx context.Context, pubkey hexutil.Bytes, msg hexutil.Bytes) (uint64, error) {
+	to, err := crypto.UnmarshalPubkey(pubkey)
+	if err != nil {
+		return 0, err
+	}
+	return api.mailbox.Send(ctx, to, msg)
+}
+
+// MailboxFetch returns the messages which were not acknowledged yet in the
+// mailbox of the sender with the public key, at most the latest 256
+func (api *API) MailboxFetch(ctx context.Context, pubkey hexutil.Bytes) ([]*Message, error) {
+	from, err := crypto.UnmarshalPubkey(pubkey)
+	if err != nil {
+		return nil, err
+	}
+	return api.mailbox.Fetch(ctx, from)
+}
+
+// MailboxAck acknowledges the messages in the mailbox of the sender with the
+// public key up to the sequence number
+func (api *API) MailboxAck(ctx context.Context, pubkey hexutil.Bytes, seq uint64) error {
+	from, err := crypto.UnmarshalPubkey(pubkey)
+	if err != nil {
+		return err
+	}
+	return api.mailbox.Ack(ctx, from, seq)
+}
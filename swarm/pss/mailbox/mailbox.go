@@ -0,0 +1,369 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package mailbox stores pss messages for offline recipients in swarm.
+//
+// The messages a sender leaves for a recipient are encrypted with a secret
+// derived from the keys of both, the address of the sender and a random nonce
+// stored with the message, and stored as swarm content. The sender
+// publishes the address of its latest message on a feed of its own, whose
+// topic is derived from the same secret, and every message refers to the
+// message before it. Once the recipient is back online, it follows the feed
+// to fetch the messages and acknowledges the ones it handled on an
+// acknowledgement feed of its own, so that they are not fetched again.
+package mailbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/common/hexutil"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/crypto/ecies"
+	"github.com/susy-go/susy-graviton/metrics"
+	"github.com/susy-go/susy-graviton/srlp"
+	"github.com/susy-go/susy-graviton/swarm/log"
+	"github.com/susy-go/susy-graviton/swarm/storage"
+	"github.com/susy-go/susy-graviton/swarm/storage/encryption"
+	"github.com/susy-go/susy-graviton/swarm/storage/feed"
+	"github.com/susy-go/susy-graviton/swarm/storage/feed/lookup"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// names the feed topics of the messages and of the acknowledgements are
+	// derived from
+	messagesTopicName = "mailbox"
+	acksTopicName     = "mailbox-ack"
+
+	// feed updates of a mailbox hold the sequence number of the latest
+	// message followed by its address
+	seqLength = 8
+
+	// the stored messages start with the nonce of their encryption key
+	nonceLength = 32
+)
+
+var (
+	ErrInvalidMessage = errors.New("invalid mailbox message")
+	ErrInvalidUpdate  = errors.New("invalid mailbox feed update")
+
+	// maxFetchMessages is the number of messages fetched at most, the
+	// sequence numbers of the feeds are set by the senders
+	maxFetchMessages uint64 = 256
+)
+
+// Message is a message fetched from a mailbox
+type Message struct {
+	Seq     uint64        `json:"seq"`
+	Time    uint64        `json:"time"`
+	Payload hexutil.Bytes `json:"payload"`
+}
+
+// message is the content stored for a message in swarm, before encryption
+type message struct {
+	Seq     uint64
+	Time    uint64
+	Prev    []byte // address of the message with the previous sequence number
+	Payload []byte
+}
+
+// Mailbox sends messages to the mailboxes of recipients and fetches the
+// messages of senders from their mailboxes
+type Mailbox struct {
+	privateKey *ecdsa.PrivateKey
+	signer     feed.Signer
+	fileStore  *storage.FileStore
+	feeds      *feed.Handler
+	sendMu     sync.Mutex // serializes the updates of the message feeds
+	ackMu      sync.Mutex // serializes the updates of the acknowledgement feeds
+}
+
+// New creates a Mailbox with the identity of the private key, which should
+// be the key of the pss node, storing messages in the file store and
+// publishing them on the feeds of the handler
+func New(privateKey *ecdsa.PrivateKey, fileStore *storage.FileStore, feeds *feed.Handler) *Mailbox {
+	return &Mailbox{
+		privateKey: privateKey,
+		signer:     feed.NewGenericSigner(privateKey),
+		fileStore:  fileStore,
+		feeds:      feeds,
+	}
+}
+
+// Send stores the payload in the mailbox of the recipient with the public
+// key and returns the sequence number of the message
+func (m *Mailbox) Send(ctx context.Context, to *ecdsa.PublicKey, payload []byte) (uint64, error) {
+	metrics.GetOrRegisterCounter("pss.mailbox.send", nil).Inc(1)
+
+	secret, err := m.secret(to)
+	if err != nil {
+		return 0, err
+	}
+	fd, err := m.messagesFeed(secret, crypto.PubkeyToAddress(m.privateKey.PublicKey))
+	if err != nil {
+		return 0, err
+	}
+
+	m.sendMu.Lock()
+	defer m.sendMu.Unlock()
+
+	var msg message
+	msg.Seq, msg.Prev, err = m.latestMessage(ctx, fd)
+	if err != nil {
+		return 0, err
+	}
+	msg.Seq++
+	msg.Time = feed.TimestampProvider.Now().Time
+	msg.Payload = payload
+
+	addr, err := m.store(ctx, secret, crypto.PubkeyToAddress(m.privateKey.PublicKey), &msg)
+	if err != nil {
+		return 0, err
+	}
+	data := make([]byte, seqLength, seqLength+len(addr))
+	binary.BigEndian.PutUint64(data, msg.Seq)
+	if err := m.publish(ctx, fd, append(data, addr...)); err != nil {
+		return 0, err
+	}
+	log.Debug("mailbox message sent", "to", crypto.PubkeyToAddress(*to), "seq", msg.Seq, "addr", addr)
+	return msg.Seq, nil
+}
+
+// Fetch returns the messages in the mailbox of the sender with the public
+// key which were not acknowledged yet, oldest first. At most maxFetchMessages
+// messages are fetched, the latest ones, older messages are not returned.
+func (m *Mailbox) Fetch(ctx context.Context, from *ecdsa.PublicKey) ([]*Message, error) {
+	metrics.GetOrRegisterCounter("pss.mailbox.fetch", nil).Inc(1)
+
+	secret, err := m.secret(from)
+	if err != nil {
+		return nil, err
+	}
+	sender := crypto.PubkeyToAddress(*from)
+	fd, err := m.messagesFeed(secret, sender)
+	if err != nil {
+		return nil, err
+	}
+	seq, addr, err := m.latestMessage(ctx, fd)
+	if err != nil {
+		return nil, err
+	}
+	acked, err := m.acked(ctx, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []*Message
+	for ; seq > acked; seq-- {
+		if uint64(len(msgs)) == maxFetchMessages {
+			log.Warn("mailbox messages not fetched", "from", sender, "count", seq-acked)
+			break
+		}
+		msg, err := m.retrieve(ctx, secret, sender, seq, addr)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append([]*Message{{
+			Seq:     msg.Seq,
+			Time:    msg.Time,
+			Payload: msg.Payload,
+		}}, msgs...)
+		addr = msg.Prev
+	}
+	return msgs, nil
+}
+
+// Ack acknowledges the messages in the mailbox of the sender with the
+// public key up to the sequence number, so that they are not fetched again
+func (m *Mailbox) Ack(ctx context.Context, from *ecdsa.PublicKey, seq uint64) error {
+	metrics.GetOrRegisterCounter("pss.mailbox.ack", nil).Inc(1)
+
+	secret, err := m.secret(from)
+	if err != nil {
+		return err
+	}
+
+	m.ackMu.Lock()
+	defer m.ackMu.Unlock()
+
+	acked, err := m.acked(ctx, secret)
+	if err != nil {
+		return err
+	}
+	if seq <= acked {
+		return nil
+	}
+	fd, err := m.acksFeed(secret)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, seqLength)
+	binary.BigEndian.PutUint64(data, seq)
+	return m.publish(ctx, fd, data)
+}
+
+// secret derives the secret shared with the peer with the public key
+func (m *Mailbox) secret(pubkey *ecdsa.PublicKey) ([]byte, error) {
+	privateKey := ecies.ImportECDSA(m.privateKey)
+	shared, err := privateKey.GenerateShared(ecies.ImportECDSAPublic(pubkey), 16, 16)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256(shared), nil
+}
+
+// messagesFeed returns the feed on which the sender publishes the messages
+// it sends to the peer it shares the secret with
+func (m *Mailbox) messagesFeed(secret []byte, sender common.Address) (*feed.Feed, error) {
+	topic, err := feed.NewTopic(messagesTopicName, secret)
+	if err != nil {
+		return nil, err
+	}
+	return &feed.Feed{Topic: topic, User: sender}, nil
+}
+
+// acksFeed returns the feed on which the node acknowledges the messages of
+// the peer it shares the secret with
+func (m *Mailbox) acksFeed(secret []byte) (*feed.Feed, error) {
+	topic, err := feed.NewTopic(acksTopicName, secret)
+	if err != nil {
+		return nil, err
+	}
+	return &feed.Feed{Topic: topic, User: m.signer.Address()}, nil
+}
+
+// latestMessage returns the sequence number and the address of the latest
+// message published on the feed, or zero if there is none
+func (m *Mailbox) latestMessage(ctx context.Context, fd *feed.Feed) (uint64, storage.Address, error) {
+	data, err := m.latest(ctx, fd)
+	if err != nil || data == nil {
+		return 0, nil, err
+	}
+	if len(data) != seqLength+storage.AddressLength {
+		return 0, nil, ErrInvalidUpdate
+	}
+	return binary.BigEndian.Uint64(data), storage.Address(data[seqLength:]), nil
+}
+
+// acked returns the sequence number up to which the node acknowledged the
+// messages of the peer it shares the secret with
+func (m *Mailbox) acked(ctx context.Context, secret []byte) (uint64, error) {
+	fd, err := m.acksFeed(secret)
+	if err != nil {
+		return 0, err
+	}
+	data, err := m.latest(ctx, fd)
+	if err != nil || data == nil {
+		return 0, err
+	}
+	if len(data) != seqLength {
+		return 0, ErrInvalidUpdate
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// latest returns the data of the latest update of the feed, or nil if the
+// feed has no updates
+func (m *Mailbox) latest(ctx context.Context, fd *feed.Feed) ([]byte, error) {
+	if _, err := m.feeds.Lookup(ctx, feed.NewQueryLatest(fd, lookup.NoClue)); err != nil {
+		if ferr, ok := err.(*feed.Error); ok && ferr.Code() == feed.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	_, data, err := m.feeds.GetContent(fd)
+	return data, err
+}
+
+// publish signs and publishes the data as the next update of the feed
+func (m *Mailbox) publish(ctx context.Context, fd *feed.Feed, data []byte) error {
+	request, err := m.feeds.NewRequest(ctx, fd)
+	if err != nil {
+		return err
+	}
+	request.SetData(data)
+	if err := request.Sign(m.signer); err != nil {
+		return err
+	}
+	_, err = m.feeds.Update(ctx, request)
+	return err
+}
+
+// store encrypts the message of the sender and stores it in swarm following
+// the nonce of its key
+func (m *Mailbox) store(ctx context.Context, secret []byte, sender common.Address, msg *message) (storage.Address, error) {
+	data, err := srlp.EncodeToBytes(msg)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	data, err = messageEncryption(secret, sender, nonce).Encrypt(data)
+	if err != nil {
+		return nil, err
+	}
+	data = append(nonce, data...)
+	addr, wait, err := m.fileStore.Store(ctx, bytes.NewReader(data), int64(len(data)), false)
+	if err != nil {
+		return nil, err
+	}
+	return addr, wait(ctx)
+}
+
+// retrieve retrieves the message of the sender with the sequence number from
+// the address and decrypts it
+func (m *Mailbox) retrieve(ctx context.Context, secret []byte, sender common.Address, seq uint64, addr storage.Address) (*message, error) {
+	if len(addr) != storage.AddressLength {
+		return nil, ErrInvalidMessage
+	}
+	reader, _ := m.fileStore.Retrieve(ctx, addr)
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving mailbox message %d: %v", seq, err)
+	}
+	if len(data) < nonceLength {
+		return nil, ErrInvalidMessage
+	}
+	data, err = messageEncryption(secret, sender, data[:nonceLength]).Decrypt(data[nonceLength:])
+	if err != nil {
+		return nil, err
+	}
+	var msg message
+	if err := srlp.DecodeBytes(data, &msg); err != nil || msg.Seq != seq {
+		return nil, ErrInvalidMessage
+	}
+	return &msg, nil
+}
+
+// messageEncryption returns the encryption of a message of the sender with
+// the nonce. The key depends on the sender, so that the messages of the two
+// peers sharing the secret have different keys, and on the random nonce, so
+// that it is unique to the message.
+func messageEncryption(secret []byte, sender common.Address, nonce []byte) encryption.Encryption {
+	key := crypto.Keccak256(secret, sender.Bytes(), nonce)
+	return encryption.New(key, 0, 0, sha3.NewLegacyKeccak256)
+}
@@ -0,0 +1,234 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package mailbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/swarm/storage"
+	"github.com/susy-go/susy-graviton/swarm/storage/feed"
+)
+
+// tickingTimeProvider advances a second on every call, so that every feed
+// update of the test is in a new epoch
+type tickingTimeProvider struct {
+	time uint64
+}
+
+func (t *tickingTimeProvider) Now() feed.Timestamp {
+	return feed.Timestamp{Time: atomic.AddUint64(&t.time, 1)}
+}
+
+// newTestMailboxes creates mailboxes for the keys which share their storage,
+// as nodes of a network would
+func newTestMailboxes(t *testing.T, keys ...*ecdsa.PrivateKey) ([]*Mailbox, func()) {
+	dir, err := ioutil.TempDir("", "swarm-mailbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileStore, err := storage.NewLocalFileStore(dir, make([]byte, 32))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	feeds, err := feed.NewTestHandler(dir, &feed.HandlerParams{})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	timeProvider := feed.TimestampProvider
+	feed.TimestampProvider = &tickingTimeProvider{time: 4200}
+
+	mailboxes := make([]*Mailbox, len(keys))
+	for i, key := range keys {
+		mailboxes[i] = New(key, fileStore, feeds.Handler)
+	}
+	return mailboxes, func() {
+		feed.TimestampProvider = timeProvider
+		feeds.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestKeys(t *testing.T, n int) []*ecdsa.PrivateKey {
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+// checkMessages checks that the messages have the sequence numbers and
+// payloads of the sent messages
+func checkMessages(msgs []*Message, seqs ...uint64) error {
+	if len(msgs) != len(seqs) {
+		return fmt.Errorf("expected %d messages, got %d", len(seqs), len(msgs))
+	}
+	for i, msg := range msgs {
+		if msg.Seq != seqs[i] {
+			return fmt.Errorf("expected message %d to have seq %d, got %d", i, seqs[i], msg.Seq)
+		}
+		if payload := []byte(fmt.Sprintf("message %d", seqs[i])); !bytes.Equal(msg.Payload, payload) {
+			return fmt.Errorf("expected message %d to have payload %q, got %q", i, payload, msg.Payload)
+		}
+	}
+	return nil
+}
+
+// TestMailbox tests that messages sent to a recipient are fetched by the
+// recipient until they are acknowledged
+func TestMailbox(t *testing.T) {
+	keys := newTestKeys(t, 3)
+	mailboxes, cleanup := newTestMailboxes(t, keys...)
+	defer cleanup()
+	sender, recipient, other := mailboxes[0], mailboxes[1], mailboxes[2]
+	ctx := context.Background()
+
+	send := func(seq uint64) {
+		n, err := sender.Send(ctx, &keys[1].PublicKey, []byte(fmt.Sprintf("message %d", seq)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != seq {
+			t.Fatalf("expected seq %d, got %d", seq, n)
+		}
+	}
+	fetch := func(mailbox *Mailbox, seqs ...uint64) {
+		msgs, err := mailbox.Fetch(ctx, &keys[0].PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkMessages(msgs, seqs...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ack := func(seq uint64) {
+		if err := recipient.Ack(ctx, &keys[0].PublicKey, seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fetch(recipient)
+	for seq := uint64(1); seq <= 3; seq++ {
+		send(seq)
+	}
+	fetch(recipient, 1, 2, 3)
+	// only the recipient can find the messages
+	fetch(other)
+
+	ack(2)
+	fetch(recipient, 3)
+	send(4)
+	fetch(recipient, 3, 4)
+
+	// acknowledging older messages is ignored
+	ack(4)
+	ack(1)
+	fetch(recipient)
+}
+
+// TestMailboxEncryption tests that the messages are stored encrypted
+func TestMailboxEncryption(t *testing.T) {
+	keys := newTestKeys(t, 2)
+	mailboxes, cleanup := newTestMailboxes(t, keys...)
+	defer cleanup()
+	sender := mailboxes[0]
+
+	secret, err := sender.secret(&keys[1].PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(keys[0].PublicKey)
+	to := crypto.PubkeyToAddress(keys[1].PublicKey)
+	payload := []byte("the content of the message")
+	store := func() (storage.Address, []byte) {
+		addr, err := sender.store(context.Background(), secret, from, &message{Seq: 1, Payload: payload})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, _ := sender.fileStore.Retrieve(context.Background(), addr)
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return addr, data
+	}
+	addr, data := store()
+	if bytes.Contains(data, payload) {
+		t.Fatal("message stored in plain text")
+	}
+
+	// the key of a message depends on a random nonce, so storing the same
+	// message again gives a different content
+	if _, other := store(); bytes.Equal(data[nonceLength:], other[nonceLength:]) {
+		t.Fatal("message stored twice with the same key")
+	}
+
+	// the key of a message depends on its sender, so that the messages of
+	// the recipient, which shares the secret, have other keys
+	if _, err := sender.retrieve(context.Background(), secret, to, 1, addr); err != ErrInvalidMessage {
+		t.Fatalf("expected error %v, got %v", ErrInvalidMessage, err)
+	}
+	if _, err := sender.retrieve(context.Background(), secret, from, 2, addr); err != ErrInvalidMessage {
+		t.Fatalf("expected error %v, got %v", ErrInvalidMessage, err)
+	}
+	msg, err := sender.retrieve(context.Background(), secret, from, 1, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg.Payload, payload) {
+		t.Fatalf("expected payload %q, got %q", payload, msg.Payload)
+	}
+}
+
+// TestMailboxFetchLimit tests that a fetch returns the latest
+// maxFetchMessages messages
+func TestMailboxFetchLimit(t *testing.T) {
+	defer func(max uint64) { maxFetchMessages = max }(maxFetchMessages)
+	maxFetchMessages = 2
+
+	keys := newTestKeys(t, 2)
+	mailboxes, cleanup := newTestMailboxes(t, keys...)
+	defer cleanup()
+	sender, recipient := mailboxes[0], mailboxes[1]
+	ctx := context.Background()
+
+	for seq := uint64(1); seq <= 3; seq++ {
+		if _, err := sender.Send(ctx, &keys[1].PublicKey, []byte(fmt.Sprintf("message %d", seq))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs, err := recipient.Fetch(ctx, &keys[0].PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkMessages(msgs, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -37,7 +37,6 @@ import (
 	"github.com/susy-go/susy-graviton/swarm/log"
 	"github.com/susy-go/susy-graviton/swarm/network"
 	"github.com/susy-go/susy-graviton/swarm/pot"
-	"github.com/susy-go/susy-graviton/swarm/storage"
 	whisper "github.com/susy-go/susy-graviton/whisper/whisperv6"
 	"golang.org/x/crypto/sha3"
 )
@@ -180,9 +179,10 @@ func NewPss(k *network.Kademlia, params *PssParams) (*Pss, error) {
 		},
 	}
 
+	// the cache digests whole messages, which can be longer than a chunk, so
+	// the hashers have to be the same plain keccak hashers the pool creates
 	for i := 0; i < hasherCount; i++ {
-		hashfunc := storage.MakeHashFunc(storage.DefaultHash)()
-		ps.hashPool.Put(hashfunc)
+		ps.hashPool.Put(sha3.NewLegacyKeccak256())
 	}
 
 	return ps, nil
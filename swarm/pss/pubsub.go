@@ -0,0 +1,87 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"github.com/susy-go/susy-graviton/p2p"
+	"github.com/susy-go/susy-graviton/swarm/network"
+	"github.com/susy-go/susy-graviton/swarm/pot"
+)
+
+// PubSub exposes raw messaging over Pss to services addressing content
+// rather than peers, such as push syncing. Topics are plain strings and
+// messages are sent unencrypted, so raw messages have to be allowed.
+type PubSub struct {
+	pss *Pss
+}
+
+// NewPubSub wraps the Pss instance in a PubSub
+func NewPubSub(p *Pss) *PubSub {
+	return &PubSub{pss: p}
+}
+
+// BaseAddr returns the overlay address of the node
+func (ps *PubSub) BaseAddr() []byte {
+	return ps.pss.BaseAddr()
+}
+
+// IsClosestTo returns whether the node is closer to addr than any of its
+// connected peers, in which case messages sent to addr end with the node
+func (ps *PubSub) IsClosestTo(addr []byte) bool {
+	closest := true
+	ps.pss.Kademlia.EachConn(addr, 255, func(p *network.Peer, _ int) bool {
+		closest = pot.ProxCmp(addr, ps.pss.BaseAddr(), p.Address()) < 0
+		return false
+	})
+	return closest
+}
+
+// InNeighbourhood returns whether the node with the overlay address over can
+// belong to the neighbourhood of addr as far as the kademlia of the node can
+// tell: it is within the neighbourhood depth of addr, or at least as close to
+// addr as the closest connected peer
+func (ps *PubSub) InNeighbourhood(addr, over []byte) bool {
+	if po, _ := network.Pof(over, addr, 0); po >= ps.pss.Kademlia.NeighbourhoodDepth() {
+		return true
+	}
+	closest := true
+	ps.pss.Kademlia.EachConn(addr, 255, func(p *network.Peer, _ int) bool {
+		closest = pot.ProxCmp(addr, over, p.Address()) <= 0
+		return false
+	})
+	return closest
+}
+
+// Register registers a handler for raw messages on the topic. If prox is
+// set, the handler receives all the messages addressed to the neighbourhood
+// of the node, not only the ones addressed to the node itself.
+// It returns the function deregistering the handler.
+func (ps *PubSub) Register(topic string, prox bool, handler func(msg []byte, p *p2p.Peer) error) func() {
+	h := NewHandler(func(msg []byte, p *p2p.Peer, _ bool, _ string) error {
+		return handler(msg, p)
+	}).WithRaw()
+	if prox {
+		h = h.WithProxBin()
+	}
+	t := BytesToTopic([]byte(topic))
+	return ps.pss.Register(&t, h)
+}
+
+// Send sends a raw message on the topic to the given overlay address
+func (ps *PubSub) Send(to []byte, topic string, msg []byte) error {
+	return ps.pss.SendRaw(PssAddress(to), BytesToTopic([]byte(topic)), msg)
+}
@@ -0,0 +1,558 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/susy-go/susy-graviton/common/hexutil"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/metrics"
+	"github.com/susy-go/susy-graviton/p2p"
+	"github.com/susy-go/susy-graviton/rpc"
+	"github.com/susy-go/susy-graviton/srlp"
+	"github.com/susy-go/susy-graviton/swarm/log"
+)
+
+const (
+	defaultRequestTimeout    = 10 * time.Second
+	defaultRequestRetries    = 2
+	defaultMaxServedRequests = 64
+)
+
+var (
+	// ErrRequestTimeout is returned if no response to a request arrived
+	// before its deadline
+	ErrRequestTimeout = errors.New("request timed out")
+	// ErrUnknownRequestKey is returned if the key of a request is neither a
+	// stored public key nor a stored symmetric key
+	ErrUnknownRequestKey = errors.New("unknown request key")
+
+	errServeLimit = errors.New("too many requests being served")
+
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// RequestError is the error a request handler of the peer failed with
+type RequestError string
+
+func (e RequestError) Error() string {
+	return string(e)
+}
+
+// requestMsg is the envelope of requests and responses. Responses have the
+// ID of the request and are sent to the From address prefix of the request.
+type requestMsg struct {
+	ID       uint64
+	Response bool
+	From     []byte
+	Payload  []byte
+	Error    string
+}
+
+// RequestHandler serves requests on a topic. The keyid is the public key of
+// the requester for asymmetric requests and the symmetric key id otherwise.
+type RequestHandler func(ctx context.Context, keyid string, req []byte) ([]byte, error)
+
+// NewTypedRequestHandler returns a request handler which decodes requests
+// into and encodes the responses from the arguments of fn, which must be of
+// the form
+//
+//   func(ctx context.Context, keyid string, req *Req) (*Resp, error)
+//
+// with request and response types which can be srlp encoded
+func NewTypedRequestHandler(fn interface{}) (RequestHandler, error) {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func || ft.NumIn() != 3 || ft.NumOut() != 2 ||
+		ft.In(0) != contextType || ft.In(1).Kind() != reflect.String || ft.In(2).Kind() != reflect.Ptr ||
+		ft.Out(1) != errorType {
+		return nil, fmt.Errorf("invalid request handler type %v", ft)
+	}
+	reqType := ft.In(2).Elem()
+	return func(ctx context.Context, keyid string, req []byte) ([]byte, error) {
+		reqv := reflect.New(reqType)
+		if err := srlp.DecodeBytes(req, reqv.Interface()); err != nil {
+			return nil, fmt.Errorf("invalid request: %v", err)
+		}
+		out := fv.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(keyid), reqv})
+		if err, _ := out[1].Interface().(error); err != nil {
+			return nil, err
+		}
+		return srlp.EncodeToBytes(out[0].Interface())
+	}, nil
+}
+
+// RequestParams are the parameters of the RequestController
+//
+// Timeout: deadline of requests whose context has no deadline, and of
+// serving requests (default 10 s)
+//
+// Retries: number of times a request is resent if no response arrives,
+// spread evenly until the deadline (default 2)
+//
+// AddressLength: number of bytes of the overlay address of the node sent
+// with requests, the responses are routed to this address prefix. Shorter
+// prefixes hide the requester in a larger neighbourhood at the cost of more
+// forwarding (default full address)
+//
+// MaxServed: number of requests served at the same time, further requests
+// are dropped until one of them is answered (default 64)
+type RequestParams struct {
+	Timeout       time.Duration
+	Retries       int
+	AddressLength int
+	MaxServed     int
+}
+
+// NewRequestParams returns the default parameters of the RequestController
+func NewRequestParams() *RequestParams {
+	return &RequestParams{
+		Timeout:       defaultRequestTimeout,
+		Retries:       defaultRequestRetries,
+		AddressLength: addressLength,
+		MaxServed:     defaultMaxServedRequests,
+	}
+}
+
+// pendingRequest is a sent request waiting for its response
+type pendingRequest struct {
+	keyid string
+	respC chan *requestMsg
+}
+
+// servedRequest is a request which is served or being served, kept until it
+// expires to answer resent requests without calling the handler again
+type servedRequest struct {
+	response  []byte // nil while the request is being served
+	expiresAt time.Time
+}
+
+// RequestController correlates requests and responses sent over pss
+type RequestController struct {
+	pss    *Pss
+	params *RequestParams
+	sem    chan struct{} // limits the requests served at the same time
+
+	mu         sync.Mutex
+	nextID     uint64
+	pending    map[uint64]*pendingRequest
+	handlers   map[Topic]*RequestHandler
+	registered map[Topic]func()
+	served     map[string]*servedRequest
+}
+
+// SetRequestController attaches a RequestController to the pss node and
+// adds its API
+//
+// Must be called before starting the pss node service
+func SetRequestController(pss *Pss, params *RequestParams) *RequestController {
+	// request ids are random so that responses can not be guessed
+	var id [8]byte
+	rand.Read(id[:])
+	ctrl := &RequestController{
+		pss:        pss,
+		params:     params,
+		sem:        make(chan struct{}, params.MaxServed),
+		nextID:     binary.BigEndian.Uint64(id[:]),
+		pending:    make(map[uint64]*pendingRequest),
+		handlers:   make(map[Topic]*RequestHandler),
+		registered: make(map[Topic]func()),
+		served:     make(map[string]*servedRequest),
+	}
+	pss.addAPI(rpc.API{
+		Namespace: "pss",
+		Version:   "1.0",
+		Service:   NewRequestAPI(ctrl),
+		Public:    true,
+	})
+	return ctrl
+}
+
+// Handle serves the requests on the topic with the handler, replacing the
+// previous handler of the topic. It returns the function removing the
+// handler.
+func (c *RequestController) Handle(topic Topic, handler RequestHandler) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listen(topic)
+	h := &handler
+	c.handlers[topic] = h
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.handlers[topic] == h {
+			delete(c.handlers, topic)
+		}
+	}
+}
+
+// Request sends a request on the topic to the peer with the public key or
+// symmetric key keyid, and returns its response. The request is resent until
+// a response arrives or the deadline of the context, or the default timeout
+// if there is none, passes.
+func (c *RequestController) Request(ctx context.Context, keyid string, topic Topic, req []byte) ([]byte, error) {
+	var send func(msg []byte) error
+	switch {
+	case c.pss.isPubKeyStored(keyid):
+		send = func(msg []byte) error { return c.pss.SendAsym(keyid, topic, msg) }
+	case c.pss.isSymKeyStored(keyid):
+		send = func(msg []byte) error { return c.pss.SendSym(keyid, topic, msg) }
+	default:
+		return nil, ErrUnknownRequestKey
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.params.Timeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+	interval := time.Until(deadline) / time.Duration(c.params.Retries+1)
+	if interval <= 0 {
+		return nil, ErrRequestTimeout
+	}
+
+	from := c.pss.BaseAddr()
+	if c.params.AddressLength < len(from) {
+		from = from[:c.params.AddressLength]
+	}
+	pending := &pendingRequest{
+		keyid: keyid,
+		respC: make(chan *requestMsg, 1),
+	}
+	c.mu.Lock()
+	c.listen(topic)
+	id := c.nextID
+	c.nextID++
+	c.pending[id] = pending
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	msg, err := srlp.EncodeToBytes(&requestMsg{
+		ID:      id,
+		From:    from,
+		Payload: req,
+	})
+	if err != nil {
+		return nil, err
+	}
+	metrics.GetOrRegisterCounter("pss.request.send", nil).Inc(1)
+	if err := send(msg); err != nil {
+		return nil, err
+	}
+
+	retry := time.NewTicker(interval)
+	defer retry.Stop()
+	for retries := 0; ; {
+		select {
+		case resp := <-pending.respC:
+			if resp.Error != "" {
+				return nil, RequestError(resp.Error)
+			}
+			return resp.Payload, nil
+		case <-retry.C:
+			if retries == c.params.Retries {
+				continue
+			}
+			retries++
+			metrics.GetOrRegisterCounter("pss.request.retry", nil).Inc(1)
+			log.Debug("resending pss request", "id", id, "topic", topic, "retry", retries)
+			if err := send(msg); err != nil {
+				return nil, err
+			}
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				metrics.GetOrRegisterCounter("pss.request.timeout", nil).Inc(1)
+				return nil, ErrRequestTimeout
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Call sends the srlp encoding of req as a request on the topic to the peer
+// with the key keyid and decodes the response into resp
+func (c *RequestController) Call(ctx context.Context, keyid string, topic Topic, req interface{}, resp interface{}) error {
+	msg, err := srlp.EncodeToBytes(req)
+	if err != nil {
+		return err
+	}
+	data, err := c.Request(ctx, keyid, topic, msg)
+	if err != nil {
+		return err
+	}
+	return srlp.DecodeBytes(data, resp)
+}
+
+// listen registers the pss handler of requests and responses on the topic
+// if it is not registered yet, must be called with the lock held
+func (c *RequestController) listen(topic Topic) {
+	if _, ok := c.registered[topic]; ok {
+		return
+	}
+	c.registered[topic] = c.pss.Register(&topic, NewHandler(func(msg []byte, p *p2p.Peer, asymmetric bool, keyid string) error {
+		return c.handle(topic, msg, asymmetric, keyid)
+	}))
+}
+
+// handle passes responses to the pending requests and serves requests
+func (c *RequestController) handle(topic Topic, payload []byte, asymmetric bool, keyid string) error {
+	var msg requestMsg
+	if err := srlp.DecodeBytes(payload, &msg); err != nil {
+		return fmt.Errorf("invalid request message: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if msg.Response {
+		pending, ok := c.pending[msg.ID]
+		if !ok || pending.keyid != keyid {
+			log.Trace("unexpected pss response", "id", msg.ID, "key", keyid)
+			return nil
+		}
+		select {
+		case pending.respC <- &msg:
+		default:
+		}
+		return nil
+	}
+
+	handler, ok := c.handlers[topic]
+	if !ok {
+		return fmt.Errorf("no request handler for topic %x", topic)
+	}
+	// resent requests are answered with the response to the first one
+	now := time.Now()
+	servedKey := fmt.Sprintf("%s:%d", keyid, msg.ID)
+	if served, ok := c.served[servedKey]; ok && now.Before(served.expiresAt) {
+		if served.response != nil && c.acquire() {
+			go func() {
+				defer c.release()
+				c.reply(topic, asymmetric, keyid, msg.From, served.response)
+			}()
+		}
+		return nil
+	}
+	for k, served := range c.served {
+		if !now.Before(served.expiresAt) {
+			delete(c.served, k)
+		}
+	}
+	// requests over the limit are dropped, they are served if they are resent
+	// once there is room
+	if !c.acquire() {
+		metrics.GetOrRegisterCounter("pss.request.drop", nil).Inc(1)
+		return errServeLimit
+	}
+	served := &servedRequest{expiresAt: now.Add(2 * c.params.Timeout)}
+	c.served[servedKey] = served
+
+	metrics.GetOrRegisterCounter("pss.request.serve", nil).Inc(1)
+	go func() {
+		defer c.release()
+		ctx, cancel := context.WithTimeout(context.Background(), c.params.Timeout)
+		defer cancel()
+		resp := &requestMsg{
+			ID:       msg.ID,
+			Response: true,
+		}
+		data, err := (*handler)(ctx, keyid, msg.Payload)
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Payload = data
+		}
+		encoded, err := srlp.EncodeToBytes(resp)
+		if err != nil {
+			log.Error("encoding pss response failed", "err", err)
+			return
+		}
+		c.mu.Lock()
+		served.response = encoded
+		c.mu.Unlock()
+		c.reply(topic, asymmetric, keyid, msg.From, encoded)
+	}()
+	return nil
+}
+
+// acquire takes a place of the requests served at the same time and returns
+// whether there was one
+func (c *RequestController) acquire() bool {
+	select {
+	case c.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees a place taken with acquire
+func (c *RequestController) release() {
+	<-c.sem
+}
+
+// reply sends the response to a request with the same kind of encryption as
+// the request, asymmetric responses are routed to the address prefix of the
+// requester
+func (c *RequestController) reply(topic Topic, asymmetric bool, keyid string, to []byte, resp []byte) {
+	var err error
+	if asymmetric {
+		err = c.replyAsym(topic, keyid, to, resp)
+	} else {
+		err = c.pss.SendSym(keyid, topic, resp)
+	}
+	if err != nil {
+		log.Warn("sending pss response failed", "topic", topic, "key", keyid, "err", err)
+	}
+}
+
+func (c *RequestController) replyAsym(topic Topic, keyid string, to []byte, resp []byte) error {
+	pubkeybytes, err := hexutil.Decode(keyid)
+	if err != nil {
+		return err
+	}
+	pubkey, err := crypto.UnmarshalPubkey(pubkeybytes)
+	if err != nil {
+		return err
+	}
+	// the address of the request only routes the response to peers which
+	// are not known yet, it must not redirect the responses to known ones
+	if _, ok := c.pss.getPeerPub(keyid, topic); !ok {
+		if err := c.pss.SetPeerPublicKey(pubkey, topic, PssAddress(to)); err != nil {
+			return err
+		}
+	}
+	return c.pss.SendAsym(keyid, topic, resp)
+}
+
+// RequestAPIMsg is a request passed to the subscribers of the RequestAPI,
+// which respond to it with its ID
+type RequestAPIMsg struct {
+	ID  uint64
+	Key string
+	Msg hexutil.Bytes
+}
+
+// requestAPIResponse is the response of a subscriber to a request
+type requestAPIResponse struct {
+	msg []byte
+	err error
+}
+
+// RequestAPI gives RPC clients access to the RequestController
+type RequestAPI struct {
+	ctrl *RequestController
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan requestAPIResponse
+}
+
+// NewRequestAPI creates the API of the RequestController
+func NewRequestAPI(ctrl *RequestController) *RequestAPI {
+	return &RequestAPI{
+		ctrl:    ctrl,
+		pending: make(map[uint64]chan requestAPIResponse),
+	}
+}
+
+// Request sends a request on the topic to the peer with the public key or
+// symmetric key keyid, and returns its response
+func (api *RequestAPI) Request(ctx context.Context, keyid string, topic Topic, msg hexutil.Bytes) (hexutil.Bytes, error) {
+	if err := validateMsg(msg); err != nil {
+		return nil, err
+	}
+	resp, err := api.ctrl.Request(ctx, keyid, topic, msg)
+	return hexutil.Bytes(resp), err
+}
+
+// ReceiveRequests creates a subscription to the requests on the topic, the
+// subscriber serves them calling Respond
+func (api *RequestAPI) ReceiveRequests(ctx context.Context, topic Topic) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, fmt.Errorf("Subscribe not supported")
+	}
+	sub := notifier.CreateSubscription()
+
+	var handler RequestHandler = func(ctx context.Context, keyid string, req []byte) ([]byte, error) {
+		respC := make(chan requestAPIResponse, 1)
+		api.mu.Lock()
+		id := api.nextID
+		api.nextID++
+		api.pending[id] = respC
+		api.mu.Unlock()
+		defer func() {
+			api.mu.Lock()
+			delete(api.pending, id)
+			api.mu.Unlock()
+		}()
+
+		if err := notifier.Notify(sub.ID, &RequestAPIMsg{ID: id, Key: keyid, Msg: req}); err != nil {
+			return nil, err
+		}
+		select {
+		case resp := <-respC:
+			return resp.msg, resp.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	remove := api.ctrl.Handle(topic, handler)
+	go func() {
+		defer remove()
+		select {
+		case err := <-sub.Err():
+			log.Debug("pss request subscription closed", "topic", topic, "err", err)
+		case <-notifier.Closed():
+		}
+	}()
+	return sub, nil
+}
+
+// Respond responds to the request with the given ID passed to a subscriber,
+// a non-empty errmsg is the error the request failed with
+func (api *RequestAPI) Respond(id uint64, msg hexutil.Bytes, errmsg string) error {
+	api.mu.Lock()
+	respC, ok := api.pending[id]
+	api.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown request %d", id)
+	}
+	resp := requestAPIResponse{msg: msg}
+	if errmsg != "" {
+		resp.err = errors.New(errmsg)
+	}
+	select {
+	case respC <- resp:
+	default:
+		return fmt.Errorf("request %d already responded to", id)
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/node"
+	"github.com/susy-go/susy-graviton/p2p"
+	"github.com/susy-go/susy-graviton/p2p/enode"
+	"github.com/susy-go/susy-graviton/p2p/simulations/adapters"
+	"github.com/susy-go/susy-graviton/rpc"
+	"github.com/susy-go/susy-graviton/srlp"
+	"github.com/susy-go/susy-graviton/swarm/network"
+	"github.com/susy-go/susy-graviton/swarm/network/simulation"
+	"github.com/susy-go/susy-graviton/swarm/state"
+)
+
+const (
+	bucketKeyPss               = simulation.BucketKey("pss")
+	bucketKeyRequestController = simulation.BucketKey("requests")
+)
+
+var (
+	echoTopic = BytesToTopic([]byte("echo"))
+	failTopic = BytesToTopic([]byte("fail"))
+	slowTopic = BytesToTopic([]byte("slow"))
+)
+
+type echoRequest struct {
+	Text string
+	N    uint64
+}
+
+type echoResponse struct {
+	Text string
+	N    uint64
+}
+
+func echoHandler(ctx context.Context, keyid string, req *echoRequest) (*echoResponse, error) {
+	return &echoResponse{
+		Text: strings.ToUpper(req.Text),
+		N:    req.N + 1,
+	}, nil
+}
+
+// requestTestService runs bzz and pss with a request controller on a
+// simulated node
+type requestTestService struct {
+	bzz *network.Bzz
+	pss *Pss
+}
+
+func (s *requestTestService) Protocols() []p2p.Protocol {
+	return append(s.bzz.Protocols(), s.pss.Protocols()...)
+}
+
+func (s *requestTestService) APIs() []rpc.API {
+	return append(s.bzz.APIs(), s.pss.APIs()...)
+}
+
+func (s *requestTestService) Start(srv *p2p.Server) error {
+	if err := s.bzz.Start(srv); err != nil {
+		return err
+	}
+	return s.pss.Start(srv)
+}
+
+func (s *requestTestService) Stop() error {
+	s.pss.Stop()
+	return s.bzz.Stop()
+}
+
+func newRequestTestService(ctx *adapters.ServiceContext, bucket *sync.Map) (node.Service, func(), error) {
+	addr := network.NewAddr(ctx.Config.Node())
+	kad := network.NewKademlia(addr.Over(), network.NewKadParams())
+	bucket.Store(simulation.BucketKeyKademlia, kad)
+
+	ps, err := NewPss(kad, NewPssParams().WithPrivateKey(ctx.Config.PrivateKey))
+	if err != nil {
+		return nil, nil, err
+	}
+	// responses are routed to a prefix of the requester address
+	params := NewRequestParams()
+	params.Timeout = 5 * time.Second
+	params.AddressLength = 2
+	ctrl := SetRequestController(ps, params)
+	bucket.Store(bucketKeyPss, ps)
+	bucket.Store(bucketKeyRequestController, ctrl)
+
+	hp := network.NewHiveParams()
+	hp.Discovery = false
+	config := &network.BzzConfig{
+		OverlayAddr:  addr.Over(),
+		UnderlayAddr: addr.Under(),
+		HiveParams:   hp,
+	}
+	bzz := network.NewBzz(config, kad, state.NewInmemoryStore(), nil, nil)
+	return &requestTestService{bzz: bzz, pss: ps}, nil, nil
+}
+
+// setRequestPeer stores the public key of the responder in the pss of the
+// requester and returns it as the key to send requests with
+func setRequestPeer(sim *simulation.Simulation, requester, responder enode.ID, topics ...Topic) (string, error) {
+	item, _ := sim.NodeItem(requester, bucketKeyPss)
+	ps := item.(*Pss)
+	item, _ = sim.NodeItem(responder, bucketKeyPss)
+	pubkey := item.(*Pss).PublicKey()
+	for _, topic := range topics {
+		if err := ps.SetPeerPublicKey(pubkey, topic, PssAddress(responder[:])); err != nil {
+			return "", err
+		}
+	}
+	return common.ToHex(crypto.FromECDSAPub(pubkey)), nil
+}
+
+// TestRequestSimulation tests that requests between nodes are
+// answered by the handlers of their topics, that resent requests are served
+// once and that requests without a response time out
+func TestRequestSimulation(t *testing.T) {
+	sim := simulation.New(map[string]simulation.ServiceFunc{
+		"pss-request": newRequestTestService,
+	})
+	defer sim.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if _, err := sim.AddNodesAndConnectFull(8); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.WaitTillHealthy(ctx); err != nil {
+		t.Fatal(err)
+	}
+	result := sim.Run(ctx, func(ctx context.Context, sim *simulation.Simulation) error {
+		ids := sim.UpNodeIDs()
+		requester, responder := ids[0], ids[len(ids)/2]
+
+		item, _ := sim.NodeItem(responder, bucketKeyRequestController)
+		server := item.(*RequestController)
+		echo, err := NewTypedRequestHandler(echoHandler)
+		if err != nil {
+			return err
+		}
+		server.Handle(echoTopic, echo)
+		server.Handle(failTopic, func(ctx context.Context, keyid string, req []byte) ([]byte, error) {
+			return nil, errors.New("failed")
+		})
+		var served int32
+		server.Handle(slowTopic, func(ctx context.Context, keyid string, req []byte) ([]byte, error) {
+			atomic.AddInt32(&served, 1)
+			time.Sleep(1500 * time.Millisecond)
+			return req, nil
+		})
+
+		keyid, err := setRequestPeer(sim, requester, responder, echoTopic, failTopic, slowTopic)
+		if err != nil {
+			return err
+		}
+		item, _ = sim.NodeItem(requester, bucketKeyRequestController)
+		client := item.(*RequestController)
+
+		var resp echoResponse
+		if err := client.Call(ctx, keyid, echoTopic, &echoRequest{Text: "foo", N: 41}, &resp); err != nil {
+			return err
+		}
+		if resp.Text != "FOO" || resp.N != 42 {
+			return fmt.Errorf("unexpected echo response %+v", resp)
+		}
+
+		_, err = client.Request(ctx, keyid, failTopic, []byte("foo"))
+		if err != RequestError("failed") {
+			return fmt.Errorf("expected request error, got %v", err)
+		}
+
+		// the request is resent while the handler is busy
+		slowCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		defer cancel()
+		data, err := client.Request(slowCtx, keyid, slowTopic, []byte("foo"))
+		if err != nil {
+			return err
+		}
+		if string(data) != "foo" {
+			return fmt.Errorf("unexpected slow response %q", data)
+		}
+		if n := atomic.LoadInt32(&served); n != 1 {
+			return fmt.Errorf("resent request served %d times", n)
+		}
+
+		// the requester has no handler of the topic
+		keyid, err = setRequestPeer(sim, responder, requester, echoTopic)
+		if err != nil {
+			return err
+		}
+		timeoutCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		_, err = server.Request(timeoutCtx, keyid, echoTopic, []byte("foo"))
+		if err != ErrRequestTimeout {
+			return fmt.Errorf("expected error %v, got %v", ErrRequestTimeout, err)
+		}
+		return nil
+	})
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+}
+
+// TestRequestUnknownKey tests that requests can only be sent with stored keys
+func TestRequestUnknownKey(t *testing.T) {
+	privkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kad := network.NewKademlia(network.RandomAddr().Over(), network.NewKadParams())
+	ps, err := NewPss(kad, NewPssParams().WithPrivateKey(privkey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl := SetRequestController(ps, NewRequestParams())
+	if _, err := ctrl.Request(context.Background(), "0x00", echoTopic, []byte("foo")); err != ErrUnknownRequestKey {
+		t.Fatalf("expected error %v, got %v", ErrUnknownRequestKey, err)
+	}
+}
+
+// TestNewTypedRequestHandler tests the checks of the handler type
+func TestNewTypedRequestHandler(t *testing.T) {
+	for _, fn := range []interface{}{
+		"foo",
+		func(ctx context.Context, req *echoRequest) (*echoResponse, error) { return nil, nil },
+		func(ctx context.Context, keyid string, req echoRequest) (*echoResponse, error) { return nil, nil },
+		func(ctx context.Context, keyid string, req *echoRequest) *echoResponse { return nil },
+	} {
+		if _, err := NewTypedRequestHandler(fn); err == nil {
+			t.Fatalf("expected error for handler %T", fn)
+		}
+	}
+	if _, err := NewTypedRequestHandler(echoHandler); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRequestServeLimit tests that requests over the limit of requests served
+// at the same time are dropped and served once they are resent
+func TestRequestServeLimit(t *testing.T) {
+	privkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kad := network.NewKademlia(network.RandomAddr().Over(), network.NewKadParams())
+	ps, err := NewPss(kad, NewPssParams().WithPrivateKey(privkey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := NewRequestParams()
+	params.MaxServed = 1
+	ctrl := SetRequestController(ps, params)
+
+	var served int32
+	unblock := make(chan struct{})
+	ctrl.Handle(slowTopic, func(ctx context.Context, keyid string, req []byte) ([]byte, error) {
+		atomic.AddInt32(&served, 1)
+		<-unblock
+		return req, nil
+	})
+	request := func(id uint64) error {
+		msg, err := srlp.EncodeToBytes(&requestMsg{ID: id, Payload: []byte("foo")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ctrl.handle(slowTopic, msg, false, "key")
+	}
+
+	if err := request(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := request(2); err != errServeLimit {
+		t.Fatalf("expected error %v, got %v", errServeLimit, err)
+	}
+	close(unblock)
+	for i := 0; ; i++ {
+		err := request(2)
+		if err == nil {
+			break
+		}
+		if err != errServeLimit || i == 100 {
+			t.Fatalf("expected the resent request to be served, got error %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; atomic.LoadInt32(&served) != 2; i++ {
+		if i == 100 {
+			t.Fatalf("expected 2 requests served, got %d", atomic.LoadInt32(&served))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRequestReplyAddress tests that responses do not change the stored
+// address of the requester
+func TestRequestReplyAddress(t *testing.T) {
+	privkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kad := network.NewKademlia(network.RandomAddr().Over(), network.NewKadParams())
+	ps, err := NewPss(kad, NewPssParams().WithPrivateKey(privkey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl := SetRequestController(ps, NewRequestParams())
+
+	peerkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyid := common.ToHex(crypto.FromECDSAPub(&peerkey.PublicKey))
+	if err := ps.SetPeerPublicKey(&peerkey.PublicKey, echoTopic, PssAddress{0x01}); err != nil {
+		t.Fatal(err)
+	}
+	ctrl.replyAsym(echoTopic, keyid, []byte{0x02}, []byte("foo"))
+	peer, ok := ps.getPeerPub(keyid, echoTopic)
+	if !ok || !bytes.Equal(peer.address, PssAddress{0x01}) {
+		t.Fatalf("expected stored address 01, got %x", peer.address)
+	}
+
+	// unknown requesters are replied to at the address of the request
+	topic := BytesToTopic([]byte("other"))
+	ctrl.replyAsym(topic, keyid, []byte{0x02}, []byte("foo"))
+	peer, ok = ps.getPeerPub(keyid, topic)
+	if !ok || !bytes.Equal(peer.address, PssAddress{0x02}) {
+		t.Fatalf("expected address 02, got %x", peer.address)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+/*
+Package pushsync implements push syncing of locally uploaded chunks.
+
+Chunks uploaded to a node only spread through pull syncing, so an upload
+completes before any of its chunks reaches the nodes responsible for storing
+them. Push syncing closes that gap: the Pusher follows the push index of the
+local store and sends every new chunk to the chunk address itself, which
+routes it through kademlia to the neighbourhood of the chunk. There the Storer
+of each node in the neighbourhood stores the chunk and replies to the origin
+with a receipt signed by its key. The first valid receipt, signed by a node
+which can belong to the neighbourhood of the chunk, marks the chunk as synced
+in the local store, taking it out of the push index; chunks without a receipt
+are sent again after a retry interval. A chunk for which the uploader
+is itself the closest node is synced as soon as it is sent.
+
+Chunks and receipts are carried as raw pss messages on dedicated topics.
+*/
+package pushsync
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/p2p"
+	"github.com/susy-go/susy-graviton/swarm/storage"
+)
+
+// Pss topics of the push sync messages
+const (
+	pssChunkTopic   = "PUSHSYNC_CHUNKS"
+	pssReceiptTopic = "PUSHSYNC_RECEIPTS"
+)
+
+// PubSub is the messaging service push syncing relies on to send chunks to
+// their neighbourhood and receipts back to the origin. It is implemented by
+// pss.PubSub.
+type PubSub interface {
+	Register(topic string, prox bool, handler func(msg []byte, p *p2p.Peer) error) func()
+	Send(to []byte, topic string, msg []byte) error
+	BaseAddr() []byte
+	IsClosestTo(addr []byte) bool
+	InNeighbourhood(addr, over []byte) bool
+}
+
+// chunkMsg carries a chunk to its neighbourhood
+type chunkMsg struct {
+	Origin []byte // overlay address of the uploader to send the receipt to
+	Addr   []byte
+	Data   []byte
+}
+
+// receiptMsg acknowledges a stored chunk, signed by the storer
+type receiptMsg struct {
+	Addr      []byte
+	Signature []byte // signature of the chunk address by the storer
+}
+
+// overlayAddr derives the overlay address of a node from its public key, the
+// same way the bzz key of a swarm node is derived
+var overlayAddr = func(pub *ecdsa.PublicKey) []byte {
+	return crypto.Keccak256(crypto.FromECDSAPub(pub))
+}
+
+// receiptHash returns the hash of the chunk address signed in receipts
+func receiptHash(addr storage.Address) []byte {
+	return crypto.Keccak256([]byte("pushsync receipt"), addr)
+}
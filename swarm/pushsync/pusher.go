@@ -0,0 +1,254 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package pushsync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/metrics"
+	"github.com/susy-go/susy-graviton/p2p"
+	"github.com/susy-go/susy-graviton/srlp"
+	"github.com/susy-go/susy-graviton/swarm/chunk"
+	"github.com/susy-go/susy-graviton/swarm/log"
+	"github.com/susy-go/susy-graviton/swarm/storage"
+	"github.com/susy-go/susy-graviton/swarm/storage/localstore"
+)
+
+// retryInterval is the time after which a chunk without a receipt is sent again
+var retryInterval = 10 * time.Second
+
+var (
+	errInvalidReceipt = errors.New("invalid receipt signature")
+	errFarReceipt     = errors.New("receipt from outside the neighbourhood of the chunk")
+)
+
+// Progress counts the chunks going through push syncing
+type Progress struct {
+	Stored uint64 `json:"stored"` // chunks stored locally and queued for push syncing
+	Sent   uint64 `json:"sent"`   // chunks sent to their neighbourhood at least once
+	Synced uint64 `json:"synced"` // chunks with a receipt from their neighbourhood
+}
+
+// pushedItem tracks a chunk sent to its neighbourhood
+type pushedItem struct {
+	sentAt time.Time  // time of the last attempt
+	sent   bool       // whether the chunk was sent successfully once
+	tag    *chunk.Tag // upload tag of the chunk, nil if not tagged
+}
+
+// Pusher sends the chunks of the local push index to their neighbourhood and
+// marks them as synced on receiving a receipt
+type Pusher struct {
+	db   *localstore.DB
+	ps   PubSub
+	tags *chunk.Tags
+
+	pushed   map[string]*pushedItem // chunks sent and waiting for a receipt
+	progress Progress
+	lock     sync.Mutex
+
+	deregister func()
+	quit       chan struct{}
+	done       chan struct{}
+}
+
+// NewPusher creates a Pusher following the push index of the local store and
+// starts push syncing. Chunks of uploads tagged in the registry are counted
+// as sent and synced in their tag.
+func NewPusher(db *localstore.DB, ps PubSub, tags *chunk.Tags) *Pusher {
+	p := &Pusher{
+		db:     db,
+		ps:     ps,
+		tags:   tags,
+		pushed: make(map[string]*pushedItem),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	p.deregister = ps.Register(pssReceiptTopic, false, p.handleReceiptMsg)
+	go p.sync()
+	return p
+}
+
+// Close stops push syncing
+func (p *Pusher) Close() {
+	close(p.quit)
+	<-p.done
+	p.deregister()
+}
+
+// Progress returns the push syncing counters of the chunks seen since the
+// Pusher started
+func (p *Pusher) Progress() Progress {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.progress
+}
+
+// sync sends the chunks of the push index, subscribing again from the start
+// of the index periodically to retry the chunks that were not synced
+func (p *Pusher) sync() {
+	defer close(p.done)
+
+	var (
+		chunks      <-chan storage.Chunk
+		unsubscribe = func() {}
+		timer       = time.NewTimer(0)
+	)
+	defer timer.Stop()
+
+	for {
+		select {
+		case ch, ok := <-chunks:
+			if !ok {
+				chunks = nil
+				continue
+			}
+			if err := p.push(ch); err != nil {
+				log.Debug("pushsync: failed to send chunk", "addr", ch.Address(), "err", err)
+			}
+
+		case <-timer.C:
+			unsubscribe()
+			chunks, unsubscribe = p.db.SubscribePush(context.Background())
+			timer.Reset(retryInterval)
+
+		case <-p.quit:
+			unsubscribe()
+			return
+		}
+	}
+}
+
+// push sends the chunk to its neighbourhood, unless it was sent recently
+func (p *Pusher) push(ch storage.Chunk) error {
+	p.lock.Lock()
+	item, ok := p.pushed[string(ch.Address())]
+	if ok && time.Since(item.sentAt) < retryInterval {
+		p.lock.Unlock()
+		return nil
+	}
+	if !ok {
+		item = &pushedItem{tag: p.tag(ch)}
+		p.pushed[string(ch.Address())] = item
+		p.progress.Stored++
+	}
+	item.sentAt = time.Now()
+	p.lock.Unlock()
+
+	msg, err := srlp.EncodeToBytes(&chunkMsg{
+		Origin: p.ps.BaseAddr(),
+		Addr:   ch.Address(),
+		Data:   ch.Data(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := p.ps.Send(ch.Address(), pssChunkTopic, msg); err != nil {
+		p.lock.Lock()
+		item.sentAt = time.Time{}
+		p.lock.Unlock()
+		return err
+	}
+	p.lock.Lock()
+	retry := item.sent
+	if !retry {
+		item.sent = true
+		p.progress.Sent++
+	}
+	p.lock.Unlock()
+
+	if retry {
+		metrics.GetOrRegisterCounter("pushsync.chunk.retry", nil).Inc(1)
+	} else {
+		metrics.GetOrRegisterCounter("pushsync.chunk.send", nil).Inc(1)
+		if item.tag != nil {
+			item.tag.Inc(chunk.StateSent)
+		}
+	}
+	// no other node of the neighbourhood is closer to the chunk, so the
+	// local store is where the chunk belongs
+	if p.ps.IsClosestTo(ch.Address()) {
+		return p.setSynced(ch.Address())
+	}
+	return nil
+}
+
+// handleReceiptMsg marks the chunk acknowledged by a valid receipt of a node in
+// its neighbourhood as synced
+func (p *Pusher) handleReceiptMsg(data []byte, _ *p2p.Peer) error {
+	var msg receiptMsg
+	if err := srlp.DecodeBytes(data, &msg); err != nil {
+		return err
+	}
+	addr := storage.Address(msg.Addr)
+	pub, err := crypto.SigToPub(receiptHash(addr), msg.Signature)
+	if err != nil {
+		return errInvalidReceipt
+	}
+	// only the nodes of the neighbourhood of the chunk are responsible for
+	// storing it, so receipts from any other node are not accepted
+	storer := overlayAddr(pub)
+	if !p.ps.InNeighbourhood(addr, storer) {
+		metrics.GetOrRegisterCounter("pushsync.receipt.far", nil).Inc(1)
+		return errFarReceipt
+	}
+
+	log.Trace("pushsync: receipt", "addr", addr, "storer", storage.Address(storer))
+	return p.setSynced(addr)
+}
+
+// setSynced marks the chunk as synced in the local store, unless it is not
+// waiting for a receipt
+func (p *Pusher) setSynced(addr storage.Address) error {
+	p.lock.Lock()
+	item, ok := p.pushed[string(addr)]
+	delete(p.pushed, string(addr))
+	p.lock.Unlock()
+	if !ok {
+		// receipt for a chunk of another node or already synced
+		return nil
+	}
+	if err := p.db.NewSetter(localstore.ModeSetSync).Set(addr); err != nil {
+		return err
+	}
+	metrics.GetOrRegisterCounter("pushsync.chunk.synced", nil).Inc(1)
+	if item.tag != nil {
+		item.tag.Inc(chunk.StateSynced)
+	}
+
+	p.lock.Lock()
+	p.progress.Synced++
+	p.lock.Unlock()
+	return nil
+}
+
+// tag returns the upload tag of the chunk, or nil if it is not tagged
+func (p *Pusher) tag(ch storage.Chunk) *chunk.Tag {
+	if p.tags == nil || ch.TagID() == 0 {
+		return nil
+	}
+	tag, err := p.tags.Get(ch.TagID())
+	if err != nil {
+		return nil
+	}
+	return tag
+}
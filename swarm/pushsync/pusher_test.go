@@ -0,0 +1,92 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package pushsync
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/p2p"
+	"github.com/susy-go/susy-graviton/srlp"
+	"github.com/susy-go/susy-graviton/swarm/storage"
+	"github.com/susy-go/susy-graviton/swarm/storage/localstore"
+)
+
+// testPubSub is a PubSub dropping the messages sent, with a single node in
+// the neighbourhood of every chunk
+type testPubSub struct {
+	neighbour []byte
+	closest   bool // whether the node is the closest to every chunk
+}
+
+func (ps *testPubSub) Register(string, bool, func([]byte, *p2p.Peer) error) func() { return func() {} }
+func (ps *testPubSub) Send([]byte, string, []byte) error                           { return nil }
+func (ps *testPubSub) BaseAddr() []byte                                            { return make([]byte, 32) }
+func (ps *testPubSub) IsClosestTo([]byte) bool                                     { return ps.closest }
+func (ps *testPubSub) InNeighbourhood(_, over []byte) bool                         { return bytes.Equal(over, ps.neighbour) }
+
+// Tests that only the receipts of nodes in the neighbourhood of a chunk mark
+// it as synced.
+func TestPusherReceiptNeighbourhood(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pushsync-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := localstore.New(dir, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	near, _ := crypto.GenerateKey()
+	far, _ := crypto.GenerateKey()
+
+	pusher := NewPusher(db, &testPubSub{neighbour: overlayAddr(&near.PublicKey)}, nil)
+	defer pusher.Close()
+
+	ch := storage.GenerateRandomChunk(4096)
+	if err := db.NewPutter(localstore.ModePutUpload).Put(ch); err != nil {
+		t.Fatal(err)
+	}
+	for pusher.Progress().Sent == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	receipt := func(key *ecdsa.PrivateKey) []byte {
+		sig, _ := crypto.Sign(receiptHash(ch.Address()), key)
+		data, _ := srlp.EncodeToBytes(&receiptMsg{Addr: ch.Address(), Signature: sig})
+		return data
+	}
+	if err := pusher.handleReceiptMsg(receipt(far), nil); err != errFarReceipt {
+		t.Fatalf("far receipt: have error %v, want %v", err, errFarReceipt)
+	}
+	if synced := pusher.Progress().Synced; synced != 0 {
+		t.Fatalf("synced after far receipt: have %d, want 0", synced)
+	}
+	if err := pusher.handleReceiptMsg(receipt(near), nil); err != nil {
+		t.Fatalf("near receipt: %v", err)
+	}
+	if synced := pusher.Progress().Synced; synced != 1 {
+		t.Fatalf("synced after near receipt: have %d, want 1", synced)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package pushsync
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/susy-go/susy-graviton/node"
+	"github.com/susy-go/susy-graviton/p2p"
+	"github.com/susy-go/susy-graviton/p2p/enode"
+	"github.com/susy-go/susy-graviton/p2p/simulations/adapters"
+	"github.com/susy-go/susy-graviton/rpc"
+	"github.com/susy-go/susy-graviton/swarm/chunk"
+	"github.com/susy-go/susy-graviton/swarm/network"
+	"github.com/susy-go/susy-graviton/swarm/network/simulation"
+	"github.com/susy-go/susy-graviton/swarm/pot"
+	"github.com/susy-go/susy-graviton/swarm/pss"
+	"github.com/susy-go/susy-graviton/swarm/state"
+	"github.com/susy-go/susy-graviton/swarm/storage"
+	"github.com/susy-go/susy-graviton/swarm/storage/localstore"
+)
+
+const (
+	bucketKeyStore  = simulation.BucketKey("store")
+	bucketKeyPusher = simulation.BucketKey("pusher")
+	bucketKeyTags   = simulation.BucketKey("tags")
+)
+
+func init() {
+	// the overlay addresses of the simulated nodes are their node IDs
+	overlayAddr = func(pub *ecdsa.PublicKey) []byte {
+		id := enode.PubkeyToIDV4(pub)
+		return id[:]
+	}
+}
+
+// dbStore stores the pushed chunks in the local store of a simulated node
+type dbStore struct {
+	db *localstore.DB
+}
+
+func (s *dbStore) Has(_ context.Context, addr storage.Address) bool {
+	_, err := s.db.NewGetter(localstore.ModeGetSync).Get(addr)
+	return err == nil
+}
+
+func (s *dbStore) Put(_ context.Context, ch storage.Chunk) error {
+	return s.db.NewPutter(localstore.ModePutSync).Put(ch)
+}
+
+// testService runs bzz and pss on a simulated node
+type testService struct {
+	bzz *network.Bzz
+	pss *pss.Pss
+}
+
+func (s *testService) Protocols() []p2p.Protocol {
+	return append(s.bzz.Protocols(), s.pss.Protocols()...)
+}
+
+func (s *testService) APIs() []rpc.API {
+	return append(s.bzz.APIs(), s.pss.APIs()...)
+}
+
+func (s *testService) Start(srv *p2p.Server) error {
+	if err := s.bzz.Start(srv); err != nil {
+		return err
+	}
+	return s.pss.Start(srv)
+}
+
+func (s *testService) Stop() error {
+	s.pss.Stop()
+	return s.bzz.Stop()
+}
+
+// newTestService sets up a node with a local store push syncing its
+// uploads through pss
+func newTestService(ctx *adapters.ServiceContext, bucket *sync.Map) (node.Service, func(), error) {
+	addr := network.NewAddr(ctx.Config.Node())
+
+	dir, err := ioutil.TempDir("", "pushsync-test")
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := localstore.New(dir, addr.Over(), nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+
+	kad := network.NewKademlia(addr.Over(), network.NewKadParams())
+	bucket.Store(simulation.BucketKeyKademlia, kad)
+
+	params := pss.NewPssParams().WithPrivateKey(ctx.Config.PrivateKey)
+	params.AllowRaw = true
+	ps, err := pss.NewPss(kad, params)
+	if err != nil {
+		db.Close()
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	pubsub := pss.NewPubSub(ps)
+
+	tags := chunk.NewTags()
+	pusher := NewPusher(db, pubsub, tags)
+	storer := NewStorer(&dbStore{db}, pubsub, ctx.Config.PrivateKey, storage.NewContentAddressValidator(storage.MakeHashFunc(storage.DefaultHash)))
+	bucket.Store(bucketKeyStore, db)
+	bucket.Store(bucketKeyPusher, pusher)
+	bucket.Store(bucketKeyTags, tags)
+
+	hp := network.NewHiveParams()
+	hp.Discovery = false
+	config := &network.BzzConfig{
+		OverlayAddr:  addr.Over(),
+		UnderlayAddr: addr.Under(),
+		HiveParams:   hp,
+	}
+	bzz := network.NewBzz(config, kad, state.NewInmemoryStore(), nil, nil)
+
+	cleanup := func() {
+		pusher.Close()
+		storer.Close()
+		db.Close()
+		os.RemoveAll(dir)
+	}
+	return &testService{bzz: bzz, pss: ps}, cleanup, nil
+}
+
+// Tests that chunks uploaded to a node are pushed to the neighbourhood of the
+// node closest to them, and are marked as synced on the uploader once
+// receipts arrive, counting them in the upload tag.
+func TestPushSyncSimulation(t *testing.T) {
+	nodes, chunks := 8, 32
+
+	sim := simulation.New(map[string]simulation.ServiceFunc{
+		"pushsync": newTestService,
+	})
+	defer sim.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if _, err := sim.AddNodesAndConnectFull(nodes); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.WaitTillHealthy(ctx); err != nil {
+		t.Fatal(err)
+	}
+	result := sim.Run(ctx, func(ctx context.Context, sim *simulation.Simulation) error {
+		ids := sim.UpNodeIDs()
+		uploader := ids[0]
+
+		item, _ := sim.NodeItem(uploader, bucketKeyTags)
+		tag, err := item.(*chunk.Tags).New("test", int64(chunks))
+		if err != nil {
+			return err
+		}
+		item, _ = sim.NodeItem(uploader, bucketKeyStore)
+		db := item.(*localstore.DB)
+		var addrs []storage.Address
+		for i := 0; i < chunks; i++ {
+			ch := storage.GenerateRandomChunk(4096).WithTagID(tag.Uid)
+			if err := db.NewPutter(localstore.ModePutUpload).Put(ch); err != nil {
+				return err
+			}
+			addrs = append(addrs, ch.Address())
+		}
+
+		// wait until all chunks are synced
+		item, _ = sim.NodeItem(uploader, bucketKeyPusher)
+		pusher := item.(*Pusher)
+		for {
+			progress := pusher.Progress()
+			if progress.Synced == uint64(chunks) {
+				if progress.Stored != uint64(chunks) || progress.Sent != uint64(chunks) {
+					return fmt.Errorf("unexpected progress %+v", progress)
+				}
+				if !tag.Done(chunk.StateSent) || !tag.Done(chunk.StateSynced) {
+					return fmt.Errorf("unexpected tag counters: sent %d, synced %d", tag.Get(chunk.StateSent), tag.Get(chunk.StateSynced))
+				}
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("synced %d of %d chunks: %v", progress.Synced, chunks, ctx.Err())
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+
+		// check every chunk reaches the neighbourhood of the node closest to
+		// it, on a node other than the uploader unless it is the closest
+		for _, addr := range addrs {
+			closest := closestNode(ids, addr)
+			item, _ := sim.NodeItem(closest, simulation.BucketKeyKademlia)
+			depth := item.(*network.Kademlia).NeighbourhoodDepth()
+			for !storedInNeighbourhood(sim, ids, uploader, closest, addr, depth) {
+				select {
+				case <-ctx.Done():
+					return fmt.Errorf("chunk %s not stored in neighbourhood of node %s: %v", addr, closest, ctx.Err())
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+		}
+		return nil
+	})
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+}
+
+// storedInNeighbourhood returns whether a node with at least depth proximity
+// to addr has the chunk in its store, the uploader only counting if it is the
+// closest node
+func storedInNeighbourhood(sim *simulation.Simulation, ids []enode.ID, uploader, closest enode.ID, addr storage.Address, depth int) bool {
+	for _, id := range ids {
+		if id == uploader && id != closest {
+			continue
+		}
+		if storage.Proximity(id[:], addr) < depth {
+			continue
+		}
+		item, _ := sim.NodeItem(id, bucketKeyStore)
+		if _, err := item.(*localstore.DB).NewGetter(localstore.ModeGetSync).Get(addr); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// closestNode returns the node with the overlay address closest to addr
+func closestNode(ids []enode.ID, addr storage.Address) enode.ID {
+	closest := ids[0]
+	for _, id := range ids[1:] {
+		if pot.ProxCmp([]byte(addr), id[:], closest[:]) < 0 {
+			closest = id
+		}
+	}
+	return closest
+}
@@ -0,0 +1,115 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package pushsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/metrics"
+	"github.com/susy-go/susy-graviton/p2p"
+	"github.com/susy-go/susy-graviton/srlp"
+	"github.com/susy-go/susy-graviton/swarm/log"
+	"github.com/susy-go/susy-graviton/swarm/storage"
+)
+
+// Store is the local chunk store the pushed chunks are kept in, implemented
+// by storage.NetStore
+type Store interface {
+	Has(ctx context.Context, addr storage.Address) bool
+	Put(ctx context.Context, ch storage.Chunk) error
+}
+
+// Storer stores the chunks pushed to the neighbourhood of the node and
+// replies to their origin with a signed receipt
+type Storer struct {
+	store      Store
+	ps         PubSub
+	key        *ecdsa.PrivateKey
+	validators []storage.ChunkValidator
+
+	deregister func()
+}
+
+// NewStorer creates a Storer accepting the pushed chunks which pass any of the
+// validators, signing the receipts with the given key
+func NewStorer(store Store, ps PubSub, key *ecdsa.PrivateKey, validators ...storage.ChunkValidator) *Storer {
+	s := &Storer{
+		store:      store,
+		ps:         ps,
+		key:        key,
+		validators: validators,
+	}
+	s.deregister = ps.Register(pssChunkTopic, true, s.handleChunkMsg)
+	return s
+}
+
+// Close stops accepting pushed chunks
+func (s *Storer) Close() {
+	s.deregister()
+}
+
+// handleChunkMsg stores a pushed chunk and sends the receipt to its origin
+func (s *Storer) handleChunkMsg(data []byte, _ *p2p.Peer) error {
+	var msg chunkMsg
+	if err := srlp.DecodeBytes(data, &msg); err != nil {
+		return err
+	}
+	// receipts have to come from other nodes of the neighbourhood
+	if bytes.Equal(msg.Origin, s.ps.BaseAddr()) {
+		return nil
+	}
+	chunk := storage.NewChunk(msg.Addr, msg.Data)
+	if !s.isValid(chunk) {
+		metrics.GetOrRegisterCounter("pushsync.chunk.invalid", nil).Inc(1)
+		return storage.ErrChunkInvalid
+	}
+	// chunks already in the store, including the ones uploaded to this node,
+	// are only acknowledged
+	if !s.store.Has(context.Background(), chunk.Address()) {
+		if err := s.store.Put(context.Background(), chunk); err != nil {
+			return err
+		}
+		log.Trace("pushsync: stored chunk", "addr", chunk.Address(), "origin", storage.Address(msg.Origin))
+	}
+
+	sig, err := crypto.Sign(receiptHash(chunk.Address()), s.key)
+	if err != nil {
+		return err
+	}
+	receipt, err := srlp.EncodeToBytes(&receiptMsg{
+		Addr:      chunk.Address(),
+		Signature: sig,
+	})
+	if err != nil {
+		return err
+	}
+	metrics.GetOrRegisterCounter("pushsync.receipt.send", nil).Inc(1)
+	return s.ps.Send(msg.Origin, pssReceiptTopic, receipt)
+}
+
+// isValid returns whether any of the validators accepts the chunk
+func (s *Storer) isValid(chunk storage.Chunk) bool {
+	for _, v := range s.validators {
+		if v.Validate(chunk) {
+			return true
+		}
+	}
+	return false
+}
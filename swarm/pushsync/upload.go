@@ -0,0 +1,84 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package pushsync
+
+import (
+	"context"
+	"sync"
+
+	"github.com/susy-go/susy-graviton/swarm/chunk"
+	"github.com/susy-go/susy-graviton/swarm/storage"
+	"github.com/susy-go/susy-graviton/swarm/storage/localstore"
+)
+
+// UploadStore is a ChunkStore for uploads, storing the chunks in the wrapped
+// store and queueing them in the push index of the Pusher's database
+type UploadStore struct {
+	storage.ChunkStore
+	db   *localstore.DB
+	tags *chunk.Tags
+	lock sync.Mutex // serialises queueing, so a chunk is queued only once
+}
+
+// NewUploadStore creates an UploadStore storing the chunks in store and
+// queueing them for push syncing in db. Chunks of uploads tagged in the
+// registry which were pushed before are counted as sent and synced in their tag.
+func NewUploadStore(store storage.ChunkStore, db *localstore.DB, tags *chunk.Tags) *UploadStore {
+	return &UploadStore{
+		ChunkStore: store,
+		db:         db,
+		tags:       tags,
+	}
+}
+
+// Put stores the chunk and queues it for push syncing, unless it is already
+// queued or was pushed before
+func (u *UploadStore) Put(ctx context.Context, ch storage.Chunk) error {
+	if err := u.ChunkStore.Put(ctx, ch); err != nil {
+		return err
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	_, err := u.db.NewGetter(localstore.ModeGetSync).Get(ch.Address())
+	switch err {
+	case storage.ErrChunkNotFound:
+		return u.db.NewPutter(localstore.ModePutUpload).Put(ch)
+	case nil:
+		// the Pusher counts the chunk in the tag of the upload it was queued
+		// with, so count it here in the tag of this upload
+		if tag := u.tag(ch); tag != nil {
+			tag.Inc(chunk.StateSent)
+			tag.Inc(chunk.StateSynced)
+		}
+		return nil
+	default:
+		return err
+	}
+}
+
+// tag returns the upload tag of the chunk, or nil if it is not tagged
+func (u *UploadStore) tag(ch storage.Chunk) *chunk.Tag {
+	if u.tags == nil || ch.TagID() == 0 {
+		return nil
+	}
+	tag, err := u.tags.Get(ch.TagID())
+	if err != nil {
+		return nil
+	}
+	return tag
+}
@@ -0,0 +1,115 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package pushsync
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/susy-go/susy-graviton/swarm/chunk"
+	"github.com/susy-go/susy-graviton/swarm/sctx"
+	"github.com/susy-go/susy-graviton/swarm/storage"
+	"github.com/susy-go/susy-graviton/swarm/storage/localstore"
+)
+
+// mapStore is an in-memory ChunkStore
+type mapStore struct {
+	chunks map[string]storage.Chunk
+	lock   sync.Mutex
+}
+
+func (m *mapStore) Put(_ context.Context, ch storage.Chunk) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.chunks[string(ch.Address())] = ch
+	return nil
+}
+
+func (m *mapStore) Get(_ context.Context, addr storage.Address) (storage.Chunk, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ch, ok := m.chunks[string(addr)]
+	if !ok {
+		return nil, storage.ErrChunkNotFound
+	}
+	return ch, nil
+}
+
+func (m *mapStore) Has(ctx context.Context, addr storage.Address) bool {
+	_, err := m.Get(ctx, addr)
+	return err == nil
+}
+
+func (m *mapStore) Close() {}
+
+// Tests that the chunks of a tagged upload stored through an UploadStore are
+// counted as sent and synced in the tag by push syncing, including the chunks
+// repeated in the upload.
+func TestUploadStoreTag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pushsync-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := localstore.New(dir, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tags := chunk.NewTags()
+	pusher := NewPusher(db, &testPubSub{closest: true}, tags)
+	defer pusher.Close()
+
+	fileStore := storage.NewFileStore(NewUploadStore(&mapStore{chunks: make(map[string]storage.Chunk)}, db, tags), storage.NewFileStoreParams(), tags)
+
+	// the upload consists of the same data chunk three times and the root
+	tag, err := tags.New("test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := sctx.SetTag(context.Background(), tag.Uid)
+	data := make([]byte, 3*4096)
+	_, wait, err := fileStore.Store(ctx, bytes.NewReader(data), int64(len(data)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if total := tag.Total(); total != 4 {
+		t.Fatalf("total mismatch: have %d, want 4", total)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !tag.Done(chunk.StateSynced) {
+		if time.Now().After(deadline) {
+			t.Fatalf("upload not synced: sent %d, synced %d of %d", tag.Get(chunk.StateSent), tag.Get(chunk.StateSynced), tag.Total())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sent := tag.Get(chunk.StateSent); sent != 4 {
+		t.Errorf("sent mismatch: have %d, want 4", sent)
+	}
+}
@@ -5,6 +5,8 @@ import "context"
 type (
 	HTTPRequestIDKey struct{}
 	requestHostKey   struct{}
+	tagKey           struct{}
+	redundancyKey    struct{}
 )
 
 func SetHost(ctx context.Context, domain string) context.Context {
@@ -18,3 +20,33 @@ func GetHost(ctx context.Context) string {
 	}
 	return ""
 }
+
+// SetTag sets the uid of the upload tag in the context
+func SetTag(ctx context.Context, uid uint32) context.Context {
+	return context.WithValue(ctx, tagKey{}, uid)
+}
+
+// GetTag returns the uid of the upload tag set in the context, or 0 if it
+// is not set
+func GetTag(ctx context.Context) uint32 {
+	v, ok := ctx.Value(tagKey{}).(uint32)
+	if ok {
+		return v
+	}
+	return 0
+}
+
+// SetRedundancy sets the redundancy level of uploads in the context
+func SetRedundancy(ctx context.Context, level uint8) context.Context {
+	return context.WithValue(ctx, redundancyKey{}, level)
+}
+
+// GetRedundancy returns the redundancy level of uploads set in the context,
+// or 0 if it is not set
+func GetRedundancy(ctx context.Context) uint8 {
+	v, ok := ctx.Value(redundancyKey{}).(uint8)
+	if ok {
+		return v
+	}
+	return 0
+}
@@ -39,6 +39,8 @@ type Item struct {
 	Data            []byte
 	AccessTimestamp int64
 	StoreTimestamp  int64
+	PinCounter      uint64
+	Tag             uint32
 	// UseMockStore is a pointer to identify
 	// an unset state of the field in Join function.
 	UseMockStore *bool
@@ -60,6 +62,12 @@ func (i Item) Merge(i2 Item) (new Item) {
 	if i.StoreTimestamp == 0 {
 		i.StoreTimestamp = i2.StoreTimestamp
 	}
+	if i.PinCounter == 0 {
+		i.PinCounter = i2.PinCounter
+	}
+	if i.Tag == 0 {
+		i.Tag = i2.Tag
+	}
 	if i.UseMockStore == nil {
 		i.UseMockStore = i2.UseMockStore
 	}
@@ -224,6 +224,9 @@ func (tc *TreeChunker) Split(ctx context.Context) (k Address, wait func(context.
 	if tc.chunkSize <= 0 {
 		panic("chunker must be initialised")
 	}
+	if tc.dataSize >= MaxSpan {
+		return nil, nil, ErrDataTooLarge
+	}
 
 	tc.runWorker(ctx)
 
@@ -410,6 +413,10 @@ func (r *LazyChunkReader) Size(ctx context.Context, quitC chan bool) (n int64, e
 		}
 		metrics.GetOrRegisterResettingTimer("lcr.getter.get", nil).UpdateSince(startTime)
 		r.chunkData = chunkData
+		// parities take the place of children in the tree chunks
+		if len(chunkData) >= 8 {
+			r.branches -= chunkData.redundancy().parities(r.branches)
+		}
 	}
 
 	s := r.chunkData.Size()
@@ -508,11 +515,29 @@ func (r *LazyChunkReader) join(ctx context.Context, b []byte, off int64, eoff in
 	end := (eoff + treeSize - 1) / treeSize
 
 	// last non-leaf chunk can be shorter than default chunk size, let's not read it further then its end
-	currentBranches := int64(len(chunkData)-8) / r.hashSize
+	// the references of parity chunks follow those of the children
+	currentBranches := int64(len(chunkData)-8)/r.hashSize - chunkData.redundancy().parities(r.chunkSize/r.hashSize)
 	if end > currentBranches {
 		end = currentBranches
 	}
 
+	// the children of tree chunks with parities are retrieved together with
+	// the parity chunks, so that missing children are reconstructed as soon
+	// as enough of them are retrieved
+	var children []ChunkData
+	if chunkData.redundancy().parities(r.chunkSize/r.hashSize) > 0 && start < end {
+		var err error
+		children, err = r.getChildren(ctx, chunkData, start, end, depth-1, treeSize/r.branches)
+		if err != nil {
+			log.Debug("lazychunkreader.join: recover", "err", err)
+			select {
+			case errC <- fmt.Errorf("chunk %v-%v not found: %v", off, off+treeSize, err):
+			case <-quitC:
+			}
+			return
+		}
+	}
+
 	wg := &sync.WaitGroup{}
 	defer wg.Wait()
 	for i := start; i < end; i++ {
@@ -532,6 +557,10 @@ func (r *LazyChunkReader) join(ctx context.Context, b []byte, off int64, eoff in
 		wg.Add(1)
 		go func(j int64) {
 			childAddress := chunkData[8+j*r.hashSize : 8+(j+1)*r.hashSize]
+			if children != nil {
+				r.join(ctx, b[soff-off:seoff-off], soff-roff, seoff-roff, depth-1, treeSize/r.branches, children[j-start], wg, errC, quitC)
+				return
+			}
 			startTime := time.Now()
 			chunkData, err := r.getter.Get(ctx, Reference(childAddress))
 			if err != nil {
@@ -43,7 +43,7 @@ type chunkerTester struct {
 }
 
 func newTestHasherStore(store ChunkStore, hash string) *hasherStore {
-	return NewHasherStore(store, MakeHashFunc(hash), false)
+	return NewHasherStore(store, MakeHashFunc(hash), false, nil)
 }
 
 func testRandomBrokenData(n int, tester *chunkerTester) {
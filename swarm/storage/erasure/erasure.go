@@ -0,0 +1,248 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package erasure implements a systematic Reed-Solomon erasure code over
+// GF(2^8). The k data shards are kept as they are and m parity shards are
+// added, any k of the k+m shards are enough to reconstruct the data.
+// The parity shards are computed with a Cauchy matrix, every square
+// submatrix of which is invertible.
+package erasure
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxShards is the maximum number of data and parity shards of a code
+const MaxShards = 256
+
+var (
+	// ErrTooFewShards is returned by Reconstruct if less than k shards are
+	// available
+	ErrTooFewShards = errors.New("too few shards to reconstruct the data")
+	// ErrShardSize is returned if the shards are not of the same size
+	ErrShardSize = errors.New("shards differ in size")
+)
+
+// the field is GF(2^8) with the polynomial x^8+x^4+x^3+x^2+1
+const polynomial = 0x11d
+
+var (
+	expTable [510]byte
+	logTable [256]byte
+	mulTable [256][256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= polynomial
+		}
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			mulTable[a][b] = expTable[int(logTable[a])+int(logTable[b])]
+		}
+	}
+}
+
+// inv returns the multiplicative inverse of a non-zero element
+func inv(a byte) byte {
+	return expTable[255-int(logTable[a])]
+}
+
+// mulAdd adds c*src to dst
+func mulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	row := &mulTable[c]
+	for i, b := range src {
+		dst[i] ^= row[b]
+	}
+}
+
+// Code is a Reed-Solomon code with k data and m parity shards
+type Code struct {
+	k, m   int
+	parity [][]byte // m x k encoding matrix of the parity shards
+}
+
+// New creates a code with the given numbers of data and parity shards
+func New(dataShards, parityShards int) (*Code, error) {
+	if dataShards <= 0 || parityShards < 0 {
+		return nil, fmt.Errorf("invalid number of shards: %d data, %d parity", dataShards, parityShards)
+	}
+	if dataShards+parityShards > MaxShards {
+		return nil, fmt.Errorf("too many shards: %d data, %d parity, maximum %d", dataShards, parityShards, MaxShards)
+	}
+	c := &Code{
+		k:      dataShards,
+		m:      parityShards,
+		parity: make([][]byte, parityShards),
+	}
+	// the Cauchy matrix 1/(x_i+y_j) with x_i = i and y_j = m+j
+	for i := range c.parity {
+		c.parity[i] = make([]byte, dataShards)
+		for j := range c.parity[i] {
+			c.parity[i][j] = inv(byte(i) ^ byte(parityShards+j))
+		}
+	}
+	return c, nil
+}
+
+// DataShards returns the number of data shards
+func (c *Code) DataShards() int {
+	return c.k
+}
+
+// ParityShards returns the number of parity shards
+func (c *Code) ParityShards() int {
+	return c.m
+}
+
+// Encode returns the parity shards of the data shards, which must all be of
+// the same size
+func (c *Code) Encode(data [][]byte) ([][]byte, error) {
+	if len(data) != c.k {
+		return nil, fmt.Errorf("expected %d data shards, got %d", c.k, len(data))
+	}
+	size := len(data[0])
+	for _, shard := range data {
+		if len(shard) != size {
+			return nil, ErrShardSize
+		}
+	}
+	parity := make([][]byte, c.m)
+	for i := range parity {
+		parity[i] = make([]byte, size)
+		for j, shard := range data {
+			mulAdd(parity[i], shard, c.parity[i][j])
+		}
+	}
+	return parity, nil
+}
+
+// Reconstruct fills in the missing data shards. The shards are the data
+// shards followed by the parity shards, missing shards are nil. At least k
+// shards must be given, all of the same size. Missing parity shards are not
+// reconstructed.
+func (c *Code) Reconstruct(shards [][]byte) error {
+	if len(shards) != c.k+c.m {
+		return fmt.Errorf("expected %d shards, got %d", c.k+c.m, len(shards))
+	}
+	var (
+		missing bool
+		avail   []int
+		size    = -1
+	)
+	for i, shard := range shards {
+		if shard == nil {
+			if i < c.k {
+				missing = true
+			}
+			continue
+		}
+		if size == -1 {
+			size = len(shard)
+		} else if len(shard) != size {
+			return ErrShardSize
+		}
+		if len(avail) < c.k {
+			avail = append(avail, i)
+		}
+	}
+	if !missing {
+		return nil
+	}
+	if len(avail) < c.k {
+		return ErrTooFewShards
+	}
+
+	// the rows of the encoding matrix of the available shards map the data
+	// shards to them, its inverse maps them back to the data shards
+	matrix := make([][]byte, c.k)
+	for r, i := range avail {
+		if i < c.k {
+			matrix[r] = make([]byte, c.k)
+			matrix[r][i] = 1
+		} else {
+			matrix[r] = append([]byte{}, c.parity[i-c.k]...)
+		}
+	}
+	decode, err := invert(matrix)
+	if err != nil {
+		return err
+	}
+	for j := 0; j < c.k; j++ {
+		if shards[j] != nil {
+			continue
+		}
+		shard := make([]byte, size)
+		for r, i := range avail {
+			mulAdd(shard, shards[i], decode[j][r])
+		}
+		shards[j] = shard
+	}
+	return nil
+}
+
+// invert returns the inverse of a square matrix using Gauss-Jordan
+// elimination, the matrix is modified
+func invert(matrix [][]byte) ([][]byte, error) {
+	n := len(matrix)
+	inverse := make([][]byte, n)
+	for i := range inverse {
+		inverse[i] = make([]byte, n)
+		inverse[i][i] = 1
+	}
+	for col := 0; col < n; col++ {
+		// find a pivot and swap it into place
+		pivot := col
+		for pivot < n && matrix[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, errors.New("singular matrix")
+		}
+		matrix[col], matrix[pivot] = matrix[pivot], matrix[col]
+		inverse[col], inverse[pivot] = inverse[pivot], inverse[col]
+
+		// scale the pivot row to 1
+		if s := matrix[col][col]; s != 1 {
+			f := inv(s)
+			for j := 0; j < n; j++ {
+				matrix[col][j] = mulTable[f][matrix[col][j]]
+				inverse[col][j] = mulTable[f][inverse[col][j]]
+			}
+		}
+		// eliminate the column from the other rows
+		for r := 0; r < n; r++ {
+			if r == col || matrix[r][col] == 0 {
+				continue
+			}
+			f := matrix[r][col]
+			mulAdd(matrix[r], matrix[col], f)
+			mulAdd(inverse[r], inverse[col], f)
+		}
+	}
+	return inverse, nil
+}
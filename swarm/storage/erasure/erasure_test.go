@@ -0,0 +1,94 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package erasure
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// TestReconstruct tests that the data shards are reconstructed from any k
+// of the data and parity shards
+func TestReconstruct(t *testing.T) {
+	for _, x := range []struct{ k, m int }{
+		{1, 1},
+		{3, 2},
+		{10, 4},
+		{120, 8},
+		{32, 32},
+		{192, 64},
+	} {
+		t.Run(fmt.Sprintf("%d_%d", x.k, x.m), func(t *testing.T) {
+			code, err := New(x.k, x.m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rng := rand.New(rand.NewSource(int64(x.k*1000 + x.m)))
+			data := make([][]byte, x.k)
+			for i := range data {
+				data[i] = make([]byte, 64)
+				rng.Read(data[i])
+			}
+			parity, err := code.Encode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(parity) != x.m {
+				t.Fatalf("expected %d parity shards, got %d", x.m, len(parity))
+			}
+
+			for round := 0; round < 10; round++ {
+				shards := append(append([][]byte{}, data...), parity...)
+				// lose m random shards
+				for _, i := range rng.Perm(x.k + x.m)[:x.m] {
+					shards[i] = nil
+				}
+				if err := code.Reconstruct(shards); err != nil {
+					t.Fatal(err)
+				}
+				for i := range data {
+					if !bytes.Equal(shards[i], data[i]) {
+						t.Fatalf("data shard %d not reconstructed", i)
+					}
+				}
+			}
+
+			// one more lost shard can not be recovered
+			shards := append(append([][]byte{}, data...), parity...)
+			for i := 0; i <= x.m; i++ {
+				shards[i] = nil
+			}
+			if err := code.Reconstruct(shards); err != ErrTooFewShards {
+				t.Fatalf("expected error %v, got %v", ErrTooFewShards, err)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(0, 1); err == nil {
+		t.Fatal("expected error for no data shards")
+	}
+	if _, err := New(200, 57); err == nil {
+		t.Fatal("expected error for too many shards")
+	}
+	if _, err := New(200, 56); err != nil {
+		t.Fatal(err)
+	}
+}
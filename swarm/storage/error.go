@@ -32,6 +32,7 @@ const (
 )
 
 var (
-	ErrChunkNotFound = errors.New("chunk not found")
-	ErrChunkInvalid  = errors.New("invalid chunk")
+	ErrChunkNotFound  = errors.New("chunk not found")
+	ErrChunkInvalid   = errors.New("invalid chunk")
+	ErrChunkNotPinned = errors.New("chunk not pinned")
 )
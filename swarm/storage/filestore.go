@@ -18,9 +18,13 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"sort"
 	"sync"
+
+	ch "github.com/susy-go/susy-graviton/swarm/chunk"
+	"github.com/susy-go/susy-graviton/swarm/sctx"
 )
 
 /*
@@ -44,6 +48,7 @@ const (
 type FileStore struct {
 	ChunkStore
 	hashFunc SwarmHasher
+	tags     *ch.Tags
 }
 
 type FileStoreParams struct {
@@ -65,14 +70,17 @@ func NewLocalFileStore(datadir string, basekey []byte) (*FileStore, error) {
 		return nil, err
 	}
 	localStore.Validators = append(localStore.Validators, NewContentAddressValidator(MakeHashFunc(DefaultHash)))
-	return NewFileStore(localStore, NewFileStoreParams()), nil
+	return NewFileStore(localStore, NewFileStoreParams(), ch.NewTags()), nil
 }
 
-func NewFileStore(store ChunkStore, params *FileStoreParams) *FileStore {
+// NewFileStore creates a FileStore on the chunk store. Uploads with the uid
+// of a tag of the registry in their context are counted in that tag.
+func NewFileStore(store ChunkStore, params *FileStoreParams, tags *ch.Tags) *FileStore {
 	hashFunc := MakeHashFunc(params.Hash)
 	return &FileStore{
 		ChunkStore: store,
 		hashFunc:   hashFunc,
+		tags:       tags,
 	}
 }
 
@@ -83,16 +91,37 @@ func NewFileStore(store ChunkStore, params *FileStoreParams) *FileStore {
 // It returns a reader with the chunk data and whether the content was encrypted
 func (f *FileStore) Retrieve(ctx context.Context, addr Address) (reader *LazyChunkReader, isEncrypted bool) {
 	isEncrypted = len(addr) > f.hashFunc().Size()
-	getter := NewHasherStore(f.ChunkStore, f.hashFunc, isEncrypted)
+	getter := NewHasherStore(f.ChunkStore, f.hashFunc, isEncrypted, nil)
 	reader = TreeJoin(ctx, addr, getter, 0)
 	return
 }
 
 // Store is a public API. Main entry point for document storage directly. Used by the
 // FS-aware API and httpaccess
+// If the context holds the uid of a tag, the chunks of the upload are counted
+// in the tag and its total is set once splitting is done.
+// If the context holds a redundancy level, parity chunks are added to the
+// tree chunks at that level.
 func (f *FileStore) Store(ctx context.Context, data io.Reader, size int64, toEncrypt bool) (addr Address, wait func(context.Context) error, err error) {
-	putter := NewHasherStore(f.ChunkStore, f.hashFunc, toEncrypt)
-	return PyramidSplit(ctx, data, putter, putter)
+	var tag *ch.Tag
+	if f.tags != nil {
+		tag, _ = f.tags.GetFromContext(ctx)
+	}
+	level := RedundancyLevel(sctx.GetRedundancy(ctx))
+	if !level.Valid() {
+		return nil, nil, fmt.Errorf("invalid redundancy level %d", level)
+	}
+	putter := NewHasherStore(f.ChunkStore, f.hashFunc, toEncrypt, tag)
+	addr, wait, err = PyramidSplitRedundant(ctx, data, putter, putter, level)
+	if err == nil && tag != nil {
+		tag.DoneSplit(addr)
+	}
+	return addr, wait, err
+}
+
+// Tags returns the registry of the upload tags
+func (f *FileStore) Tags() *ch.Tags {
+	return f.tags
 }
 
 func (f *FileStore) HashSize() int {
@@ -103,7 +132,7 @@ func (f *FileStore) HashSize() int {
 func (f *FileStore) GetAllReferences(ctx context.Context, data io.Reader, toEncrypt bool) (addrs AddressCollection, err error) {
 	// create a special kind of putter, which only will store the references
 	putter := &hashExplorer{
-		hasherStore: NewHasherStore(f.ChunkStore, f.hashFunc, toEncrypt),
+		hasherStore: NewHasherStore(f.ChunkStore, f.hashFunc, toEncrypt, nil),
 	}
 	// do the actual splitting anyway, no way around it
 	_, wait, err := PyramidSplit(ctx, data, putter, putter)
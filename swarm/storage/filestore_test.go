@@ -24,6 +24,8 @@ import (
 	"os"
 	"testing"
 
+	ch "github.com/susy-go/susy-graviton/swarm/chunk"
+	"github.com/susy-go/susy-graviton/swarm/sctx"
 	"github.com/susy-go/susy-graviton/swarm/testutil"
 )
 
@@ -48,7 +50,7 @@ func testFileStoreRandom(toEncrypt bool, t *testing.T) {
 		DbStore:  db,
 	}
 
-	fileStore := NewFileStore(localStore, NewFileStoreParams())
+	fileStore := NewFileStore(localStore, NewFileStoreParams(), nil)
 	defer os.RemoveAll("/tmp/bzz")
 
 	slice := testutil.RandomBytes(1, testDataSize)
@@ -115,7 +117,7 @@ func testFileStoreCapacity(toEncrypt bool, t *testing.T) {
 		memStore: memStore,
 		DbStore:  db,
 	}
-	fileStore := NewFileStore(localStore, NewFileStoreParams())
+	fileStore := NewFileStore(localStore, NewFileStoreParams(), nil)
 	slice := testutil.RandomBytes(1, testDataSize)
 	ctx := context.TODO()
 	key, wait, err := fileStore.Store(ctx, bytes.NewReader(slice), testDataSize, toEncrypt)
@@ -188,7 +190,7 @@ func TestGetAllReferences(t *testing.T) {
 		memStore: memStore,
 		DbStore:  db,
 	}
-	fileStore := NewFileStore(localStore, NewFileStoreParams())
+	fileStore := NewFileStore(localStore, NewFileStoreParams(), nil)
 
 	// testRuns[i] and expectedLen[i] are dataSize and expected length respectively
 	testRuns := []int{1024, 8192, 16000, 30000, 1000000}
@@ -205,3 +207,35 @@ func TestGetAllReferences(t *testing.T) {
 		}
 	}
 }
+
+// TestFileStoreTag tests that the chunks of an upload with a tag uid in its
+// context are counted as split and stored in the tag
+func TestFileStoreTag(t *testing.T) {
+	tags := ch.NewTags()
+	fileStore := NewFileStore(&FakeChunkStore{}, NewFileStoreParams(), tags)
+	tag, err := tags.New("test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := sctx.SetTag(context.Background(), tag.Uid)
+	slice := testutil.RandomBytes(1, 1000000)
+	addr, wait, err := fileStore.Store(ctx, bytes.NewReader(slice), int64(len(slice)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(tag.Address(), addr) {
+		t.Fatalf("expected tag address %s, got %x", addr, tag.Address())
+	}
+	// 1000000 bytes are split into 245 data chunks and 3 intermediate chunks
+	if total := tag.Total(); total != 248 {
+		t.Fatalf("expected 248 chunks, got %d", total)
+	}
+	if !tag.Done(ch.StateSplit) || !tag.Done(ch.StateStored) {
+		t.Fatalf("expected all chunks split and stored, got %d split and %d stored", tag.Get(ch.StateSplit), tag.Get(ch.StateStored))
+	}
+}
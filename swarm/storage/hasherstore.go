@@ -35,6 +35,7 @@ type hasherStore struct {
 	errC      chan error    // global error channel
 	doneC     chan struct{} // closed by Close() call to indicate that count is the final number of chunks
 	quitC     chan struct{} // closed to quit unterminated routines
+	tag       *ch.Tag       // upload tag counting the chunks split and stored, may be nil
 	// nrChunks is used with atomic functions
 	// it is required to be at the end of the struct to ensure 64bit alignment for arm architecture
 	// see: https://golang.org/pkg/sync/atomic/#pkg-note-BUG
@@ -43,8 +44,9 @@ type hasherStore struct {
 
 // NewHasherStore creates a hasherStore object, which implements Putter and Getter interfaces.
 // With the HasherStore you can put and get chunk data (which is just []byte) into a ChunkStore
-// and the hasherStore will take core of encryption/decryption of data if necessary
-func NewHasherStore(store ChunkStore, hashFunc SwarmHasher, toEncrypt bool) *hasherStore {
+// and the hasherStore will take core of encryption/decryption of data if necessary.
+// If tag is not nil, the chunks put are counted in it.
+func NewHasherStore(store ChunkStore, hashFunc SwarmHasher, toEncrypt bool, tag *ch.Tag) *hasherStore {
 	hashSize := hashFunc().Size()
 	refSize := int64(hashSize)
 	if toEncrypt {
@@ -60,6 +62,7 @@ func NewHasherStore(store ChunkStore, hashFunc SwarmHasher, toEncrypt bool) *has
 		errC:      make(chan error),
 		doneC:     make(chan struct{}),
 		quitC:     make(chan struct{}),
+		tag:       tag,
 	}
 
 	return h
@@ -79,6 +82,10 @@ func (h *hasherStore) Put(ctx context.Context, chunkData ChunkData) (Reference,
 		}
 	}
 	chunk := h.createChunk(c)
+	if h.tag != nil {
+		chunk.tagID = h.tag.Uid
+		h.tag.Inc(ch.StateSplit)
+	}
 	h.storeChunk(ctx, chunk)
 
 	return Reference(append(chunk.Address(), encryptionKey...)), nil
@@ -189,10 +196,17 @@ func (h *hasherStore) decryptChunkData(chunkData ChunkData, encryptionKey encryp
 
 	// removing extra bytes which were just added for padding
 	length := ChunkData(decryptedSpan).Size()
-	for length > ch.DefaultSize {
-		length = length + (ch.DefaultSize - 1)
-		length = length / ch.DefaultSize
-		length *= uint64(h.refSize)
+	if length > ch.DefaultSize {
+		// the number of children of the tree chunk, followed by the
+		// references of the parity chunks
+		branches := uint64(ch.DefaultSize / h.refSize)
+		parities := uint64(ChunkData(decryptedSpan).redundancy().parities(int64(branches)))
+		branches -= parities
+		n := (length + ch.DefaultSize - 1) / ch.DefaultSize
+		for n > branches {
+			n = (n + branches - 1) / branches
+		}
+		length = (n + parities) * uint64(h.refSize)
 	}
 
 	c := make(ChunkData, length+8)
@@ -242,8 +256,12 @@ func (h *hasherStore) newDataEncryption(key encryption.Key) encryption.Encryptio
 func (h *hasherStore) storeChunk(ctx context.Context, chunk *chunk) {
 	atomic.AddUint64(&h.nrChunks, 1)
 	go func() {
+		err := h.store.Put(ctx, chunk)
+		if err == nil && h.tag != nil {
+			h.tag.Inc(ch.StateStored)
+		}
 		select {
-		case h.errC <- h.store.Put(ctx, chunk):
+		case h.errC <- err:
 		case <-h.quitC:
 		}
 	}()
@@ -63,7 +63,8 @@ var (
 	keyData        = byte(6)
 	keyDistanceCnt = byte(7)
 	keySchema      = []byte{8}
-	keyGCIdx       = byte(9) // access to chunk data index, used by garbage collection in ascending order from first entry
+	keyGCIdx       = byte(9)  // access to chunk data index, used by garbage collection in ascending order from first entry
+	keyPinCnt      = byte(10) // number of times a chunk is pinned, pinned chunks are skipped by garbage collection
 )
 
 var (
@@ -256,6 +257,13 @@ func getIndexKey(hash Address) []byte {
 	return key
 }
 
+func getPinKey(hash Address) []byte {
+	key := make([]byte, len(hash)+1)
+	key[0] = keyPinCnt
+	copy(key[1:], hash[:])
+	return key
+}
+
 func getDataKey(idx uint64, po uint8) []byte {
 	key := make([]byte, 10)
 	key[0] = keyData
@@ -334,9 +342,12 @@ func (s *LDBStore) collectGarbage() error {
 	s.startGC(int(entryCnt))
 	log.Debug("collectGarbage", "target", s.gc.target, "entryCnt", entryCnt)
 
+	// every batch continues after the chunks seen by the previous one, so that
+	// pinned chunks are skipped only once
+	seek := []byte{keyGCIdx}
 	for s.gc.count < s.gc.target {
 		it := s.db.NewIterator()
-		ok := it.Seek([]byte{keyGCIdx})
+		ok := it.Seek(seek)
 		var singleIterationCount int
 
 		// every batch needs a lock so we avoid entries changing accessidx in the meantime
@@ -346,6 +357,7 @@ func (s *LDBStore) collectGarbage() error {
 			// quit if no more access index keys
 			itkey := it.Key()
 			if (itkey == nil) || (itkey[0] != keyGCIdx) {
+				ok = false
 				break
 			}
 
@@ -356,6 +368,10 @@ func (s *LDBStore) collectGarbage() error {
 			keyIdx[0] = keyIndex
 			copy(keyIdx[1:], hash)
 
+			// pinned chunks are never collected
+			if s.pinCount(hash) > 0 {
+				continue
+			}
 			// add delete operation to batch
 			s.delete(s.gc.batch.Batch, index, keyIdx, po)
 			singleIterationCount++
@@ -368,10 +384,18 @@ func (s *LDBStore) collectGarbage() error {
 			}
 		}
 
+		if ok {
+			seek = append([]byte(nil), it.Key()...)
+		}
 		s.writeBatch(s.gc.batch, wEntryCnt)
 		log.Trace("garbage collect batch done", "batch", singleIterationCount, "total", s.gc.count)
 		s.lock.Unlock()
 		it.Release()
+
+		// quit if the whole index was seen, only pinned chunks are left
+		if !ok {
+			break
+		}
 	}
 
 	metrics.GetOrRegisterCounter("ldbstore.collectgarbage.delete", nil).Inc(int64(s.gc.count))
@@ -738,6 +762,56 @@ func (s *LDBStore) Delete(addr Address) error {
 	return s.deleteNow(&idx, ikey, proximity)
 }
 
+// PinChunk increments the pin counter of a stored chunk, protecting it from
+// garbage collection until it is unpinned as many times as it was pinned.
+func (s *LDBStore) PinChunk(_ context.Context, addr Address) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return ErrDBClosed
+	}
+	if _, err := s.db.Get(getIndexKey(addr)); err != nil {
+		return ErrChunkNotFound
+	}
+	return s.db.Put(getPinKey(addr), U64ToBytes(s.pinCount(addr)+1))
+}
+
+// UnpinChunk decrements the pin counter of a chunk, handing it back to
+// garbage collection once the counter drops to zero.
+func (s *LDBStore) UnpinChunk(_ context.Context, addr Address) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return ErrDBClosed
+	}
+	count := s.pinCount(addr)
+	if count == 0 {
+		return ErrChunkNotPinned
+	}
+	if count == 1 {
+		return s.db.Delete(getPinKey(addr))
+	}
+	return s.db.Put(getPinKey(addr), U64ToBytes(count-1))
+}
+
+// PinCount returns the number of times the chunk is pinned.
+func (s *LDBStore) PinCount(addr Address) uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.pinCount(addr)
+}
+
+func (s *LDBStore) pinCount(addr Address) uint64 {
+	data, err := s.db.Get(getPinKey(addr))
+	if err != nil {
+		return 0
+	}
+	return BytesToU64(data)
+}
+
 // executes one delete operation immediately
 // see *LDBStore.delete
 func (s *LDBStore) deleteNow(idx *dpaDBIndex, idxKey []byte, po uint8) error {
@@ -601,6 +601,90 @@ func TestLDBStoreCollectGarbageAccessUnlikeIndex(t *testing.T) {
 	log.Info("ldbstore", "total", n, "missing", missing, "entrycnt", ldb.entryCnt, "accesscnt", ldb.accessCnt)
 }
 
+// TestLDBStoreCollectGarbagePinned tests that pinned chunks survive garbage
+// collection until they are unpinned as many times as they were pinned
+func TestLDBStoreCollectGarbagePinned(t *testing.T) {
+	capacity := defaultMaxGCRound / 100
+	n := capacity * 4
+
+	ldb, cleanup := newLDBStore(t)
+	ldb.setCapacity(uint64(capacity))
+	defer cleanup()
+
+	if err := ldb.PinChunk(context.TODO(), GenerateRandomChunk(ch.DefaultSize).Address()); err != ErrChunkNotFound {
+		t.Fatalf("expected error %v pinning a missing chunk, got %v", ErrChunkNotFound, err)
+	}
+
+	// pin the oldest chunks, which would be the first ones to be collected
+	pinned, err := mputRandomChunks(ldb, capacity/2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for i, ch := range pinned {
+		if err := ldb.PinChunk(context.TODO(), ch.Address()); err != nil {
+			t.Fatalf("fail pin chunk #%d - %s: %v", i, ch.Address(), err)
+		}
+	}
+	if err := ldb.PinChunk(context.TODO(), pinned[0].Address()); err != nil {
+		t.Fatal(err)
+	}
+	if c := ldb.PinCount(pinned[0].Address()); c != 2 {
+		t.Fatalf("expected pin count 2, got %d", c)
+	}
+
+	ldb.startGC(capacity)
+	roundTarget := ldb.gc.target
+
+	var chunks []Chunk
+	for remaining := n; remaining > 0; remaining -= roundTarget {
+		putCount := roundTarget
+		if remaining < roundTarget {
+			putCount = remaining
+		}
+		added, err := mputRandomChunks(ldb, putCount)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		chunks = append(chunks, added...)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		waitGc(ctx, ldb)
+	}
+
+	for i, ch := range pinned {
+		ret, err := ldb.Get(context.TODO(), ch.Address())
+		if err != nil {
+			t.Fatalf("fail find pinned chunk #%d - %s: %v", i, ch.Address(), err)
+		}
+		if !bytes.Equal(ret.Data(), ch.Data()) {
+			t.Fatal("expected to get the same data back, but got smth else")
+		}
+	}
+	var missing int
+	for _, ch := range chunks {
+		if _, err := ldb.Get(context.TODO(), ch.Address()); err != nil {
+			missing++
+		}
+	}
+	if missing == 0 {
+		t.Fatal("expected unpinned chunks to be garbage collected")
+	}
+
+	// unpinning needs to match the number of pins
+	for i := 0; i < 2; i++ {
+		if err := ldb.UnpinChunk(context.TODO(), pinned[0].Address()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c := ldb.PinCount(pinned[0].Address()); c != 0 {
+		t.Fatalf("expected pin count 0, got %d", c)
+	}
+	if err := ldb.UnpinChunk(context.TODO(), pinned[0].Address()); err != ErrChunkNotPinned {
+		t.Fatalf("expected error %v, got %v", ErrChunkNotPinned, err)
+	}
+}
+
 func TestCleanIndex(t *testing.T) {
 	capacity := 5000
 	n := 3
@@ -188,6 +188,16 @@ func (ls *LocalStore) FetchFunc(ctx context.Context, addr Address) func(context.
 	}
 }
 
+// PinChunk protects the chunk from garbage collection in the underlying DbStore
+func (ls *LocalStore) PinChunk(ctx context.Context, addr Address) error {
+	return ls.DbStore.PinChunk(ctx, addr)
+}
+
+// UnpinChunk releases a pin on the chunk in the underlying DbStore
+func (ls *LocalStore) UnpinChunk(ctx context.Context, addr Address) error {
+	return ls.DbStore.UnpinChunk(ctx, addr)
+}
+
 func (ls *LocalStore) BinIndex(po uint8) uint64 {
 	return ls.DbStore.BinIndex(po)
 }
@@ -48,6 +48,8 @@ Push and Pull syncing.
 
 DB implements an internal garbage collector that removes only synced
 Chunks from the database based on their most recent access time.
+Chunks set with ModeSetPin are protected from garbage collection until
+they are set with ModeSetUnpin as many times as they were pinned.
 
 Internally, DB stores Chunk data and any required information, such as
 store and access timestamps in different shed indexes that can be
@@ -164,6 +164,14 @@ func (db *DB) collectGarbage() (collectedCount int64, done bool, err error) {
 		if gcSize-collectedCount <= target {
 			return true, nil
 		}
+		// skip the chunks pinned after iteration started
+		pinned, err := db.isPinned(item)
+		if err != nil {
+			return false, err
+		}
+		if pinned {
+			return false, nil
+		}
 		// delete from retrieve, pull, gc
 		db.retrievalDataIndex.DeleteInBatch(batch, item)
 		db.retrievalAccessIndex.DeleteInBatch(batch, item)
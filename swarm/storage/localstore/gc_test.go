@@ -127,6 +127,100 @@ func testDB_collectGarbageWorker(t *testing.T) {
 	}
 }
 
+// TestDB_collectGarbageWorker_withPinned tests that pinned
+// chunks are not removed by garbage collection.
+func TestDB_collectGarbageWorker_withPinned(t *testing.T) {
+	chunkCount := 150
+	pinnedCount := 10
+
+	testHookCollectGarbageChan := make(chan int64)
+	defer setTestHookCollectGarbage(func(collectedCount int64) {
+		testHookCollectGarbageChan <- collectedCount
+	})()
+
+	db, cleanupFunc := newTestDB(t, &Options{
+		Capacity: 100,
+	})
+	defer cleanupFunc()
+
+	uploader := db.NewPutter(ModePutUpload)
+	syncer := db.NewSetter(ModeSetSync)
+	pinner := db.NewSetter(ModeSetPin)
+
+	addrs := make([]storage.Address, 0)
+
+	// upload random chunks, pinning the oldest ones
+	for i := 0; i < chunkCount; i++ {
+		chunk := generateRandomChunk()
+
+		err := uploader.Put(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = syncer.Set(chunk.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i < pinnedCount {
+			err = pinner.Set(chunk.Address())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		addrs = append(addrs, chunk.Address())
+	}
+
+	gcTarget := db.gcTarget()
+
+	for {
+		select {
+		case <-testHookCollectGarbageChan:
+		case <-time.After(10 * time.Second):
+			t.Error("collect garbage timeout")
+		}
+		gcSize := db.getGCSize()
+		if gcSize == gcTarget {
+			break
+		}
+	}
+
+	t.Run("pin index count", newItemsCountTest(db.pinIndex, pinnedCount))
+
+	t.Run("gc index count", newItemsCountTest(db.gcIndex, int(gcTarget)))
+
+	t.Run("gc size", newIndexGCSizeTest(db))
+
+	// pinned chunks should not be removed
+	t.Run("get pinned chunks", func(t *testing.T) {
+		for _, addr := range addrs[:pinnedCount] {
+			_, err := db.NewGetter(ModeGetRequest).Get(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	// the first unpinned synced chunk should be removed
+	t.Run("get the first unpinned chunk", func(t *testing.T) {
+		_, err := db.NewGetter(ModeGetRequest).Get(addrs[pinnedCount])
+		if err != storage.ErrChunkNotFound {
+			t.Errorf("got error %v, want %v", err, storage.ErrChunkNotFound)
+		}
+	})
+
+	// cleanup: drain the last testHookCollectGarbageChan
+	// element before calling deferred functions not to block
+	// collectGarbageWorker loop, preventing the race in
+	// setting testHookCollectGarbage function
+	select {
+	case <-testHookCollectGarbageChan:
+	default:
+	}
+}
+
 // TestDB_collectGarbageWorker_withRequests is a helper test function
 // to test garbage collection runs by uploading, syncing and
 // requesting a number of chunks.
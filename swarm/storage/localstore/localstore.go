@@ -37,6 +37,9 @@ var (
 	// is updated in parallel and one of the updates
 	// takes longer then the configured timeout duration.
 	ErrAddressLockTimeout = errors.New("address lock timeout")
+	// ErrNotPinned is returned when a chunk which
+	// is not pinned is unpinned.
+	ErrNotPinned = errors.New("chunk is not pinned")
 )
 
 var (
@@ -78,6 +81,10 @@ type DB struct {
 	// counted in and saved to storedGCSize
 	gcUncountedHashesIndex shed.Index
 
+	// pinning index that stores the number of times
+	// a chunk is pinned, keeping it out of gcIndex
+	pinIndex shed.Index
+
 	// number of elements in garbage collection index
 	// it must be always read by getGCSize and
 	// set with incGCSize which are locking gcSizeMu
@@ -261,6 +268,8 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 	// create a pull syncing triggers used by SubscribePull function
 	db.pullTriggers = make(map[uint8][]chan struct{})
 	// push index contains as yet unsynced chunks
+	// the value holds the upload tag of the chunk, the index name is kept
+	// from when it had no value not to lose the items of existing databases
 	db.pushIndex, err = db.shed.NewIndex("StoredTimestamp|Hash->nil", shed.IndexFuncs{
 		EncodeKey: func(fields shed.Item) (key []byte, err error) {
 			key = make([]byte, 40)
@@ -274,9 +283,15 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 			return e, nil
 		},
 		EncodeValue: func(fields shed.Item) (value []byte, err error) {
-			return nil, nil
+			value = make([]byte, 4)
+			binary.BigEndian.PutUint32(value, fields.Tag)
+			return value, nil
 		},
 		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			// values of items indexed before tags were added are empty
+			if len(value) == 4 {
+				e.Tag = binary.BigEndian.Uint32(value)
+			}
 			return e, nil
 		},
 	})
@@ -330,6 +345,29 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 	if err != nil {
 		return nil, err
 	}
+	// pin index keeps the pin counters of chunks
+	// protected from garbage collection
+	db.pinIndex, err = db.shed.NewIndex("Hash->PinCounter", shed.IndexFuncs{
+		EncodeKey: func(fields shed.Item) (key []byte, err error) {
+			return fields.Address, nil
+		},
+		DecodeKey: func(key []byte) (e shed.Item, err error) {
+			e.Address = key
+			return e, nil
+		},
+		EncodeValue: func(fields shed.Item) (value []byte, err error) {
+			b := make([]byte, 8)
+			binary.BigEndian.PutUint64(b, fields.PinCounter)
+			return b, nil
+		},
+		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			e.PinCounter = binary.BigEndian.Uint64(value)
+			return e, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// count number of elements in garbage collection index
 	gcSize, err := db.storedGCSize.Get()
@@ -407,6 +445,7 @@ func chunkToItem(ch storage.Chunk) shed.Item {
 	return shed.Item{
 		Address: ch.Address(),
 		Data:    ch.Data(),
+		Tag:     ch.TagID(),
 	}
 }
 
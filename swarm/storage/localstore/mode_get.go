@@ -137,14 +137,22 @@ func (db *DB) updateGC(item shed.Item) (err error) {
 		// do not add it to the gc index
 		return nil
 	}
+	pinned, err := db.isPinned(item)
+	if err != nil {
+		return err
+	}
 	// delete current entry from the gc index
-	db.gcIndex.DeleteInBatch(batch, item)
+	if !pinned {
+		db.gcIndex.DeleteInBatch(batch, item)
+	}
 	// update access timestamp
 	item.AccessTimestamp = now()
 	// update retrieve access index
 	db.retrievalAccessIndex.PutInBatch(batch, item)
-	// add new entry to gc index
-	db.gcIndex.PutInBatch(batch, item)
+	// add new entry to gc index unless the chunk is pinned
+	if !pinned {
+		db.gcIndex.PutInBatch(batch, item)
+	}
 
 	return db.shed.WriteBatch(batch)
 }
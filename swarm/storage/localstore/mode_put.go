@@ -102,7 +102,12 @@ func (db *DB) put(mode ModePut, item shed.Item) (err error) {
 		default:
 			return err
 		}
-		if item.AccessTimestamp != 0 {
+		// pinned chunks are kept out of the gc index
+		pinned, err := db.isPinned(item)
+		if err != nil {
+			return err
+		}
+		if item.AccessTimestamp != 0 && !pinned {
 			// delete current entry from the gc index
 			db.gcIndex.DeleteInBatch(batch, item)
 			gcSizeChange--
@@ -115,9 +120,11 @@ func (db *DB) put(mode ModePut, item shed.Item) (err error) {
 		// update retrieve access index
 		db.retrievalAccessIndex.PutInBatch(batch, item)
 		// add new entry to gc index
-		db.gcIndex.PutInBatch(batch, item)
-		db.gcUncountedHashesIndex.PutInBatch(batch, item)
-		gcSizeChange++
+		if !pinned {
+			db.gcIndex.PutInBatch(batch, item)
+			db.gcUncountedHashesIndex.PutInBatch(batch, item)
+			gcSizeChange++
+		}
 
 		db.retrievalDataIndex.PutInBatch(batch, item)
 
@@ -17,6 +17,7 @@
 package localstore
 
 import (
+	"github.com/susy-go/susy-graviton/swarm/shed"
 	"github.com/susy-go/susy-graviton/swarm/storage"
 	"github.com/syndtr/goleveldb/leveldb"
 )
@@ -30,6 +31,10 @@ const (
 	ModeSetAccess ModeSet = iota
 	// ModeSetSync: when push sync receipt is received
 	ModeSetSync
+	// ModeSetPin: when a chunk is pinned to be protected from GC
+	ModeSetPin
+	// ModeSetUnpin: when a pinned chunk is unpinned
+	ModeSetUnpin
 	// modeSetRemove: when GC-d
 	// unexported as no external packages should remove chunks from database
 	modeSetRemove
@@ -97,12 +102,18 @@ func (db *DB) set(mode ModeSet, addr storage.Address) (err error) {
 			return err
 		}
 
+		pinned, err := db.isPinned(item)
+		if err != nil {
+			return err
+		}
 		i, err = db.retrievalAccessIndex.Get(item)
 		switch err {
 		case nil:
 			item.AccessTimestamp = i.AccessTimestamp
-			db.gcIndex.DeleteInBatch(batch, item)
-			gcSizeChange--
+			if !pinned {
+				db.gcIndex.DeleteInBatch(batch, item)
+				gcSizeChange--
+			}
 		case leveldb.ErrNotFound:
 			// the chunk is not accessed before
 		default:
@@ -112,9 +123,12 @@ func (db *DB) set(mode ModeSet, addr storage.Address) (err error) {
 		db.retrievalAccessIndex.PutInBatch(batch, item)
 		db.pullIndex.PutInBatch(batch, item)
 		triggerPullFeed = true
-		db.gcIndex.PutInBatch(batch, item)
-		db.gcUncountedHashesIndex.PutInBatch(batch, item)
-		gcSizeChange++
+		// pinned chunks are kept out of the gc index
+		if !pinned {
+			db.gcIndex.PutInBatch(batch, item)
+			db.gcUncountedHashesIndex.PutInBatch(batch, item)
+			gcSizeChange++
+		}
 
 	case ModeSetSync:
 		// delete from push, insert to gc
@@ -136,12 +150,18 @@ func (db *DB) set(mode ModeSet, addr storage.Address) (err error) {
 		}
 		item.StoreTimestamp = i.StoreTimestamp
 
+		pinned, err := db.isPinned(item)
+		if err != nil {
+			return err
+		}
 		i, err = db.retrievalAccessIndex.Get(item)
 		switch err {
 		case nil:
 			item.AccessTimestamp = i.AccessTimestamp
-			db.gcIndex.DeleteInBatch(batch, item)
-			gcSizeChange--
+			if !pinned {
+				db.gcIndex.DeleteInBatch(batch, item)
+				gcSizeChange--
+			}
 		case leveldb.ErrNotFound:
 			// the chunk is not accessed before
 		default:
@@ -150,9 +170,97 @@ func (db *DB) set(mode ModeSet, addr storage.Address) (err error) {
 		item.AccessTimestamp = now()
 		db.retrievalAccessIndex.PutInBatch(batch, item)
 		db.pushIndex.DeleteInBatch(batch, item)
-		db.gcIndex.PutInBatch(batch, item)
-		db.gcUncountedHashesIndex.PutInBatch(batch, item)
-		gcSizeChange++
+		// pinned chunks are kept out of the gc index
+		if !pinned {
+			db.gcIndex.PutInBatch(batch, item)
+			db.gcUncountedHashesIndex.PutInBatch(batch, item)
+			gcSizeChange++
+		}
+
+	case ModeSetPin:
+		// increment pin counter, delete from gc on the first pin
+
+		// pinning is only possible for chunks in the database
+		i, err := db.retrievalDataIndex.Get(item)
+		if err != nil {
+			if err == leveldb.ErrNotFound {
+				return storage.ErrChunkNotFound
+			}
+			return err
+		}
+		item.StoreTimestamp = i.StoreTimestamp
+
+		i, err = db.pinIndex.Get(item)
+		switch err {
+		case nil:
+			item.PinCounter = i.PinCounter
+		case leveldb.ErrNotFound:
+			// the chunk is pinned for the first time,
+			// remove it from the gc index if it is there
+			i, err = db.retrievalAccessIndex.Get(item)
+			switch err {
+			case nil:
+				item.AccessTimestamp = i.AccessTimestamp
+				// a check is needed for decrementing gcSize
+				// as delete is not reporting if the key/value pair
+				// is deleted or not
+				if _, err := db.gcIndex.Get(item); err == nil {
+					db.gcIndex.DeleteInBatch(batch, item)
+					gcSizeChange--
+				}
+			case leveldb.ErrNotFound:
+				// the chunk is not synced yet,
+				// so it is not in the gc index
+			default:
+				return err
+			}
+		default:
+			return err
+		}
+		item.PinCounter++
+		db.pinIndex.PutInBatch(batch, item)
+
+	case ModeSetUnpin:
+		// decrement pin counter, insert to gc on the last unpin
+
+		i, err := db.pinIndex.Get(item)
+		if err != nil {
+			if err == leveldb.ErrNotFound {
+				return ErrNotPinned
+			}
+			return err
+		}
+		item.PinCounter = i.PinCounter - 1
+		if item.PinCounter > 0 {
+			db.pinIndex.PutInBatch(batch, item)
+			break
+		}
+		db.pinIndex.DeleteInBatch(batch, item)
+
+		// return the chunk to the gc index if it is synced
+		i, err = db.retrievalDataIndex.Get(item)
+		if err != nil {
+			if err == leveldb.ErrNotFound {
+				break
+			}
+			return err
+		}
+		item.StoreTimestamp = i.StoreTimestamp
+
+		i, err = db.retrievalAccessIndex.Get(item)
+		switch err {
+		case nil:
+			item.AccessTimestamp = i.AccessTimestamp
+			if _, err := db.gcIndex.Get(item); err == leveldb.ErrNotFound {
+				db.gcIndex.PutInBatch(batch, item)
+				db.gcUncountedHashesIndex.PutInBatch(batch, item)
+				gcSizeChange++
+			}
+		case leveldb.ErrNotFound:
+			// the chunk is not synced yet
+		default:
+			return err
+		}
 
 	case modeSetRemove:
 		// delete from retrieve, pull, gc
@@ -203,3 +311,31 @@ func (db *DB) set(mode ModeSet, addr storage.Address) (err error) {
 	}
 	return nil
 }
+
+// PinCounter returns the number of times the chunk
+// with the provided address is pinned, or zero
+// if it is not pinned.
+func (db *DB) PinCounter(addr storage.Address) (counter uint64, err error) {
+	item, err := db.pinIndex.Get(addressToItem(addr))
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return item.PinCounter, nil
+}
+
+// isPinned returns whether the chunk represented
+// by the item is pinned and so kept out of gc index.
+func (db *DB) isPinned(item shed.Item) (pinned bool, err error) {
+	_, err = db.pinIndex.Get(item)
+	switch err {
+	case nil:
+		return true, nil
+	case leveldb.ErrNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
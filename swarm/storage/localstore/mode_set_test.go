@@ -20,6 +20,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/susy-go/susy-graviton/swarm/storage"
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
@@ -84,6 +85,98 @@ func TestModeSetSync(t *testing.T) {
 	t.Run("gc size", newIndexGCSizeTest(db))
 }
 
+// TestModeSetPin validates ModeSetPin and ModeSetUnpin
+// index values on the provided DB.
+func TestModeSetPin(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	chunk := generateRandomChunk()
+
+	err := db.NewSetter(ModeSetPin).Set(chunk.Address())
+	if err != storage.ErrChunkNotFound {
+		t.Fatalf("got error %v, want %v", err, storage.ErrChunkNotFound)
+	}
+
+	err = db.NewPutter(ModePutUpload).Put(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.NewSetter(ModeSetSync).Set(chunk.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPinCounterTest := func(want uint64) func(t *testing.T) {
+		return func(t *testing.T) {
+			counter, err := db.PinCounter(chunk.Address())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counter != want {
+				t.Errorf("got pin counter %v, want %v", counter, want)
+			}
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		err = db.NewSetter(ModeSetPin).Set(chunk.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("pinned", func(t *testing.T) {
+		t.Run("pin counter", newPinCounterTest(2))
+
+		t.Run("gc index count", newItemsCountTest(db.gcIndex, 0))
+
+		t.Run("gc size", newIndexGCSizeTest(db))
+	})
+
+	// accessing or requesting a pinned chunk must not return it to the gc index
+	err = db.NewSetter(ModeSetAccess).Set(chunk.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.NewPutter(ModePutRequest).Put(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.NewSetter(ModeSetUnpin).Set(chunk.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("unpinned once", func(t *testing.T) {
+		t.Run("pin counter", newPinCounterTest(1))
+
+		t.Run("gc index count", newItemsCountTest(db.gcIndex, 0))
+
+		t.Run("gc size", newIndexGCSizeTest(db))
+	})
+
+	err = db.NewSetter(ModeSetUnpin).Set(chunk.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("unpinned", func(t *testing.T) {
+		t.Run("pin counter", newPinCounterTest(0))
+
+		t.Run("pin index count", newItemsCountTest(db.pinIndex, 0))
+
+		t.Run("gc index count", newItemsCountTest(db.gcIndex, 1))
+
+		t.Run("gc size", newIndexGCSizeTest(db))
+	})
+
+	err = db.NewSetter(ModeSetUnpin).Set(chunk.Address())
+	if err != ErrNotPinned {
+		t.Errorf("got error %v, want %v", err, ErrNotPinned)
+	}
+}
+
 // TestModeSetRemove validates ModeSetRemove index values on the provided DB.
 func TestModeSetRemove(t *testing.T) {
 	db, cleanupFunc := newTestDB(t, nil)
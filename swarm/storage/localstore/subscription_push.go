@@ -65,7 +65,7 @@ func (db *DB) SubscribePush(ctx context.Context) (c <-chan storage.Chunk, stop f
 					}
 
 					select {
-					case chunks <- storage.NewChunk(dataItem.Address, dataItem.Data):
+					case chunks <- storage.NewChunk(dataItem.Address, dataItem.Data).WithTagID(item.Tag):
 						// set next iteration start item
 						// when its chunk is successfully sent to channel
 						sinceItem = &item
@@ -73,7 +73,8 @@ const (
 
 type PyramidSplitterParams struct {
 	SplitterParams
-	getter Getter
+	getter     Getter
+	redundancy RedundancyLevel
 }
 
 func NewPyramidSplitterParams(addr Address, reader io.Reader, putter Putter, getter Getter, chunkSize int64) *PyramidSplitterParams {
@@ -100,6 +101,14 @@ func PyramidSplit(ctx context.Context, reader io.Reader, putter Putter, getter G
 	return NewPyramidSplitter(NewPyramidSplitterParams(nil, reader, putter, getter, ch.DefaultSize)).Split(ctx)
 }
 
+// PyramidSplitRedundant is like PyramidSplit, but adds parity chunks to the
+// tree chunks at the given redundancy level
+func PyramidSplitRedundant(ctx context.Context, reader io.Reader, putter Putter, getter Getter, level RedundancyLevel) (Address, func(context.Context) error, error) {
+	params := NewPyramidSplitterParams(nil, reader, putter, getter, ch.DefaultSize)
+	params.redundancy = level
+	return NewPyramidSplitter(params).Split(ctx)
+}
+
 func PyramidAppend(ctx context.Context, addr Address, reader io.Reader, putter Putter, getter Getter) (Address, func(context.Context) error, error) {
 	return NewPyramidSplitter(NewPyramidSplitterParams(addr, reader, putter, getter, ch.DefaultSize)).Append(ctx)
 }
@@ -111,8 +120,9 @@ type TreeEntry struct {
 	subtreeSize   uint64
 	chunk         []byte
 	key           []byte
-	index         int  // used in append to indicate the index of existing tree entry
-	updatePending bool // indicates if the entry is loaded from existing tree
+	index         int      // used in append to indicate the index of existing tree entry
+	updatePending bool     // indicates if the entry is loaded from existing tree
+	children      [][]byte // data of the children to compute the parities of, if any
 }
 
 func NewTreeEntry(pyramid *PyramidChunker) *TreeEntry {
@@ -138,6 +148,8 @@ type PyramidChunker struct {
 	chunkSize   int64
 	hashSize    int64
 	branches    int64
+	redundancy  RedundancyLevel
+	parities    int64 // number of parity chunks of tree chunks
 	reader      io.Reader
 	putter      Putter
 	getter      Getter
@@ -150,6 +162,7 @@ type PyramidChunker struct {
 	quitC       chan bool
 	rootAddress []byte
 	chunkLevel  [][]*TreeEntry
+	err         error // error preparing the chunks, no chunks are prepared once it is set
 }
 
 func NewPyramidSplitter(params *PyramidSplitterParams) (pc *PyramidChunker) {
@@ -158,6 +171,10 @@ func NewPyramidSplitter(params *PyramidSplitterParams) (pc *PyramidChunker) {
 	pc.hashSize = params.hashSize
 	pc.branches = params.chunkSize / pc.hashSize
 	pc.chunkSize = pc.hashSize * pc.branches
+	// parities take the place of children in tree chunks
+	pc.redundancy = params.redundancy
+	pc.parities = pc.redundancy.parities(pc.branches)
+	pc.branches -= pc.parities
 	pc.putter = params.putter
 	pc.getter = params.getter
 	pc.key = params.addr
@@ -219,6 +236,10 @@ func (pc *PyramidChunker) Split(ctx context.Context) (k Address, wait func(conte
 	defer close(pc.quitC)
 	defer pc.putter.Close()
 
+	if pc.err != nil {
+		return nil, nil, pc.err
+	}
+
 	select {
 	case err := <-pc.errC:
 		if err != nil {
@@ -251,6 +272,10 @@ func (pc *PyramidChunker) Append(ctx context.Context) (k Address, wait func(cont
 	defer close(pc.quitC)
 	defer pc.putter.Close()
 
+	if pc.err != nil {
+		return nil, nil, pc.err
+	}
+
 	select {
 	case err := <-pc.errC:
 		if err != nil {
@@ -425,7 +450,7 @@ func (pc *PyramidChunker) prepareChunks(ctx context.Context, isAppend bool) {
 		}
 	}
 
-	for index := 0; ; index++ {
+	for index := 0; pc.err == nil; index++ {
 		var err error
 		chunkData := make([]byte, pc.chunkSize+8)
 
@@ -526,6 +551,13 @@ func (pc *PyramidChunker) prepareChunks(ctx context.Context, isAppend bool) {
 }
 
 func (pc *PyramidChunker) buildTree(isAppend bool, ent *TreeEntry, chunkWG *sync.WaitGroup, last bool, lonelyChunkKey []byte) {
+	// the lonely chunk is the last child of the entry, its data is needed for
+	// the parities of the tree chunk replacing the entry with it
+	var lonelyChunk []byte
+	if lonelyChunkKey != nil && len(ent.children) > 0 {
+		lonelyChunk = ent.children[len(ent.children)-1]
+	}
+
 	chunkWG.Wait()
 	pc.enqueueTreeChunk(ent, chunkWG, last)
 
@@ -604,6 +636,9 @@ func (pc *PyramidChunker) buildTree(isAppend bool, ent *TreeEntry, chunkWG *sync
 					entry := pc.chunkLevel[lvl][i]
 					newEntry.subtreeSize += entry.subtreeSize
 					copy(newEntry.chunk[8+(index*pc.hashSize):8+((index+1)*pc.hashSize)], entry.key[:pc.hashSize])
+					if pc.parities > 0 {
+						newEntry.children = append(newEntry.children, entry.chunk)
+					}
 					index++
 				}
 				// Lonely chunk key is the key of the last chunk that is only one on the last branch.
@@ -611,6 +646,13 @@ func (pc *PyramidChunker) buildTree(isAppend bool, ent *TreeEntry, chunkWG *sync
 				if lonelyChunkKey != nil {
 					// Overwrite the last tree chunk key with the lonely data chunk key.
 					copy(newEntry.chunk[int64(len(newEntry.chunk))-pc.hashSize:], lonelyChunkKey[:pc.hashSize])
+					if lonelyChunk != nil {
+						newEntry.children[len(newEntry.children)-1] = lonelyChunk
+					}
+				}
+				if pc.parities > 0 {
+					// make room for the parities
+					newEntry.chunk = append(newEntry.chunk, make([]byte, pc.parities*pc.hashSize)...)
 				}
 
 				pc.enqueueTreeChunk(newEntry, chunkWG, last)
@@ -630,18 +672,34 @@ func (pc *PyramidChunker) buildTree(isAppend bool, ent *TreeEntry, chunkWG *sync
 }
 
 func (pc *PyramidChunker) enqueueTreeChunk(ent *TreeEntry, chunkWG *sync.WaitGroup, last bool) {
-	if ent != nil && ent.branchCount > 0 {
+	if ent != nil && ent.branchCount > 0 && pc.err == nil {
 
 		// wait for data chunks to get over before processing the tree chunk
 		if last {
 			chunkWG.Wait()
 		}
 
+		// the most significant byte of the span is the redundancy level
+		if ent.subtreeSize >= MaxSpan {
+			pc.err = ErrDataTooLarge
+			return
+		}
 		binary.LittleEndian.PutUint64(ent.chunk[:8], ent.subtreeSize)
+		length := ent.branchCount*pc.hashSize + 8
+		if pc.parities > 0 && int64(len(ent.children)) == ent.branchCount {
+			if !pc.enqueueParities(ent, length) {
+				return
+			}
+			ent.chunk[7] = byte(pc.redundancy)
+			length += pc.parities * pc.hashSize
+			// the chunk is the data of a child of the next level
+			ent.chunk = ent.chunk[:length]
+			ent.children = nil
+		}
 		ent.key = make([]byte, pc.hashSize)
 		chunkWG.Add(1)
 		select {
-		case pc.jobC <- &chunkJob{ent.key, ent.chunk[:ent.branchCount*pc.hashSize+8], chunkWG}:
+		case pc.jobC <- &chunkJob{ent.key, ent.chunk[:length], chunkWG}:
 		case <-pc.quitC:
 		}
 
@@ -656,9 +714,36 @@ func (pc *PyramidChunker) enqueueTreeChunk(ent *TreeEntry, chunkWG *sync.WaitGro
 	}
 }
 
+// enqueueParities stores the parity chunks of the children of the tree
+// entry and writes their references into the chunk of the entry from the
+// given offset. It returns false if the parities can't be encoded or the
+// chunker quit.
+func (pc *PyramidChunker) enqueueParities(ent *TreeEntry, offset int64) bool {
+	parities, err := encodeParities(ent.children, pc.parities, pc.chunkSize)
+	if err != nil {
+		pc.err = err
+		return false
+	}
+	parityWG := &sync.WaitGroup{}
+	for i, parity := range parities {
+		pkey := ent.chunk[offset+int64(i)*pc.hashSize : offset+int64(i+1)*pc.hashSize]
+		parityWG.Add(1)
+		select {
+		case pc.jobC <- &chunkJob{pkey, parity, parityWG}:
+		case <-pc.quitC:
+			return false
+		}
+	}
+	parityWG.Wait()
+	return true
+}
+
 func (pc *PyramidChunker) enqueueDataChunk(chunkData []byte, size uint64, parent *TreeEntry, chunkWG *sync.WaitGroup) Address {
 	binary.LittleEndian.PutUint64(chunkData[:8], size)
 	pkey := parent.chunk[8+parent.branchCount*pc.hashSize : 8+(parent.branchCount+1)*pc.hashSize]
+	if pc.parities > 0 {
+		parent.children = append(parent.children, chunkData[:size+8])
+	}
 
 	chunkWG.Add(1)
 	select {
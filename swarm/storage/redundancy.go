@@ -0,0 +1,255 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/susy-go/susy-graviton/metrics"
+	"github.com/susy-go/susy-graviton/swarm/log"
+	"github.com/susy-go/susy-graviton/swarm/storage/erasure"
+)
+
+/*
+Erasure coding of the chunk tree
+
+At a redundancy level above RedundancyNone every tree chunk holds the
+references of parity chunks after the references of its children:
+
+data_{i} := size(subtree_{i}) || key_{j} || ... || key_{j+k-1} || parity_{0} || ... || parity_{m-1}
+
+The parity chunks are the Reed-Solomon parities of the payloads of the k
+children, padded to the chunk size, so any k of the children and parity chunks
+are enough to reconstruct the missing children. The payload of a parity chunk
+is the parity, its span is the chunk size.
+
+The number of parities m is fixed by the level, which is stored in the most
+significant byte of the span of the tree chunks. The byte is not part of the
+size: the chunkers do not split data of MaxSpan bytes or more, so the sizes in
+spans never reach it. Tree chunks have fewer children to make room for the
+parities, so the branching factor of the tree is also given by the level.
+*/
+
+// RedundancyLevel is the level of erasure coding of the chunk tree of a file
+type RedundancyLevel uint8
+
+const (
+	RedundancyNone     RedundancyLevel = iota // no parity chunks
+	RedundancyMedium                          // 1/16 of the references of tree chunks are parities
+	RedundancyStrong                          // 1/8 of the references of tree chunks are parities
+	RedundancyInsane                          // 1/4 of the references of tree chunks are parities
+	RedundancyParanoid                        // 1/2 of the references of tree chunks are parities
+)
+
+// spanSizeMask masks the byte of the redundancy level in spans
+const spanSizeMask = 1<<56 - 1
+
+// MaxSpan is the limit of the size of data split into a chunk tree, sizes
+// below it leave the byte of the redundancy level in spans free
+const MaxSpan = spanSizeMask + 1
+
+var (
+	errNoParities = errors.New("no parity chunks")
+	// ErrDataTooLarge is returned by the chunkers for data of MaxSpan bytes
+	// or more
+	ErrDataTooLarge = errors.New("data too large")
+)
+
+// Valid returns whether the redundancy level is known
+func (l RedundancyLevel) Valid() bool {
+	return l <= RedundancyParanoid
+}
+
+// parities returns the number of parity chunks of tree chunks which have
+// room for the given number of references
+func (l RedundancyLevel) parities(branches int64) int64 {
+	if l == RedundancyNone || !l.Valid() {
+		return 0
+	}
+	return branches >> (5 - uint(l))
+}
+
+// redundancy returns the redundancy level of a tree chunk
+// NOTE: this returns invalid data if chunk is encrypted
+func (c ChunkData) redundancy() RedundancyLevel {
+	return RedundancyLevel(c[7])
+}
+
+// encodeParities returns the parity chunks of the children of a tree chunk
+func encodeParities(children [][]byte, parities int64, chunkSize int64) ([]ChunkData, error) {
+	code, err := erasure.New(len(children), int(parities))
+	if err != nil {
+		return nil, err
+	}
+	shards := make([][]byte, len(children))
+	for i, child := range children {
+		shards[i] = make([]byte, chunkSize)
+		copy(shards[i], child[8:])
+	}
+	parity, err := code.Encode(shards)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]ChunkData, len(parity))
+	for i, p := range parity {
+		chunks[i] = make(ChunkData, chunkSize+8)
+		binary.LittleEndian.PutUint64(chunks[i][:8], uint64(chunkSize))
+		copy(chunks[i][8:], p)
+	}
+	return chunks, nil
+}
+
+// childSpans returns the spans of the k children of a tree chunk with the
+// given span. All children but the last span full subtrees.
+func childSpans(span uint64, k int64, chunkSize int64, branches int64) []uint64 {
+	subtree := uint64(chunkSize)
+	for k > 1 && uint64(k)*subtree < span {
+		subtree *= uint64(branches)
+	}
+	spans := make([]uint64, k)
+	for i := range spans {
+		spans[i] = subtree
+	}
+	if k == 1 {
+		subtree = 0
+	}
+	spans[k-1] = span - uint64(k-1)*subtree
+	return spans
+}
+
+// getChildren retrieves the children from start to end of a tree chunk with
+// parities. All its children and parity chunks are retrieved in parallel and
+// the retrieval stops as soon as either the children from start to end or any
+// k of them are retrieved, in which case the missing children are
+// reconstructed. The depth and treeSize are those the children are joined at.
+func (r *LazyChunkReader) getChildren(ctx context.Context, parent ChunkData, start, end int64, depth int, treeSize int64) ([]ChunkData, error) {
+	level := parent.redundancy()
+	m := level.parities(r.chunkSize / r.hashSize)
+	k := int64(len(parent)-8)/r.hashSize - m
+	if m == 0 || k <= 0 {
+		return nil, errNoParities
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		index int64
+		data  ChunkData
+		err   error
+	}
+	resultC := make(chan result, k+m)
+	for j := int64(0); j < k+m; j++ {
+		go func(j int64) {
+			ref := Reference(parent[8+j*r.hashSize : 8+(j+1)*r.hashSize])
+			data, err := r.getter.Get(ctx, ref)
+			resultC <- result{j, data, err}
+		}(j)
+	}
+
+	// race for the requested children or any k shards
+	children := make([]ChunkData, end-start)
+	shards := make([][]byte, k+m)
+	var retrieved, found, failed int64
+	for found < end-start && retrieved < k {
+		res := <-resultC
+		if res.err == nil && (len(res.data) < 9 || int64(len(res.data)) > r.chunkSize+8) {
+			res.err = fmt.Errorf("invalid chunk length %d", len(res.data))
+		}
+		if res.err != nil {
+			log.Debug("lazychunkreader.getchildren", "index", res.index, "err", res.err)
+			failed++
+			if failed > m {
+				return nil, fmt.Errorf("cannot recover children: %d of %d chunks not found", failed, k+m)
+			}
+			continue
+		}
+		if res.index >= start && res.index < end {
+			children[res.index-start] = res.data
+			found++
+		}
+		shards[res.index] = make([]byte, r.chunkSize)
+		copy(shards[res.index], res.data[8:])
+		retrieved++
+	}
+	cancel()
+	if found == end-start {
+		return children, nil
+	}
+
+	metrics.GetOrRegisterCounter("lazychunkreader.recover", nil).Inc(1)
+	code, err := erasure.New(int(k), int(m))
+	if err != nil {
+		return nil, err
+	}
+	if err := code.Reconstruct(shards); err != nil {
+		return nil, err
+	}
+	spans := childSpans(parent.Size(), k, r.chunkSize, r.branches)
+	for i := start; i < end; i++ {
+		if children[i-start] != nil {
+			continue
+		}
+		children[i-start], err = r.restoreChild(shards[i], spans[i], level, depth, treeSize)
+		if err != nil {
+			return nil, fmt.Errorf("cannot recover child %d: %v", i, err)
+		}
+	}
+	return children, nil
+}
+
+// restoreChild restores the span of a reconstructed child and trims its
+// padding, leaves are recognized the same way as in join
+func (r *LazyChunkReader) restoreChild(shard []byte, span uint64, level RedundancyLevel, depth int, treeSize int64) (ChunkData, error) {
+	for span < uint64(treeSize) && depth > r.depth {
+		treeSize /= r.branches
+		depth--
+	}
+	var length int64
+	if depth == r.depth {
+		if span > uint64(r.chunkSize) {
+			return nil, fmt.Errorf("invalid span %d", span)
+		}
+		length = int64(span)
+	} else {
+		// references are never zero, so the padding is the trailing zeros
+		for length = r.chunkSize; length > 0; length -= r.hashSize {
+			if !isZero(shard[length-r.hashSize : length]) {
+				break
+			}
+		}
+	}
+	child := make(ChunkData, length+8)
+	binary.LittleEndian.PutUint64(child[:8], span)
+	if depth != r.depth {
+		child[7] = byte(level)
+	}
+	copy(child[8:], shard[:length])
+	return child, nil
+}
+
+func isZero(b []byte) bool {
+	for _, x := range b {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
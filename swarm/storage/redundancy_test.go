@@ -0,0 +1,160 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	ch "github.com/susy-go/susy-graviton/swarm/chunk"
+	"github.com/susy-go/susy-graviton/swarm/testutil"
+)
+
+// lossyGetter is a Getter which does not find the chunks of lost references,
+// or does not respond to their requests until they are cancelled if stall
+// is set
+type lossyGetter struct {
+	Getter
+	lost  map[string]bool
+	stall bool
+}
+
+func (g *lossyGetter) Get(ctx context.Context, ref Reference) (ChunkData, error) {
+	if g.lost[string(ref)] {
+		if g.stall {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return nil, ErrChunkNotFound
+	}
+	return g.Getter.Get(ctx, ref)
+}
+
+// loseChildren marks the first and the last child of every tree chunk of the
+// tree with the given root as lost
+func loseChildren(t *testing.T, getter Getter, ref Reference, refSize int64, parities int64, lost map[string]bool) {
+	chunkData, err := getter.Get(context.TODO(), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunkData.Size() <= ch.DefaultSize {
+		return
+	}
+	k := int64(len(chunkData)-8)/refSize - parities
+	for i := int64(0); i < k; i++ {
+		child := Reference(chunkData[8+i*refSize : 8+(i+1)*refSize])
+		loseChildren(t, getter, child, refSize, parities, lost)
+		if i == 0 || (i == k-1 && parities > 1) {
+			lost[string(child)] = true
+		}
+	}
+}
+
+// TestRedundancy tests that files split with parity chunks are read if
+// chunks of the tree are lost
+func TestRedundancy(t *testing.T) {
+	for _, toEncrypt := range []bool{false, true} {
+		for _, level := range []RedundancyLevel{RedundancyMedium, RedundancyStrong, RedundancyInsane, RedundancyParanoid} {
+			for _, n := range []int{5*ch.DefaultSize + 1, 120 * ch.DefaultSize, 121 * ch.DefaultSize, 243*ch.DefaultSize + 17} {
+				t.Run(fmt.Sprintf("encrypt_%v_level_%d_size_%d", toEncrypt, level, n), func(t *testing.T) {
+					testRedundancy(t, toEncrypt, level, n, false)
+				})
+			}
+		}
+	}
+}
+
+// TestRedundancyStall tests that files split with parity chunks are read
+// without waiting for the chunks of the tree which are not delivered
+func TestRedundancyStall(t *testing.T) {
+	for _, toEncrypt := range []bool{false, true} {
+		t.Run(fmt.Sprintf("encrypt_%v", toEncrypt), func(t *testing.T) {
+			testRedundancy(t, toEncrypt, RedundancyStrong, 243*ch.DefaultSize+17, true)
+		})
+	}
+}
+
+func testRedundancy(t *testing.T, toEncrypt bool, level RedundancyLevel, n int, stall bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	putGetter := NewHasherStore(NewMapChunkStore(), MakeHashFunc(DefaultHash), toEncrypt, nil)
+	input := testutil.RandomBytes(1, n)
+	addr, wait, err := PyramidSplitRedundant(ctx, bytes.NewReader(input), putGetter, putGetter, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	refSize := putGetter.RefSize()
+	getter := &lossyGetter{
+		Getter: putGetter,
+		lost:   make(map[string]bool),
+		stall:  stall,
+	}
+	loseChildren(t, putGetter, Reference(addr), refSize, level.parities(ch.DefaultSize/refSize), getter.lost)
+	if len(getter.lost) == 0 {
+		t.Fatal("no chunks lost")
+	}
+
+	reader := TreeJoin(ctx, addr, getter, 0)
+	output := make([]byte, n)
+	r, err := reader.Read(output)
+	if r != n || err != io.EOF {
+		t.Fatalf("read error read: %v n = %v err = %v", r, n, err)
+	}
+	if !bytes.Equal(output, input) {
+		t.Fatal("input and output mismatch")
+	}
+	r, err = reader.ReadAt(output, int64(n/2))
+	if r != n-n/2 || err != io.EOF {
+		t.Fatalf("read error read: %v n = %v err = %v", r, n-n/2, err)
+	}
+	if !bytes.Equal(output[:r], input[n/2:]) {
+		t.Fatal("input and output mismatch")
+	}
+}
+
+// TestRedundancyNone tests that without parity chunks lost chunks can not be
+// recovered
+func TestRedundancyNone(t *testing.T) {
+	ctx := context.TODO()
+	n := 5*ch.DefaultSize + 1
+	putGetter := NewHasherStore(NewMapChunkStore(), MakeHashFunc(DefaultHash), false, nil)
+	addr, wait, err := PyramidSplitRedundant(ctx, bytes.NewReader(testutil.RandomBytes(1, n)), putGetter, putGetter, RedundancyNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	getter := &lossyGetter{
+		Getter: putGetter,
+		lost:   make(map[string]bool),
+	}
+	loseChildren(t, putGetter, Reference(addr), putGetter.RefSize(), 0, getter.lost)
+
+	reader := TreeJoin(ctx, addr, getter, 0)
+	if _, err := reader.Read(make([]byte, n)); err == nil || err == io.EOF {
+		t.Fatalf("expected error reading lost chunks, got %v", err)
+	}
+}
@@ -137,12 +137,15 @@ func (c AddressCollection) Swap(i, j int) {
 type Chunk interface {
 	Address() Address
 	Data() []byte
+	TagID() uint32
+	WithTagID(t uint32) Chunk
 }
 
 type chunk struct {
 	addr  Address
 	sdata []byte
 	span  int64
+	tagID uint32 // uid of the upload tag of the chunk, 0 if not tagged
 }
 
 func NewChunk(addr Address, data []byte) *chunk {
@@ -161,6 +164,17 @@ func (c *chunk) Data() []byte {
 	return c.sdata
 }
 
+// TagID returns the uid of the upload tag of the chunk
+func (c *chunk) TagID() uint32 {
+	return c.tagID
+}
+
+// WithTagID sets the uid of the upload tag of the chunk
+func (c *chunk) WithTagID(t uint32) Chunk {
+	c.tagID = t
+	return c
+}
+
 // String() for pretty printing
 func (self *chunk) String() string {
 	return fmt.Sprintf("Address: %v TreeSize: %v Chunksize: %v", self.addr.Log(), self.span, len(self.sdata))
@@ -253,7 +267,7 @@ type Getter interface {
 
 // NOTE: this returns invalid data if chunk is encrypted
 func (c ChunkData) Size() uint64 {
-	return binary.LittleEndian.Uint64(c[:8])
+	return binary.LittleEndian.Uint64(c[:8]) & spanSizeMask
 }
 
 type ChunkValidator interface {
@@ -304,6 +318,14 @@ type SyncChunkStore interface {
 	FetchFunc(ctx context.Context, ref Address) func(context.Context) error
 }
 
+// Pinner protects stored chunks from garbage collection.
+// Pins are counted, a chunk pinned several times has to be unpinned as many
+// times to be collected again.
+type Pinner interface {
+	PinChunk(ctx context.Context, addr Address) error
+	UnpinChunk(ctx context.Context, addr Address) error
+}
+
 // FakeChunkStore doesn't store anything, just implements the ChunkStore interface
 // It can be used to inject into a hasherStore if you don't want to actually store data just do the
 // hashing
@@ -0,0 +1,61 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"github.com/susy-go/susy-graviton/contracts/chequebook"
+	"github.com/susy-go/susy-graviton/p2p/enode"
+)
+
+// API is the RPC API of swap to inspect the balances and cheques of peers
+// and to cash the cheques
+type API struct {
+	swap *Swap
+}
+
+// NewAPI creates the swap API
+func NewAPI(s *Swap) *API {
+	return &API{swap: s}
+}
+
+// Balance returns the balance with a peer, positive if the peer owes the
+// local node
+func (a *API) Balance(peer enode.ID) (int64, error) {
+	return a.swap.GetPeerBalance(peer)
+}
+
+// Balances returns the balances with all peers accounted for since the
+// node started
+func (a *API) Balances() map[enode.ID]int64 {
+	return a.swap.Balances()
+}
+
+// SentCheque returns the last cheque sent to a peer
+func (a *API) SentCheque(peer enode.ID) (*chequebook.Cheque, error) {
+	return a.swap.SentCheque(peer)
+}
+
+// ReceivedCheque returns the last cheque received from a peer
+func (a *API) ReceivedCheque(peer enode.ID) (*chequebook.Cheque, error) {
+	return a.swap.ReceivedCheque(peer)
+}
+
+// Cash cashes the last cheque received from a connected peer and returns the
+// hash of the transaction
+func (a *API) Cash(peer enode.ID) (string, error) {
+	return a.swap.Cash(peer)
+}
@@ -0,0 +1,235 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/susy-go/susy-graviton/accounts/abi/bind"
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/contracts/chequebook"
+	"github.com/susy-go/susy-graviton/contracts/chequebook/contract"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/p2p"
+	"github.com/susy-go/susy-graviton/p2p/protocols"
+	"github.com/susy-go/susy-graviton/rpc"
+	"github.com/susy-go/susy-graviton/swarm/log"
+)
+
+// Spec is the spec of the swap protocol, which exchanges the chequebooks of
+// the peers in the handshake and the cheques settling their balances
+var Spec = &protocols.Spec{
+	Name:       "swap",
+	Version:    1,
+	MaxMsgSize: 10 * 1024 * 1024,
+	Messages: []interface{}{
+		HandshakeMsg{},
+		EmitChequeMsg{},
+	},
+}
+
+// HandshakeMsg advertises the chequebook of a node and the address it wants
+// to be paid to. The contract address is zero if the node has no chequebook.
+type HandshakeMsg struct {
+	ContractAddress common.Address // address of the chequebook contract
+	Beneficiary     common.Address // recipient of the cheques for the node
+	PublicKey       []byte         // public key of the chequebook owner, signing the cheques
+}
+
+func (hs *HandshakeMsg) String() string {
+	return fmt.Sprintf("Handshake: Contract: %v, Beneficiary: %v", hs.ContractAddress.Hex(), hs.Beneficiary.Hex())
+}
+
+// EmitChequeMsg sends a cheque to the beneficiary
+type EmitChequeMsg struct {
+	Cheque *chequebook.Cheque
+}
+
+// Peer is a peer of the swap protocol
+type Peer struct {
+	*protocols.Peer
+	swap         *Swap
+	inbox        *chequebook.Inbox          // receives the cheques of the peer, nil if it has no valid chequebook
+	outbox       *chequebook.Outbox         // issues cheques to the peer, nil if there is no local chequebook
+	contractAddr common.Address             // address of the peer's chequebook contract
+	contract     *contract.ChequebookCaller // peer's chequebook contract, checks the funds for its cheques
+}
+
+// Protocols implements the node.Service interface
+func (s *Swap) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{
+		{
+			Name:    Spec.Name,
+			Version: Spec.Version,
+			Length:  Spec.Length(),
+			Run:     s.run,
+		},
+	}
+}
+
+// APIs implements the node.Service interface
+func (s *Swap) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "swap",
+			Version:   "1.0",
+			Service:   NewAPI(s),
+			Public:    false,
+		},
+	}
+}
+
+// run is the protocol run function, it sets up the inbox and outbox for the
+// peer from the handshake and handles its cheques
+func (s *Swap) run(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	protoPeer := protocols.NewPeer(p, rw, Spec)
+	rhs, err := protoPeer.Handshake(context.Background(), s.handshake(), s.checkHandshake)
+	if err != nil {
+		return err
+	}
+	peer := s.newPeer(protoPeer, rhs.(*HandshakeMsg))
+
+	s.lock.Lock()
+	s.peers[peer.ID()] = peer
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.peers, peer.ID())
+		s.lock.Unlock()
+		if peer.inbox != nil {
+			peer.inbox.Stop()
+		}
+	}()
+
+	return peer.Run(peer.handleMsg)
+}
+
+// handshake returns the handshake of the local node
+func (s *Swap) handshake() *HandshakeMsg {
+	hs := &HandshakeMsg{
+		Beneficiary: s.beneficiary,
+		PublicKey:   crypto.CompressPubkey(&s.privateKey.PublicKey),
+	}
+	if s.backend != nil {
+		if ch := s.chequebookf(); ch != nil {
+			hs.ContractAddress = ch.Address()
+		}
+	}
+	return hs
+}
+
+// checkHandshake checks that the public key of the remote handshake is valid
+func (s *Swap) checkHandshake(hs interface{}) error {
+	rhs, ok := hs.(*HandshakeMsg)
+	if !ok {
+		return errors.New("invalid handshake")
+	}
+	if _, err := crypto.DecompressPubkey(rhs.PublicKey); err != nil {
+		return fmt.Errorf("invalid public key in handshake: %v", err)
+	}
+	return nil
+}
+
+// newPeer creates a swap peer, it gets an inbox if the peer's chequebook
+// contract is valid and an outbox if the local node has a chequebook
+func (s *Swap) newPeer(p *protocols.Peer, rhs *HandshakeMsg) *Peer {
+	peer := &Peer{
+		Peer: p,
+		swap: s,
+	}
+	if s.backend == nil {
+		return peer
+	}
+	if ch := s.chequebookf(); ch != nil {
+		peer.outbox = chequebook.NewOutbox(ch, rhs.Beneficiary)
+	}
+	if rhs.ContractAddress == (common.Address{}) {
+		return peer
+	}
+	ok, err := chequebook.ValidateCode(context.TODO(), s.backend, rhs.ContractAddress)
+	if !ok {
+		log.Info("invalid chequebook contract", "peer", p.ID(), "contract", rhs.ContractAddress.Hex(), "err", err)
+		return peer
+	}
+	// the public key is checked in the handshake
+	signer, _ := crypto.DecompressPubkey(rhs.PublicKey)
+	caller, err := contract.NewChequebookCaller(rhs.ContractAddress, s.backend)
+	if err != nil {
+		log.Warn("unable to bind chequebook contract", "peer", p.ID(), "contract", rhs.ContractAddress.Hex(), "err", err)
+		return peer
+	}
+	peer.inbox, err = chequebook.NewInbox(s.privateKey, rhs.ContractAddress, s.beneficiary, signer, s.backend)
+	if err != nil {
+		log.Warn("unable to set up chequebook inbox", "peer", p.ID(), "contract", rhs.ContractAddress.Hex(), "err", err)
+		return peer
+	}
+	peer.contractAddr = rhs.ContractAddress
+	peer.contract = caller
+	return peer
+}
+
+// handleMsg is the message handler of swap peers
+func (p *Peer) handleMsg(ctx context.Context, msg interface{}) error {
+	switch msg := msg.(type) {
+
+	case *EmitChequeMsg:
+		return p.handleEmitChequeMsg(ctx, msg)
+
+	default:
+		return fmt.Errorf("unknown message type: %T", msg)
+	}
+}
+
+// handleEmitChequeMsg verifies a cheque of the peer and credits its amount
+// to the peer's balance. Invalid cheques disconnect the peer.
+func (p *Peer) handleEmitChequeMsg(ctx context.Context, msg *EmitChequeMsg) error {
+	if p.inbox == nil {
+		return errNoChequebook
+	}
+	if msg.Cheque == nil || msg.Cheque.Amount == nil {
+		return errors.New("empty cheque")
+	}
+	if err := p.checkFunds(ctx, msg.Cheque); err != nil {
+		return err
+	}
+	amount, err := p.inbox.Receive(msg.Cheque)
+	if err != nil {
+		return fmt.Errorf("invalid cheque: %v", err)
+	}
+	return p.swap.receiveCheque(p.ID(), msg.Cheque, amount)
+}
+
+// checkFunds checks that the peer's chequebook is able to pay the cumulative
+// amount of a cheque. The contract pays out the difference to what it already
+// sent to the beneficiary, so its balance plus the amount sent must cover it.
+func (p *Peer) checkFunds(ctx context.Context, cheque *chequebook.Cheque) error {
+	balance, err := p.swap.backend.BalanceAt(ctx, p.contractAddr, nil)
+	if err != nil {
+		return fmt.Errorf("unable to get chequebook balance: %v", err)
+	}
+	sent, err := p.contract.Sent(&bind.CallOpts{Context: ctx}, p.swap.beneficiary)
+	if err != nil {
+		return fmt.Errorf("unable to get amount sent by chequebook: %v", err)
+	}
+	if funds := new(big.Int).Add(balance, sent); funds.Cmp(cheque.Amount) < 0 {
+		return fmt.Errorf("%v: cheque amount %v, funds %v", errInsufficientFunds, cheque.Amount, funds)
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/susy-go/susy-graviton/accounts/abi/bind"
+	"github.com/susy-go/susy-graviton/accounts/abi/bind/backends"
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/contracts/chequebook"
+	"github.com/susy-go/susy-graviton/contracts/chequebook/contract"
+	"github.com/susy-go/susy-graviton/core"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/p2p"
+	"github.com/susy-go/susy-graviton/p2p/enode"
+	"github.com/susy-go/susy-graviton/p2p/protocols"
+	p2ptest "github.com/susy-go/susy-graviton/p2p/testing"
+	"github.com/susy-go/susy-graviton/swarm/state"
+)
+
+var (
+	localKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	remoteKey, _ = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+	localAddr    = crypto.PubkeyToAddress(localKey.PublicKey)
+	remoteAddr   = crypto.PubkeyToAddress(remoteKey.PublicKey)
+)
+
+// swapTester is a protocol tester of a swap node with a chequebook, connected
+// to a remote peer which has a chequebook on the same simulated backend
+type swapTester struct {
+	*p2ptest.ProtocolTester
+	swap             *Swap
+	backend          *backends.SimulatedBackend
+	localChequebook  *chequebook.Chequebook
+	remoteChequebook *chequebook.Chequebook
+	dir              string
+}
+
+func newSwapTester(t *testing.T, params *Params) *swapTester {
+	dir, err := ioutil.TempDir("", "swap_protocol_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		localAddr:  {Balance: big.NewInt(1000000000)},
+		remoteAddr: {Balance: big.NewInt(1000000000)},
+	}, 10000000)
+	localChequebook := newTestChequebook(t, dir, localKey, backend)
+	remoteChequebook := newTestChequebook(t, dir, remoteKey, backend)
+
+	stateStore, err := state.NewDBStore(filepath.Join(dir, "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap := New(stateStore, localKey, func() *chequebook.Chequebook { return localChequebook }, backend, params)
+	return &swapTester{
+		ProtocolTester:   p2ptest.NewProtocolTester(enode.PubkeyToIDV4(&localKey.PublicKey), 1, swap.run),
+		swap:             swap,
+		backend:          backend,
+		localChequebook:  localChequebook,
+		remoteChequebook: remoteChequebook,
+		dir:              dir,
+	}
+}
+
+// newTestChequebook deploys a chequebook contract funded with 1000 wei
+func newTestChequebook(t *testing.T, dir string, prvKey *ecdsa.PrivateKey, backend *backends.SimulatedBackend) *chequebook.Chequebook {
+	opts := bind.NewKeyedTransactor(prvKey)
+	opts.Value = big.NewInt(1000)
+	addr, _, _, err := contract.DeployChequebook(opts, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Commit()
+	path := filepath.Join(dir, addr.Hex()+".json")
+	chbook, err := chequebook.NewChequebook(path, addr, prvKey, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chbook
+}
+
+func (s *swapTester) Close() {
+	s.Stop()
+	s.swap.Close()
+	os.RemoveAll(s.dir)
+}
+
+// handshake runs the handshake with the remote peer and waits until the
+// peer is registered
+func (s *swapTester) handshake(t *testing.T) enode.ID {
+	id := s.Nodes[0].ID()
+	err := s.TestExchanges(p2ptest.Exchange{
+		Label: "handshake",
+		Expects: []p2ptest.Expect{
+			{
+				Code: 0,
+				Msg: &HandshakeMsg{
+					ContractAddress: s.localChequebook.Address(),
+					Beneficiary:     localAddr,
+					PublicKey:       crypto.CompressPubkey(&localKey.PublicKey),
+				},
+				Peer: id,
+			},
+		},
+		Triggers: []p2ptest.Trigger{
+			{
+				Code: 0,
+				Msg: &HandshakeMsg{
+					ContractAddress: s.remoteChequebook.Address(),
+					Beneficiary:     remoteAddr,
+					PublicKey:       crypto.CompressPubkey(&remoteKey.PublicKey),
+				},
+				Peer: id,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		s.swap.lock.RLock()
+		_, ok := s.swap.peers[id]
+		s.swap.lock.RUnlock()
+		if ok {
+			return id
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("peer not registered after handshake")
+	return id
+}
+
+// TestEmitCheque tests that crossing the payment threshold sends a cheque
+// for the debt to the peer
+func TestEmitCheque(t *testing.T) {
+	s := newSwapTester(t, &Params{PaymentThreshold: 100, DisconnectThreshold: 1000})
+	defer s.Close()
+
+	id := s.handshake(t)
+	peer := protocols.NewPeer(p2p.NewPeer(id, "remote", nil), nil, nil)
+
+	if err := s.swap.Add(-99, peer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.swap.SentCheque(id); err != state.ErrNotFound {
+		t.Fatalf("expected no cheque below the payment threshold, got error %v", err)
+	}
+	if err := s.swap.Add(-51, peer); err != nil {
+		t.Fatal(err)
+	}
+	cheque, err := s.swap.SentCheque(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cheque.Amount.Int64() != 150 || cheque.Beneficiary != remoteAddr || cheque.Contract != s.localChequebook.Address() {
+		t.Fatalf("unexpected cheque %v", cheque)
+	}
+	err = s.TestExchanges(p2ptest.Exchange{
+		Label: "cheque",
+		Expects: []p2ptest.Expect{
+			{
+				Code: 1,
+				Msg:  &EmitChequeMsg{Cheque: cheque},
+				Peer: id,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance, _ := s.swap.GetPeerBalance(id); balance != 0 {
+		t.Fatalf("expected balance 0 after paying, got %d", balance)
+	}
+	if balance := s.localChequebook.Balance(); balance.Int64() != 850 {
+		t.Fatalf("expected chequebook balance 850, got %v", balance)
+	}
+}
+
+// TestReceiveCheque tests that cheques of the peer are credited to its
+// balance and can be cashed
+func TestReceiveCheque(t *testing.T) {
+	s := newSwapTester(t, NewParams())
+	defer s.Close()
+
+	id := s.handshake(t)
+	peer := protocols.NewPeer(p2p.NewPeer(id, "remote", nil), nil, nil)
+	if err := s.swap.Add(300, peer); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, amount := range []int64{100, 200} {
+		cheque, err := s.remoteChequebook.Issue(localAddr, big.NewInt(amount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.TestExchanges(p2ptest.Exchange{
+			Label: "cheque",
+			Triggers: []p2ptest.Trigger{
+				{
+					Code: 1,
+					Msg:  &EmitChequeMsg{Cheque: cheque},
+					Peer: id,
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the cheque is handled asynchronously
+		for j := 0; j < 100; j++ {
+			if received, err := s.swap.ReceivedCheque(id); err == nil && received.Amount.Cmp(cheque.Amount) == 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		balance, err := s.swap.GetPeerBalance(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := []int64{200, 0}[i]; balance != expected {
+			t.Fatalf("expected balance %d after cheque %d, got %d", expected, i, balance)
+		}
+	}
+
+	if _, err := s.swap.Cash(id); err != nil {
+		t.Fatal(err)
+	}
+	s.backend.Commit()
+	session, err := contract.NewChequebook(s.remoteChequebook.Address(), s.backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent, err := session.Sent(nil, localAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.Cmp(big.NewInt(300)) != 0 {
+		t.Fatalf("expected 300 cashed, got %v", sent)
+	}
+	if _, err := s.swap.Cash(enode.ID(common.HexToHash("0x01"))); err != ErrPeerNotFound {
+		t.Fatalf("expected error %v, got %v", ErrPeerNotFound, err)
+	}
+}
+
+// TestReceiveChequeInsufficientFunds tests that a cheque for more than the
+// chequebook of the peer is able to pay is rejected and not credited
+func TestReceiveChequeInsufficientFunds(t *testing.T) {
+	s := newSwapTester(t, NewParams())
+	defer s.Close()
+
+	id := s.handshake(t)
+	peer := protocols.NewPeer(p2p.NewPeer(id, "remote", nil), nil, nil)
+	if err := s.swap.Add(500, peer); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second chequebook on the same contract issues cheques for the funds
+	// which the first one pays out to another beneficiary
+	path := filepath.Join(s.dir, "double.json")
+	double, err := chequebook.NewChequebook(path, s.remoteChequebook.Address(), remoteKey, s.backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.remoteChequebook.Issue(common.HexToAddress("0xbeef"), big.NewInt(800))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.remoteChequebook.Cash(other); err != nil {
+		t.Fatal(err)
+	}
+	s.backend.Commit()
+
+	cheque, err := double.Issue(localAddr, big.NewInt(500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.TestExchanges(p2ptest.Exchange{
+		Label: "cheque",
+		Triggers: []p2ptest.Trigger{
+			{
+				Code: 1,
+				Msg:  &EmitChequeMsg{Cheque: cheque},
+				Peer: id,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.TestDisconnected(&p2ptest.Disconnect{
+		Peer:  id,
+		Error: errors.New("Message handler error: (msg code 1): " + errInsufficientFunds.Error() + ": cheque amount 500, funds 200"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.swap.ReceivedCheque(id); err != state.ErrNotFound {
+		t.Fatalf("expected no received cheque, got error %v", err)
+	}
+	if balance, _ := s.swap.GetPeerBalance(id); balance != 500 {
+		t.Fatalf("expected balance 500, got %d", balance)
+	}
+}
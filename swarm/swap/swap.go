@@ -17,38 +17,103 @@
 package swap
 
 import (
+	"context"
+	"crypto/ecdsa"
 	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 	"sync"
 
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/contracts/chequebook"
+	"github.com/susy-go/susy-graviton/crypto"
 	"github.com/susy-go/susy-graviton/p2p/enode"
 	"github.com/susy-go/susy-graviton/p2p/protocols"
 	"github.com/susy-go/susy-graviton/swarm/log"
 	"github.com/susy-go/susy-graviton/swarm/state"
 )
 
+const (
+	// DefaultPaymentThreshold is the debt to a peer which triggers sending
+	// it a cheque
+	DefaultPaymentThreshold = 1000000
+	// DefaultDisconnectThreshold is the debt of a peer at which it is
+	// disconnected
+	DefaultDisconnectThreshold = 1500000
+
+	sentChequePrefix     = "sent_cheque_"
+	receivedChequePrefix = "received_cheque_"
+)
+
+var (
+	// ErrDisconnectThreshold is returned by Add if the balance with a peer
+	// would cross the disconnect threshold
+	ErrDisconnectThreshold = errors.New("balance crosses the disconnect threshold")
+	// ErrPeerNotFound is returned for peers without balance or connection
+	ErrPeerNotFound = errors.New("Peer not found")
+	errNoChequebook = errors.New("no chequebook")
+	// errInsufficientFunds is returned for cheques which the chequebook of
+	// the issuer is unable to pay
+	errInsufficientFunds = errors.New("insufficient chequebook funds")
+)
+
+// Params are the thresholds of the balances with peers, in the units of the
+// accounting, which are the same as the units of the cheques (wei)
+type Params struct {
+	PaymentThreshold    int64 // debt to a peer which triggers sending a cheque
+	DisconnectThreshold int64 // debt of a peer at which it is disconnected
+}
+
+// NewParams returns the default thresholds
+func NewParams() *Params {
+	return &Params{
+		PaymentThreshold:    DefaultPaymentThreshold,
+		DisconnectThreshold: DefaultDisconnectThreshold,
+	}
+}
+
 // SwAP Swarm Accounting Protocol
 // a peer to peer micropayment system
 // A node maintains an individual balance with every peer
 // Only messages which have a price will be accounted for
+// Debts to peers above the payment threshold are settled by sending them
+// cheques of the local chequebook
 type Swap struct {
-	stateStore state.Store        //stateStore is needed in order to keep balances across sessions
-	lock       sync.RWMutex       //lock the balances
-	balances   map[enode.ID]int64 //map of balances for each peer
+	stateStore  state.Store                   //stateStore is needed in order to keep balances across sessions
+	lock        sync.RWMutex                  //lock the balances
+	balances    map[enode.ID]int64            //map of balances for each peer
+	peers       map[enode.ID]*Peer            //connected peers of the swap protocol
+	params      *Params                       //payment and disconnect thresholds
+	privateKey  *ecdsa.PrivateKey             //key of the chequebook owner, signs cheques and cashing transactions
+	beneficiary common.Address                //address receiving the payments of peers
+	chequebookf func() *chequebook.Chequebook //local chequebook issuing cheques, may return nil
+	backend     chequebook.Backend            //blockchain backend to verify and cash cheques, may be nil
 }
 
 // New - swap constructor
-func New(stateStore state.Store) (swap *Swap) {
+// The chequebook function returns the local chequebook, it may return nil
+// until the chequebook is set up. If the backend is nil cheques are neither
+// sent nor received, only the balances are kept.
+func New(stateStore state.Store, prvkey *ecdsa.PrivateKey, chequebookf func() *chequebook.Chequebook, backend chequebook.Backend, params *Params) (swap *Swap) {
 	swap = &Swap{
-		stateStore: stateStore,
-		balances:   make(map[enode.ID]int64),
+		stateStore:  stateStore,
+		balances:    make(map[enode.ID]int64),
+		peers:       make(map[enode.ID]*Peer),
+		params:      params,
+		privateKey:  prvkey,
+		beneficiary: crypto.PubkeyToAddress(prvkey.PublicKey),
+		chequebookf: chequebookf,
+		backend:     backend,
 	}
 	return
 }
 
 //Swap implements the protocols.Balance interface
 //Add is the (sole) accounting function
+//If the peer's debt would cross the disconnect threshold an error is
+//returned and the balance is not changed. If the local debt crosses the
+//payment threshold a cheque is sent to the peer.
 func (s *Swap) Add(amount int64, peer *protocols.Peer) (err error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -60,13 +125,97 @@ func (s *Swap) Add(amount int64, peer *protocols.Peer) (err error) {
 	}
 	//adjust the balance
 	//if amount is negative, it will decrease, otherwise increase
-	s.balances[peer.ID()] += amount
+	peerBalance := s.balances[peer.ID()] + amount
+	if peerBalance > s.params.DisconnectThreshold {
+		log.Warn("balance crosses the disconnect threshold", "peer", peer.ID(), "balance", peerBalance)
+		return ErrDisconnectThreshold
+	}
+	s.balances[peer.ID()] = peerBalance
 	//save the new balance to the state store
-	peerBalance := s.balances[peer.ID()]
 	err = s.stateStore.Put(peer.ID().String(), &peerBalance)
-
+	if err != nil {
+		return err
+	}
 	log.Debug(fmt.Sprintf("balance for peer %s: %s", peer.ID().String(), strconv.FormatInt(peerBalance, 10)))
-	return err
+
+	if peerBalance <= -s.params.PaymentThreshold {
+		if err := s.sendCheque(peer.ID()); err != nil {
+			//not paying is not fatal until the peer disconnects
+			log.Warn("unable to send cheque", "peer", peer.ID(), "err", err)
+		}
+	}
+	return nil
+}
+
+//sendCheque issues a cheque for the debt to the peer and sends it
+//the caller must hold s.lock
+func (s *Swap) sendCheque(id enode.ID) error {
+	p, ok := s.peers[id]
+	if !ok || p.outbox == nil {
+		return errNoChequebook
+	}
+	amount := -s.balances[id]
+	promise, err := p.outbox.Issue(big.NewInt(amount))
+	if err != nil {
+		return err
+	}
+	cheque := promise.(*chequebook.Cheque)
+	if err := s.stateStore.Put(sentChequePrefix+id.String(), cheque); err != nil {
+		return err
+	}
+	peerBalance := s.balances[id] + amount
+	if err := s.stateStore.Put(id.String(), &peerBalance); err != nil {
+		return err
+	}
+	s.balances[id] = peerBalance
+	log.Debug("sending cheque", "peer", id, "amount", amount, "cheque", cheque)
+
+	//the message is sent on the swap protocol, so it is not accounted for
+	//and it is sent asynchronously not to block accounting
+	go func() {
+		if err := p.Send(context.TODO(), &EmitChequeMsg{Cheque: cheque}); err != nil {
+			log.Warn("unable to send cheque message", "peer", id, "err", err)
+		}
+	}()
+	return nil
+}
+
+//receiveCheque credits the peer with the amount of a verified cheque
+//the amount is the difference to the last cheque received from the peer,
+//which may be more recent than what the inbox knows after a restart
+func (s *Swap) receiveCheque(id enode.ID, cheque *chequebook.Cheque, amount *big.Int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var last chequebook.Cheque
+	err := s.stateStore.Get(receivedChequePrefix+id.String(), &last)
+	if err != nil && err != state.ErrNotFound {
+		return err
+	}
+	if err == nil && last.Amount != nil {
+		amount = new(big.Int).Sub(cheque.Amount, last.Amount)
+		if amount.Sign() <= 0 {
+			return fmt.Errorf("cheque amount %v not above last cheque amount %v", cheque.Amount, last.Amount)
+		}
+	}
+	if !amount.IsInt64() {
+		return fmt.Errorf("cheque amount %v out of range", amount)
+	}
+	if err := s.stateStore.Put(receivedChequePrefix+id.String(), cheque); err != nil {
+		return err
+	}
+	if _, ok := s.balances[id]; !ok {
+		var peerBalance int64
+		err := s.stateStore.Get(id.String(), &peerBalance)
+		if err != nil && err != state.ErrNotFound {
+			return err
+		}
+		s.balances[id] = peerBalance
+	}
+	peerBalance := s.balances[id] - amount.Int64()
+	s.balances[id] = peerBalance
+	log.Debug("received cheque", "peer", id, "amount", amount, "balance", peerBalance)
+	return s.stateStore.Put(id.String(), &peerBalance)
 }
 
 //GetPeerBalance returns the balance for a given peer
@@ -76,7 +225,52 @@ func (swap *Swap) GetPeerBalance(peer enode.ID) (int64, error) {
 	if p, ok := swap.balances[peer]; ok {
 		return p, nil
 	}
-	return 0, errors.New("Peer not found")
+	return 0, ErrPeerNotFound
+}
+
+//Balances returns the balances of the peers accounted for in this session
+func (swap *Swap) Balances() map[enode.ID]int64 {
+	swap.lock.RLock()
+	defer swap.lock.RUnlock()
+	balances := make(map[enode.ID]int64, len(swap.balances))
+	for id, balance := range swap.balances {
+		balances[id] = balance
+	}
+	return balances
+}
+
+//SentCheque returns the last cheque sent to a peer
+func (swap *Swap) SentCheque(peer enode.ID) (*chequebook.Cheque, error) {
+	return swap.loadCheque(sentChequePrefix, peer)
+}
+
+//ReceivedCheque returns the last cheque received from a peer
+func (swap *Swap) ReceivedCheque(peer enode.ID) (*chequebook.Cheque, error) {
+	return swap.loadCheque(receivedChequePrefix, peer)
+}
+
+//Cash cashes the last cheque received from a connected peer and returns
+//the hash of the cashing transaction
+func (swap *Swap) Cash(peer enode.ID) (string, error) {
+	swap.lock.RLock()
+	p, ok := swap.peers[peer]
+	swap.lock.RUnlock()
+	if !ok {
+		return "", ErrPeerNotFound
+	}
+	if p.inbox == nil {
+		return "", errNoChequebook
+	}
+	return p.inbox.Cash()
+}
+
+//loadCheque loads a cheque of a peer from the state store
+func (swap *Swap) loadCheque(prefix string, peer enode.ID) (*chequebook.Cheque, error) {
+	cheque := &chequebook.Cheque{}
+	if err := swap.stateStore.Get(prefix+peer.String(), cheque); err != nil {
+		return nil, err
+	}
+	return cheque, nil
 }
 
 //load balances from the state store (persisted)
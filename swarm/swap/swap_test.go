@@ -25,6 +25,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/susy-go/susy-graviton/contracts/chequebook"
+	"github.com/susy-go/susy-graviton/crypto"
 	"github.com/susy-go/susy-graviton/log"
 	"github.com/susy-go/susy-graviton/p2p"
 	"github.com/susy-go/susy-graviton/p2p/protocols"
@@ -119,6 +121,28 @@ func TestRepeatedBookings(t *testing.T) {
 	}
 }
 
+//Test that a peer's debt can not cross the disconnect threshold
+func TestDisconnectThreshold(t *testing.T) {
+	//create a test swap account
+	swap, testDir := createTestSwap(t)
+	defer os.RemoveAll(testDir)
+
+	testPeer := newDummyPeer()
+	if err := swap.Add(DefaultDisconnectThreshold, testPeer.Peer); err != nil {
+		t.Fatal(err)
+	}
+	if err := swap.Add(1, testPeer.Peer); err != ErrDisconnectThreshold {
+		t.Fatalf("Expected error %v, got %v", ErrDisconnectThreshold, err)
+	}
+	if b := swap.balances[testPeer.ID()]; b != DefaultDisconnectThreshold {
+		t.Fatalf("Expected balance to stay at %d, but is %d", DefaultDisconnectThreshold, b)
+	}
+	//local debt does not disconnect
+	if err := swap.Add(-2*DefaultDisconnectThreshold, testPeer.Peer); err != nil {
+		t.Fatal(err)
+	}
+}
+
 //try restoring a balance from state store
 //this is simulated by creating a node,
 //assigning it an arbitrary balance,
@@ -165,7 +189,11 @@ func createTestSwap(t *testing.T) (*Swap, string) {
 	if err2 != nil {
 		t.Fatal(err2)
 	}
-	swap := New(stateStore)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap := New(stateStore, key, func() *chequebook.Chequebook { return nil }, nil, NewParams())
 	return swap, dir
 }
 
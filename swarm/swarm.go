@@ -41,15 +41,19 @@ import (
 	"github.com/susy-go/susy-graviton/params"
 	"github.com/susy-go/susy-graviton/rpc"
 	"github.com/susy-go/susy-graviton/swarm/api"
+	"github.com/susy-go/susy-graviton/swarm/chunk"
 	httpapi "github.com/susy-go/susy-graviton/swarm/api/http"
 	"github.com/susy-go/susy-graviton/swarm/fuse"
 	"github.com/susy-go/susy-graviton/swarm/log"
 	"github.com/susy-go/susy-graviton/swarm/network"
 	"github.com/susy-go/susy-graviton/swarm/network/stream"
 	"github.com/susy-go/susy-graviton/swarm/pss"
+	"github.com/susy-go/susy-graviton/swarm/pss/mailbox"
+	"github.com/susy-go/susy-graviton/swarm/pushsync"
 	"github.com/susy-go/susy-graviton/swarm/state"
 	"github.com/susy-go/susy-graviton/swarm/storage"
 	"github.com/susy-go/susy-graviton/swarm/storage/feed"
+	"github.com/susy-go/susy-graviton/swarm/storage/localstore"
 	"github.com/susy-go/susy-graviton/swarm/storage/mock"
 	"github.com/susy-go/susy-graviton/swarm/swap"
 	"github.com/susy-go/susy-graviton/swarm/tracing"
@@ -63,6 +67,10 @@ var (
 	requestsCacheGauge = metrics.NewRegisteredGauge("storage.cache.requests.size", nil)
 )
 
+// pushSyncCapacity is the number of synced chunks kept in the push sync queue
+// before they are garbage collected, the chunks themselves live in the local store
+const pushSyncCapacity = 10000
+
 // the swarm stack
 type Swarm struct {
 	config            *api.Config        // swarm configuration
@@ -74,8 +82,13 @@ type Swarm struct {
 	backend           chequebook.Backend // simple blockchain Backend
 	privateKey        *ecdsa.PrivateKey
 	netStore          *storage.NetStore
+	lstore            *storage.LocalStore
+	pushDB            *localstore.DB // queue of the uploaded chunks to push to their neighbourhood
+	pusher            *pushsync.Pusher
+	storer            *pushsync.Storer
 	sfs               *fuse.SwarmFS // need this to cleanup all the active mounts on node exit
 	ps                *pss.Pss
+	mailbox           *mailbox.Mailbox
 	swap              *swap.Swap
 	stateStore        *state.DBStore
 	accountingMetrics *protocols.AccountingMetrics
@@ -150,6 +163,7 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		return nil, err
 	}
 
+	self.lstore = lstore
 	self.netStore, err = storage.NewNetStore(lstore, nil)
 	if err != nil {
 		return nil, err
@@ -167,7 +181,7 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		if err != nil {
 			return nil, err
 		}
-		self.swap = swap.New(balancesStore)
+		self.swap = swap.New(balancesStore, self.privateKey, config.Swap.Chequebook, backend, swap.NewParams())
 		self.accountingMetrics = protocols.SetupAccountingMetrics(10*time.Second, filepath.Join(config.Path, "metrics.db"))
 	}
 
@@ -195,8 +209,19 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 	}
 	self.streamer = stream.NewRegistry(nodeID, delivery, self.netStore, self.stateStore, registryOptions, self.swap)
 
-	// Swarm Hash Merklised Chunking for Arbitrary-length Document/File storage
-	self.fileStore = storage.NewFileStore(self.netStore, self.config.FileStoreParams)
+	// uploaded chunks are queued in the push index to be pushed to their neighbourhood
+	self.pushDB, err = localstore.New(filepath.Join(config.Path, "pushsync"), common.FromHex(config.BzzKey), &localstore.Options{
+		Capacity:      pushSyncCapacity,
+		MetricsPrefix: "pushsync",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Swarm Hash Merklised Chunking for Arbitrary-length Document/File storage,
+	// counting the progress of tagged uploads until their chunks are synced
+	tags := chunk.NewTags()
+	self.fileStore = storage.NewFileStore(pushsync.NewUploadStore(self.netStore, self.pushDB, tags), self.config.FileStoreParams, tags)
 
 	var feedsHandler *feed.Handler
 	fhParams := &feed.HandlerParams{}
@@ -226,8 +251,13 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 	if pss.IsActiveHandshake {
 		pss.SetHandshakeController(self.ps, pss.NewHandshakeParams())
 	}
+	pss.SetRequestController(self.ps, pss.NewRequestParams())
+
+	// messages for offline pss recipients are stored in swarm
+	self.mailbox = mailbox.New(self.privateKey, self.fileStore, feedsHandler)
 
 	self.api = api.NewAPI(self.fileStore, self.dns, feedsHandler, self.privateKey)
+	self.api.SetPinning(lstore, self.stateStore)
 
 	self.sfs = fuse.NewSwarmFS(self.api)
 	log.Debug("Initialized FUSE filesystem")
@@ -377,12 +407,29 @@ func (s *Swarm) Start(srv *p2p.Server) error {
 
 	if s.ps != nil {
 		s.ps.Start(srv)
+
+		// push the uploaded chunks to their neighbourhood, and store the ones
+		// pushed to this node unless it is a light node
+		pubsub := pss.NewPubSub(s.ps)
+		s.pusher = pushsync.NewPusher(s.pushDB, pubsub, s.fileStore.Tags())
+		if !s.config.LightNodeEnabled {
+			s.storer = pushsync.NewStorer(s.netStore, pubsub, s.privateKey, s.lstore.Validators...)
+		}
 	}
 
 	// start swarm http proxy server
 	if s.config.Port != "" {
 		addr := net.JoinHostPort(s.config.ListenAddr, s.config.Port)
-		server := httpapi.NewServer(s.api, s.config.Cors)
+		var gateway *httpapi.GatewayParams
+		if s.config.GatewayMode {
+			gateway = &httpapi.GatewayParams{
+				AuthTokens:  s.config.GatewayAuthTokens,
+				Quota:       s.config.GatewayQuota,
+				QuotaPeriod: s.config.GatewayQuotaPeriod,
+			}
+			log.Info("Swarm HTTP proxy in gateway mode", "quota", s.config.GatewayQuota, "period", s.config.GatewayQuotaPeriod)
+		}
+		server := httpapi.NewGatewayServer(s.api, s.config.Cors, gateway)
 
 		if s.config.Cors != "" {
 			log.Debug("Swarm HTTP proxy CORS headers", "allowedOrigins", s.config.Cors)
@@ -431,6 +478,12 @@ func (s *Swarm) Stop() error {
 		}
 	}
 
+	if s.pusher != nil {
+		s.pusher.Close()
+	}
+	if s.storer != nil {
+		s.storer.Close()
+	}
 	if s.ps != nil {
 		s.ps.Stop()
 	}
@@ -447,6 +500,9 @@ func (s *Swarm) Stop() error {
 	if s.netStore != nil {
 		s.netStore.Close()
 	}
+	if s.pushDB != nil {
+		s.pushDB.Close()
+	}
 	s.sfs.Stop()
 	stopCounter.Inc(1)
 	s.streamer.Stop()
@@ -476,6 +532,9 @@ func (s *Swarm) Protocols() (protos []p2p.Protocol) {
 		if s.ps != nil {
 			protos = append(protos, s.ps.Protocols()...)
 		}
+		if s.swap != nil {
+			protos = append(protos, s.swap.Protocols()...)
+		}
 	}
 	return
 }
@@ -525,6 +584,14 @@ func (s *Swarm) APIs() []rpc.API {
 		apis = append(apis, s.ps.APIs()...)
 	}
 
+	if s.mailbox != nil {
+		apis = append(apis, s.mailbox.APIs()...)
+	}
+
+	if s.swap != nil {
+		apis = append(apis, s.swap.APIs()...)
+	}
+
 	return apis
 }
 
@@ -90,7 +90,14 @@ type Database struct {
 	dirtiesSize   common.StorageSize // Storage size of the dirty node cache (exc. flushlist)
 	preimagesSize common.StorageSize // Storage size of the preimages cache
 
-	lock sync.RWMutex
+	refcount   bool                     // Whether flushed nodes are reference counted on disk
+	refdeltas  map[common.Hash]int64    // Reference count changes of flushed nodes not yet persisted
+	refdeleted map[common.Hash]struct{} // Unreferenced nodes deleted in the pending batch
+	refnodes   uint64                   // Nodes deleted from disk since last commit
+	refsize    common.StorageSize       // Data storage deleted from disk since last commit
+
+	lock    sync.RWMutex
+	reflock sync.Mutex // Lock protecting refdeltas, which are also changed while only reading the cache
 }
 
 // rawNode is a simple binary blob used to differentiate between collapsed trie
@@ -298,6 +305,24 @@ func NewDatabaseWithCache(diskdb sofdb.Database, cache int) *Database {
 	}
 }
 
+// NewDatabaseWithRefcount creates a new trie database like NewDatabaseWithCache,
+// which also reference counts the nodes it flushes to disk. Nodes are deleted
+// from disk once neither a live node, nor a flushed one, nor a committed root
+// references them any more. Committed roots are retained until released.
+func NewDatabaseWithRefcount(diskdb sofdb.Database, cache int) *Database {
+	db := NewDatabaseWithCache(diskdb, cache)
+	db.refcount = true
+	db.refdeltas = make(map[common.Hash]int64)
+	db.refdeleted = make(map[common.Hash]struct{})
+	return db
+}
+
+// Refcount reports whether the database reference counts the nodes flushed to
+// disk.
+func (db *Database) Refcount() bool {
+	return db.refcount
+}
+
 // DiskDB retrieves the persistent storage backing the trie database.
 func (db *Database) DiskDB() DatabaseReader {
 	return db.diskdb
@@ -332,6 +357,8 @@ func (db *Database) insert(hash common.Hash, blob []byte, node node) {
 	for _, child := range entry.childs() {
 		if c := db.dirties[child]; c != nil {
 			c.parents++
+		} else if db.refcount {
+			db.refdeltas[child]++
 		}
 	}
 	db.dirties[hash] = entry
@@ -474,18 +501,25 @@ func (db *Database) Reference(child common.Hash, parent common.Hash) {
 
 // reference is the private locked version of Reference.
 func (db *Database) reference(child common.Hash, parent common.Hash) {
-	// If the node does not exist, it's a node pulled from disk, skip
+	// If the node does not exist, it's a node pulled from disk, skip unless its
+	// references are counted on disk
 	node, ok := db.dirties[child]
-	if !ok {
+	if !ok && !db.refcount {
 		return
 	}
 	// If the reference already exists, only duplicate for roots
 	if db.dirties[parent].children == nil {
 		db.dirties[parent].children = make(map[common.Hash]uint16)
-	} else if _, ok = db.dirties[parent].children[child]; ok && parent != (common.Hash{}) {
+	} else if _, exists := db.dirties[parent].children[child]; exists && parent != (common.Hash{}) {
 		return
 	}
-	node.parents++
+	if ok {
+		node.parents++
+	} else {
+		db.reflock.Lock()
+		db.refdeltas[child]++
+		db.reflock.Unlock()
+	}
 	db.dirties[parent].children[child]++
 }
 
@@ -500,7 +534,15 @@ func (db *Database) Dereference(root common.Hash) {
 	defer db.lock.Unlock()
 
 	nodes, storage, start := len(db.dirties), db.dirtiesSize, time.Now()
-	db.dereference(root, common.Hash{})
+	batch := db.diskdb.NewBatch()
+	if err := db.dereference(root, common.Hash{}, batch); err != nil {
+		log.Error("Failed to dereference trie from disk", "err", err)
+	}
+	if db.refcount {
+		if err := db.writeRefdeleted(batch); err != nil {
+			log.Error("Failed to delete trie nodes from disk", "err", err)
+		}
+	}
 
 	db.gcnodes += uint64(nodes - len(db.dirties))
 	db.gcsize += storage - db.dirtiesSize
@@ -515,20 +557,32 @@ func (db *Database) Dereference(root common.Hash) {
 }
 
 // dereference is the private locked version of Dereference.
-func (db *Database) dereference(child common.Hash, parent common.Hash) {
+func (db *Database) dereference(child common.Hash, parent common.Hash, batch sofdb.Batch) error {
 	// Dereference the parent-child
 	node := db.dirties[parent]
 
+	external := false
 	if node.children != nil && node.children[child] > 0 {
 		node.children[child]--
 		if node.children[child] == 0 {
 			delete(node.children, child)
 		}
+		external = true
 	}
+	// Internal references are always tracked, the meta-root only holds external ones
+	return db.release(child, external || parent != (common.Hash{}), batch)
+}
+
+// release drops a reference to a node, deleting it if it was the last one. The
+// tracked flag signals whether the reference was accounted for when created.
+func (db *Database) release(child common.Hash, tracked bool, batch sofdb.Batch) error {
 	// If the child does not exist, it's a previously committed node.
 	node, ok := db.dirties[child]
 	if !ok {
-		return
+		if db.refcount && tracked {
+			return db.releaseFlushed(child, batch)
+		}
+		return nil
 	}
 	// If there are no more references to the child, delete it and cascade
 	if node.parents > 0 {
@@ -553,11 +607,14 @@ func (db *Database) dereference(child common.Hash, parent common.Hash) {
 		}
 		// Dereference all children and delete the node
 		for _, hash := range node.childs() {
-			db.dereference(hash, child)
+			if err := db.dereference(hash, child, batch); err != nil {
+				return err
+			}
 		}
 		delete(db.dirties, child)
 		db.dirtiesSize -= common.StorageSize(common.HashLength + int(node.size))
 	}
+	return nil
 }
 
 // Cap iteratively flushes old but still referenced trie nodes until the total
@@ -572,6 +629,14 @@ func (db *Database) Cap(limit common.StorageSize) error {
 	nodes, storage, start := len(db.dirties), db.dirtiesSize, time.Now()
 	batch := db.diskdb.NewBatch()
 
+	// Persist the references held by live nodes before any of them is flushed
+	if db.refcount {
+		if err := db.writeRefdeltas(); err != nil {
+			log.Error("Failed to write reference counts to disk", "err", err)
+			db.lock.RUnlock()
+			return err
+		}
+	}
 	// db.dirtiesSize only contains the useful data in the cache, but when reporting
 	// the total memory consumption, the maintenance metadata is also needed to be
 	// counted. For every useful node, we track 2 extra hashes as the flushlist.
@@ -605,6 +670,12 @@ func (db *Database) Cap(limit common.StorageSize) error {
 			db.lock.RUnlock()
 			return err
 		}
+		if db.refcount {
+			if err := db.flushRefcount(oldest, node, batch); err != nil {
+				db.lock.RUnlock()
+				return err
+			}
+		}
 		// If we exceeded the ideal batch size, commit and reset
 		if batch.ValueSize() >= sofdb.IdealBatchSize {
 			if err := batch.Write(); err != nil {
@@ -662,7 +733,9 @@ func (db *Database) Cap(limit common.StorageSize) error {
 }
 
 // Commit iterates over all the children of a particular node, writes them out
-// to disk, forcefully tearing down all references in both directions.
+// to disk, forcefully tearing down all references in both directions. If nodes
+// are reference counted, the committed node is retained on disk until Release
+// is called for it.
 //
 // As a side effect, all pre-images accumulated up to this point are also written.
 func (db *Database) Commit(node common.Hash, report bool) error {
@@ -689,9 +762,20 @@ func (db *Database) Commit(node common.Hash, report bool) error {
 			batch.Reset()
 		}
 	}
+	// Persist the references held by live nodes and retain the committed root
+	if db.refcount {
+		if err := db.writeRefdeltas(); err != nil {
+			log.Error("Failed to write reference counts to disk", "err", err)
+			db.lock.RUnlock()
+			return err
+		}
+		db.reflock.Lock()
+		db.refdeltas[node]++
+		db.reflock.Unlock()
+	}
 	// Move the trie itself into the batch, flushing if enough data is accumulated
 	nodes, storage := len(db.dirties), db.dirtiesSize
-	if err := db.commit(node, batch); err != nil {
+	if err := db.commit(node, batch, make(map[common.Hash]struct{})); err != nil {
 		log.Error("Failed to commit trie from trie database", "err", err)
 		db.lock.RUnlock()
 		return err
@@ -702,6 +786,14 @@ func (db *Database) Commit(node common.Hash, report bool) error {
 		db.lock.RUnlock()
 		return err
 	}
+	// If the root was already on disk, its retention reference is still pending
+	if db.refcount {
+		if err := db.writeRefdeltas(); err != nil {
+			log.Error("Failed to write reference counts to disk", "err", err)
+			db.lock.RUnlock()
+			return err
+		}
+	}
 	db.lock.RUnlock()
 
 	// Write successful, clear out the flushed data
@@ -721,31 +813,47 @@ func (db *Database) Commit(node common.Hash, report bool) error {
 	if !report {
 		logger = log.Debug
 	}
-	logger("Persisted trie from memory database", "nodes", nodes-len(db.dirties)+int(db.flushnodes), "size", storage-db.dirtiesSize+db.flushsize, "time", time.Since(start)+db.flushtime,
-		"gcnodes", db.gcnodes, "gcsize", db.gcsize, "gctime", db.gctime, "livenodes", len(db.dirties), "livesize", db.dirtiesSize)
+	context := []interface{}{"nodes", nodes - len(db.dirties) + int(db.flushnodes), "size", storage - db.dirtiesSize + db.flushsize, "time", time.Since(start) + db.flushtime,
+		"gcnodes", db.gcnodes, "gcsize", db.gcsize, "gctime", db.gctime, "livenodes", len(db.dirties), "livesize", db.dirtiesSize}
+	if db.refcount {
+		context = append(context, "delnodes", db.refnodes, "delsize", db.refsize)
+	}
+	logger("Persisted trie from memory database", context...)
 
 	// Reset the garbage collection statistics
 	db.gcnodes, db.gcsize, db.gctime = 0, 0, 0
 	db.flushnodes, db.flushsize, db.flushtime = 0, 0, 0
+	db.refnodes, db.refsize = 0, 0
 
 	return nil
 }
 
-// commit is the private locked version of Commit.
-func (db *Database) commit(hash common.Hash, batch sofdb.Batch) error {
+// commit is the private locked version of Commit. Nodes shared within the trie
+// are only written once, tracked in the done set.
+func (db *Database) commit(hash common.Hash, batch sofdb.Batch, done map[common.Hash]struct{}) error {
 	// If the node does not exist, it's a previously committed node
 	node, ok := db.dirties[hash]
 	if !ok {
 		return nil
 	}
+	if _, ok := done[hash]; ok {
+		return nil
+	}
+	done[hash] = struct{}{}
+
 	for _, child := range node.childs() {
-		if err := db.commit(child, batch); err != nil {
+		if err := db.commit(child, batch, done); err != nil {
 			return err
 		}
 	}
 	if err := batch.Put(hash[:], node.srlp()); err != nil {
 		return err
 	}
+	if db.refcount {
+		if err := db.flushRefcount(hash, node, batch); err != nil {
+			return err
+		}
+	}
 	// If we've reached an optimal batch size, commit and start over
 	if batch.ValueSize() >= sofdb.IdealBatchSize {
 		if err := batch.Write(); err != nil {
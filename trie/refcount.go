@@ -0,0 +1,401 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/log"
+	"github.com/susy-go/susy-graviton/sofdb"
+)
+
+// Reference counting of the trie nodes flushed to disk
+//
+// A database created with NewDatabaseWithRefcount persists the number of
+// references every flushed node has alongside it. A reference is held by every
+// parent node on disk, by every live node in the memory layer and by every
+// Commit of a root, until it's undone via Release. Nodes whose count drops to
+// zero are deleted from disk right away, cascading to their children.
+//
+// Reference counts only ever err on the high side: increments are persisted
+// before the nodes depending on them and decrements are kept in memory until
+// they are persisted atomically, so a crash can at worst leak some nodes, but
+// never delete a referenced one.
+//
+// Nodes persisted without reference counting (e.g. before it was enabled on an
+// existing database) have no count. They are never deleted, which allows to
+// turn the feature on for any database. Such nodes can be pruned offline, or
+// counted by TrackRefcounts to become collectible.
+
+var (
+	refcountPrefix = []byte("trie-rc-") // refcountPrefix + hash -> reference count (uint32 big endian) + flags
+	externalPrefix = []byte("trie-xc-") // externalPrefix + hash -> hashes of the external children
+)
+
+// refcountRawFlag marks the reference count of a raw blob (e.g. contract code),
+// which must not be decoded as a trie node when searching for children.
+const refcountRawFlag = 1
+
+// refcountKey = refcountPrefix + hash
+func refcountKey(hash common.Hash) []byte {
+	return append(append([]byte{}, refcountPrefix...), hash[:]...)
+}
+
+// externalKey = externalPrefix + hash
+func externalKey(hash common.Hash) []byte {
+	return append(append([]byte{}, externalPrefix...), hash[:]...)
+}
+
+// readRefcount retrieves the persisted reference count of a node, whether it
+// is a raw blob, and whether the node is reference counted at all.
+func readRefcount(db DatabaseReader, hash common.Hash) (uint32, bool, bool) {
+	blob, err := db.Get(refcountKey(hash))
+	if err != nil || len(blob) != 5 {
+		return 0, false, false
+	}
+	return binary.BigEndian.Uint32(blob), blob[4]&refcountRawFlag != 0, true
+}
+
+// encodeRefcount encodes a reference count along with the node flags.
+func encodeRefcount(count uint32, raw bool) []byte {
+	blob := make([]byte, 5)
+	binary.BigEndian.PutUint32(blob, count)
+	if raw {
+		blob[4] = refcountRawFlag
+	}
+	return blob
+}
+
+// clampRefcount converts a reference count with applied deltas to its persisted
+// form.
+func clampRefcount(count int64) uint32 {
+	switch {
+	case count < 0:
+		return 0
+	case count > int64(^uint32(0)):
+		return ^uint32(0)
+	}
+	return uint32(count)
+}
+
+// DeleteNodeMetadata removes the reference counting metadata of a trie node or
+// blob deleted from the database outside of the trie database (e.g. by offline
+// pruning).
+func DeleteNodeMetadata(db sofdb.Deleter, hash common.Hash) error {
+	if err := db.Delete(refcountKey(hash)); err != nil {
+		return err
+	}
+	return db.Delete(externalKey(hash))
+}
+
+// NodeMetadataPrefixes returns the key prefixes of the reference counting
+// metadata stored alongside the trie nodes.
+func NodeMetadataPrefixes() [][]byte {
+	return [][]byte{refcountPrefix, externalPrefix}
+}
+
+// diskChildren retrieves the hashes of all the nodes referenced by a node decoded
+// from disk, including the ones of embedded nodes.
+func diskChildren(n node, children *[]common.Hash) {
+	switch n := n.(type) {
+	case *shortNode:
+		diskChildren(n.Val, children)
+	case *fullNode:
+		for i := 0; i < 16; i++ {
+			diskChildren(n.Children[i], children)
+		}
+	case hashNode:
+		*children = append(*children, common.BytesToHash(n))
+	}
+}
+
+// diskLeaves retrieves all the values stored in a node decoded from disk,
+// including the ones of embedded nodes.
+func diskLeaves(n node, leaves *[][]byte) {
+	switch n := n.(type) {
+	case *shortNode:
+		diskLeaves(n.Val, leaves)
+	case *fullNode:
+		for i := 0; i < 17; i++ {
+			diskLeaves(n.Children[i], leaves)
+		}
+	case valueNode:
+		*leaves = append(*leaves, n)
+	}
+}
+
+// writeRefdeltas atomically persists all the pending reference count changes.
+// It must be invoked before flushing nodes, so the references they hold are
+// accounted for on disk before them.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) writeRefdeltas() error {
+	db.reflock.Lock()
+	defer db.reflock.Unlock()
+
+	if len(db.refdeltas) == 0 {
+		return nil
+	}
+	batch := db.diskdb.NewBatch()
+	for hash, delta := range db.refdeltas {
+		count, raw, tracked := readRefcount(db.diskdb, hash)
+		if !tracked || delta == 0 {
+			continue
+		}
+		if err := batch.Put(refcountKey(hash), encodeRefcount(clampRefcount(int64(count)+delta), raw)); err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	db.refdeltas = make(map[common.Hash]int64)
+	return nil
+}
+
+// flushRefcount adds the reference counting metadata of a node being flushed
+// to disk to the batch the node is written with. Nodes already counted on disk
+// gain the references of their live parents, nodes persisted without counting
+// stay uncounted.
+//
+// Note, the references of a recounted node to its children are not dropped, so
+// they are leaked. This only happens if a node is recreated while still stored
+// on disk, which is rare.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) flushRefcount(hash common.Hash, node *cachedNode, batch sofdb.Batch) error {
+	db.reflock.Lock()
+	defer db.reflock.Unlock()
+
+	count, raw, tracked := readRefcount(db.diskdb, hash)
+	if !tracked {
+		if ok, _ := db.diskdb.Has(hash[:]); ok {
+			delete(db.refdeltas, hash)
+			return nil
+		}
+		_, raw = node.node.(rawNode)
+	}
+	total := int64(count) + int64(node.parents) + db.refdeltas[hash]
+	delete(db.refdeltas, hash)
+
+	if err := batch.Put(refcountKey(hash), encodeRefcount(clampRefcount(total), raw)); err != nil {
+		return err
+	}
+	if tracked || len(node.children) == 0 {
+		return nil
+	}
+	external := make([]byte, 0, len(node.children)*common.HashLength)
+	for child := range node.children {
+		external = append(external, child[:]...)
+	}
+	return batch.Put(externalKey(hash), external)
+}
+
+// releaseFlushed drops a reference to a node which is not live in memory any
+// more. If no references remain, the node is deleted from disk together with
+// its metadata, and the references it held are dropped too.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) releaseFlushed(hash common.Hash, batch sofdb.Batch) error {
+	if _, ok := db.refdeleted[hash]; ok {
+		return nil
+	}
+	count, raw, tracked := readRefcount(db.diskdb, hash)
+	if !tracked {
+		// Nodes persisted without counting are never deleted, but a live copy of
+		// one might still hold the dropped reference
+		if _, ok := db.dirties[hash]; ok {
+			return db.release(hash, true, batch)
+		}
+		return nil
+	}
+	db.refdeltas[hash]--
+	if int64(count)+db.refdeltas[hash] > 0 {
+		return nil
+	}
+	// No references left, delete the node and cascade into its children
+	blob, err := db.diskdb.Get(hash[:])
+	if err != nil {
+		return err
+	}
+	var children []common.Hash
+	if !raw {
+		if n, err := decodeNode(hash[:], blob, 0); err == nil {
+			diskChildren(n, &children)
+		}
+	}
+	if external, _ := db.diskdb.Get(externalKey(hash)); len(external)%common.HashLength == 0 {
+		for i := 0; i < len(external); i += common.HashLength {
+			children = append(children, common.BytesToHash(external[i:i+common.HashLength]))
+		}
+	}
+	delete(db.refdeltas, hash)
+	db.refdeleted[hash] = struct{}{}
+
+	if err := batch.Delete(hash[:]); err != nil {
+		return err
+	}
+	if err := DeleteNodeMetadata(batch, hash); err != nil {
+		return err
+	}
+	if db.cleans != nil {
+		db.cleans.Delete(string(hash[:]))
+	}
+	db.refnodes++
+	db.refsize += common.StorageSize(common.HashLength + len(blob))
+
+	// Deletions are final, so large cascades can be written out piecemeal
+	if batch.ValueSize() >= sofdb.IdealBatchSize {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+	}
+	for _, child := range children {
+		if err := db.releaseFlushed(child, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release drops the reference a Commit added to a trie root, deleting all the
+// nodes of the trie from disk which are not referenced any more. It's a noop if
+// the database doesn't reference count its nodes.
+func (db *Database) Release(root common.Hash) error {
+	if !db.refcount || root == (common.Hash{}) {
+		return nil
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	nodes, size, start := db.refnodes, db.refsize, time.Now()
+	batch := db.diskdb.NewBatch()
+	if err := db.releaseFlushed(root, batch); err != nil {
+		log.Error("Failed to release trie from disk", "root", root, "err", err)
+		return err
+	}
+	if err := db.writeRefdeleted(batch); err != nil {
+		log.Error("Failed to delete trie nodes from disk", "root", root, "err", err)
+		return err
+	}
+	log.Debug("Released trie from disk", "root", root, "nodes", db.refnodes-nodes, "size", db.refsize-size, "time", time.Since(start))
+	return nil
+}
+
+// writeRefdeleted writes out the deletions of unreferenced nodes.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) writeRefdeleted(batch sofdb.Batch) error {
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	db.refdeleted = make(map[common.Hash]struct{})
+	return nil
+}
+
+// LeafResolver returns the hashes of the tries and raw blobs referenced from a
+// trie leaf, e.g. the storage trie and contract code of an account.
+type LeafResolver func(leaf []byte) (tries []common.Hash, blobs []common.Hash)
+
+// TrackRefcounts reference counts all the nodes of a trie persisted without
+// counting, along with the tries and blobs referenced from its leaves, and adds
+// a retention reference to its root as Commit would. Nodes already counted are
+// not descended into. The database must not be in use by a trie database.
+//
+// If interrupted, the counts written so far are too high or missing, which only
+// causes some nodes to never be deleted.
+func TrackRefcounts(diskdb sofdb.Database, root common.Hash, resolve LeafResolver) error {
+	type item struct {
+		hash    common.Hash
+		resolve LeafResolver
+	}
+	// reference adds a reference to a node, scheduling it for descending into
+	// if it's the first one
+	var stack []item
+	reference := func(hash common.Hash, raw bool, resolve LeafResolver) error {
+		count, wasRaw, tracked := readRefcount(diskdb, hash)
+		if tracked {
+			return diskdb.Put(refcountKey(hash), encodeRefcount(clampRefcount(int64(count)+1), wasRaw))
+		}
+		if ok, _ := diskdb.Has(hash[:]); !ok {
+			return &MissingNodeError{NodeHash: hash}
+		}
+		if err := diskdb.Put(refcountKey(hash), encodeRefcount(1, raw)); err != nil {
+			return err
+		}
+		if !raw {
+			stack = append(stack, item{hash, resolve})
+		}
+		return nil
+	}
+	if err := reference(root, false, resolve); err != nil {
+		return err
+	}
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		blob, err := diskdb.Get(next.hash[:])
+		if err != nil {
+			return &MissingNodeError{NodeHash: next.hash}
+		}
+		n, err := decodeNode(next.hash[:], blob, 0)
+		if err != nil {
+			return err
+		}
+		var children []common.Hash
+		diskChildren(n, &children)
+		for _, child := range children {
+			if err := reference(child, false, next.resolve); err != nil {
+				return err
+			}
+		}
+		if next.resolve == nil {
+			continue
+		}
+		var leaves [][]byte
+		diskLeaves(n, &leaves)
+
+		external := make(map[common.Hash]bool)
+		for _, leaf := range leaves {
+			tries, blobs := next.resolve(leaf)
+			for _, hash := range tries {
+				external[hash] = false
+			}
+			for _, hash := range blobs {
+				external[hash] = true
+			}
+		}
+		if len(external) == 0 {
+			continue
+		}
+		enc := make([]byte, 0, len(external)*common.HashLength)
+		for hash, raw := range external {
+			if err := reference(hash, raw, nil); err != nil {
+				return err
+			}
+			enc = append(enc, hash[:]...)
+		}
+		if err := diskdb.Put(externalKey(next.hash), enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+// Copyleft 2019 The susy-graviton Authors
+// This file is part of the susy-graviton library.
+//
+// The susy-graviton library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The susy-graviton library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MSRCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the susy-graviton library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/susy-go/susy-graviton/common"
+	"github.com/susy-go/susy-graviton/crypto"
+	"github.com/susy-go/susy-graviton/sofdb"
+)
+
+// makeRefcountTrie creates a trie on top of the given root, setting n keys to
+// the hashes of blobs which are referenced from the leaves, like contract code
+// is from accounts.
+func makeRefcountTrie(t *testing.T, db *Database, parent common.Hash, seed byte, n int) common.Hash {
+	trie, err := New(parent, db)
+	if err != nil {
+		t.Fatalf("failed to open trie %x: %v", parent, err)
+	}
+	for i := 0; i < n; i++ {
+		blob := []byte(fmt.Sprintf("blob-%d-%d", seed, i))
+		hash := crypto.Keccak256Hash(blob)
+
+		db.InsertBlob(hash, blob)
+		trie.Update([]byte(fmt.Sprintf("key-%04d", i)), hash[:])
+	}
+	root, err := trie.Commit(func(leaf []byte, parent common.Hash) error {
+		db.Reference(common.BytesToHash(leaf), parent)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	return root
+}
+
+// checkRefcountTrie verifies that a trie and all the blobs referenced from its
+// leaves are available on disk.
+func checkRefcountTrie(t *testing.T, diskdb sofdb.Database, root common.Hash) {
+	trie, err := New(root, NewDatabase(diskdb))
+	if err != nil {
+		t.Fatalf("trie %x unavailable: %v", root, err)
+	}
+	it := trie.NodeIterator(nil)
+	for it.Next(true) {
+		if it.Leaf() {
+			if ok, _ := diskdb.Has(it.LeafBlob()); !ok {
+				t.Fatalf("trie %x misses blob %x", root, it.LeafBlob())
+			}
+		}
+	}
+	if it.Error() != nil {
+		t.Fatalf("trie %x incomplete: %v", root, it.Error())
+	}
+}
+
+// countNodes returns the number of trie nodes and blobs stored in the database.
+func countNodes(diskdb *sofdb.MemDatabase) int {
+	var count int
+	for _, key := range diskdb.Keys() {
+		if len(key) == common.HashLength {
+			count++
+		}
+	}
+	return count
+}
+
+// Tests that releasing committed tries deletes exactly the nodes and blobs no
+// other retained trie references.
+func TestRefcountRelease(t *testing.T) {
+	diskdb := sofdb.NewMemDatabase()
+	db := NewDatabaseWithRefcount(diskdb, 0)
+
+	first := makeRefcountTrie(t, db, common.Hash{}, 0, 256)
+	if err := db.Commit(first, false); err != nil {
+		t.Fatalf("failed to commit first trie: %v", err)
+	}
+	second := makeRefcountTrie(t, db, first, 1, 16)
+	if err := db.Commit(second, false); err != nil {
+		t.Fatalf("failed to commit second trie: %v", err)
+	}
+	before := countNodes(diskdb)
+
+	if err := db.Release(first); err != nil {
+		t.Fatalf("failed to release first trie: %v", err)
+	}
+	checkRefcountTrie(t, diskdb, second)
+	if ok, _ := diskdb.Has(first[:]); ok {
+		t.Errorf("released root not deleted")
+	}
+	if after := countNodes(diskdb); after >= before {
+		t.Errorf("nothing deleted: %d nodes before, %d after", before, after)
+	}
+	if err := db.Release(second); err != nil {
+		t.Fatalf("failed to release second trie: %v", err)
+	}
+	for _, key := range diskdb.Keys() {
+		if !bytes.HasPrefix(key, secureKeyPrefix) {
+			t.Errorf("leftover entry after releasing all tries: %x", key)
+		}
+	}
+}
+
+// Tests that references to flushed nodes can be added while tries are being
+// committed, both changing the pending reference counts.
+func TestRefcountConcurrentReference(t *testing.T) {
+	diskdb := sofdb.NewMemDatabase()
+	db := NewDatabaseWithRefcount(diskdb, 0)
+
+	first := makeRefcountTrie(t, db, common.Hash{}, 0, 16)
+	if err := db.Commit(first, false); err != nil {
+		t.Fatalf("failed to commit first trie: %v", err)
+	}
+	quit, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+				db.Reference(first, common.Hash{})
+			}
+		}
+	}()
+	for i := 1; i <= 10; i++ {
+		root := makeRefcountTrie(t, db, first, byte(i), 16)
+		if err := db.Commit(root, false); err != nil {
+			t.Fatalf("failed to commit trie %d: %v", i, err)
+		}
+	}
+	close(quit)
+	<-done
+
+	if err := db.Commit(first, false); err != nil {
+		t.Fatalf("failed to recommit first trie: %v", err)
+	}
+	checkRefcountTrie(t, diskdb, first)
+}
+
+// Tests that nodes flushed by Cap are deleted from disk when the tries holding
+// them are dereferenced from memory, keeping the ones still referenced.
+func TestRefcountDereference(t *testing.T) {
+	diskdb := sofdb.NewMemDatabase()
+	db := NewDatabaseWithRefcount(diskdb, 0)
+
+	first := makeRefcountTrie(t, db, common.Hash{}, 0, 128)
+	db.Reference(first, common.Hash{})
+	second := makeRefcountTrie(t, db, first, 1, 8)
+	db.Reference(second, common.Hash{})
+
+	if err := db.Cap(0); err != nil {
+		t.Fatalf("failed to flush tries: %v", err)
+	}
+	if nodes := len(db.Nodes()); nodes != 0 {
+		t.Fatalf("live nodes after flush: %d", nodes)
+	}
+	checkRefcountTrie(t, diskdb, first)
+	checkRefcountTrie(t, diskdb, second)
+
+	db.Dereference(first)
+	checkRefcountTrie(t, diskdb, second)
+	if ok, _ := diskdb.Has(first[:]); ok {
+		t.Errorf("dereferenced root not deleted")
+	}
+	db.Dereference(second)
+	if count := countNodes(diskdb); count != 0 {
+		t.Errorf("nodes left after dereferencing all tries: %d", count)
+	}
+}
+
+// Tests that nodes persisted without reference counting are never deleted, even
+// if tries built on top of them are.
+func TestRefcountLegacy(t *testing.T) {
+	diskdb := sofdb.NewMemDatabase()
+
+	db := NewDatabase(diskdb)
+	legacy := makeRefcountTrie(t, db, common.Hash{}, 0, 64)
+	if err := db.Commit(legacy, false); err != nil {
+		t.Fatalf("failed to commit legacy trie: %v", err)
+	}
+	before := countNodes(diskdb)
+
+	// Tries built on top of legacy nodes must not delete them
+	refdb := NewDatabaseWithRefcount(diskdb, 0)
+	updated := makeRefcountTrie(t, refdb, legacy, 1, 8)
+	if err := refdb.Commit(updated, false); err != nil {
+		t.Fatalf("failed to commit updated trie: %v", err)
+	}
+	if err := refdb.Release(legacy); err != nil {
+		t.Fatalf("failed to release legacy trie: %v", err)
+	}
+	if err := refdb.Release(updated); err != nil {
+		t.Fatalf("failed to release updated trie: %v", err)
+	}
+	checkRefcountTrie(t, diskdb, legacy)
+	if after := countNodes(diskdb); after != before {
+		t.Errorf("legacy node count mismatch: have %d, want %d", after, before)
+	}
+}
+
+// Tests that tries persisted without reference counting can be counted after
+// the fact, making them collectible.
+func TestTrackRefcounts(t *testing.T) {
+	diskdb := sofdb.NewMemDatabase()
+
+	db := NewDatabase(diskdb)
+	first := makeRefcountTrie(t, db, common.Hash{}, 0, 64)
+	if err := db.Commit(first, false); err != nil {
+		t.Fatalf("failed to commit first trie: %v", err)
+	}
+	second := makeRefcountTrie(t, db, first, 1, 8)
+	if err := db.Commit(second, false); err != nil {
+		t.Fatalf("failed to commit second trie: %v", err)
+	}
+	resolve := func(leaf []byte) ([]common.Hash, []common.Hash) {
+		return nil, []common.Hash{common.BytesToHash(leaf)}
+	}
+	for _, root := range []common.Hash{first, second} {
+		if err := TrackRefcounts(diskdb, root, resolve); err != nil {
+			t.Fatalf("failed to track trie %x: %v", root, err)
+		}
+	}
+	if err := TrackRefcounts(diskdb, common.HexToHash("0x01"), resolve); err == nil {
+		t.Fatalf("tracking missing trie succeeded")
+	}
+	refdb := NewDatabaseWithRefcount(diskdb, 0)
+	if err := refdb.Release(first); err != nil {
+		t.Fatalf("failed to release first trie: %v", err)
+	}
+	checkRefcountTrie(t, diskdb, second)
+	if ok, _ := diskdb.Has(first[:]); ok {
+		t.Errorf("released root not deleted")
+	}
+	if err := refdb.Release(second); err != nil {
+		t.Fatalf("failed to release second trie: %v", err)
+	}
+	if count := countNodes(diskdb); count != 0 {
+		t.Errorf("nodes left after releasing all tries: %d", count)
+	}
+}